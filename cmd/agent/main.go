@@ -4,19 +4,27 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/caarlos0/env/v6"
 	"gopkg.in/yaml.v3"
 
 	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/agent"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/config"
 	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/logger"
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/promfmt"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -31,6 +39,34 @@ type AgentConfig struct {
 	ServerAddress  string        `yaml:"server_adress" env:"ADDRESS"` // Обращаем внимание: env тег использует точное имя переменной
 	PollInterval   time.Duration `yaml:"poll_interval"`               // интервал в time.Duration, парсим отдельно
 	ReportInterval time.Duration `yaml:"report_interval"`             // как выше
+	Labels         models.Labels `yaml:"labels"`                      // статические метки для всех метрик агента
+	Buckets        []float64     `yaml:"histogram_buckets"`           // границы корзин гистограмм
+
+	// Sources — источники метрик со своими интервалами и таймаутами;
+	// если секция не задана, включаются runtime, random и system
+	Sources []agent.SourceConfig `yaml:"sources"`
+
+	// Scrape — цели опроса Prometheus /metrics, опрашиваются с интервалом poll_interval
+	Scrape []agent.ScrapeConfig `yaml:"scrape_configs"`
+
+	// Servers — несколько серверов в режиме failover или fanout; если адреса не заданы,
+	// используется server_adress (допускается список через запятую)
+	Servers agent.ServersConfig `yaml:"servers"`
+
+	// MetricRules — правила фильтрации, переименования и масштабирования метрик,
+	// применяются по порядку перед отправкой
+	MetricRules []agent.MetricRule `yaml:"metric_rules"`
+
+	// HTTPAddress — локальный адрес эндпоинтов /healthz, /status и /metrics агента;
+	// пусто — не слушать. При перезагрузке конфигурации не меняется.
+	HTTPAddress string `yaml:"http_address"`
+
+	// Aggregation — агрегация gauge за окно report_interval (last, suffix, histogram)
+	Aggregation agent.AggregationConfig `yaml:"aggregation"`
+
+	// Logging — журнал агента (по умолчанию в stderr, чтобы не смешиваться с выводом
+	// -dry-run). При перезагрузке конфигурации не меняется.
+	Logging logger.Config `yaml:"logging"`
 }
 
 const (
@@ -38,6 +74,10 @@ const (
 	defaultReportInterval = 10 * time.Second
 	defaultServerAddress  = "localhost:8080"
 	configPath            = "internal/config/agent.yaml"
+	defaultLogFile        = "logs/agent.log"
+
+	// finalReportTimeout — предел последнего опроса и отчёта при остановке
+	finalReportTimeout = 3 * time.Second
 )
 
 func main() {
@@ -48,61 +88,103 @@ func main() {
 }
 
 func run() error {
-	log := logger.GetLogger()
-
-	cfg, err := loadConfig(configPath)
+	flags := parseFlags()
+	cfg, err := readConfig(configPath, flags)
 	if err != nil {
-		return fmt.Errorf("load config: %w", err)
+		return err
 	}
 
-	if err := applyEnv(cfg); err != nil {
-		return fmt.Errorf("apply env: %w", err)
+	log, err := logger.New(cfg.Logging)
+	if err != nil {
+		return fmt.Errorf("logger: %w", err)
 	}
+	logger.SetDefault(log)
 
-	if err := parseFlags(cfg); err != nil {
-		return fmt.Errorf("parse flags: %w", err)
+	if flags.dryRun {
+		return dryRun(cfg, os.Stdout)
 	}
 
 	log.Info().
-		Str("Starting metrics agent with config:", "").
-		Str("  Server address: %s", cfg.ServerAddress).
-		Dur("  Poll interval: %v", cfg.PollInterval).
-		Dur("  Report interval: %v", cfg.ReportInterval)
-
-	collector := agent.NewCollector()
-
-	serverURL := cfg.ServerAddress
-	if len(serverURL) < 7 || (serverURL[:7] != "http://" && serverURL[:8] != "https://") {
-		serverURL = "http://" + serverURL
+		Str("server_address", cfg.ServerAddress).
+		Dur("poll_interval", cfg.PollInterval).
+		Dur("report_interval", cfg.ReportInterval).
+		Str("labels", cfg.Labels.String()).
+		Msg("Starting metrics agent")
+
+	// Адрес эндпоинтов занимается до запуска сбора: занятый порт — ошибка запуска
+	var listener net.Listener
+	if cfg.HTTPAddress != "" {
+		if listener, err = net.Listen("tcp", cfg.HTTPAddress); err != nil {
+			log.Error().Err(err).Str("addr", cfg.HTTPAddress).Msg("Failed to start agent HTTP server")
+			return fmt.Errorf("agent http server: %w", err)
+		}
 	}
 
-	sender := agent.NewSender(serverURL)
+	runner, err := newAgentRunner(log, configPath, flags, cfg)
+	if err != nil {
+		if listener != nil {
+			listener.Close()
+		}
+		return err
+	}
 
 	// Router и middleware с логированием
 	r := chi.NewRouter()
 	r.Use(logger.Middleware)
+	runner.routes(r)
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	var httpServer *http.Server
+	httpErr := make(chan error, 1)
+	if listener != nil {
+		httpServer = &http.Server{Handler: r}
+		go func() {
+			log.Info().Msgf("Agent status endpoints listening on %s", listener.Addr())
+			if err := httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+				// Без эндпоинтов агент не виден оркестратору: останавливаемся
+				log.Error().Err(err).Msg("Agent HTTP server failed, stopping agent")
+				httpErr <- err
+				stop()
+			}
+		}()
+	}
+
+	runner.startSources(ctx)
+
+	// Конфигурация перечитывается по SIGHUP и при изменении файла
+	reloads := make(chan struct{}, 1)
+	requestReload := func() {
+		select {
+		case reloads <- struct{}{}:
+		default:
+		}
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	if err := config.Watch(ctx, configPath, config.DefaultWatchDebounce, requestReload); err != nil {
+		log.Info().Msgf("Config file watch disabled: %v", err)
+	}
+
 	var wg sync.WaitGroup
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		log.Info().Dur("Started metrics collection with interval: %v", cfg.PollInterval)
-		ticker := time.NewTicker(cfg.PollInterval)
-		defer ticker.Stop()
-
 		for {
 			select {
 			case <-ctx.Done():
-				log.Println("Stopping metrics collection...")
 				return
-			case <-ticker.C:
-				collector.UpdateMetrics()
-				gCount, cCount := collector.GetMetricsCount()
-				log.Info().Msgf("Collected metrics: %d gauges, %d counters", gCount, cCount)
+			case <-hup:
+				requestReload()
+			case <-reloads:
+				if err := runner.reload(ctx); err != nil {
+					log.Error().Msgf("Config reload rejected, keeping previous config: %v", err)
+				} else {
+					log.Info().Msgf("Config reloaded from %s", configPath)
+				}
 			}
 		}
 	}()
@@ -110,30 +192,7 @@ func run() error {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		log.Info().Msgf("Started metrics reporting with interval: %v", cfg.ReportInterval)
-		ticker := time.NewTicker(cfg.ReportInterval)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ctx.Done():
-				log.Info().Msg("Stopping metrics reporting...")
-				return
-			case <-ticker.C:
-				gauges := collector.GetGauges()
-				counters := collector.GetCounters()
-				if len(gauges) == 0 && len(counters) == 0 {
-					log.Info().Msg("No metrics to send")
-					continue
-				}
-				log.Info().Str("Sending metrics to %s", serverURL)
-				if err := sender.SendAllMetrics(gauges, counters); err != nil {
-					log.Info().Msgf("Failed to send metrics: %v", err)
-				} else {
-					log.Info().Msg("Successfully sent all metrics")
-				}
-			}
-		}
+		runner.reportLoop(ctx)
 	}()
 
 	log.Info().Msg("Agent is running. Press Ctrl+C to stop.")
@@ -143,20 +202,123 @@ func run() error {
 
 	stop()
 
+	if httpServer != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		httpServer.Shutdown(shutdownCtx)
+		cancel()
+	}
+
 	done := make(chan struct{})
 	go func() {
 		wg.Wait()
+		log.Info().Msg("Stopping metrics collection, sending final report...")
+		runner.stop(finalReportTimeout)
 		close(done)
 	}()
 
 	select {
 	case <-done:
 		log.Info().Msg("Agent stopped gracefully")
-	case <-time.After(5 * time.Second):
+	case <-time.After(finalReportTimeout + 2*time.Second):
 		log.Info().Msg("Shutdown timeout, forcing exit")
 	}
 
-	return nil
+	select {
+	case err := <-httpErr:
+		return fmt.Errorf("agent http server: %w", err)
+	default:
+		return nil
+	}
+}
+
+// dryRun опрашивает источники один раз и печатает метрики, которые были бы
+// отправлены, в текстовом формате Prometheus
+func dryRun(cfg *AgentConfig, w io.Writer) error {
+	sources, err := buildSources(cfg)
+	if err != nil {
+		return fmt.Errorf("sources: %w", err)
+	}
+	defer sources.Close()
+	filter, err := agent.NewMetricFilter(cfg.MetricRules)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ReportInterval)
+	defer cancel()
+	sources.CollectOnce(ctx)
+
+	collected := sources.Take()
+	metrics := filter.Apply(withLabels(collected, cfg.Labels))
+	fmt.Fprintf(os.Stderr, "Collected %d metrics, %d would be sent\n", len(collected), len(metrics))
+	return promfmt.Write(w, metrics)
+}
+
+// readConfig собирает конфигурацию из YAML, переменных окружения и флагов и проверяет её
+func readConfig(path string, flags *flagValues) (*AgentConfig, error) {
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return nil, fmt.Errorf("load config: %w", err)
+	}
+
+	if err := applyEnv(cfg); err != nil {
+		return nil, fmt.Errorf("apply env: %w", err)
+	}
+
+	if err := flags.apply(cfg); err != nil {
+		return nil, fmt.Errorf("parse flags: %w", err)
+	}
+
+	if err := validateConfig(cfg); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return cfg, nil
+}
+
+// buildSources создаёт реестр источников из конфигурации. Интервал источников
+// по умолчанию — poll_interval; цели scrape_configs опрашиваются источником prometheus.
+func buildSources(cfg *AgentConfig) (*agent.Registry, error) {
+	registry := agent.NewRegistry()
+
+	sourceCfgs := cfg.Sources
+	if len(sourceCfgs) == 0 {
+		sourceCfgs = agent.DefaultSources()
+	}
+	if err := registry.Build(sourceCfgs, cfg.PollInterval); err != nil {
+		return nil, err
+	}
+
+	if len(cfg.Scrape) > 0 {
+		scraper, err := agent.NewScraper(cfg.Scrape)
+		if err != nil {
+			return nil, fmt.Errorf("scrape config: %w", err)
+		}
+		if err := registry.Add(scraper, cfg.PollInterval, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := registry.SetAggregation(cfg.Aggregation); err != nil {
+		return nil, err
+	}
+
+	// Границы корзин из флага или переменной окружения перекрывают YAML
+	if len(cfg.Buckets) > 0 {
+		for _, src := range registry.Sources() {
+			if rs, ok := src.(*agent.RuntimeSource); ok {
+				rs.SetHistogramBuckets(cfg.Buckets)
+			}
+		}
+	}
+	return registry, nil
+}
+
+// defaultLogging — журнал агента по умолчанию: stderr, файл logs/agent.log
+func defaultLogging() logger.Config {
+	cfg := logger.DefaultConfig()
+	cfg.Sinks = []string{logger.SinkStderr}
+	cfg.File.Path = defaultLogFile
+	return cfg
 }
 
 // loadConfig читает YAML, задаёт дефолты, парсит в структуру
@@ -166,6 +328,7 @@ func loadConfig(path string) (*AgentConfig, error) {
 			ServerAddress:  defaultServerAddress,
 			PollInterval:   defaultPollInterval,
 			ReportInterval: defaultReportInterval,
+			Logging:        defaultLogging(),
 		},
 	}
 
@@ -186,6 +349,25 @@ func applyEnv(cfg *AgentConfig) error {
 	// Переменная окружения ADDRESS
 	if addr := os.Getenv("ADDRESS"); addr != "" {
 		cfg.ServerAddress = addr
+		cfg.Servers.Addresses = nil
+	}
+
+	if mode := os.Getenv("SERVER_MODE"); mode != "" {
+		cfg.Servers.Mode = agent.SendMode(mode)
+	}
+
+	if token := os.Getenv("AUTH_TOKEN"); token != "" {
+		cfg.Servers.Token = token
+	}
+
+	if ca := os.Getenv("TLS_CA"); ca != "" {
+		cfg.Servers.TLS.CA = ca
+	}
+	if cert := os.Getenv("TLS_CERT"); cert != "" {
+		cfg.Servers.TLS.Cert = cert
+	}
+	if key := os.Getenv("TLS_KEY"); key != "" {
+		cfg.Servers.TLS.Key = key
 	}
 
 	// Переменные интервалов интервалов в секундах — парсим из строк
@@ -205,35 +387,150 @@ func applyEnv(cfg *AgentConfig) error {
 		cfg.ReportInterval = time.Duration(sec) * time.Second
 	}
 
+	if labelsStr := os.Getenv("LABELS"); labelsStr != "" {
+		labels, err := models.ParseLabels(labelsStr)
+		if err != nil {
+			return fmt.Errorf("invalid LABELS: %w", err)
+		}
+		cfg.Labels = labels
+	}
+
+	if bucketsStr := os.Getenv("HISTOGRAM_BUCKETS"); bucketsStr != "" {
+		buckets, err := parseBuckets(bucketsStr)
+		if err != nil {
+			return fmt.Errorf("invalid HISTOGRAM_BUCKETS: %w", err)
+		}
+		cfg.Buckets = buckets
+	}
+
+	if addr := os.Getenv("AGENT_HTTP_ADDRESS"); addr != "" {
+		cfg.HTTPAddress = addr
+	}
+
+	if mode := os.Getenv("AGGREGATION"); mode != "" {
+		cfg.Aggregation.Mode = agent.AggregationMode(mode)
+	}
+
+	// Переменные журнала LOG_* описаны тегами logger.Config
+	if err := env.Parse(&cfg.Logging); err != nil {
+		return fmt.Errorf("invalid logging env: %w", err)
+	}
+
 	return nil
 }
 
-// parseFlags применяет параметры из флагов, только если соответствующая ENV не задана (приоритет env выше)
-func parseFlags(cfg *AgentConfig) error {
-	var (
-		flagAddress        string
-		flagPollInterval   int
-		flagReportInterval int
-	)
+// parseBuckets разбирает список границ корзин вида "0.1,0.5,1,5"
+func parseBuckets(s string) ([]float64, error) {
+	var buckets []float64
+	for _, part := range strings.Split(s, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, v)
+	}
+	return buckets, nil
+}
+
+// flagValues — значения флагов командной строки; применяются при каждом чтении конфигурации
+type flagValues struct {
+	address        string
+	serverMode     string
+	token          string
+	tlsCA          string
+	tlsCert        string
+	tlsKey         string
+	pollInterval   int
+	reportInterval int
+	labels         string
+	buckets        string
+	aggregation    string
+	httpAddress    string
+	dryRun         bool
+	logging        logger.Flags
+}
 
-	flag.StringVar(&flagAddress, "a", "", "HTTP server endpoint address")
-	flag.IntVar(&flagPollInterval, "p", 0, "Poll interval in seconds")
-	flag.IntVar(&flagReportInterval, "r", 0, "Report interval in seconds")
+// parseFlags разбирает флаги командной строки
+func parseFlags() *flagValues {
+	f := &flagValues{}
+
+	flag.StringVar(&f.address, "a", "", "HTTP server endpoint address, comma-separated for several servers")
+	flag.StringVar(&f.serverMode, "server-mode", "", "Mode for several servers: failover or fanout")
+	flag.StringVar(&f.token, "token", "", "Bearer token for the server API")
+	flag.StringVar(&f.tlsCA, "tls-ca", "", "CA bundle for verifying servers (enables HTTPS)")
+	flag.StringVar(&f.tlsCert, "tls-cert", "", "Client certificate file for mTLS")
+	flag.StringVar(&f.tlsKey, "tls-key", "", "Client private key file for mTLS")
+	flag.IntVar(&f.pollInterval, "p", 0, "Poll interval in seconds")
+	flag.IntVar(&f.reportInterval, "r", 0, "Report interval in seconds")
+	flag.StringVar(&f.buckets, "buckets", "", "Histogram bucket upper bounds, e.g. 0.1,0.5,1,5")
+	flag.StringVar(&f.labels, "labels", "", "Static labels attached to all metrics, e.g. host=web1,env=prod")
+	flag.StringVar(&f.httpAddress, "http", "", "Local address for agent /healthz, /status and /metrics, e.g. localhost:9091")
+	flag.BoolVar(&f.dryRun, "dry-run", false, "Collect once, apply metric rules and print what would be sent")
+	flag.StringVar(&f.aggregation, "aggregation", "", "Gauge aggregation per report window: last, suffix or histogram")
+	f.logging.Register(flag.CommandLine)
 
 	flag.Parse()
+	return f
+}
+
+// apply применяет параметры из флагов, только если соответствующая ENV не задана (приоритет env выше)
+func (f *flagValues) apply(cfg *AgentConfig) error {
+	if os.Getenv("ADDRESS") == "" && f.address != "" {
+		cfg.ServerAddress = f.address
+		cfg.Servers.Addresses = nil
+	}
+
+	if os.Getenv("SERVER_MODE") == "" && f.serverMode != "" {
+		cfg.Servers.Mode = agent.SendMode(f.serverMode)
+	}
+
+	if os.Getenv("AUTH_TOKEN") == "" && f.token != "" {
+		cfg.Servers.Token = f.token
+	}
+
+	if os.Getenv("TLS_CA") == "" && f.tlsCA != "" {
+		cfg.Servers.TLS.CA = f.tlsCA
+	}
+	if os.Getenv("TLS_CERT") == "" && f.tlsCert != "" {
+		cfg.Servers.TLS.Cert = f.tlsCert
+	}
+	if os.Getenv("TLS_KEY") == "" && f.tlsKey != "" {
+		cfg.Servers.TLS.Key = f.tlsKey
+	}
+
+	if os.Getenv("POLL_INTERVAL") == "" && f.pollInterval > 0 {
+		cfg.PollInterval = time.Duration(f.pollInterval) * time.Second
+	}
+
+	if os.Getenv("REPORT_INTERVAL") == "" && f.reportInterval > 0 {
+		cfg.ReportInterval = time.Duration(f.reportInterval) * time.Second
+	}
+
+	if os.Getenv("LABELS") == "" && f.labels != "" {
+		labels, err := models.ParseLabels(f.labels)
+		if err != nil {
+			return fmt.Errorf("invalid -labels: %w", err)
+		}
+		cfg.Labels = labels
+	}
 
-	// Применяем флаги, если переменные окружения не заданы
-	if os.Getenv("ADDRESS") == "" && flagAddress != "" {
-		cfg.ServerAddress = flagAddress
+	if os.Getenv("HISTOGRAM_BUCKETS") == "" && f.buckets != "" {
+		buckets, err := parseBuckets(f.buckets)
+		if err != nil {
+			return fmt.Errorf("invalid -buckets: %w", err)
+		}
+		cfg.Buckets = buckets
 	}
 
-	if os.Getenv("POLL_INTERVAL") == "" && flagPollInterval > 0 {
-		cfg.PollInterval = time.Duration(flagPollInterval) * time.Second
+	if os.Getenv("AGENT_HTTP_ADDRESS") == "" && f.httpAddress != "" {
+		cfg.HTTPAddress = f.httpAddress
 	}
 
-	if os.Getenv("REPORT_INTERVAL") == "" && flagReportInterval > 0 {
-		cfg.ReportInterval = time.Duration(flagReportInterval) * time.Second
+	if os.Getenv("AGGREGATION") == "" && f.aggregation != "" {
+		cfg.Aggregation.Mode = agent.AggregationMode(f.aggregation)
 	}
 
+	f.logging.Apply(&cfg.Logging)
+
 	return nil
 }
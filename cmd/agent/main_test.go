@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/logger"
+)
+
+func TestDryRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.yaml")
+	writeConfig(t, path, `agent_config:
+  server_adress: "localhost:18080"
+  report_interval: 2s
+  labels:
+    host: web1
+  sources:
+    - type: runtime
+  metric_rules:
+    - action: keep
+      regex: "HeapAlloc|PollCount"
+    - action: prefix
+      regex: HeapAlloc
+      prefix: "go_"
+`)
+	cfg, err := readConfig(path, &flagValues{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := dryRun(cfg, &out); err != nil {
+		t.Fatal(err)
+	}
+	text := out.String()
+	if !strings.Contains(text, `go_HeapAlloc{host="web1"}`) || !strings.Contains(text, `PollCount{host="web1"} 1`) {
+		t.Errorf("Unexpected dry-run output:\n%s", text)
+	}
+	samples := 0
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			samples++
+		}
+	}
+	if samples != 2 {
+		t.Errorf("Metrics outside keep rule must not be printed:\n%s", text)
+	}
+}
+
+func TestReadConfigLogging(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.yaml")
+	writeConfig(t, path, `agent_config:
+  logging:
+    level: debug
+    sinks: [stderr, file]
+    file:
+      path: /var/log/agent.log
+      max_size_mb: 10
+    sampling:
+      burst: 5
+`)
+	t.Setenv("LOG_LEVEL", "warn")
+	flags := &flagValues{logging: logger.Flags{Level: "error", Format: logger.FormatConsole}}
+	cfg, err := readConfig(path, flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := cfg.Logging
+	if l.Level != "warn" {
+		t.Errorf("Expected env to override level, got %q", l.Level)
+	}
+	if l.Format != logger.FormatConsole {
+		t.Errorf("Expected flag to set format, got %q", l.Format)
+	}
+	if len(l.Sinks) != 2 || l.File.Path != "/var/log/agent.log" || l.File.MaxSizeMB != 10 {
+		t.Errorf("Unexpected sinks or file from YAML: %+v", l)
+	}
+	if l.File.MaxBackups != 7 || l.Sampling.Burst != 5 || l.Sampling.Period != time.Second {
+		t.Errorf("Expected defaults for unset fields, got %+v", l)
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/agent"
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/telemetry"
+)
+
+// Метрика результатов перезагрузки конфигурации, метка result: success или failure
+const configReloadsMetric = "agent_config_reloads_total"
+
+// agentRunner держит применённую конфигурацию агента: реестр источников и отправитель.
+// При перезагрузке реестр пересоздаётся, а накопленные старым реестром метрики
+// отправляются вместе со следующим отчётом.
+type agentRunner struct {
+	log   zerolog.Logger
+	path  string
+	flags *flagValues
+
+	mu      sync.Mutex
+	cfg     *AgentConfig
+	sources *agent.Registry
+	sender  *agent.MultiSender
+	filter  *agent.MetricFilter
+	carry   []models.Metrics
+	reloads map[string]int64
+	// Прежние реестры: их позиции источников сохраняются после доставки carry
+	carrySources []*agent.Registry
+
+	// Собственные метрики и состояние отправки для HTTP эндпоинтов агента
+	telemetry    *telemetry.Registry
+	startedAt    time.Time
+	lastSuccess  time.Time
+	lastError    string
+	sendFailures int64
+	reloadErrors int64
+
+	// Остановка сбора текущего реестра
+	stopSources context.CancelFunc
+	sourcesDone chan struct{}
+
+	// Новый интервал отправки для цикла отчётов
+	intervals chan time.Duration
+}
+
+func newAgentRunner(log zerolog.Logger, path string, flags *flagValues, cfg *AgentConfig) (*agentRunner, error) {
+	sources, err := buildSources(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("sources: %w", err)
+	}
+	sender, err := newSender(cfg)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := agent.NewMetricFilter(cfg.MetricRules)
+	if err != nil {
+		return nil, err
+	}
+	a := &agentRunner{
+		log:       log,
+		path:      path,
+		flags:     flags,
+		reloads:   make(map[string]int64),
+		intervals: make(chan time.Duration, 1),
+		telemetry: telemetry.NewRegistry(),
+		startedAt: time.Now(),
+	}
+	sender.SetTelemetry(a.telemetry)
+	a.apply(cfg, sources, sender, filter)
+	return a, nil
+}
+
+// apply делает cfg текущей конфигурацией. Вызывается под a.mu либо до запуска.
+func (a *agentRunner) apply(cfg *AgentConfig, sources *agent.Registry, sender *agent.MultiSender, filter *agent.MetricFilter) {
+	sources.SetLogger(a.log)
+	sender.SetLogger(a.log)
+	filter.SetLogger(a.log)
+	a.cfg = cfg
+	a.sources = sources
+	a.sender = sender
+	a.filter = filter
+}
+
+// newSender создаёт отправитель для серверов из конфигурации
+func newSender(cfg *AgentConfig) (*agent.MultiSender, error) {
+	servers := cfg.Servers
+	if len(servers.Addresses) == 0 {
+		for _, addr := range strings.Split(cfg.ServerAddress, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				servers.Addresses = append(servers.Addresses, addr)
+			}
+		}
+	}
+	sender, err := agent.NewMultiSender(servers)
+	if err != nil {
+		return nil, fmt.Errorf("servers: %w", err)
+	}
+	return sender, nil
+}
+
+// withLabels дополняет метрики статическими метками конфигурации (метки метрики
+// важнее). Вызывается до правил метрик, чтобы правила видели и могли изменить
+// статические метки.
+func withLabels(metrics []models.Metrics, labels models.Labels) []models.Metrics {
+	if len(labels) == 0 {
+		return metrics
+	}
+	for i := range metrics {
+		metrics[i].Labels = labels.Merge(metrics[i].Labels)
+	}
+	return metrics
+}
+
+// startSources запускает опрос текущего реестра. Вызывается под a.mu либо до запуска.
+func (a *agentRunner) startSources(ctx context.Context) {
+	sctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	a.stopSources, a.sourcesDone = cancel, done
+
+	sources := a.sources
+	a.log.Info().Msgf("Started %d metric sources", len(sources.Sources()))
+	go func() {
+		defer close(done)
+		sources.Run(sctx)
+	}()
+}
+
+// stop останавливает опрос, выполняет последний опрос и отчёт не дольше timeout,
+// чтобы не потерять окно агрегации и строки logtail после прошлого отчёта,
+// и закрывает источники. Вызывается после остановки цикла отчётов.
+func (a *agentRunner) stop(timeout time.Duration) {
+	a.mu.Lock()
+	a.stopSources()
+	<-a.sourcesDone
+	sources := a.sources
+	a.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sources.CollectOnce(ctx)
+		a.report()
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		a.log.Error().Dur("timeout", timeout).Msg("Final report did not finish in time")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.sources.Close(); err != nil {
+		a.log.Info().Msgf("Failed to close sources: %v", err)
+	}
+}
+
+// reportLoop отправляет накопленные метрики с интервалом report_interval до отмены контекста
+func (a *agentRunner) reportLoop(ctx context.Context) {
+	a.mu.Lock()
+	interval := a.cfg.ReportInterval
+	a.mu.Unlock()
+
+	a.log.Info().Msgf("Started metrics reporting with interval: %v", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			a.log.Info().Msg("Stopping metrics reporting...")
+			return
+		case interval = <-a.intervals:
+			ticker.Reset(interval)
+			a.log.Info().Msgf("Report interval changed to %v", interval)
+		case <-ticker.C:
+			a.report()
+		}
+	}
+}
+
+// report забирает метрики реестра и данные прежней конфигурации и отправляет их
+func (a *agentRunner) report() {
+	a.mu.Lock()
+	metrics := append(a.carry, a.sources.Take()...)
+	carried := a.carrySources
+	a.carry, a.carrySources = nil, nil
+	for result, n := range a.reloads {
+		delta := n
+		metrics = append(metrics, models.Metrics{
+			ID: configReloadsMetric, MType: models.Counter, Delta: &delta,
+			Labels: models.Labels{"result": result},
+		})
+	}
+	a.reloads = make(map[string]int64)
+	sender, sources, filter, labels := a.sender, a.sources, a.filter, a.cfg.Labels
+	a.mu.Unlock()
+	metrics = filter.Apply(withLabels(append(metrics, sender.Metrics()...), labels))
+
+	for _, st := range sources.Status() {
+		labels := models.Labels{"source": st.Name}
+		a.telemetry.Gauge("agent_source_up", labels).Set(boolValue(st.Up))
+		a.telemetry.Gauge("agent_source_duration_seconds", labels).Set(st.DurationSeconds)
+	}
+
+	if len(metrics) == 0 {
+		a.log.Info().Msg("No metrics to send")
+		return
+	}
+	a.log.Info().Msgf("Sending %d metrics to %s", len(metrics), strings.Join(sender.URLs(), ", "))
+	start := time.Now()
+	err := sender.SendMetrics(metrics)
+	a.telemetry.Histogram("agent_report_duration_seconds", nil, models.DefaultBuckets).Observe(time.Since(start).Seconds())
+
+	outbox := 0
+	for _, st := range sender.Status() {
+		outbox += st.Outbox
+	}
+	a.telemetry.Gauge("agent_outbox_size", nil).Set(float64(outbox))
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err != nil {
+		a.sendFailures++
+		a.lastError = err.Error()
+		a.telemetry.Counter("agent_reports_total", models.Labels{"result": "failure"}).Inc()
+		a.log.Info().Msgf("Failed to send metrics: %v", err)
+		// Позиции прежних реестров ждут следующей успешной отправки
+		a.carrySources = append(carried, a.carrySources...)
+		return
+	}
+	// Позиции logtail сохраняются только после доставки посчитанных строк:
+	// сначала прежних реестров, затем текущего, более поздние
+	for _, old := range append(carried, sources) {
+		if err := old.Commit(); err != nil {
+			a.log.Error().Err(err).Msg("Failed to save source checkpoints")
+		}
+	}
+	a.lastSuccess = time.Now()
+	a.telemetry.Counter("agent_reports_total", models.Labels{"result": "success"}).Inc()
+	a.telemetry.Counter("agent_metrics_sent_total", nil).Add(int64(len(metrics)))
+	a.log.Info().Msg("Successfully sent all metrics")
+}
+
+// countReload учитывает результат перезагрузки конфигурации. Вызывается под a.mu.
+func (a *agentRunner) countReload(result string) {
+	a.reloads[result]++
+	a.telemetry.Counter(configReloadsMetric, models.Labels{"result": result}).Inc()
+	if result == "failure" {
+		a.reloadErrors++
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// reload перечитывает конфигурацию и применяет её. Если конфигурация некорректна,
+// остаётся прежняя.
+func (a *agentRunner) reload(ctx context.Context) error {
+	cfg, err := a.load()
+	var (
+		sender *agent.MultiSender
+		filter *agent.MetricFilter
+	)
+	if err == nil {
+		sender, err = newSender(cfg)
+	}
+	if err == nil {
+		filter, err = agent.NewMetricFilter(cfg.MetricRules)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err != nil {
+		a.countReload("failure")
+		return err
+	}
+
+	// Накопленное старым реестром уходит со следующим отчётом, а его позиции
+	// сохраняются только после доставки (carrySources). Источники нового реестра
+	// продолжают с позиций старого, а не с сохранённых в checkpoint.
+	a.stopSources()
+	<-a.sourcesDone
+	a.carry = append(a.carry, a.sources.Take()...)
+	sources, err := buildSources(cfg)
+	if err != nil {
+		a.startSources(ctx)
+		a.countReload("failure")
+		return fmt.Errorf("sources: %w", err)
+	}
+	sources.Inherit(a.sources)
+	if err := a.sources.Close(); err != nil {
+		a.log.Info().Msgf("Failed to close sources: %v", err)
+	}
+	a.carrySources = append(a.carrySources, a.sources)
+
+	// Очереди повторов серверов, оставшихся в конфигурации, сохраняются
+	sender.Inherit(a.sender)
+	sender.SetTelemetry(a.telemetry)
+
+	prevInterval := a.cfg.ReportInterval
+	a.apply(cfg, sources, sender, filter)
+	a.startSources(ctx)
+	if cfg.ReportInterval != prevInterval {
+		select {
+		case <-a.intervals:
+		default:
+		}
+		a.intervals <- cfg.ReportInterval
+	}
+	a.countReload("success")
+	return nil
+}
+
+// load читает и проверяет конфигурацию
+func (a *agentRunner) load() (*AgentConfig, error) {
+	// При перезагрузке отсутствующий файл — ошибка, а не возврат к значениям по умолчанию
+	if _, err := os.Stat(a.path); err != nil {
+		return nil, err
+	}
+	return readConfig(a.path, a.flags)
+}
+
+// validateConfig проверяет значения, без которых агент не может работать
+func validateConfig(cfg *AgentConfig) error {
+	var errs []error
+	if cfg.ServerAddress == "" && len(cfg.Servers.Addresses) == 0 {
+		errs = append(errs, errors.New("server address must not be empty"))
+	}
+	if cfg.PollInterval <= 0 {
+		errs = append(errs, errors.New("poll interval must be positive"))
+	}
+	if cfg.ReportInterval <= 0 {
+		errs = append(errs, errors.New("report interval must be positive"))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/logger"
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+)
+
+const reloadTestConfig = `agent_config:
+  server_adress: "localhost:18080"
+  poll_interval: 10ms
+  report_interval: 1s
+  sources:
+    - type: random
+`
+
+func writeConfig(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func reloadCount(a *agentRunner, result string) int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.reloads[result]
+}
+
+func TestAgentReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.yaml")
+	writeConfig(t, path, reloadTestConfig)
+
+	cfg, err := readConfig(path, &flagValues{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := newAgentRunner(logger.GetLogger(), path, &flagValues{}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a.startSources(ctx)
+	defer a.stop(time.Second)
+	time.Sleep(50 * time.Millisecond)
+
+	// Некорректная конфигурация отклоняется, прежняя остаётся в силе
+	writeConfig(t, path, "agent_config:\n  report_interval: -1s\n")
+	if err := a.reload(ctx); err == nil {
+		t.Error("Expected invalid config to be rejected")
+	}
+	writeConfig(t, path, reloadTestConfig+"    - type: unknown\n")
+	if err := a.reload(ctx); err == nil {
+		t.Error("Expected config with unknown source to be rejected")
+	}
+	if reloadCount(a, "failure") != 2 || a.cfg.ServerAddress != "localhost:18080" {
+		t.Errorf("Previous config must be kept, got %+v", a.cfg)
+	}
+
+	// Новые интервалы, адрес и метки применяются без потери накопленного
+	writeConfig(t, path, `agent_config:
+  server_adress: "localhost:18081"
+  poll_interval: 10ms
+  report_interval: 2s
+  labels:
+    env: test
+  sources:
+    - type: random
+      name: rnd
+`)
+	if err := a.reload(ctx); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if reloadCount(a, "success") != 1 {
+		t.Error("Expected successful reload to be counted")
+	}
+	if urls := a.sender.URLs(); urls[0] != "http://localhost:18081" || a.cfg.Labels["env"] != "test" {
+		t.Errorf("New config not applied: %v %v", urls, a.cfg.Labels)
+	}
+	select {
+	case d := <-a.intervals:
+		if d != 2*time.Second {
+			t.Errorf("Expected new report interval 2s, got %v", d)
+		}
+	default:
+		t.Error("Report loop must be notified about new interval")
+	}
+
+	a.mu.Lock()
+	carried := a.carry
+	a.mu.Unlock()
+	found := false
+	for _, m := range carried {
+		if m.ID == "RandomValue" && m.MType == models.Gauge {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Metrics collected before reload must be carried to the next report")
+	}
+	if names := a.sources.Sources(); len(names) != 1 || names[0].Name() != "rnd" {
+		t.Errorf("Expected new sources to be running, got %v", names)
+	}
+}
+
+func TestAgentStopSendsFinalReport(t *testing.T) {
+	var received atomic.Int64
+	metricsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+	}))
+	defer metricsServer.Close()
+
+	path := filepath.Join(t.TempDir(), "agent.yaml")
+	writeConfig(t, path, `agent_config:
+  server_adress: "`+metricsServer.URL+`"
+  poll_interval: 1h
+  report_interval: 1h
+  sources:
+    - type: random
+`)
+	cfg, err := readConfig(path, &flagValues{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := newAgentRunner(logger.GetLogger(), path, &flagValues{}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.startSources(context.Background())
+
+	// Отчёт по интервалу ещё не наступил: накопленное уходит при остановке
+	a.stop(time.Second)
+	if received.Load() == 0 {
+		t.Error("Expected pending metrics to be sent on stop")
+	}
+	if a.lastSuccess.IsZero() {
+		t.Error("Expected final report to succeed")
+	}
+}
+
+func TestReportAppliesRulesToStaticLabels(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []models.Metrics
+	)
+	metricsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Errorf("Expected gzip JSON body on %s: %v", r.URL.Path, err)
+			return
+		}
+		var m models.Metrics
+		json.NewDecoder(gz).Decode(&m)
+		mu.Lock()
+		received = append(received, m)
+		mu.Unlock()
+	}))
+	defer metricsServer.Close()
+
+	// Правила ссылаются на статические метки: keep по host и удаление env
+	path := filepath.Join(t.TempDir(), "agent.yaml")
+	writeConfig(t, path, `agent_config:
+  server_adress: "`+metricsServer.URL+`"
+  poll_interval: 1h
+  report_interval: 1h
+  labels:
+    host: web1
+    env: prod
+  sources:
+    - type: random
+  metric_rules:
+    - action: keep
+      source_labels: [host]
+      regex: web1
+    - action: labeldrop
+      regex: env
+`)
+	cfg, err := readConfig(path, &flagValues{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := newAgentRunner(logger.GetLogger(), path, &flagValues{}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.sources.Close()
+	a.sources.CollectOnce(context.Background())
+	a.report()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) == 0 {
+		t.Fatal("Expected metrics kept by the host rule to be sent")
+	}
+	for _, m := range received {
+		if m.Labels["host"] != "web1" || m.Labels["env"] != "" {
+			t.Errorf("Expected host label and no env label on %s, got %v", m.ID, m.Labels)
+		}
+	}
+}
+
+func TestAgentReloadSavesCheckpointAfterSend(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusInternalServerError)
+	metricsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer metricsServer.Close()
+
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "app.log")
+	checkpoint := filepath.Join(dir, "app.pos")
+	writeConfig(t, logPath, "")
+	path := filepath.Join(dir, "agent.yaml")
+	config := func(interval string) string {
+		return `agent_config:
+  poll_interval: 1h
+  report_interval: ` + interval + `
+  servers:
+    addresses: ["` + metricsServer.URL + `"]
+    health_interval: 1ns
+  sources:
+    - type: logtail
+      name: app
+      options:
+        files: ["` + logPath + `"]
+        checkpoint: "` + checkpoint + `"
+        rules:
+          - name: app_errors_total
+            regex: "level=error"
+`
+	}
+	writeConfig(t, path, config("1h"))
+	cfg, err := readConfig(path, &flagValues{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := newAgentRunner(logger.GetLogger(), path, &flagValues{}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Опрос выполняется вручную, без фонового цикла старого реестра
+	done := make(chan struct{})
+	close(done)
+	a.stopSources, a.sourcesDone = func() {}, done
+	defer a.stop(time.Second)
+
+	// Первый опрос запоминает конец файла, затем появляются две строки
+	a.sources.CollectOnce(ctx)
+	writeConfig(t, logPath, "level=error\nlevel=error\n")
+	a.sources.CollectOnce(ctx)
+
+	writeConfig(t, path, config("2h"))
+	if err := a.reload(ctx); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if _, err := os.Stat(checkpoint); err == nil {
+		t.Fatal("Checkpoint must not be saved before the carried lines are sent")
+	}
+
+	// Отправка не удалась: позиции по-прежнему не сохранены
+	a.report()
+	if _, err := os.Stat(checkpoint); err == nil {
+		t.Fatal("Checkpoint must not be saved after a failed send")
+	}
+
+	// Новый реестр продолжает с позиций старого и не считает строки повторно
+	a.sources.CollectOnce(ctx)
+	for _, m := range a.sources.Take() {
+		if m.ID == "app_errors_total" {
+			t.Errorf("Lines counted before reload must not be counted again, got %+v", m)
+		}
+	}
+
+	status.Store(http.StatusOK)
+	a.report()
+	data, err := os.ReadFile(checkpoint)
+	if err != nil {
+		t.Fatalf("Expected checkpoint after a successful send: %v", err)
+	}
+	if !strings.Contains(string(data), `"offset":24`) {
+		t.Errorf("Expected checkpoint at the end of both lines, got %s", data)
+	}
+}
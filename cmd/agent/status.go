@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/agent"
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+)
+
+// unhealthyReports — число интервалов отправки без успешной отправки,
+// после которого /healthz отвечает 503
+const unhealthyReports = 3
+
+// statusConfig — применённая конфигурация на странице статуса
+type statusConfig struct {
+	Servers        []string              `json:"servers"`
+	ServerMode     agent.SendMode        `json:"server_mode"`
+	PollInterval   string                `json:"poll_interval"`
+	ReportInterval string                `json:"report_interval"`
+	Labels         models.Labels         `json:"labels,omitempty"`
+	Sources        []string              `json:"sources"`
+	Aggregation    agent.AggregationMode `json:"aggregation,omitempty"`
+}
+
+// agentStatus — ответ /status
+type agentStatus struct {
+	StartedAt          time.Time            `json:"started_at"`
+	Uptime             string               `json:"uptime"`
+	Config             statusConfig         `json:"config"`
+	LastSuccessfulSend time.Time            `json:"last_successful_send,omitzero"`
+	LastError          string               `json:"last_error,omitempty"`
+	QueueDepth         int                  `json:"queue_depth"`
+	SendErrors         int64                `json:"send_errors"`
+	ReloadErrors       int64                `json:"reload_errors"`
+	Servers            []agent.ServerStatus `json:"servers"`
+	Sources            []agent.SourceStatus `json:"sources"`
+}
+
+// routes регистрирует эндпоинты агента: /healthz, /status и /metrics
+func (a *agentRunner) routes(r chi.Router) {
+	r.Get("/healthz", a.healthzHandler)
+	r.Get("/status", a.statusHandler)
+	r.Method(http.MethodGet, "/metrics", a.telemetry.Handler())
+}
+
+// health сообщает, отправлял ли агент метрики в последние unhealthyReports интервалов
+func (a *agentRunner) health() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	last := a.lastSuccess
+	if last.IsZero() {
+		last = a.startedAt
+	}
+	if a.lastError != "" && time.Since(last) > unhealthyReports*a.cfg.ReportInterval {
+		return fmt.Errorf("no successful send since %s: %s", last.Format(time.RFC3339), a.lastError)
+	}
+	return nil
+}
+
+func (a *agentRunner) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := a.health(); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{"status": "failing", "error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+func (a *agentRunner) statusHandler(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	cfg, sender, sources := a.cfg, a.sender, a.sources
+	st := agentStatus{
+		StartedAt:          a.startedAt,
+		Uptime:             time.Since(a.startedAt).Truncate(time.Second).String(),
+		LastSuccessfulSend: a.lastSuccess,
+		LastError:          a.lastError,
+		SendErrors:         a.sendFailures,
+		ReloadErrors:       a.reloadErrors,
+	}
+	a.mu.Unlock()
+
+	st.Config = statusConfig{
+		Servers:        sender.URLs(),
+		ServerMode:     sender.Mode(),
+		PollInterval:   cfg.PollInterval.String(),
+		ReportInterval: cfg.ReportInterval.String(),
+		Labels:         cfg.Labels,
+		Aggregation:    cfg.Aggregation.Mode,
+	}
+	for _, src := range sources.Sources() {
+		st.Config.Sources = append(st.Config.Sources, src.Name())
+	}
+	st.Servers = sender.Status()
+	for _, s := range st.Servers {
+		st.QueueDepth += s.Outbox
+	}
+	st.Sources = sources.Status()
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(st)
+}
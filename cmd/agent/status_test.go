@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/logger"
+)
+
+func TestAgentStatusEndpoints(t *testing.T) {
+	metricsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer metricsServer.Close()
+
+	path := filepath.Join(t.TempDir(), "agent.yaml")
+	writeConfig(t, path, `agent_config:
+  server_adress: "`+metricsServer.URL+`"
+  poll_interval: 1s
+  report_interval: 1s
+  sources:
+    - type: random
+`)
+	cfg, err := readConfig(path, &flagValues{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := newAgentRunner(logger.GetLogger(), path, &flagValues{}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.sources.CollectOnce(context.Background())
+	a.report()
+
+	r := chi.NewRouter()
+	a.routes(r)
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	if w := get("/healthz"); w.Code != http.StatusOK {
+		t.Errorf("Expected healthy agent, got %d %s", w.Code, w.Body)
+	}
+
+	var st agentStatus
+	if err := json.Unmarshal(get("/status").Body.Bytes(), &st); err != nil {
+		t.Fatalf("Invalid status JSON: %v", err)
+	}
+	if st.LastSuccessfulSend.IsZero() || st.LastError != "" {
+		t.Errorf("Expected successful send in status, got %+v", st)
+	}
+	if len(st.Config.Servers) != 1 || st.Config.Servers[0] != metricsServer.URL {
+		t.Errorf("Unexpected servers in status: %v", st.Config.Servers)
+	}
+	if len(st.Sources) != 1 || st.Sources[0].Name != "random" || !st.Sources[0].Up {
+		t.Errorf("Unexpected sources in status: %+v", st.Sources)
+	}
+
+	body := get("/metrics").Body.String()
+	for _, name := range []string{"agent_report_duration_seconds_bucket", "agent_server_send_duration_seconds_count", "agent_reports_total", "agent_source_up"} {
+		if !strings.Contains(body, name) {
+			t.Errorf("Expected %s in /metrics", name)
+		}
+	}
+
+	// Сервер недоступен дольше unhealthyReports интервалов
+	metricsServer.Close()
+	a.report()
+	a.mu.Lock()
+	a.lastSuccess = time.Now().Add(-time.Minute)
+	a.mu.Unlock()
+	if w := get("/healthz"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 after failed sends, got %d", w.Code)
+	}
+	if err := json.Unmarshal(get("/status").Body.Bytes(), &st); err != nil || st.SendErrors != 1 || st.QueueDepth == 0 {
+		t.Errorf("Expected send error and queued metrics in status, got %+v", st)
+	}
+}
@@ -0,0 +1,32 @@
+// Команда devca создаёт самоподписанный CA и сертификаты сервера и агента
+// для проверки TLS и mTLS без внешней инфраструктуры.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/tlsutil"
+)
+
+func main() {
+	out := flag.String("out", "certs", "Directory for generated certificates")
+	hosts := flag.String("hosts", "localhost,127.0.0.1", "Comma-separated server DNS names and IP addresses")
+	validity := flag.Duration("validity", 365*24*time.Hour, "Certificate validity")
+	flag.Parse()
+
+	var names []string
+	for _, h := range strings.Split(*hosts, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			names = append(names, h)
+		}
+	}
+	if err := tlsutil.GenerateDevCA(*out, names, *validity); err != nil {
+		log.Printf("Failed to generate certificates: %v", err)
+		os.Exit(1)
+	}
+	log.Printf("Generated dev CA, server and client certificates in %s", *out)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+)
+
+func newAuthTestServer(t *testing.T) *Server {
+	t.Helper()
+	store, err := loadTokens("ci:ci-secret:write:ci_;grafana:ro-secret:read;ops:admin-secret:admin", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewServer(NewMetricsStorage(), &ServerConfig{InfluxCounterSuffixes: defaultInfluxCounterSuffixes, Auth: store})
+}
+
+func doRequest(t *testing.T, h http.Handler, method, path, token, contentType, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestAuthScopes(t *testing.T) {
+	s := newAuthTestServer(t)
+	h := s.Router()
+
+	tests := []struct {
+		name, method, path, token string
+		code                      int
+	}{
+		{"no token", http.MethodPost, "/update/gauge/ci_load/1", "", http.StatusUnauthorized},
+		{"unknown token", http.MethodPost, "/update/gauge/ci_load/1", "nope", http.StatusUnauthorized},
+		{"read token writes", http.MethodPost, "/update/gauge/ci_load/1", "ro-secret", http.StatusForbidden},
+		{"allowed prefix", http.MethodPost, "/update/gauge/ci_load/1", "ci-secret", http.StatusOK},
+		{"outside prefix", http.MethodPost, "/update/gauge/HeapAlloc/1", "ci-secret", http.StatusForbidden},
+		{"read", http.MethodGet, "/value/gauge/ci_load", "ro-secret", http.StatusOK},
+		{"write token reads", http.MethodGet, "/metrics", "ci-secret", http.StatusForbidden},
+		{"debug needs admin", http.MethodGet, "/debug/metrics", "ro-secret", http.StatusForbidden},
+		{"admin", http.MethodGet, "/debug/metrics", "admin-secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := doRequest(t, h, tt.method, tt.path, tt.token, "", "")
+		if w.Code != tt.code {
+			t.Errorf("%s: expected %d, got %d (%s)", tt.name, tt.code, w.Code, w.Body)
+		}
+		if w.Code == http.StatusUnauthorized || w.Code == http.StatusForbidden {
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("%s: expected JSON error, got %s", tt.name, ct)
+			}
+		}
+	}
+	if _, ok := s.storage.Gauge("HeapAlloc", nil); ok {
+		t.Error("Metric outside token prefixes must not be written")
+	}
+}
+
+func TestAuthPrefixesOnBatchWrites(t *testing.T) {
+	s := newAuthTestServer(t)
+	h := s.Router()
+
+	// JSON API
+	w := doRequest(t, h, http.MethodPost, "/update", "ci-secret", "application/json", `{"id":"other","type":"gauge","value":1}`)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for JSON write outside prefixes, got %d", w.Code)
+	}
+
+	// Influx: разрешённые метрики записываются, остальные отбрасываются
+	w = doRequest(t, h, http.MethodPost, "/write", "ci-secret", "", "ci_jobs,host=a value=1\nother,host=a value=2")
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "dropped=1") {
+		t.Errorf("Expected partial write, got %d %s", w.Code, w.Body)
+	}
+	if _, ok := s.storage.Gauge("ci_jobs", models.Labels{"host": "a"}); !ok {
+		t.Error("Allowed influx metric must be written")
+	}
+	if _, ok := s.storage.Gauge("other", models.Labels{"host": "a"}); ok {
+		t.Error("Influx metric outside prefixes must be dropped")
+	}
+}
+
+func TestAuthRequestLog(t *testing.T) {
+	var buf bytes.Buffer
+	orig := log.Logger
+	log.Logger = zerolog.New(&buf)
+	defer func() { log.Logger = orig }()
+
+	h := newAuthTestServer(t).Router()
+	doRequest(t, h, http.MethodGet, "/metrics", "ro-secret", "", "")
+
+	if !strings.Contains(buf.String(), `"token":"grafana"`) {
+		t.Errorf("Expected token name in request log, got %q", buf.String())
+	}
+	if strings.Contains(buf.String(), "ro-secret") {
+		t.Error("Token secret must not be logged")
+	}
+}
+
+func TestAuthDisabledWithoutTokens(t *testing.T) {
+	w := doRequest(t, newTestServer().Router(), http.MethodPost, "/update/gauge/x/1", "", "", "")
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected open API without tokens, got %d", w.Code)
+	}
+}
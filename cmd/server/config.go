@@ -0,0 +1,282 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/caarlos0/env/v6"
+	"gopkg.in/yaml.v3"
+
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/auth"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/graphite"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/logger"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/otlp"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/statsd"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/tenant"
+)
+
+type ServerConfig struct {
+	Address       string `env:"ADDRESS"`
+	StoreInterval time.Duration
+	FileStorage   string
+	Restore       bool
+
+	// StatsD: пустой адрес отключает UDP приёмник
+	StatsDAddress       string        `env:"STATSD_ADDRESS"`
+	StatsDFlushInterval time.Duration `env:"STATSD_FLUSH_INTERVAL"`
+	// StatsDGaugeExpiry — число сбросов без обновлений, после которого gauge забывается
+	StatsDGaugeExpiry int `env:"STATSD_GAUGE_EXPIRY"`
+
+	// InfluxCounterSuffixes — суффиксы имён, для которых поля Influx считаются counter
+	InfluxCounterSuffixes string `env:"INFLUX_COUNTER_SUFFIXES"`
+
+	// Graphite: пустой адрес отключает TCP приёмник.
+	// Шаблоны разделяются ';', например "servers.* .host.measurement*;stats.* .measurement*"
+	GraphiteAddress     string        `env:"GRAPHITE_ADDRESS"`
+	GraphiteTemplates   string        `env:"GRAPHITE_TEMPLATES"`
+	GraphiteSeparator   string        `env:"GRAPHITE_SEPARATOR"`
+	GraphiteMaxConns    int           `env:"GRAPHITE_MAX_CONNS"`
+	GraphiteIdleTimeout time.Duration `env:"GRAPHITE_IDLE_TIMEOUT"`
+
+	// OTLPHistogramMode — хранение OTLP гистограмм: native или buckets (развёрнутые корзины)
+	OTLPHistogramMode string `env:"OTLP_HISTOGRAM_MODE"`
+	OTLPHistograms    otlp.HistogramMode
+
+	// Токены API: строка "name:token:scopes[:prefixes[:tenant]];..." и/или YAML файл.
+	// Без токенов аутентификация выключена.
+	AuthTokens     string `env:"AUTH_TOKENS"`
+	AuthTokensFile string `env:"AUTH_TOKENS_FILE"`
+	Auth           *auth.Store
+
+	// Tenants — арендаторы через запятую, которых может создать запись без токена;
+	// остальных создаёт только запись с токеном
+	Tenants string `env:"TENANTS"`
+
+	// Ограничения записи, 0 — без ограничения. Превышение квот отклоняется с 429,
+	// слишком длинные имена — с 422.
+	MaxSeries          int     `env:"MAX_SERIES"`
+	MaxTenants         int     `env:"MAX_TENANTS"`
+	MaxTenantSeries    int     `env:"MAX_TENANT_SERIES"`
+	MaxNameLength      int     `env:"MAX_NAME_LENGTH"`
+	MaxWritesPerSecond float64 `env:"MAX_WRITES_PER_SECOND"`
+	WriteBurst         int     `env:"WRITE_BURST"`
+
+	// Ограничение частоты запросов (token bucket) по ключу ip, token или tenant,
+	// отдельно для записи и чтения; 0 — без ограничения
+	RateLimitKey    string        `env:"RATE_LIMIT_KEY"`
+	RateLimitWrites float64       `env:"RATE_LIMIT_WRITES"`
+	RateLimitReads  float64       `env:"RATE_LIMIT_READS"`
+	RateLimitBurst  int           `env:"RATE_LIMIT_BURST"`
+	RateLimitGC     time.Duration `env:"RATE_LIMIT_GC_INTERVAL"`
+
+	// TLS: сертификат и ключ включают HTTPS, TLSClientCA — проверку клиентских
+	// сертификатов (mTLS). Файлы перечитываются при изменении.
+	TLSCert     string `env:"TLS_CERT"`
+	TLSKey      string `env:"TLS_KEY"`
+	TLSClientCA string `env:"TLS_CLIENT_CA"`
+
+	// Pprof включает /debug/pprof (с токенами — только для admin)
+	Pprof bool `env:"PPROF"`
+
+	// ShutdownTimeout — дедлайн остановки: дожидания запросов и сброса приёмников
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT"`
+	// ShutdownDelay — пауза после снятия готовности до закрытия HTTP: балансировщики
+	// видят 503 на /readyz, пока сервер ещё принимает запросы
+	ShutdownDelay time.Duration `env:"SHUTDOWN_DELAY"`
+
+	// ConfigFile — YAML файл с секцией logging; флаги и env перекрывают его
+	ConfigFile string `env:"CONFIG"`
+
+	// Logging — журнал: уровень, формат, выводы, ротация файла и прореживание.
+	// Запись каждой метрики журналируется только на уровне debug.
+	Logging logger.Config
+}
+
+// serverFile — содержимое YAML файла -config
+type serverFile struct {
+	Logging *logger.Config `yaml:"logging"`
+}
+
+const (
+	defaultStoreInterval = 300 * time.Second
+	defaultFileStorage   = "metrics.json"
+	defaultRestore       = false
+
+	defaultStatsDFlushInterval = 10 * time.Second
+
+	defaultInfluxCounterSuffixes = "_total,_count"
+
+	defaultRateLimitGC = time.Minute
+
+	defaultMaxTenants = 1000
+
+	defaultShutdownTimeout = 30 * time.Second
+	defaultShutdownDelay   = 5 * time.Second
+
+	defaultLogFile = "logs/server.log"
+)
+
+// parseServerFlags читает флаги, затем переменные окружения (приоритет env выше)
+func parseServerFlags() (*ServerConfig, error) {
+	config := &ServerConfig{Logging: logger.DefaultConfig()}
+	config.Logging.File.Path = defaultLogFile
+	var logFlags logger.Flags
+
+	flag.StringVar(&config.Address, "a", "localhost:8080", "HTTP server endpoint address")
+	flag.StringVar(&config.StatsDAddress, "statsd-addr", "", "UDP address for StatsD ingestion, e.g. :8125 (disabled if empty)")
+	flag.DurationVar(&config.StatsDFlushInterval, "statsd-flush", defaultStatsDFlushInterval, "StatsD aggregation flush interval")
+	flag.IntVar(&config.StatsDGaugeExpiry, "statsd-gauge-expiry", statsd.DefaultGaugeExpiry, "Flushes without updates after which a StatsD gauge is forgotten (0 keeps gauges forever)")
+	flag.StringVar(&config.InfluxCounterSuffixes, "influx-counter-suffixes", defaultInfluxCounterSuffixes,
+		"Comma-separated metric name suffixes mapped to counters on /write")
+	flag.StringVar(&config.GraphiteAddress, "graphite-addr", "", "TCP address for Graphite plaintext ingestion, e.g. :2003 (disabled if empty)")
+	flag.StringVar(&config.GraphiteTemplates, "graphite-templates", "", "Semicolon-separated Graphite mapping templates")
+	flag.StringVar(&config.GraphiteSeparator, "graphite-separator", graphite.DefaultSeparator, "Separator for joining Graphite path parts into metric names")
+	flag.IntVar(&config.GraphiteMaxConns, "graphite-max-conns", graphite.DefaultMaxConns, "Maximum concurrent Graphite connections")
+	flag.DurationVar(&config.GraphiteIdleTimeout, "graphite-idle-timeout", graphite.DefaultIdleTimeout, "Close idle Graphite connections after this duration")
+	flag.StringVar(&config.OTLPHistogramMode, "otlp-histograms", "native", "How OTLP histograms are stored: native or buckets")
+	flag.StringVar(&config.AuthTokens, "auth-tokens", "", "API tokens as name:token:scopes[:prefixes[:tenant]], separated by ';'")
+	flag.StringVar(&config.AuthTokensFile, "auth-tokens-file", "", "YAML file with API tokens")
+	flag.IntVar(&config.MaxSeries, "max-series", 0, "Maximum number of series across all tenants (0 = unlimited)")
+	flag.StringVar(&config.Tenants, "tenants", "", "Comma-separated tenants that writes without an API token may create")
+	flag.IntVar(&config.MaxTenants, "max-tenants", defaultMaxTenants, "Maximum number of tenants including default (0 = unlimited)")
+	flag.IntVar(&config.MaxTenantSeries, "max-tenant-series", 0, "Maximum number of series per tenant (0 = unlimited)")
+	flag.IntVar(&config.MaxNameLength, "max-name-length", 0, "Maximum metric name length in bytes (0 = unlimited)")
+	flag.Float64Var(&config.MaxWritesPerSecond, "max-writes-per-second", 0, "Maximum metrics written per second per client (0 = unlimited)")
+	flag.IntVar(&config.WriteBurst, "write-burst", 0, "Write rate burst per client (defaults to one second of writes)")
+	flag.StringVar(&config.RateLimitKey, "rate-limit-key", rateLimitByIP, "Rate limit requests per ip, token or tenant")
+	flag.Float64Var(&config.RateLimitWrites, "rate-limit-writes", 0, "Write requests per second per client (0 = unlimited)")
+	flag.Float64Var(&config.RateLimitReads, "rate-limit-reads", 0, "Read requests per second per client (0 = unlimited)")
+	flag.IntVar(&config.RateLimitBurst, "rate-limit-burst", 0, "Request burst per client (defaults to one second of requests)")
+	flag.DurationVar(&config.RateLimitGC, "rate-limit-gc", defaultRateLimitGC, "Interval for removing idle rate limit buckets")
+	flag.StringVar(&config.TLSCert, "tls-cert", "", "TLS certificate file (enables HTTPS)")
+	flag.StringVar(&config.TLSKey, "tls-key", "", "TLS private key file")
+	flag.StringVar(&config.TLSClientCA, "tls-client-ca", "", "CA bundle for verifying client certificates (enables mTLS)")
+	flag.BoolVar(&config.Pprof, "pprof", false, "Serve /debug/pprof (admin scope when API tokens are configured)")
+	flag.DurationVar(&config.ShutdownTimeout, "shutdown-timeout", defaultShutdownTimeout, "Deadline for draining requests and flushing listeners on shutdown")
+	flag.DurationVar(&config.ShutdownDelay, "shutdown-delay", defaultShutdownDelay, "Wait after failing /readyz before refusing new connections on shutdown")
+	flag.StringVar(&config.ConfigFile, "config", "", "YAML file with a logging section")
+	logFlags.Register(flag.CommandLine)
+	flag.Parse()
+
+	if flag.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "Error: unknown arguments: %v\n", flag.Args())
+		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n", os.Args[0])
+		flag.PrintDefaults()
+		return nil, fmt.Errorf("unknown arguments provided")
+	}
+
+	// Файл читается до env.Parse, чтобы переменные LOG_* перекрывали его
+	if path := os.Getenv("CONFIG"); path != "" {
+		config.ConfigFile = path
+	}
+	if config.ConfigFile != "" {
+		if err := loadServerFile(config.ConfigFile, config); err != nil {
+			return nil, fmt.Errorf("config file: %w", err)
+		}
+	}
+	logFlags.Apply(&config.Logging)
+
+	if err := env.Parse(config); err != nil {
+		return nil, fmt.Errorf("parsing env: %w", err)
+	}
+
+	if config.StatsDFlushInterval <= 0 {
+		return nil, fmt.Errorf("statsd flush interval must be positive, got %v", config.StatsDFlushInterval)
+	}
+	if config.StatsDGaugeExpiry < 0 {
+		return nil, fmt.Errorf("statsd gauge expiry must not be negative, got %d", config.StatsDGaugeExpiry)
+	}
+
+	if err := parseRateLimitKey(config.RateLimitKey); err != nil {
+		return nil, err
+	}
+	if config.ShutdownTimeout <= 0 {
+		return nil, fmt.Errorf("shutdown timeout must be positive, got %v", config.ShutdownTimeout)
+	}
+	if config.ShutdownDelay < 0 {
+		return nil, fmt.Errorf("shutdown delay must not be negative, got %v", config.ShutdownDelay)
+	}
+	for _, id := range splitList(config.Tenants) {
+		if err := tenant.Validate(id); err != nil {
+			return nil, fmt.Errorf("tenants: %w", err)
+		}
+	}
+	if config.MaxTenants < 0 {
+		return nil, fmt.Errorf("max tenants must not be negative, got %d", config.MaxTenants)
+	}
+	if config.RateLimitGC <= 0 {
+		return nil, fmt.Errorf("rate limit gc interval must be positive, got %v", config.RateLimitGC)
+	}
+
+	if (config.TLSCert == "") != (config.TLSKey == "") {
+		return nil, fmt.Errorf("tls certificate and key must be set together")
+	}
+	if config.TLSClientCA != "" && config.TLSCert == "" {
+		return nil, fmt.Errorf("tls client CA requires a server certificate")
+	}
+
+	mode, err := otlp.ParseHistogramMode(config.OTLPHistogramMode)
+	if err != nil {
+		return nil, err
+	}
+	config.OTLPHistograms = mode
+
+	if config.Auth, err = loadTokens(config.AuthTokens, config.AuthTokensFile); err != nil {
+		return nil, fmt.Errorf("auth tokens: %w", err)
+	}
+
+	return config, nil
+}
+
+// loadServerFile читает YAML файл настроек поверх значений по умолчанию
+func loadServerFile(path string, config *ServerConfig) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(data, &serverFile{Logging: &config.Logging}); err != nil {
+		return fmt.Errorf("unmarshal yaml: %w", err)
+	}
+	return nil
+}
+
+// loadTokens собирает токены из строки и файла
+func loadTokens(inline, path string) (*auth.Store, error) {
+	tokens, err := auth.ParseTokens(inline)
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		fromFile, err := auth.LoadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, fromFile...)
+	}
+	return auth.NewStore(tokens)
+}
+
+// splitList разбирает список значений через запятую, пропуская пустые
+func splitList(s string) []string {
+	var res []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			res = append(res, part)
+		}
+	}
+	return res
+}
+
+// splitTemplates разбирает список шаблонов Graphite через ';'
+func splitTemplates(s string) []string {
+	var res []string
+	for _, part := range strings.Split(s, ";") {
+		if part = strings.TrimSpace(part); part != "" {
+			res = append(res, part)
+		}
+	}
+	return res
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/health"
+)
+
+// registerHealthChecks регистрирует проверки, не зависящие от запущенных приёмников.
+// Приёмники StatsD и Graphite добавляют свои проверки при запуске в serve.
+func (s *Server) registerHealthChecks() {
+	// Живость — только уровень процесса: раз обработчик ответил, процесс жив.
+	// Занятое хранилище под нагрузкой записи не повод перезапускать сервер.
+	s.health.Add("process", health.Liveness, func(ctx context.Context) error {
+		return nil
+	})
+	s.health.Add("storage", health.Readiness, func(ctx context.Context) error {
+		return s.tenants.ping(ctx)
+	})
+	s.health.Add("startup", health.Readiness, func(ctx context.Context) error {
+		if !s.started.Load() {
+			return errors.New("server is starting")
+		}
+		return nil
+	})
+	s.health.Add("shutdown", health.Readiness, func(ctx context.Context) error {
+		if s.lifecycle.ShuttingDown() {
+			return errors.New("server is shutting down")
+		}
+		return nil
+	})
+}
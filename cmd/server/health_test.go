@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/health"
+)
+
+func TestHealthEndpoints(t *testing.T) {
+	s := newAuthTestServer(t)
+	h := s.Router()
+	code := func(path string) int {
+		return doRequest(t, h, http.MethodGet, path, "", "", "").Code
+	}
+
+	// Проверки доступны без токена
+	if c := code("/livez"); c != http.StatusOK {
+		t.Errorf("Expected /livez 200, got %d", c)
+	}
+	if c := code("/readyz"); c != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz 503 before startup, got %d", c)
+	}
+
+	s.started.Store(true)
+	if c := code("/readyz"); c != http.StatusOK {
+		t.Errorf("Expected /readyz 200 after startup, got %d", c)
+	}
+
+	w := doRequest(t, h, http.MethodGet, "/healthz?verbose", "", "", "")
+	var rep health.Report
+	if err := json.Unmarshal(w.Body.Bytes(), &rep); err != nil {
+		t.Fatalf("Invalid verbose response %q: %v", w.Body, err)
+	}
+	if w.Code != http.StatusOK || len(rep.Checks) != 4 {
+		t.Errorf("Expected process, storage, startup and shutdown checks, got %d %+v", w.Code, rep)
+	}
+
+	// Хранилище недоступно (например, занято записью): процесс жив, но не готов
+	s.storage.mu.Lock()
+	go func() {
+		time.Sleep(health.DefaultTimeout + 500*time.Millisecond)
+		s.storage.mu.Unlock()
+	}()
+	if c := code("/livez"); c != http.StatusOK {
+		t.Errorf("Expected /livez 200 while storage is locked, got %d", c)
+	}
+	if c := code("/readyz"); c != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz 503 while storage is locked, got %d", c)
+	}
+	time.Sleep(600 * time.Millisecond)
+
+	s.lifecycle.shuttingDown.Store(true)
+	if c := code("/readyz"); c != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz 503 during shutdown, got %d", c)
+	}
+	if c := code("/livez"); c != http.StatusOK {
+		t.Errorf("Expected /livez 200 during shutdown, got %d", c)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/auth"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/influx"
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+)
+
+// influxErrorResponse — тело ошибки в формате InfluxDB 1.x
+type influxErrorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeInfluxError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Influxdb-Error", msg)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(influxErrorResponse{Error: msg})
+}
+
+// writeInfluxLimitError отвечает на отклонение записи ограничением сервера
+func writeInfluxLimitError(w http.ResponseWriter, err error) {
+	var le *limitError
+	if !errors.As(err, &le) {
+		writeInfluxError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	setRetryAfter(w, le.retryAfter)
+	writeInfluxError(w, le.status, le.msg)
+}
+
+// influxWriteHandler принимает InfluxDB line protocol (POST /write?precision=s).
+// Поля становятся gauge, либо counter при совпадении суффикса имени; теги — метками.
+// Корректные строки записываются даже при наличии ошибочных (частичная запись),
+// в ответе перечисляются ошибки с номерами строк.
+func (s *Server) influxWriteHandler(w http.ResponseWriter, r *http.Request) {
+	precision, err := influx.ParsePrecision(r.URL.Query().Get("precision"))
+	if err != nil {
+		writeInfluxError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeInfluxError(w, http.StatusBadRequest, "unable to read body: "+err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	points, lineErrs := influx.Parse(body, precision)
+
+	var problems []string
+	for _, le := range lineErrs {
+		problems = append(problems, le.Error())
+	}
+
+	var metrics []models.Metrics
+	for _, p := range points {
+		metrics = append(metrics, influx.ToMetrics(p, s.influxOptions)...)
+	}
+
+	// Квота расходуется только на метрики, прошедшие проверку прав и формата
+	dropped := len(lineErrs)
+	var (
+		limited *limitError
+		valid   []models.Metrics
+	)
+	for _, m := range metrics {
+		if err := auth.CanWrite(r.Context(), m.ID); err != nil {
+			dropped++
+			problems = append(problems, err.Error())
+			continue
+		}
+		if err := s.validateMetric(m); err != nil {
+			dropped++
+			problems = append(problems, fmt.Sprintf("unable to write %s: %v", m.Key(), err))
+			errors.As(err, &limited)
+			continue
+		}
+		valid = append(valid, m)
+	}
+	if len(valid) > 0 {
+		if err := s.admitWrites(r, len(valid)); err != nil {
+			writeInfluxLimitError(w, err)
+			return
+		}
+		space, err := s.writeSpace(r.Context())
+		if err != nil {
+			writeInfluxLimitError(w, err)
+			return
+		}
+		for _, m := range valid {
+			// Накопленное значение переводится в приращение только после допуска серии
+			err := s.writeSeries(r.Context(), space.storage, []models.Metrics{m}, func() []models.Metrics {
+				return []models.Metrics{space.cumulative.ToDelta(m)}
+			})
+			if err != nil {
+				dropped++
+				problems = append(problems, fmt.Sprintf("unable to write %s: %v", m.Key(), err))
+				errors.As(err, &limited)
+			}
+		}
+	}
+
+	if limited != nil && dropped == len(lineErrs)+len(metrics) {
+		writeInfluxLimitError(w, limited)
+		return
+	}
+	if len(problems) > 0 {
+		writeInfluxError(w, http.StatusBadRequest,
+			fmt.Sprintf("partial write: %s dropped=%d", strings.Join(problems, "; "), dropped))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+)
+
+func newTestServer() *Server {
+	return NewServer(NewMetricsStorage(), &ServerConfig{InfluxCounterSuffixes: defaultInfluxCounterSuffixes})
+}
+
+func TestInfluxWrite(t *testing.T) {
+	s := newTestServer()
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	// Telegraf присылает накопленные значения; сервер хранит сумму приращений
+	for _, body := range []string{
+		"http,host=web1 requests_total=10i,latency=0.25",
+		"http,host=web1 requests_total=15i,latency=0.5",
+	} {
+		resp, err := http.Post(ts.URL+"/write", "text/plain", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST /write failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("Expected 204, got %d", resp.StatusCode)
+		}
+	}
+
+	labels := models.Labels{"host": "web1"}
+	if v, ok := s.storage.Counter("http_requests_total", labels); !ok || v != 15 {
+		t.Errorf("Expected counter 15, got %d (found=%v)", v, ok)
+	}
+	if v, ok := s.storage.Gauge("http_latency", labels); !ok || v != 0.5 {
+		t.Errorf("Expected gauge 0.5, got %v (found=%v)", v, ok)
+	}
+}
+
+func TestInfluxWriteGzipPartial(t *testing.T) {
+	s := newTestServer()
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte("mem used=1\nmem used=\nmem free=2 1700000000\n"))
+	gz.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/write?precision=s", &buf)
+	req.Header.Set("Content-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST /write failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for partial write, got %d", resp.StatusCode)
+	}
+	var body influxErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Expected JSON error body: %v", err)
+	}
+	if !strings.Contains(body.Error, "line 2") || !strings.Contains(body.Error, "dropped=1") {
+		t.Errorf("Expected error to mention line 2 and dropped=1, got %q", body.Error)
+	}
+
+	// Корректные строки записаны
+	if _, ok := s.storage.Gauge("mem_free", nil); !ok {
+		t.Error("Expected mem_free to be written despite the bad line")
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+)
+
+// instrument учитывает число и длительность запросов по шаблону маршрута chi
+// (не по URI: имена метрик в пути не должны порождать новые серии)
+func (s *Server) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		defer func() {
+			route := "unmatched"
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			s.telemetry.Counter("server_http_requests_total", models.Labels{
+				"route": route, "method": r.Method, "status": strconv.Itoa(status),
+			}).Inc()
+			s.telemetry.Histogram("server_http_request_duration_seconds",
+				models.Labels{"route": route, "method": r.Method}, models.DefaultBuckets).
+				Observe(time.Since(start).Seconds())
+		}()
+		next.ServeHTTP(ww, r)
+	})
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/health"
+)
+
+// Коды завершения сервера
+const (
+	exitOK                 = 0
+	exitFailure            = 1 // не удалось запуститься или сервер упал
+	exitShutdownIncomplete = 2 // остановка не уложилась в дедлайн или подсистема вернула ошибку
+)
+
+// errShutdownIncomplete — остановка завершилась с ошибками
+var errShutdownIncomplete = errors.New("shutdown incomplete")
+
+// exitCode переводит результат работы сервера в код завершения процесса
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, errShutdownIncomplete):
+		return exitShutdownIncomplete
+	default:
+		return exitFailure
+	}
+}
+
+// shutdownHook — остановка одной подсистемы
+type shutdownHook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// lifecycle останавливает подсистемы сервера по порядку регистрации с общим дедлайном:
+// сначала перестаёт принимать и дожидается запросов HTTP, затем закрывает приёмники
+// StatsD и Graphite (они сбрасывают накопленное в хранилище), затем хранилище.
+type lifecycle struct {
+	timeout time.Duration
+	delay   time.Duration
+
+	mu           sync.Mutex
+	hooks        []shutdownHook
+	shuttingDown atomic.Bool
+}
+
+// newLifecycle создаёт остановку с дедлайном timeout; delay — пауза между снятием
+// готовности и остановкой подсистем (см. drain)
+func newLifecycle(timeout, delay time.Duration) *lifecycle {
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	return &lifecycle{timeout: timeout, delay: delay}
+}
+
+// onShutdown регистрирует остановку подсистемы name
+func (l *lifecycle) onShutdown(name string, fn func(ctx context.Context) error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hooks = append(l.hooks, shutdownHook{name: name, fn: fn})
+}
+
+// ShuttingDown сообщает, началась ли остановка
+func (l *lifecycle) ShuttingDown() bool {
+	return l.shuttingDown.Load()
+}
+
+// drain снимает готовность (/readyz отвечает 503) и ждёт delay, чтобы балансировщики
+// успели убрать сервер из ротации, пока он ещё принимает запросы
+func (l *lifecycle) drain() {
+	l.shuttingDown.Store(true)
+	if l.delay > 0 {
+		log.Info().Dur("delay", l.delay).Msg("readiness withdrawn, waiting before shutdown")
+		time.Sleep(l.delay)
+	}
+}
+
+// shutdown выполняет остановку всех подсистем. Подсистема, не уложившаяся в дедлайн,
+// не мешает остановке следующих: каждая получает уже истёкший контекст и должна
+// освободить ресурсы принудительно.
+func (l *lifecycle) shutdown() error {
+	l.shuttingDown.Store(true)
+	l.mu.Lock()
+	hooks := append([]shutdownHook(nil), l.hooks...)
+	l.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+	defer cancel()
+
+	var errs []error
+	for _, h := range hooks {
+		start := time.Now()
+		if err := h.fn(ctx); err != nil {
+			log.Error().Err(err).Str("subsystem", h.name).Dur("elapsed", time.Since(start)).Msg("shutdown failed")
+			errs = append(errs, fmt.Errorf("%s: %w", h.name, err))
+			continue
+		}
+		log.Info().Str("subsystem", h.name).Dur("elapsed", time.Since(start)).Msg("shutdown complete")
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %w", errShutdownIncomplete, errors.Join(errs...))
+	}
+	return nil
+}
+
+// serveUntil запускает serve в отдельной горутине и регистрирует остановку:
+// отмену контекста и ожидание возврата serve до дедлайна. Возвращённый канал
+// закрывается, когда serve вернётся.
+func (l *lifecycle) serveUntil(name string, serve func(ctx context.Context) error) <-chan struct{} {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := serve(ctx); err != nil {
+			log.Error().Err(err).Str("subsystem", name).Msg("serve failed")
+		}
+	}()
+	l.onShutdown(name, func(shutdownCtx context.Context) error {
+		cancel()
+		select {
+		case <-done:
+			return nil
+		case <-shutdownCtx.Done():
+			return shutdownCtx.Err()
+		}
+	})
+	return done
+}
+
+// runningCheck — проверка готовности подсистемы, работающей до закрытия done
+func runningCheck(done <-chan struct{}) health.Check {
+	return func(ctx context.Context) error {
+		select {
+		case <-done:
+			return errors.New("stopped")
+		default:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/auth"
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+)
+
+// Метрика отклонённых записей, метка reason — причина
+const rejectedWritesMetric = "server_rejected_writes_total"
+
+// Причины отклонения записи
+const (
+	rejectSeriesLimit       = "series_limit"
+	rejectTenantSeriesLimit = "tenant_series_limit"
+	rejectNameTooLong       = "name_too_long"
+	rejectWriteRate         = "write_rate"
+	rejectUnknownTenant     = "unknown_tenant"
+	rejectTenantLimit       = "tenant_limit"
+)
+
+// limitError — запись отклонена ограничением сервера. status — 429 (квоты и частота),
+// 422 (недопустимая метрика) или 403 (арендатор не может быть создан).
+type limitError struct {
+	reason     string
+	status     int
+	msg        string
+	retryAfter time.Duration
+}
+
+func (e *limitError) Error() string { return e.msg }
+
+// reject учитывает отклонение в собственных метриках сервера
+func (s *Server) reject(reason string, status int, format string, args ...any) *limitError {
+	s.telemetry.Counter(rejectedWritesMetric, models.Labels{"reason": reason}).Inc()
+	return &limitError{reason: reason, status: status, msg: fmt.Sprintf(format, args...)}
+}
+
+// checkName проверяет длину имени метрики
+func (s *Server) checkName(name string) error {
+	if max := s.config.MaxNameLength; max > 0 && len(name) > max {
+		return s.reject(rejectNameTooLong, http.StatusUnprocessableEntity,
+			"metric name %.32q... is %d bytes long, limit is %d", name, len(name), max)
+	}
+	return nil
+}
+
+// seriesLimited сообщает, ограничено ли число серий
+func (s *Server) seriesLimited() bool {
+	return s.config.MaxSeries > 0 || s.config.MaxTenantSeries > 0
+}
+
+// newSeries возвращает число серий metrics, которых ещё нет в st
+func newSeries(st *MetricsStorage, metrics []models.Metrics) int {
+	seen := make(map[string]bool, len(metrics))
+	for _, m := range metrics {
+		key := m.MType + " " + m.Key()
+		if !seen[key] && !st.HasSeries(m.MType, m.ID, m.Labels) {
+			seen[key] = true
+		}
+	}
+	return len(seen)
+}
+
+// admitSeries проверяет, можно ли создать n новых серий в хранилище арендатора st.
+// Вызывается под s.seriesMu.
+func (s *Server) admitSeries(st *MetricsStorage, n int) error {
+	if max := s.config.MaxTenantSeries; max > 0 && st.SeriesCount()+n > max {
+		return s.reject(rejectTenantSeriesLimit, http.StatusTooManyRequests,
+			"tenant series limit %d exceeded", max)
+	}
+	if max := s.config.MaxSeries; max > 0 && s.tenants.seriesCount()+n > max {
+		return s.reject(rejectSeriesLimit, http.StatusTooManyRequests,
+			"series limit %d exceeded", max)
+	}
+	return nil
+}
+
+// admitWrites расходует n записей из квоты клиента запроса
+func (s *Server) admitWrites(r *http.Request, n int) error {
+	ok, wait := s.writeLimiter.AllowN(clientKey(r), n)
+	if ok {
+		return nil
+	}
+	err := s.reject(rejectWriteRate, http.StatusTooManyRequests,
+		"write rate limit %g metrics/s exceeded", s.config.MaxWritesPerSecond)
+	err.retryAfter = wait
+	return err
+}
+
+// clientKey — клиент запроса: имя токена или IP адрес
+func clientKey(r *http.Request) string {
+	if t, ok := auth.FromContext(r.Context()); ok {
+		return "token:" + t.Name
+	}
+	return ipKey(r)
+}
+
+// ipKey — IP адрес клиента запроса
+func ipKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// writeLimitError отвечает на ошибку записи: ограничения — JSON с их статусом,
+// остальные ошибки — 400
+func writeLimitError(w http.ResponseWriter, err error) {
+	var le *limitError
+	if !errors.As(err, &le) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	setRetryAfter(w, le.retryAfter)
+	auth.WriteError(w, le.status, le.msg)
+}
+
+// setRetryAfter выставляет Retry-After в целых секундах, не меньше одной
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	if wait <= 0 {
+		return
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+}
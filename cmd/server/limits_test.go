@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/otlp"
+)
+
+func TestSeriesAndNameLimits(t *testing.T) {
+	s := NewServer(NewMetricsStorage(), &ServerConfig{
+		InfluxCounterSuffixes: defaultInfluxCounterSuffixes,
+		Tenants:               "acme",
+		MaxSeries:             3,
+		MaxTenantSeries:       2,
+		MaxNameLength:         16,
+	})
+	h := s.Router()
+
+	tests := []struct {
+		name, path, tenant string
+		code               int
+	}{
+		{"first series", "/update/gauge/a/1", "", http.StatusOK},
+		{"second series", "/update/gauge/b/1", "", http.StatusOK},
+		{"tenant limit", "/update/gauge/c/1", "", http.StatusTooManyRequests},
+		{"existing series", "/update/gauge/a/2", "", http.StatusOK},
+		{"other tenant", "/update/gauge/c/1", "acme", http.StatusOK},
+		{"global limit", "/update/gauge/d/1", "acme", http.StatusTooManyRequests},
+		{"long name", "/update/gauge/" + strings.Repeat("x", 17) + "/1", "", http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		w := doTenantRequest(t, h, http.MethodPost, tt.path, "", tt.tenant)
+		if w.Code != tt.code {
+			t.Errorf("%s: expected %d, got %d (%s)", tt.name, tt.code, w.Code, w.Body)
+		}
+		if w.Code != http.StatusOK && !strings.Contains(w.Body.String(), `"error"`) {
+			t.Errorf("%s: expected JSON error body, got %q", tt.name, w.Body)
+		}
+	}
+
+	body := doTenantRequest(t, h, http.MethodGet, "/debug/metrics", "", "").Body.String()
+	for _, want := range []string{
+		`server_rejected_writes_total{reason="tenant_series_limit"} 1`,
+		`server_rejected_writes_total{reason="series_limit"} 1`,
+		`server_rejected_writes_total{reason="name_too_long"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %s in self-metrics:\n%s", want, body)
+		}
+	}
+}
+
+func TestWriteRateLimit(t *testing.T) {
+	s := NewServer(NewMetricsStorage(), &ServerConfig{
+		InfluxCounterSuffixes: defaultInfluxCounterSuffixes,
+		MaxWritesPerSecond:    0.5,
+		WriteBurst:            2,
+		MaxNameLength:         16,
+	})
+	h := s.Router()
+
+	// Отклонённые проверкой записи не расходуют квоту
+	for _, body := range []string{
+		`{"id":"jobs","type":"counter"}`,
+		`{"id":"jobs","type":"counter","delta":1,"labels":{"bad-label":"x"}}`,
+		`{"id":"` + strings.Repeat("x", 17) + `","type":"counter","delta":1}`,
+	} {
+		if w := doRequest(t, h, http.MethodPost, "/update", "", "application/json", body); w.Code == http.StatusOK || w.Code == http.StatusTooManyRequests {
+			t.Errorf("Expected invalid metric %s to be rejected by validation, got %d", body, w.Code)
+		}
+	}
+	if w := doRequest(t, h, http.MethodPost, "/write", "", "", strings.Repeat("x", 17)+" value=1"); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 for influx write with a long name, got %d %q", w.Code, w.Body)
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := doTenantRequest(t, h, http.MethodPost, "/update/counter/jobs/1", "", ""); w.Code != http.StatusOK {
+			t.Fatalf("Expected write %d within burst to pass, got %d", i, w.Code)
+		}
+	}
+	w := doTenantRequest(t, h, http.MethodPost, "/update/counter/jobs/1", "", "")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "2" {
+		t.Errorf("Expected 429 with Retry-After: 2, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	w = doRequest(t, h, http.MethodPost, "/write", "", "", "cpu load=1,idle=2")
+	if w.Code != http.StatusTooManyRequests || !strings.Contains(w.Body.String(), "write rate") {
+		t.Errorf("Expected 429 for influx write, got %d %q", w.Code, w.Body)
+	}
+	if v, ok := s.storage.Counter("jobs", nil); !ok || v != 2 {
+		t.Errorf("Expected only 2 accepted writes, got %d", v)
+	}
+	if body := doTenantRequest(t, h, http.MethodGet, "/debug/metrics", "", "").Body.String(); !strings.Contains(body, `server_rejected_writes_total{reason="write_rate"} 2`) {
+		t.Errorf("Expected write_rate rejections in self-metrics:\n%s", body)
+	}
+}
+
+func TestSeriesLimitKeepsCumulativeState(t *testing.T) {
+	s := NewServer(NewMetricsStorage(), &ServerConfig{
+		InfluxCounterSuffixes: defaultInfluxCounterSuffixes,
+		MaxSeries:             1,
+	})
+	h := s.Router()
+	otlpBody, err := os.ReadFile("../../internal/otlp/testdata/metrics.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w := doTenantRequest(t, h, http.MethodPost, "/update/gauge/a/1", "", ""); w.Code != http.StatusOK {
+		t.Fatalf("Expected first series to be accepted, got %d", w.Code)
+	}
+	// Лимит серий исчерпан: записи отклоняются целиком и не сдвигают накопленные значения
+	if w := doRequest(t, h, http.MethodPost, "/write", "", "", "http,host=web1 requests_total=10i"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 for influx write over series limit, got %d %q", w.Code, w.Body)
+	}
+	if w := doRequest(t, h, http.MethodPost, "/v1/metrics", "", otlp.ContentTypeJSON, string(otlpBody)); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 when no OTLP point is accepted, got %d %q", w.Code, w.Body)
+	}
+
+	s.config.MaxSeries = 0
+	if w := doRequest(t, h, http.MethodPost, "/write", "", "", "http,host=web1 requests_total=15i"); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected influx write to pass, got %d %q", w.Code, w.Body)
+	}
+	if v, _ := s.storage.Counter("http_requests_total", models.Labels{"host": "web1"}); v != 15 {
+		t.Errorf("Rejected influx write must not move the baseline: expected 15, got %d", v)
+	}
+	if w := doRequest(t, h, http.MethodPost, "/v1/metrics", "", otlp.ContentTypeJSON, string(otlpBody)); w.Code != http.StatusOK {
+		t.Fatalf("Expected OTLP write to pass, got %d %q", w.Code, w.Body)
+	}
+	labels := models.Labels{"service_name": "checkout", "host_name": "web1", "process_pid": "4242", "http_method": "GET"}
+	if v, _ := s.storage.Counter("http_server_requests", labels); v != 42 {
+		t.Errorf("Rejected OTLP write must not move the baseline: expected 42, got %d", v)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
+
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/logger"
+)
+
+// requestLogFormatter — журнал запросов в zerolog с именем токена API и арендатором.
+// Идентификатор запроса приходит из логгера контекста (logger.WithRequestID).
+type requestLogFormatter struct{}
+
+func (requestLogFormatter) NewLogEntry(r *http.Request) middleware.LogEntry {
+	return &requestLogEntry{
+		logger: logger.FromContext(r.Context()),
+		method: r.Method,
+		uri:    r.RequestURI,
+		proto:  r.Proto,
+		remote: r.RemoteAddr,
+	}
+}
+
+// requestLogEntry — запись журнала одного запроса. Имя токена сообщает auth.Require,
+// арендатора — tenantMiddleware.
+type requestLogEntry struct {
+	logger                     *zerolog.Logger
+	method, uri, proto, remote string
+	token                      string
+	tenant                     string
+}
+
+// SetToken реализует auth.TokenLogger
+func (e *requestLogEntry) SetToken(name string) {
+	e.token = name
+}
+
+// SetTenant реализует TenantLogger
+func (e *requestLogEntry) SetTenant(id string) {
+	e.tenant = id
+}
+
+func (e *requestLogEntry) Write(status, bytes int, _ http.Header, elapsed time.Duration, _ interface{}) {
+	ev := e.logger.Info().
+		Str("method", e.method).
+		Str("uri", e.uri).
+		Str("proto", e.proto).
+		Str("remote", e.remote)
+	if e.token != "" {
+		ev = ev.Str("token", e.token)
+	}
+	if e.tenant != "" {
+		ev = ev.Str("tenant", e.tenant)
+	}
+	ev.Int("status", status).
+		Int("bytes", bytes).
+		Dur("duration", elapsed).
+		Msg("request handled")
+}
+
+func (e *requestLogEntry) Panic(v interface{}, stack []byte) {
+	e.logger.Error().Interface("panic", v).Bytes("stack", stack).Msg("request panicked")
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func TestRequestLogLevels(t *testing.T) {
+	var buf bytes.Buffer
+	orig := log.Logger
+	defer func() { log.Logger = orig }()
+
+	h := newTestServer().Router()
+	update := func() {
+		req := httptest.NewRequest(http.MethodPost, "/update/gauge/load/1", nil)
+		req.Header.Set("X-Request-Id", "req-42")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	log.Logger = zerolog.New(&buf).Level(zerolog.InfoLevel)
+	update()
+	if !strings.Contains(buf.String(), `"request_id":"req-42"`) {
+		t.Errorf("Expected request id in request log, got %q", buf.String())
+	}
+	if strings.Contains(buf.String(), "updated gauge") {
+		t.Errorf("Per-update log must be debug only, got %q", buf.String())
+	}
+
+	buf.Reset()
+	log.Logger = zerolog.New(&buf).Level(zerolog.DebugLevel)
+	update()
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "updated gauge") {
+		t.Fatalf("Expected update and request lines at debug, got %q", buf.String())
+	}
+	for _, line := range lines {
+		if !strings.Contains(line, `"request_id":"req-42"`) {
+			t.Errorf("Expected request id in %q", line)
+		}
+	}
+}
@@ -1,36 +1,43 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"html/template"
 	"io/ioutil"
-	"log"
+	"net"
 	"net/http"
+	"net/http/pprof"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/caarlos0/env/v6"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/auth"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/cumulative"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/graphite"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/health"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/influx"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/logger"
 	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/middleware_proj"
-)
-
-type ServerConfig struct {
-	Address       string `env:"ADDRESS"`
-	StoreInterval time.Duration
-	FileStorage   string
-	Restore       bool
-}
-
-const (
-	defaultStoreInterval = 300 * time.Second
-	defaultFileStorage   = "metrics.json"
-	defaultRestore       = false
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/otlp"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/ratelimit"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/sketch"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/statsd"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/telemetry"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/tlsutil"
+	"github.com/rs/zerolog/log"
 )
 
 const (
@@ -40,36 +47,57 @@ const (
 	configPath            = "internal/config/agent.yaml"
 )
 
-type Metrics struct {
-	ID    string   `json:"id"`              // имя метрики
-	MType string   `json:"type"`            // параметр, принимающий значение gauge или counter
-	Delta *int64   `json:"delta,omitempty"` // значение метрики в случае передачи counter
-	Value *float64 `json:"value,omitempty"` // значение метрики в случае передачи gauge
-}
+type Server struct {
+	storage   *MetricsStorage
+	config    *ServerConfig
+	telemetry *telemetry.Registry
 
-type MetricsStorage struct {
-	gauges   map[string]float64
-	counters map[string]int64
-	mu       sync.RWMutex
-}
+	// cumulative переводит накопленные значения счётчиков (Influx, OTLP) в приращения
+	cumulative    *cumulative.Converter
+	influxOptions influx.Options
+	otlpOptions   otlp.Options
 
-func NewMetricsStorage() *MetricsStorage {
-	return &MetricsStorage{
-		gauges:   make(map[string]float64),
-		counters: make(map[string]int64),
-	}
-}
+	// Пространства арендаторов; default — storage и cumulative выше
+	tenants *tenantStore
 
-type Server struct {
-	storage *MetricsStorage
-	config  *ServerConfig
+	// Ограничения записи: seriesMu сериализует создание новых серий при лимитах
+	seriesMu     sync.Mutex
+	writeLimiter *ratelimit.Limiter
+
+	// Ограничение частоты запросов записи и чтения
+	writeRequests *ratelimit.Limiter
+	readRequests  *ratelimit.Limiter
+
+	// Остановка подсистем по сигналу
+	lifecycle *lifecycle
+
+	// Проверки /livez, /readyz и /healthz; started — все подсистемы запущены
+	health  *health.Registry
+	started atomic.Bool
 }
 
 func NewServer(storage *MetricsStorage, config *ServerConfig) *Server {
-	return &Server{
-		storage: storage,
-		config:  config,
+	cum := cumulative.NewConverter()
+	s := &Server{
+		storage:    storage,
+		config:     config,
+		telemetry:  telemetry.NewRegistry(),
+		cumulative: cum,
+		influxOptions: influx.Options{
+			CounterSuffixes: splitList(config.InfluxCounterSuffixes),
+		},
+		otlpOptions: otlp.Options{Histograms: config.OTLPHistograms},
 	}
+	s.lifecycle = newLifecycle(config.ShutdownTimeout, config.ShutdownDelay)
+	s.health = health.NewRegistry()
+	s.registerHealthChecks()
+	s.writeLimiter = ratelimit.New(config.MaxWritesPerSecond, config.WriteBurst)
+	s.writeRequests = ratelimit.New(config.RateLimitWrites, config.RateLimitBurst)
+	s.readRequests = ratelimit.New(config.RateLimitReads, config.RateLimitBurst)
+	s.tenants = newTenantStore(&tenantSpace{storage: storage, cumulative: cum, otlp: otlp.NewConverter(s.otlpOptions, cum)},
+		s.otlpOptions, s.telemetry, splitList(config.Tenants), config.MaxTenants)
+	s.telemetry.OnCollect(s.collectStorageStats)
+	return s
 }
 
 func loadServerConfig() (*ServerConfig, error) {
@@ -105,32 +133,32 @@ func (s *Server) updateMetricJSONHandler(w http.ResponseWriter, r *http.Request)
 	}
 	defer r.Body.Close()
 
-	var m Metrics
+	var m models.Metrics
 	if err := json.Unmarshal(body, &m); err != nil {
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
-	if m.ID == "" || (m.MType != "gauge" && m.MType != "counter") {
+	if m.ID == "" || !models.ValidType(m.MType) {
 		http.Error(w, "invalid metric id or type", http.StatusBadRequest)
 		return
 	}
+	if err := auth.CanWrite(r.Context(), m.ID); err != nil {
+		auth.WriteError(w, http.StatusForbidden, err.Error())
+		return
+	}
 
-	s.storage.mu.Lock()
-	defer s.storage.mu.Unlock()
-
-	switch m.MType {
-	case "gauge":
-		if m.Value == nil {
-			http.Error(w, "missing value for gauge", http.StatusBadRequest)
-			return
-		}
-		s.storage.gauges[m.ID] = *m.Value
-	case "counter":
-		if m.Delta == nil {
-			http.Error(w, "missing delta for counter", http.StatusBadRequest)
-			return
-		}
-		s.storage.counters[m.ID] += *m.Delta
+	// Квота расходуется только на метрики, прошедшие проверку
+	if err := s.validateMetric(m); err != nil {
+		writeLimitError(w, err)
+		return
+	}
+	if err := s.admitWrites(r, 1); err != nil {
+		writeLimitError(w, err)
+		return
+	}
+	if err := s.WriteMetricContext(r.Context(), m); err != nil {
+		writeLimitError(w, err)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -139,6 +167,7 @@ func (s *Server) updateMetricJSONHandler(w http.ResponseWriter, r *http.Request)
 }
 
 func (s *Server) valueMetricJSONHandler(w http.ResponseWriter, r *http.Request) {
+	st := s.storageFor(r)
 	if r.Header.Get("Content-Type") != "application/json" {
 		http.Error(w, "Content-Type must be application/json", http.StatusBadRequest)
 		return
@@ -150,37 +179,48 @@ func (s *Server) valueMetricJSONHandler(w http.ResponseWriter, r *http.Request)
 	}
 	defer r.Body.Close()
 
-	var req Metrics
+	var req models.Metrics
 	if err := json.Unmarshal(body, &req); err != nil {
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
 
-	if req.ID == "" || (req.MType != "gauge" && req.MType != "counter") {
+	if req.ID == "" || !models.ValidType(req.MType) {
 		http.Error(w, "invalid metric id or type", http.StatusBadRequest)
 		return
 	}
 
-	s.storage.mu.RLock()
-	defer s.storage.mu.RUnlock()
-
-	resp := Metrics{ID: req.ID, MType: req.MType}
+	resp := models.Metrics{ID: req.ID, MType: req.MType, Labels: req.Labels}
 
 	switch req.MType {
-	case "gauge":
-		val, ok := s.storage.gauges[req.ID]
+	case models.Gauge:
+		val, ok := st.Gauge(req.ID, req.Labels)
 		if !ok {
 			http.Error(w, "metric not found", http.StatusNotFound)
 			return
 		}
 		resp.Value = &val
-	case "counter":
-		val, ok := s.storage.counters[req.ID]
+	case models.Counter:
+		val, ok := st.Counter(req.ID, req.Labels)
 		if !ok {
 			http.Error(w, "metric not found", http.StatusNotFound)
 			return
 		}
 		resp.Delta = &val
+	case models.Histogram:
+		h, ok := st.Histogram(req.ID, req.Labels)
+		if !ok {
+			http.Error(w, "metric not found", http.StatusNotFound)
+			return
+		}
+		resp.Histogram = h
+	case models.Summary:
+		sk, ok := st.Summary(req.ID, req.Labels)
+		if !ok {
+			http.Error(w, "metric not found", http.StatusNotFound)
+			return
+		}
+		resp.Sketch = sk
 	}
 
 	jsonResp, err := json.Marshal(resp)
@@ -197,20 +237,54 @@ func (s *Server) valueMetricJSONHandler(w http.ResponseWriter, r *http.Request)
 func (s *Server) Router() http.Handler {
 	r := chi.NewRouter()
 
-	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
 	r.Use(middleware.RequestID)
+	r.Use(logger.WithRequestID)
+	r.Use(middleware.RequestLogger(requestLogFormatter{}))
+	r.Use(s.instrument)
+	r.Use(middleware.Recoverer)
 	r.Use(middleware_proj.GzipMiddleware)
 
-	r.Post("/update", s.updateMetricJSONHandler)
-	r.Post("/value", s.valueMetricJSONHandler)
-	r.Post("/update/*", s.updateHandler)
-	r.Post("/update/{type}/{name}/{value}", s.updateHandlerChi)
-	r.Get("/value/{type}/{name}", s.valueHandler)
-	r.Get("/", s.rootHandler)
-
-	r.Post("/update", s.updateMetricJSONHandler)
-	r.Post("/value", s.valueMetricJSONHandler)
+	// Проверки состояния для оркестратора доступны без токена
+	r.Method(http.MethodGet, "/livez", s.health.Handler(health.Liveness))
+	r.Method(http.MethodGet, "/readyz", s.health.Handler(health.Readiness))
+	r.Method(http.MethodGet, "/healthz", s.health.Handler(health.Liveness|health.Readiness))
+
+	// Права токенов: запись, чтение и администрирование. Без токенов проверка выключена.
+	r.Group(func(r chi.Router) {
+		r.Use(auth.Require(s.config.Auth, auth.ScopeWrite))
+		r.Use(s.tenantMiddleware)
+		r.Use(s.rateLimit("write", s.writeRequests))
+		r.Post("/update", s.updateMetricJSONHandler)
+		r.Post("/update/*", s.updateHandler)
+		r.Post("/update/{type}/{name}/{value}", s.updateHandlerChi)
+		r.Post("/write", s.influxWriteHandler)
+		r.Post("/v1/metrics", s.otlpMetricsHandler)
+	})
+	r.Group(func(r chi.Router) {
+		r.Use(auth.Require(s.config.Auth, auth.ScopeRead))
+		r.Use(s.tenantMiddleware)
+		r.Use(s.knownTenant)
+		r.Use(s.rateLimit("read", s.readRequests))
+		r.Post("/value", s.valueMetricJSONHandler)
+		r.Get("/value/{type}/{name}", s.valueHandler)
+		r.Get("/query", s.queryHandler)
+		r.Get("/quantile", s.quantileHandler)
+		r.Get("/metrics", s.prometheusHandler)
+		r.Get("/", s.rootHandler)
+	})
+	r.Group(func(r chi.Router) {
+		r.Use(auth.Require(s.config.Auth, auth.ScopeAdmin))
+		r.Method(http.MethodGet, "/debug/metrics", s.telemetry.Handler())
+		r.Get("/admin/tenants", s.tenantsHandler)
+		// Профилирование раскрывает командную строку и нагружает процесс: только по -pprof
+		if s.config.Pprof {
+			r.HandleFunc("/debug/pprof/*", pprof.Index)
+			r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+			r.HandleFunc("/debug/pprof/profile", pprof.Profile)
+			r.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+			r.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		}
+	})
 
 	return r
 }
@@ -225,7 +299,7 @@ func (s *Server) updateHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.updateMetric(w, parts[0], parts[1], parts[2])
+	s.updateMetric(w, r, parts[0], parts[1], parts[2])
 }
 
 func (s *Server) updateHandlerChi(w http.ResponseWriter, r *http.Request) {
@@ -233,31 +307,38 @@ func (s *Server) updateHandlerChi(w http.ResponseWriter, r *http.Request) {
 	metricName := chi.URLParam(r, "name")
 	metricValue := chi.URLParam(r, "value")
 
-	s.updateMetric(w, metricType, metricName, metricValue)
+	s.updateMetric(w, r, metricType, metricName, metricValue)
 }
 
-func (s *Server) updateMetric(w http.ResponseWriter, metricType, metricName, metricValue string) {
-	s.storage.mu.Lock()
-	defer s.storage.mu.Unlock()
+func (s *Server) updateMetric(w http.ResponseWriter, r *http.Request, metricType, metricName, metricValue string) {
+	if err := auth.CanWrite(r.Context(), metricName); err != nil {
+		auth.WriteError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	m := models.Metrics{ID: metricName, MType: metricType}
 
 	switch metricType {
-	case "gauge":
+	case models.Gauge:
 		value, err := strconv.ParseFloat(metricValue, 64)
 		if err != nil {
 			http.Error(w, "Invalid gauge value", http.StatusBadRequest)
 			return
 		}
-		s.storage.gauges[metricName] = value
-		log.Printf("Updated gauge %s = %.6f", metricName, value)
+		m.Value = &value
 
-	case "counter":
+	case models.Counter:
 		value, err := strconv.ParseInt(metricValue, 10, 64)
 		if err != nil {
 			http.Error(w, "Invalid counter value", http.StatusBadRequest)
 			return
 		}
-		s.storage.counters[metricName] += value
-		log.Printf("Updated counter %s = %d (added %d)", metricName, s.storage.counters[metricName], value)
+		m.Delta = &value
+
+	case models.Histogram, models.Summary:
+		http.Error(w, "Histogram and summary metrics must be sent as JSON to /update",
+			http.StatusBadRequest)
+		return
 
 	default:
 		http.Error(w, "Unknown metric type. Use 'gauge' or 'counter'",
@@ -265,6 +346,20 @@ func (s *Server) updateMetric(w http.ResponseWriter, metricType, metricName, met
 		return
 	}
 
+	// Квота расходуется только на метрики, прошедшие проверку
+	if err := s.validateMetric(m); err != nil {
+		writeLimitError(w, err)
+		return
+	}
+	if err := s.admitWrites(r, 1); err != nil {
+		writeLimitError(w, err)
+		return
+	}
+	if err := s.WriteMetricContext(r.Context(), m); err != nil {
+		writeLimitError(w, err)
+		return
+	}
+
 	responseText := "OK\n"
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.Header().Set("Content-Length", strconv.Itoa(len(responseText)))
@@ -272,18 +367,128 @@ func (s *Server) updateMetric(w http.ResponseWriter, metricType, metricName, met
 	fmt.Fprint(w, responseText)
 }
 
+// WriteMetric — общий путь записи метрики в хранилище для всех входящих протоколов.
+// Пишет в арендатора default: у StatsD и Graphite арендатора нет.
+func (s *Server) WriteMetric(m models.Metrics) error {
+	return s.writeMetric(context.Background(), s.storage, m)
+}
+
+// WriteMetricContext записывает метрику в пространство арендатора запроса
+func (s *Server) WriteMetricContext(ctx context.Context, m models.Metrics) error {
+	sp, err := s.writeSpace(ctx)
+	if err != nil {
+		return err
+	}
+	return s.writeMetric(ctx, sp.storage, m)
+}
+
+// validateMetric проверяет метрику до расхода квоты записи: имя, метки, тип
+// и наличие значения
+func (s *Server) validateMetric(m models.Metrics) error {
+	if m.ID == "" {
+		return errors.New("missing metric id")
+	}
+	if err := m.Labels.Validate(); err != nil {
+		return err
+	}
+	if err := s.checkName(m.ID); err != nil {
+		return err
+	}
+
+	switch m.MType {
+	case models.Gauge:
+		if m.Value == nil {
+			return errors.New("missing value for gauge")
+		}
+	case models.Counter:
+		if m.Delta == nil {
+			return errors.New("missing delta for counter")
+		}
+	case models.Histogram:
+		if m.Histogram == nil {
+			return errors.New("missing histogram for histogram")
+		}
+		return m.Histogram.Validate()
+	case models.Summary:
+		if m.Sketch == nil {
+			return errors.New("missing sketch for summary")
+		}
+		return m.Sketch.Validate()
+	default:
+		return fmt.Errorf("unknown metric type %q", m.MType)
+	}
+	return nil
+}
+
+// writeMetric проверяет и записывает метрику в st; каждая запись журналируется
+// на уровне debug логгером контекста (с идентификатором запроса)
+func (s *Server) writeMetric(ctx context.Context, st *MetricsStorage, m models.Metrics) error {
+	if err := s.validateMetric(m); err != nil {
+		return err
+	}
+	return s.writeSeries(ctx, st, []models.Metrics{m}, nil)
+}
+
+// writeSeries допускает новые серии metrics в st и записывает их. convert, если задан,
+// вызывается после допуска и возвращает записываемые метрики тех же серий: так
+// отклонённая лимитом запись не сдвигает накопленное состояние (cumulative).
+func (s *Server) writeSeries(ctx context.Context, st *MetricsStorage, metrics []models.Metrics, convert func() []models.Metrics) error {
+	if s.seriesLimited() {
+		if n := newSeries(st, metrics); n > 0 {
+			s.seriesMu.Lock()
+			defer s.seriesMu.Unlock()
+			if err := s.admitSeries(st, n); err != nil {
+				return err
+			}
+		}
+	}
+	if convert != nil {
+		metrics = convert()
+	}
+	for _, m := range metrics {
+		if err := s.storeMetric(ctx, st, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storeMetric записывает проверенную метрику в st
+func (s *Server) storeMetric(ctx context.Context, st *MetricsStorage, m models.Metrics) error {
+	switch m.MType {
+	case models.Gauge:
+		st.SetGauge(m.ID, m.Labels, *m.Value)
+		logger.FromContext(ctx).Debug().Str("metric", m.Key()).Float64("value", *m.Value).Msg("updated gauge")
+
+	case models.Counter:
+		total := st.AddCounter(m.ID, m.Labels, *m.Delta)
+		logger.FromContext(ctx).Debug().Str("metric", m.Key()).Int64("value", total).Int64("delta", *m.Delta).Msg("updated counter")
+
+	case models.Histogram:
+		if err := st.MergeHistogram(m.ID, m.Labels, m.Histogram); err != nil {
+			return err
+		}
+		logger.FromContext(ctx).Debug().Str("metric", m.Key()).Uint64("observations", m.Histogram.Count).Msg("merged histogram")
+
+	case models.Summary:
+		if err := st.MergeSummary(m.ID, m.Labels, m.Sketch); err != nil {
+			return err
+		}
+		logger.FromContext(ctx).Debug().Str("metric", m.Key()).Uint64("observations", m.Sketch.Count).Msg("merged summary")
+	}
+	return nil
+}
+
 func (s *Server) valueHandler(w http.ResponseWriter, r *http.Request) {
+	st := s.storageFor(r)
 	metricType := chi.URLParam(r, "type")
 	metricName := chi.URLParam(r, "name")
 
-	s.storage.mu.RLock()
-	defer s.storage.mu.RUnlock()
-
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 
 	switch metricType {
-	case "gauge":
-		value, exists := s.storage.gauges[metricName]
+	case models.Gauge:
+		value, exists := st.Gauge(metricName, nil)
 		if !exists {
 			http.Error(w, "Metric not found", http.StatusNotFound)
 			return
@@ -291,8 +496,8 @@ func (s *Server) valueHandler(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintf(w, "%g", value)
 
-	case "counter":
-		value, exists := s.storage.counters[metricName]
+	case models.Counter:
+		value, exists := st.Counter(metricName, nil)
 		if !exists {
 			http.Error(w, "Metric not found", http.StatusNotFound)
 			return
@@ -300,25 +505,83 @@ func (s *Server) valueHandler(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintf(w, "%d", value)
 
+	case models.Histogram, models.Summary:
+		// Без параметра q возвращается число наблюдений, с ним — оценка квантиля
+		var d distribution
+		var ok bool
+		if metricType == models.Histogram {
+			d.hist, ok = st.Histogram(metricName, nil)
+		} else {
+			d.sketch, ok = st.Summary(metricName, nil)
+		}
+		if !ok {
+			http.Error(w, "Metric not found", http.StatusNotFound)
+			return
+		}
+		qs := r.URL.Query().Get("q")
+		if qs == "" {
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprintf(w, "%d", d.count())
+			return
+		}
+		q, err := strconv.ParseFloat(qs, 64)
+		if err != nil {
+			http.Error(w, "Invalid quantile", http.StatusBadRequest)
+			return
+		}
+		value, err := d.quantile(q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "%g", value)
+
 	default:
 		http.Error(w, "Unknown metric type. Use 'gauge' or 'counter'", http.StatusBadRequest)
 	}
 }
 
-func (s *Server) rootHandler(w http.ResponseWriter, r *http.Request) {
-	// Создаем копии для безопасной работы с шаблоном
-	gaugesCopy := make(map[string]float64)
-	countersCopy := make(map[string]int64)
+// queryHandler возвращает серии, отобранные по типу, имени и матчерам меток:
+// GET /query?type=gauge&name=HeapAlloc&match=host=web1,env=~prod.*
+func (s *Server) queryHandler(w http.ResponseWriter, r *http.Request) {
+	st := s.storageFor(r)
+	q := r.URL.Query()
+
+	metricType := q.Get("type")
+	if metricType != "" && !models.ValidType(metricType) {
+		http.Error(w, "Unknown metric type", http.StatusBadRequest)
+		return
+	}
+
+	matchers, err := models.ParseMatchers(q.Get("match"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	// Блокируем только на время копирования
-	s.storage.mu.RLock()
-	for k, v := range s.storage.gauges {
-		gaugesCopy[k] = v
+	result := st.Select(metricType, q.Get("name"), matchers)
+	if result == nil {
+		result = []models.Metrics{}
 	}
-	for k, v := range s.storage.counters {
-		countersCopy[k] = v
+
+	jsonResp, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, "failed to marshal response", http.StatusInternalServerError)
+		return
 	}
-	s.storage.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResp)
+}
+
+func (s *Server) rootHandler(w http.ResponseWriter, r *http.Request) {
+	st := s.storageFor(r)
+	// Создаем копии для безопасной работы с шаблоном
+	gaugesCopy, countersCopy := st.Snapshot()
+	histograms := st.Select(models.Histogram, "", nil)
+	summaries := st.Select(models.Summary, "", nil)
 
 	tmpl := `<!DOCTYPE html>
 <html>
@@ -391,12 +654,40 @@ func (s *Server) rootHandler(w http.ResponseWriter, r *http.Request) {
             <tr><td colspan="2" style="text-align: center; color: #666;">No counters available</td></tr>
             {{end}}
         </table>
+
+        <h2>Histograms <span class="count">({{len .Histograms}})</span></h2>
+        <table>
+            <tr><th>Name</th><th>Count</th><th>Sum</th><th>Buckets (le: count)</th></tr>
+            {{range .Histograms}}
+            <tr><td><strong>{{.Key}}</strong></td><td>{{.Histogram.Count}}</td><td>{{printf "%.6f" .Histogram.Sum}}</td>
+                <td>{{$h := .Histogram}}{{range $i, $b := $h.Bounds}}{{$b}}: {{index $h.Counts $i}}; {{end}}+Inf: {{index $h.Counts (len $h.Bounds)}}</td></tr>
+            {{else}}
+            <tr><td colspan="4" style="text-align: center; color: #666;">No histograms available</td></tr>
+            {{end}}
+        </table>
+
+        <h2>Summaries <span class="count">({{len .Summaries}})</span></h2>
+        <table>
+            <tr><th>Name</th><th>Count</th><th>p50</th><th>p95</th><th>p99</th></tr>
+            {{range .Summaries}}
+            <tr><td><strong>{{.Key}}</strong></td><td>{{.Sketch.Count}}</td>
+                <td>{{quantile .Sketch 0.5}}</td><td>{{quantile .Sketch 0.95}}</td><td>{{quantile .Sketch 0.99}}</td></tr>
+            {{else}}
+            <tr><td colspan="5" style="text-align: center; color: #666;">No summaries available</td></tr>
+            {{end}}
+        </table>
         
         <div style="margin-top: 30px; padding: 15px; background-color: #e7f3ff; border-left: 4px solid #2196F3;">
             <h3>API Endpoints:</h3>
             <ul>
                 <li><code>POST /update/{type}/{name}/{value}</code> - Update metric</li>
                 <li><code>GET /value/{type}/{name}</code> - Get metric value</li>
+                <li><code>GET /query?type=&amp;name=&amp;match=label=value,...</code> - Query series by labels</li>
+                <li><code>GET /quantile?type=summary&amp;name=&amp;match=&amp;q=0.5,0.95,0.99</code> - Quantiles across matched series</li>
+                <li><code>GET /metrics</code> - Prometheus exposition</li>
+                <li><code>GET /debug/metrics</code> - Server self-metrics</li>
+                <li><code>POST /write</code> - InfluxDB line protocol</li>
+                <li><code>POST /v1/metrics</code> - OTLP/HTTP metrics (protobuf or JSON)</li>
                 <li><code>GET /</code> - This dashboard</li>
             </ul>
         </div>
@@ -404,34 +695,49 @@ func (s *Server) rootHandler(w http.ResponseWriter, r *http.Request) {
 </body>
 </html>`
 
-	t, err := template.New("metrics").Parse(tmpl)
+	funcs := template.FuncMap{
+		"quantile": func(sk *sketch.DDSketch, q float64) string {
+			v, err := sk.Quantile(q)
+			if err != nil {
+				return "-"
+			}
+			return strconv.FormatFloat(v, 'f', 6, 64)
+		},
+	}
+
+	t, err := template.New("metrics").Funcs(funcs).Parse(tmpl)
 	if err != nil {
 		http.Error(w, "Template error", http.StatusInternalServerError)
-		log.Printf("Template parse error: %v", err)
+		logger.FromContext(r.Context()).Error().Err(err).Msg("template parse error")
 		return
 	}
 
 	data := struct {
-		Gauges   map[string]float64
-		Counters map[string]int64
+		Gauges     map[string]float64
+		Counters   map[string]int64
+		Histograms []models.Metrics
+		Summaries  []models.Metrics
 	}{
-		Gauges:   gaugesCopy,
-		Counters: countersCopy,
+		Gauges:     gaugesCopy,
+		Counters:   countersCopy,
+		Histograms: histograms,
+		Summaries:  summaries,
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 
 	if err := t.Execute(w, data); err != nil {
-		log.Printf("Template execution error: %v", err)
+		logger.FromContext(r.Context()).Error().Err(err).Msg("template execution error")
 	}
 }
 
 func main() {
-	if err := run(); err != nil {
-		log.Printf("Server error: %v", err)
-		os.Exit(1)
+	err := run()
+	if err != nil {
+		log.Error().Err(err).Msg("server error")
 	}
+	os.Exit(exitCode(err))
 }
 
 func run() error {
@@ -439,31 +745,132 @@ func run() error {
 	if err != nil {
 		return fmt.Errorf("parsing flags: %w", err)
 	}
+	l, err := logger.New(config.Logging)
+	if err != nil {
+		return fmt.Errorf("logger: %w", err)
+	}
+	logger.SetDefault(l)
 
-	// Создаем зависимости
-	storage := NewMetricsStorage()
-	server := NewServer(storage, config)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	return serve(ctx, NewServer(NewMetricsStorage(), config), nil)
+}
 
-	log.Printf("Starting metrics server on %s", config.Address)
-	if err := http.ListenAndServe(config.Address, server.Router()); err != nil {
+// serve запускает приёмники и HTTP сервер и работает до отмены ctx, затем
+// останавливает их через s.lifecycle. started, если задан, получает адрес HTTP сервера.
+func serve(ctx context.Context, server *Server, started func(addr net.Addr)) error {
+	config := server.config
+	lc := server.lifecycle
+
+	ln, err := net.Listen("tcp", config.Address)
+	if err != nil {
 		return fmt.Errorf("server failed to start: %w", err)
 	}
+	// fail останавливает уже запущенное, если запуск не удался
+	fail := func(err error) error {
+		lc.shutdown()
+		ln.Close()
+		return err
+	}
 
-	return nil
-}
+	httpServer := &http.Server{Handler: server.Router()}
+	if config.TLSCert != "" {
+		tlsConfig, err := tlsutil.ServerConfig(config.TLSCert, config.TLSKey, config.TLSClientCA)
+		if err != nil {
+			return fail(fmt.Errorf("tls: %w", err))
+		}
+		httpServer.TLSConfig = tlsConfig
+	}
 
-func parseServerFlags() (*ServerConfig, error) {
-	config := &ServerConfig{}
+	// HTTP останавливается первым: новые соединения не принимаются,
+	// начатые запросы дописывают метрики до дедлайна
+	lc.onShutdown("http server", func(ctx context.Context) error {
+		if err := httpServer.Shutdown(ctx); err != nil {
+			httpServer.Close()
+			return err
+		}
+		return nil
+	})
+
+	if config.StatsDAddress != "" {
+		listener := statsd.NewListener(config.StatsDAddress, config.StatsDFlushInterval, server, server.telemetry)
+		listener.SetGaugeExpiry(config.StatsDGaugeExpiry)
+		if err := listener.Listen(); err != nil {
+			return fail(fmt.Errorf("statsd listener: %w", err))
+		}
+		log.Info().Stringer("addr", listener.Addr()).Dur("flush_interval", config.StatsDFlushInterval).Msg("listening for statsd")
+		server.health.Add("statsd listener", health.Readiness, runningCheck(lc.serveUntil("statsd listener", listener.Serve)))
+	}
 
-	flag.StringVar(&config.Address, "a", "localhost:8080", "HTTP server endpoint address")
-	flag.Parse()
+	if config.GraphiteAddress != "" {
+		mapper, err := graphite.NewMapper(splitTemplates(config.GraphiteTemplates), config.GraphiteSeparator)
+		if err != nil {
+			return fail(fmt.Errorf("graphite templates: %w", err))
+		}
+		listener := graphite.NewListener(graphite.Config{
+			Addr:        config.GraphiteAddress,
+			MaxConns:    config.GraphiteMaxConns,
+			IdleTimeout: config.GraphiteIdleTimeout,
+		}, mapper, server, server.telemetry)
+		if err := listener.Listen(); err != nil {
+			return fail(fmt.Errorf("graphite listener: %w", err))
+		}
+		log.Info().Stringer("addr", listener.Addr()).Msg("listening for graphite")
+		server.health.Add("graphite listener", health.Readiness, runningCheck(lc.serveUntil("graphite listener", listener.Serve)))
+	}
 
-	if flag.NArg() > 0 {
-		fmt.Fprintf(os.Stderr, "Error: unknown arguments: %v\n", flag.Args())
-		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n", os.Args[0])
-		flag.PrintDefaults()
-		return nil, fmt.Errorf("unknown arguments provided")
+	// Заполнившиеся bucket ограничителей частоты удаляются, чтобы карты не росли
+	lc.serveUntil("rate limiter gc", func(ctx context.Context) error {
+		var wg sync.WaitGroup
+		for _, l := range []*ratelimit.Limiter{server.writeLimiter, server.writeRequests, server.readRequests} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				l.RunGC(ctx, config.RateLimitGC)
+			}()
+		}
+		wg.Wait()
+		return nil
+	})
+
+	// Хранилище в памяти: сохранять на диск нечего, фиксируется итоговое число серий
+	lc.onShutdown("storage", func(ctx context.Context) error {
+		log.Info().Int("series", server.tenants.seriesCount()).Int("tenants", len(server.tenants.list())).Msg("storage closed")
+		return nil
+	})
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if config.TLSCert != "" {
+			log.Info().Stringer("addr", ln.Addr()).Bool("tls", true).Bool("client_certs", config.TLSClientCA != "").
+				Msg("starting metrics server")
+			serveErr <- httpServer.ServeTLS(ln, "", "")
+			return
+		}
+		log.Info().Stringer("addr", ln.Addr()).Msg("starting metrics server")
+		serveErr <- httpServer.Serve(ln)
+	}()
+	if config.Pprof && config.Auth.Len() == 0 {
+		log.Warn().Msg("pprof is enabled without API tokens: /debug/pprof is open to everyone")
+	}
+	// Восстановления с диска нет: сервер готов, как только запущены все подсистемы
+	server.started.Store(true)
+	if started != nil {
+		started(ln.Addr())
+	}
+
+	select {
+	case err := <-serveErr:
+		lc.shutdown()
+		return fmt.Errorf("server failed: %w", err)
+	case <-ctx.Done():
 	}
 
-	return config, nil
+	log.Info().Dur("timeout", config.ShutdownTimeout).Msg("received shutdown signal, draining requests")
+	lc.drain()
+	if err := lc.shutdown(); err != nil {
+		return err
+	}
+	log.Info().Msg("server stopped gracefully")
+	return nil
 }
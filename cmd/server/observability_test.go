@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestServerObservability(t *testing.T) {
+	s := newAuthTestServer(t)
+	h := s.Router()
+
+	for _, path := range []string{"/update/gauge/ci_load/1", "/update/counter/ci_jobs/2", "/update/gauge/ci_load/3"} {
+		if w := doRequest(t, h, http.MethodPost, path, "ci-secret", "", ""); w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", path, w.Code)
+		}
+	}
+	doRequest(t, h, http.MethodGet, "/value/gauge/missing", "ro-secret", "", "")
+
+	w := doRequest(t, h, http.MethodGet, "/debug/metrics", "admin-secret", "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 from /debug/metrics, got %d", w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		`server_http_requests_total{method="POST",route="/update/{type}/{name}/{value}",status="200"} 3`,
+		`server_http_requests_total{method="GET",route="/value/{type}/{name}",status="404"} 1`,
+		`server_http_request_duration_seconds_count{method="POST",route="/update/{type}/{name}/{value}"} 3`,
+		`server_storage_series{tenant="default",type="gauge"} 1`,
+		`server_storage_series{tenant="default",type="counter"} 1`,
+		`server_tenants 1`,
+		`server_storage_lock_wait_seconds_count{mode="write"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %q in self-metrics:\n%s", want, body)
+		}
+	}
+}
+
+func TestPprofRequiresFlagAndAdmin(t *testing.T) {
+	s := newAuthTestServer(t)
+	if w := doRequest(t, s.Router(), http.MethodGet, "/debug/pprof/", "admin-secret", "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected pprof to be disabled by default, got %d", w.Code)
+	}
+	if w := doRequest(t, newTestServer().Router(), http.MethodGet, "/debug/pprof/cmdline", "", "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected pprof to be disabled without tokens, got %d", w.Code)
+	}
+
+	s.config.Pprof = true
+	h := s.Router()
+	if w := doRequest(t, h, http.MethodGet, "/debug/pprof/", "ro-secret", "", ""); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for read token, got %d", w.Code)
+	}
+	if w := doRequest(t, h, http.MethodGet, "/debug/pprof/goroutine?debug=1", "admin-secret", "", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 for admin token, got %d", w.Code)
+	}
+}
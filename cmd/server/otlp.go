@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/auth"
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/otlp"
+)
+
+// Коды google.rpc.Code для тела ошибки OTLP/HTTP
+const (
+	rpcInvalidArgument   = 3
+	rpcPermissionDenied  = 7
+	rpcResourceExhausted = 8
+)
+
+func writeOTLP(w http.ResponseWriter, mediaType string, status int, body []byte) {
+	w.Header().Set("Content-Type", mediaType)
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// writeOTLPLimitError отвечает на отказ ограничения статусом google.rpc
+func writeOTLPLimitError(w http.ResponseWriter, mediaType string, err error) {
+	var le *limitError
+	errors.As(err, &le)
+	code := int32(rpcResourceExhausted)
+	switch le.status {
+	case http.StatusForbidden:
+		code = rpcPermissionDenied
+	case http.StatusUnprocessableEntity:
+		code = rpcInvalidArgument
+	}
+	setRetryAfter(w, le.retryAfter)
+	writeOTLP(w, mediaType, le.status, otlp.EncodeStatus(mediaType, code, le.msg))
+}
+
+// otlpMetricsHandler принимает OTLP/HTTP экспорт метрик (POST /v1/metrics)
+// в кодировке protobuf или JSON. Ответ кодируется так же, как запрос.
+// Точки неподдерживаемых типов отклоняются через partial_success, остальные записываются.
+func (s *Server) otlpMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	mediaType, err := otlp.MediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeOTLP(w, mediaType, http.StatusBadRequest,
+			otlp.EncodeStatus(mediaType, rpcInvalidArgument, "unable to read body: "+err.Error()))
+		return
+	}
+	defer r.Body.Close()
+
+	md, err := otlp.Decode(body, mediaType)
+	if err != nil {
+		writeOTLP(w, mediaType, http.StatusBadRequest, otlp.EncodeStatus(mediaType, rpcInvalidArgument, err.Error()))
+		return
+	}
+
+	// Точки проверяются до расхода квоты, а накопленные значения переводятся
+	// в приращения только для записываемых точек
+	res := otlp.Convert(md)
+	problems := res.Errors
+	rejected := res.Rejected
+	var (
+		limited *limitError
+		valid   []otlp.Point
+	)
+	for _, p := range res.Points {
+		if err := s.checkPoint(r.Context(), p); err != nil {
+			rejected++
+			problems = append(problems, err.Error())
+			errors.As(err, &limited)
+			continue
+		}
+		valid = append(valid, p)
+	}
+	if len(valid) > 0 {
+		if err := s.admitWrites(r, len(valid)); err != nil {
+			writeOTLPLimitError(w, mediaType, err)
+			return
+		}
+		space, err := s.writeSpace(r.Context())
+		if err != nil {
+			writeOTLPLimitError(w, mediaType, err)
+			return
+		}
+		for _, p := range valid {
+			err := s.writeSeries(r.Context(), space.storage, s.otlpOptions.Series(p), func() []models.Metrics {
+				return space.otlp.Metrics(p)
+			})
+			if err != nil {
+				rejected++
+				problems = append(problems, fmt.Sprintf("unable to write %s: %v", p.Metric.Key(), err))
+				errors.As(err, &limited)
+			}
+		}
+	}
+
+	// Ни одна точка не записана из-за ограничений — статус ограничения вместо partial_success
+	if limited != nil && rejected == res.Rejected+int64(len(res.Points)) {
+		writeOTLPLimitError(w, mediaType, limited)
+		return
+	}
+	writeOTLP(w, mediaType, http.StatusOK, otlp.EncodeResponse(mediaType, rejected, strings.Join(problems, "; ")))
+}
+
+// checkPoint проверяет права и формат всех метрик, которые запишет точка p
+func (s *Server) checkPoint(ctx context.Context, p otlp.Point) error {
+	for _, m := range s.otlpOptions.Series(p) {
+		if err := auth.CanWrite(ctx, m.ID); err != nil {
+			return err
+		}
+		if err := s.validateMetric(m); err != nil {
+			return fmt.Errorf("unable to write %s: %w", m.Key(), err)
+		}
+	}
+	return nil
+}
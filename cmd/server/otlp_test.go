@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/otlp"
+)
+
+func postOTLP(t *testing.T, url, contentType, fixture string) *http.Response {
+	t.Helper()
+	body, err := os.ReadFile("../../internal/otlp/testdata/" + fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(url+"/v1/metrics", contentType, bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST /v1/metrics failed: %v", err)
+	}
+	return resp
+}
+
+func TestOTLPMetricsJSON(t *testing.T) {
+	s := newTestServer()
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	// Экспорт повторяется: накопленный counter не должен удваиваться
+	for i := 0; i < 2; i++ {
+		resp := postOTLP(t, ts.URL, otlp.ContentTypeJSON, "metrics.json")
+		var body struct {
+			PartialSuccess struct {
+				RejectedDataPoints string `json:"rejectedDataPoints"`
+				ErrorMessage       string `json:"errorMessage"`
+			} `json:"partialSuccess"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("Expected JSON response: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", resp.StatusCode)
+		}
+		if body.PartialSuccess.RejectedDataPoints != "1" || !strings.Contains(body.PartialSuccess.ErrorMessage, "exponential") {
+			t.Errorf("Expected 1 rejected exponential histogram point, got %+v", body.PartialSuccess)
+		}
+	}
+
+	labels := models.Labels{"service_name": "checkout", "host_name": "web1", "process_pid": "4242", "http_method": "GET"}
+	if v, ok := s.storage.Counter("http_server_requests", labels); !ok || v != 42 {
+		t.Errorf("Expected counter 42, got %d (found=%v)", v, ok)
+	}
+	if h, ok := s.storage.Histogram("http_server_duration", labels); !ok || h.Count != 10 {
+		t.Errorf("Expected histogram with 10 observations, got %+v (found=%v)", h, ok)
+	}
+	// Delta сумма прибавляется при каждом экспорте
+	resLabels := models.Labels{"service_name": "checkout", "host_name": "web1", "process_pid": "4242"}
+	if v, ok := s.storage.Counter("jobs_processed", resLabels); !ok || v != 10 {
+		t.Errorf("Expected delta counter 10, got %d (found=%v)", v, ok)
+	}
+}
+
+func TestOTLPMetricsProtobuf(t *testing.T) {
+	s := newTestServer()
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	resp := postOTLP(t, ts.URL, otlp.ContentTypeProtobuf, "metrics.pb")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != otlp.ContentTypeProtobuf {
+		t.Errorf("Expected protobuf response, got %q", ct)
+	}
+
+	labels := models.Labels{"service_name": "checkout", "host_name": "web1", "process_pid": "4242"}
+	if v, ok := s.storage.Gauge("process_memory_usage", labels); !ok || v != 1048576 {
+		t.Errorf("Expected gauge 1048576, got %v (found=%v)", v, ok)
+	}
+}
+
+func TestOTLPMetricsErrors(t *testing.T) {
+	s := newTestServer()
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/v1/metrics", "text/plain", strings.NewReader("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected 415, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Post(ts.URL+"/v1/metrics", otlp.ContentTypeJSON, strings.NewReader("{broken"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(body), `"code":3`) {
+		t.Errorf("Expected 400 with google.rpc.Status body, got %d %s", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/logger"
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/promfmt"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/sketch"
+)
+
+var defaultQuantiles = []float64{0.5, 0.95, 0.99}
+
+// distribution — гистограмма или скетч, по которым считаются квантили
+type distribution struct {
+	hist   *models.HistogramValue
+	sketch *sketch.DDSketch
+}
+
+func (d distribution) count() uint64 {
+	if d.hist != nil {
+		return d.hist.Count
+	}
+	if d.sketch != nil {
+		return d.sketch.Count
+	}
+	return 0
+}
+
+func (d distribution) quantile(q float64) (float64, error) {
+	if d.hist != nil {
+		return d.hist.Quantile(q)
+	}
+	if d.sketch != nil {
+		return d.sketch.Quantile(q)
+	}
+	return 0, errors.New("no data")
+}
+
+// mergeDistributions сливает серии histogram или summary в одно распределение
+func mergeDistributions(series []models.Metrics) (distribution, error) {
+	var d distribution
+	for _, m := range series {
+		switch {
+		case m.Histogram != nil:
+			if d.hist == nil {
+				d.hist = m.Histogram.Clone()
+				continue
+			}
+			if err := d.hist.Merge(m.Histogram); err != nil {
+				return d, err
+			}
+		case m.Sketch != nil:
+			if d.sketch == nil {
+				d.sketch = m.Sketch.Clone()
+				continue
+			}
+			if err := d.sketch.Merge(m.Sketch); err != nil {
+				return d, err
+			}
+		}
+	}
+	return d, nil
+}
+
+type quantileResponse struct {
+	ID        string             `json:"id"`
+	MType     string             `json:"type"`
+	Series    int                `json:"series"`
+	Count     uint64             `json:"count"`
+	Quantiles map[string]float64 `json:"quantiles"`
+}
+
+// quantileHandler считает квантили по всем сериям, отобранным матчерами:
+// GET /quantile?type=summary&name=GCPauseMs&match=env=prod&q=0.5,0.95,0.99
+func (s *Server) quantileHandler(w http.ResponseWriter, r *http.Request) {
+	st := s.storageFor(r)
+	q := r.URL.Query()
+
+	metricType := q.Get("type")
+	if metricType == "" {
+		metricType = models.Summary
+	}
+	if metricType != models.Histogram && metricType != models.Summary {
+		http.Error(w, "Quantiles are supported for 'histogram' and 'summary' only", http.StatusBadRequest)
+		return
+	}
+
+	name := q.Get("name")
+	if name == "" {
+		http.Error(w, "missing metric name", http.StatusBadRequest)
+		return
+	}
+
+	matchers, err := models.ParseMatchers(q.Get("match"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	quantiles := defaultQuantiles
+	if qs := q.Get("q"); qs != "" {
+		quantiles = nil
+		for _, part := range strings.Split(qs, ",") {
+			v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+			if err != nil || v < 0 || v > 1 {
+				http.Error(w, "Invalid quantile "+part, http.StatusBadRequest)
+				return
+			}
+			quantiles = append(quantiles, v)
+		}
+	}
+
+	series := st.Select(metricType, name, matchers)
+	if len(series) == 0 {
+		http.Error(w, "metric not found", http.StatusNotFound)
+		return
+	}
+
+	d, err := mergeDistributions(series)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	resp := quantileResponse{
+		ID:        name,
+		MType:     metricType,
+		Series:    len(series),
+		Count:     d.count(),
+		Quantiles: make(map[string]float64, len(quantiles)),
+	}
+	for _, qv := range quantiles {
+		v, err := d.quantile(qv)
+		if err != nil {
+			continue
+		}
+		resp.Quantiles[strconv.FormatFloat(qv, 'g', -1, 64)] = v
+	}
+
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, "failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResp)
+}
+
+// prometheusHandler отдаёт все серии в текстовом формате Prometheus
+func (s *Server) prometheusHandler(w http.ResponseWriter, r *http.Request) {
+	st := s.storageFor(r)
+	w.Header().Set("Content-Type", promfmt.ContentType)
+	w.WriteHeader(http.StatusOK)
+	if err := promfmt.Write(w, st.Select("", "", nil)); err != nil {
+		logger.FromContext(r.Context()).Info().Err(err).Msg("incomplete prometheus exposition")
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"testing"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+)
+
+// newQueryTestServer возвращает сервер с сериями HeapAlloc и Requests с метками host и env
+func newQueryTestServer(t *testing.T) http.Handler {
+	t.Helper()
+	s := NewServer(NewMetricsStorage(), &ServerConfig{InfluxCounterSuffixes: defaultInfluxCounterSuffixes})
+	h := s.Router()
+	for _, body := range []string{
+		`{"id":"HeapAlloc","type":"gauge","value":1,"labels":{"host":"web1","env":"prod"}}`,
+		`{"id":"HeapAlloc","type":"gauge","value":2,"labels":{"host":"web2","env":"prod"}}`,
+		`{"id":"HeapAlloc","type":"gauge","value":3,"labels":{"host":"db1","env":"staging"}}`,
+		`{"id":"HeapAlloc","type":"gauge","value":4}`,
+		`{"id":"Requests","type":"counter","delta":5,"labels":{"host":"web1","env":"prod"}}`,
+	} {
+		if w := doRequest(t, h, http.MethodPost, "/update", "", "application/json", body); w.Code != http.StatusOK {
+			t.Fatalf("update %s: expected 200, got %d (%s)", body, w.Code, w.Body)
+		}
+	}
+	return h
+}
+
+func TestQueryMatchers(t *testing.T) {
+	h := newQueryTestServer(t)
+
+	tests := []struct {
+		name, query string
+		code        int
+		want        []float64 // значения gauge HeapAlloc в ответе
+	}{
+		{"all series", "type=gauge&name=HeapAlloc", http.StatusOK, []float64{1, 2, 3, 4}},
+		{"equal", "type=gauge&name=HeapAlloc&match=host=web1", http.StatusOK, []float64{1}},
+		{"two equals", "type=gauge&name=HeapAlloc&match=env=prod,host=web2", http.StatusOK, []float64{2}},
+		{"not equal", "type=gauge&name=HeapAlloc&match=env!=prod", http.StatusOK, []float64{3, 4}},
+		{"regexp", "type=gauge&name=HeapAlloc&match=host=~web.*", http.StatusOK, []float64{1, 2}},
+		{"not regexp", "type=gauge&name=HeapAlloc&match=host!~web.*", http.StatusOK, []float64{3, 4}},
+		{"regexp is anchored", "type=gauge&name=HeapAlloc&match=host=~web", http.StatusOK, nil},
+		{"no match", "type=gauge&name=HeapAlloc&match=env=dev", http.StatusOK, nil},
+		{"invalid regexp", "type=gauge&name=HeapAlloc&match=host=~(", http.StatusBadRequest, nil},
+		{"unknown type", "type=timer&name=HeapAlloc", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := doRequest(t, h, http.MethodGet, "/query?"+q.Encode(), "", "", "")
+			if w.Code != tt.code {
+				t.Fatalf("Expected %d, got %d (%s)", tt.code, w.Code, w.Body)
+			}
+			if tt.code != http.StatusOK {
+				return
+			}
+			var series []models.Metrics
+			if err := json.Unmarshal(w.Body.Bytes(), &series); err != nil {
+				t.Fatalf("Invalid response %q: %v", w.Body, err)
+			}
+			var got []float64
+			for _, m := range series {
+				if m.ID != "HeapAlloc" || m.Value == nil {
+					t.Fatalf("Unexpected series %+v", m)
+				}
+				got = append(got, *m.Value)
+			}
+			sort.Float64s(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected values %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	// Без типа и имени матчеры отбирают серии всех метрик
+	w := doRequest(t, h, http.MethodGet, "/query?match="+url.QueryEscape("host=web1"), "", "", "")
+	var series []models.Metrics
+	if err := json.Unmarshal(w.Body.Bytes(), &series); err != nil || len(series) != 2 {
+		t.Errorf("Expected HeapAlloc and Requests for host=web1, got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestValueWithLabels(t *testing.T) {
+	h := newQueryTestServer(t)
+
+	tests := []struct {
+		name, body string
+		code       int
+		value      float64
+		delta      int64
+	}{
+		{"labeled gauge", `{"id":"HeapAlloc","type":"gauge","labels":{"host":"web2","env":"prod"}}`, http.StatusOK, 2, 0},
+		{"label order does not matter", `{"id":"HeapAlloc","type":"gauge","labels":{"env":"staging","host":"db1"}}`, http.StatusOK, 3, 0},
+		{"unlabeled gauge", `{"id":"HeapAlloc","type":"gauge"}`, http.StatusOK, 4, 0},
+		{"labeled counter", `{"id":"Requests","type":"counter","labels":{"host":"web1","env":"prod"}}`, http.StatusOK, 0, 5},
+		{"subset of labels", `{"id":"HeapAlloc","type":"gauge","labels":{"host":"web2"}}`, http.StatusNotFound, 0, 0},
+		{"unknown label value", `{"id":"HeapAlloc","type":"gauge","labels":{"host":"web3","env":"prod"}}`, http.StatusNotFound, 0, 0},
+		{"counter without labels", `{"id":"Requests","type":"counter"}`, http.StatusNotFound, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doRequest(t, h, http.MethodPost, "/value", "", "application/json", tt.body)
+			if w.Code != tt.code {
+				t.Fatalf("Expected %d, got %d (%s)", tt.code, w.Code, w.Body)
+			}
+			if tt.code != http.StatusOK {
+				return
+			}
+			var m models.Metrics
+			if err := json.Unmarshal(w.Body.Bytes(), &m); err != nil {
+				t.Fatalf("Invalid response %q: %v", w.Body, err)
+			}
+			switch {
+			case m.Value != nil && *m.Value != tt.value:
+				t.Errorf("Expected value %g, got %g", tt.value, *m.Value)
+			case m.Delta != nil && *m.Delta != tt.delta:
+				t.Errorf("Expected delta %d, got %d", tt.delta, *m.Delta)
+			case m.Value == nil && m.Delta == nil:
+				t.Errorf("Expected a value in %s", w.Body)
+			}
+		})
+	}
+
+	// /value/{type}/{name} читает серию без меток
+	if w := doRequest(t, h, http.MethodGet, "/value/gauge/HeapAlloc", "", "", ""); w.Code != http.StatusOK || w.Body.String() != "4" {
+		t.Errorf("Expected unlabeled series value 4, got %d %q", w.Code, w.Body)
+	}
+	if w := doRequest(t, h, http.MethodGet, "/value/counter/Requests", "", "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for counter with labels only, got %d", w.Code)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/auth"
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/ratelimit"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/tenant"
+)
+
+// Метрика запросов, отклонённых ограничением частоты, метка kind: write или read
+const rateLimitedMetric = "server_rate_limited_total"
+
+// Ключи ограничения частоты запросов
+const (
+	rateLimitByIP     = "ip"
+	rateLimitByToken  = "token"
+	rateLimitByTenant = "tenant"
+)
+
+// parseRateLimitKey проверяет ключ ограничения частоты
+func parseRateLimitKey(key string) error {
+	switch key {
+	case rateLimitByIP, rateLimitByToken, rateLimitByTenant:
+		return nil
+	}
+	return fmt.Errorf("unknown rate limit key %q, expected ip, token or tenant", key)
+}
+
+// rateLimitKey — ключ bucket запроса. Запрос без токена ограничивается по IP.
+func (s *Server) rateLimitKey(r *http.Request) string {
+	switch s.config.RateLimitKey {
+	case rateLimitByTenant:
+		return "tenant:" + tenant.FromContext(r.Context())
+	case rateLimitByToken:
+		return clientKey(r)
+	}
+	return ipKey(r)
+}
+
+// rateLimit ограничивает частоту запросов группы kind лимитером l.
+// Превышение — 429 с Retry-After и JSON телом.
+func (s *Server) rateLimit(kind string, l *ratelimit.Limiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if l == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ok, wait := l.Allow(s.rateLimitKey(r)); !ok {
+				s.telemetry.Counter(rateLimitedMetric, models.Labels{"kind": kind}).Inc()
+				setRetryAfter(w, wait)
+				auth.WriteError(w, http.StatusTooManyRequests, kind+" rate limit exceeded")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	s := NewServer(NewMetricsStorage(), &ServerConfig{
+		InfluxCounterSuffixes: defaultInfluxCounterSuffixes,
+		Tenants:               "acme,globex",
+		RateLimitKey:          rateLimitByTenant,
+		RateLimitWrites:       0.5,
+		RateLimitReads:        0.5,
+		RateLimitBurst:        1,
+	})
+	h := s.Router()
+
+	if w := doTenantRequest(t, h, http.MethodPost, "/update/gauge/load/1", "", "acme"); w.Code != http.StatusOK {
+		t.Fatalf("Expected first write to pass, got %d", w.Code)
+	}
+	w := doTenantRequest(t, h, http.MethodPost, "/update/gauge/load/2", "", "acme")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "2" {
+		t.Errorf("Expected 429 with Retry-After: 2, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	if !strings.Contains(w.Body.String(), `"error"`) {
+		t.Errorf("Expected JSON error body, got %q", w.Body)
+	}
+
+	// Чтение и запись ограничиваются отдельно, ключ — арендатор
+	if w := doTenantRequest(t, h, http.MethodGet, "/value/gauge/load", "", "acme"); w.Code != http.StatusOK {
+		t.Errorf("Expected read to use its own limit, got %d", w.Code)
+	}
+	if w := doTenantRequest(t, h, http.MethodPost, "/update/gauge/load/1", "", "globex"); w.Code != http.StatusOK {
+		t.Errorf("Expected other tenant to have its own bucket, got %d", w.Code)
+	}
+
+	body := doTenantRequest(t, h, http.MethodGet, "/debug/metrics", "", "").Body.String()
+	if !strings.Contains(body, `server_rate_limited_total{kind="write"} 1`) {
+		t.Errorf("Expected rate limited writes in self-metrics:\n%s", body)
+	}
+}
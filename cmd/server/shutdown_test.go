@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// freeUDPAddr возвращает свободный UDP адрес для приёмника StatsD
+func freeUDPAddr(t *testing.T) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	return pc.LocalAddr().String()
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	statsdAddr := freeUDPAddr(t)
+	s := NewServer(NewMetricsStorage(), &ServerConfig{
+		Address:               "127.0.0.1:0",
+		InfluxCounterSuffixes: defaultInfluxCounterSuffixes,
+		StatsDAddress:         statsdAddr,
+		StatsDFlushInterval:   time.Hour,
+		RateLimitGC:           time.Minute,
+		ShutdownTimeout:       5 * time.Second,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	addrs := make(chan net.Addr, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, s, func(addr net.Addr) { addrs <- addr })
+	}()
+	addr := (<-addrs).String()
+	base := "http://" + addr
+
+	// Пакет StatsD ждёт сброса: до остановки интервал не истечёт
+	udp, err := net.Dial("udp", statsdAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	udp.Write([]byte("statsd_jobs:3|c"))
+	udp.Close()
+
+	// Запрос, тело которого дописывается уже после сигнала остановки
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	body := `{"id":"inflight","type":"gauge","value":42}`
+	fmt.Fprintf(conn, "POST /update HTTP/1.1\r\nHost: %s\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n", addr, len(body))
+	conn.Write([]byte(body[:10]))
+
+	// Постоянный поток записей во время остановки
+	var (
+		accepted atomic.Int64
+		wg       sync.WaitGroup
+		stopLoad = make(chan struct{})
+	)
+	client := &http.Client{Timeout: 5 * time.Second}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stopLoad:
+					return
+				default:
+				}
+				resp, err := client.Post(base+"/update/counter/jobs/1", "text/plain", nil)
+				if err != nil {
+					continue
+				}
+				resp.Body.Close()
+				if resp.StatusCode == http.StatusOK {
+					accepted.Add(1)
+				}
+			}
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	conn.Write([]byte(body[10:]))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("In-flight request must complete during shutdown: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected in-flight request to succeed, got %d", resp.StatusCode)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Expected clean shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not stop")
+	}
+	close(stopLoad)
+	wg.Wait()
+
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Error("Expected listener to be closed after shutdown")
+	}
+	if v, ok := s.storage.Gauge("inflight", nil); !ok || v != 42 {
+		t.Errorf("Expected in-flight write to be stored, got %v %v", v, ok)
+	}
+	if v, _ := s.storage.Counter("jobs", nil); v != accepted.Load() || v == 0 {
+		t.Errorf("Expected every acknowledged write to be stored: %d acknowledged, %d stored", accepted.Load(), v)
+	}
+	if v, ok := s.storage.Counter("statsd_jobs", nil); !ok || v != 3 {
+		t.Errorf("Expected StatsD aggregates to be flushed on shutdown, got %v %v", v, ok)
+	}
+	if !s.lifecycle.ShuttingDown() {
+		t.Error("Expected lifecycle to report shutdown")
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	lc := newLifecycle(20*time.Millisecond, 0)
+	var order []string
+	lc.onShutdown("slow", func(ctx context.Context) error {
+		order = append(order, "slow")
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	lc.onShutdown("next", func(ctx context.Context) error {
+		order = append(order, "next")
+		return nil
+	})
+
+	err := lc.shutdown()
+	if !errors.Is(err, errShutdownIncomplete) || exitCode(err) != exitShutdownIncomplete {
+		t.Errorf("Expected incomplete shutdown, got %v", err)
+	}
+	if strings.Join(order, ",") != "slow,next" {
+		t.Errorf("Expected all hooks to run in order, got %v", order)
+	}
+	if exitCode(nil) != exitOK || exitCode(errors.New("listen")) != exitFailure {
+		t.Error("Unexpected exit codes")
+	}
+}
+
+func TestShutdownDelayWithdrawsReadiness(t *testing.T) {
+	s := NewServer(NewMetricsStorage(), &ServerConfig{
+		Address:               "127.0.0.1:0",
+		InfluxCounterSuffixes: defaultInfluxCounterSuffixes,
+		RateLimitGC:           time.Minute,
+		ShutdownTimeout:       5 * time.Second,
+		ShutdownDelay:         300 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	addrs := make(chan net.Addr, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, s, func(addr net.Addr) { addrs <- addr })
+	}()
+	base := "http://" + (<-addrs).String()
+
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	// Во время паузы сервер не готов, но запросы ещё принимает
+	resp, err := http.Get(base + "/readyz")
+	if err != nil {
+		t.Fatalf("Expected server to accept connections during the delay: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz 503 during the delay, got %d", resp.StatusCode)
+	}
+	resp, err = http.Post(base+"/update/counter/jobs/1", "text/plain", nil)
+	if err != nil {
+		t.Fatalf("Expected writes to be accepted during the delay: %v", err)
+	}
+	resp.Body.Close()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Expected clean shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not stop")
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/sketch"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/telemetry"
+)
+
+// seriesIndex хранит метки серий и инвертированный индекс по ним.
+// Ключ серии — models.SeriesKey(name, labels).
+type seriesIndex struct {
+	labels   map[string]models.Labels                  // ключ серии -> метки
+	names    map[string]string                         // ключ серии -> имя метрики
+	byName   map[string]map[string]struct{}            // имя метрики -> ключи серий
+	postings map[string]map[string]map[string]struct{} // метка -> значение -> ключи серий
+}
+
+func newSeriesIndex() *seriesIndex {
+	return &seriesIndex{
+		labels:   make(map[string]models.Labels),
+		names:    make(map[string]string),
+		byName:   make(map[string]map[string]struct{}),
+		postings: make(map[string]map[string]map[string]struct{}),
+	}
+}
+
+func (idx *seriesIndex) add(key, name string, labels models.Labels) {
+	if _, ok := idx.names[key]; ok {
+		return
+	}
+	idx.names[key] = name
+	idx.labels[key] = labels.Clone()
+
+	if idx.byName[name] == nil {
+		idx.byName[name] = make(map[string]struct{})
+	}
+	idx.byName[name][key] = struct{}{}
+
+	for k, v := range labels {
+		if idx.postings[k] == nil {
+			idx.postings[k] = make(map[string]map[string]struct{})
+		}
+		if idx.postings[k][v] == nil {
+			idx.postings[k][v] = make(map[string]struct{})
+		}
+		idx.postings[k][v][key] = struct{}{}
+	}
+}
+
+// lookup возвращает отсортированные ключи серий с данным именем (пустое имя — любые),
+// удовлетворяющие всем матчерам
+func (idx *seriesIndex) lookup(name string, matchers []*models.Matcher) []string {
+	var candidates map[string]struct{}
+	restricted := false
+	if name != "" {
+		candidates, restricted = idx.byName[name], true
+	}
+
+	// Сужаем выборку по матчерам на равенство с непустым значением через индекс
+	for _, m := range matchers {
+		if m.Type != models.MatchEqual || m.Value == "" {
+			continue
+		}
+		posting := idx.postings[m.Name][m.Value]
+		if !restricted {
+			candidates, restricted = posting, true
+			continue
+		}
+		narrowed := make(map[string]struct{})
+		for key := range candidates {
+			if _, ok := posting[key]; ok {
+				narrowed[key] = struct{}{}
+			}
+		}
+		candidates = narrowed
+	}
+
+	var keys []string
+	check := func(key string) {
+		if models.MatchLabels(matchers, idx.labels[key]) {
+			keys = append(keys, key)
+		}
+	}
+	if restricted {
+		for key := range candidates {
+			check(key)
+		}
+	} else {
+		for key := range idx.names {
+			check(key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (idx *seriesIndex) len() int {
+	return len(idx.names)
+}
+
+type MetricsStorage struct {
+	gauges     map[string]float64
+	counters   map[string]int64
+	histograms map[string]*models.HistogramValue
+	summaries  map[string]*sketch.DDSketch
+	index      map[string]*seriesIndex // тип метрики -> индекс серий
+	mu         sync.RWMutex
+
+	// Собственные метрики хранилища, nil — не собираются
+	tel *storageTelemetry
+}
+
+// Границы корзин времени ожидания блокировки хранилища, секунды
+var lockWaitBuckets = []float64{0.000001, 0.00001, 0.0001, 0.001, 0.01, 0.1, 1}
+
+// storageTelemetry — время ожидания блокировок и длительность снимков хранилища
+type storageTelemetry struct {
+	writeWait, readWait *telemetry.Histogram
+	snapshot, selection *telemetry.Histogram
+}
+
+// SetTelemetry включает учёт ожидания блокировок и длительности снимков в reg.
+// Хранилища арендаторов пишут в одни и те же метрики.
+func (ms *MetricsStorage) SetTelemetry(reg *telemetry.Registry) {
+	ms.tel = &storageTelemetry{
+		writeWait: reg.Histogram("server_storage_lock_wait_seconds", models.Labels{"mode": "write"}, lockWaitBuckets),
+		readWait:  reg.Histogram("server_storage_lock_wait_seconds", models.Labels{"mode": "read"}, lockWaitBuckets),
+		snapshot:  reg.Histogram("server_storage_snapshot_duration_seconds", models.Labels{"op": "snapshot"}, lockWaitBuckets),
+		selection: reg.Histogram("server_storage_snapshot_duration_seconds", models.Labels{"op": "select"}, lockWaitBuckets),
+	}
+}
+
+// lock берёт блокировку записи, учитывая время ожидания
+func (ms *MetricsStorage) lock() {
+	if ms.tel == nil {
+		ms.mu.Lock()
+		return
+	}
+	start := time.Now()
+	ms.mu.Lock()
+	ms.tel.writeWait.Observe(time.Since(start).Seconds())
+}
+
+// rlock берёт блокировку чтения, учитывая время ожидания
+func (ms *MetricsStorage) rlock() {
+	if ms.tel == nil {
+		ms.mu.RLock()
+		return
+	}
+	start := time.Now()
+	ms.mu.RLock()
+	ms.tel.readWait.Observe(time.Since(start).Seconds())
+}
+
+// observeSince учитывает длительность операции, начатой в start
+func observeSince(h *telemetry.Histogram, start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+func NewMetricsStorage() *MetricsStorage {
+	return &MetricsStorage{
+		gauges:     make(map[string]float64),
+		counters:   make(map[string]int64),
+		histograms: make(map[string]*models.HistogramValue),
+		summaries:  make(map[string]*sketch.DDSketch),
+		index: map[string]*seriesIndex{
+			models.Gauge:     newSeriesIndex(),
+			models.Counter:   newSeriesIndex(),
+			models.Histogram: newSeriesIndex(),
+			models.Summary:   newSeriesIndex(),
+		},
+	}
+}
+
+// SetGauge устанавливает значение gauge серии
+func (ms *MetricsStorage) SetGauge(name string, labels models.Labels, value float64) {
+	key := models.SeriesKey(name, labels)
+
+	ms.lock()
+	defer ms.mu.Unlock()
+	ms.index[models.Gauge].add(key, name, labels)
+	ms.gauges[key] = value
+}
+
+// AddCounter прибавляет delta к counter серии и возвращает новое значение
+func (ms *MetricsStorage) AddCounter(name string, labels models.Labels, delta int64) int64 {
+	key := models.SeriesKey(name, labels)
+
+	ms.lock()
+	defer ms.mu.Unlock()
+	ms.index[models.Counter].add(key, name, labels)
+	ms.counters[key] += delta
+	return ms.counters[key]
+}
+
+// MergeHistogram сливает гистограмму с сохранённой серией.
+// Границы корзин должны совпадать с уже сохранёнными.
+func (ms *MetricsStorage) MergeHistogram(name string, labels models.Labels, h *models.HistogramValue) error {
+	key := models.SeriesKey(name, labels)
+
+	ms.lock()
+	defer ms.mu.Unlock()
+	if cur, ok := ms.histograms[key]; ok {
+		return cur.Merge(h)
+	}
+	ms.index[models.Histogram].add(key, name, labels)
+	ms.histograms[key] = h.Clone()
+	return nil
+}
+
+// MergeSummary сливает скетч с сохранённой серией.
+// Точность скетча должна совпадать с уже сохранённой.
+func (ms *MetricsStorage) MergeSummary(name string, labels models.Labels, sk *sketch.DDSketch) error {
+	key := models.SeriesKey(name, labels)
+
+	ms.lock()
+	defer ms.mu.Unlock()
+	if cur, ok := ms.summaries[key]; ok {
+		return cur.Merge(sk)
+	}
+	ms.index[models.Summary].add(key, name, labels)
+	ms.summaries[key] = sk.Clone()
+	return nil
+}
+
+// HasSeries сообщает, есть ли серия заданного типа
+func (ms *MetricsStorage) HasSeries(mtype, name string, labels models.Labels) bool {
+	ms.rlock()
+	defer ms.mu.RUnlock()
+	idx, ok := ms.index[mtype]
+	if !ok {
+		return false
+	}
+	_, ok = idx.names[models.SeriesKey(name, labels)]
+	return ok
+}
+
+// Gauge возвращает значение gauge серии
+func (ms *MetricsStorage) Gauge(name string, labels models.Labels) (float64, bool) {
+	ms.rlock()
+	defer ms.mu.RUnlock()
+	v, ok := ms.gauges[models.SeriesKey(name, labels)]
+	return v, ok
+}
+
+// Counter возвращает значение counter серии
+func (ms *MetricsStorage) Counter(name string, labels models.Labels) (int64, bool) {
+	ms.rlock()
+	defer ms.mu.RUnlock()
+	v, ok := ms.counters[models.SeriesKey(name, labels)]
+	return v, ok
+}
+
+// Histogram возвращает копию гистограммы серии
+func (ms *MetricsStorage) Histogram(name string, labels models.Labels) (*models.HistogramValue, bool) {
+	ms.rlock()
+	defer ms.mu.RUnlock()
+	h, ok := ms.histograms[models.SeriesKey(name, labels)]
+	if !ok {
+		return nil, false
+	}
+	return h.Clone(), true
+}
+
+// Summary возвращает копию скетча серии
+func (ms *MetricsStorage) Summary(name string, labels models.Labels) (*sketch.DDSketch, bool) {
+	ms.rlock()
+	defer ms.mu.RUnlock()
+	sk, ok := ms.summaries[models.SeriesKey(name, labels)]
+	if !ok {
+		return nil, false
+	}
+	return sk.Clone(), true
+}
+
+// Select возвращает серии заданного типа (пустой тип — все типы) с именем name
+// (пустое имя — все метрики), удовлетворяющие матчерам
+func (ms *MetricsStorage) Select(mtype, name string, matchers []*models.Matcher) []models.Metrics {
+	if ms.tel != nil {
+		defer observeSince(ms.tel.selection, time.Now())
+	}
+	ms.rlock()
+	defer ms.mu.RUnlock()
+
+	var res []models.Metrics
+	for _, t := range []string{models.Gauge, models.Counter, models.Histogram, models.Summary} {
+		if mtype != "" && mtype != t {
+			continue
+		}
+		idx := ms.index[t]
+		for _, key := range idx.lookup(name, matchers) {
+			m := models.Metrics{
+				ID:     idx.names[key],
+				MType:  t,
+				Labels: idx.labels[key].Clone(),
+			}
+			switch t {
+			case models.Gauge:
+				v := ms.gauges[key]
+				m.Value = &v
+			case models.Counter:
+				v := ms.counters[key]
+				m.Delta = &v
+			case models.Histogram:
+				m.Histogram = ms.histograms[key].Clone()
+			case models.Summary:
+				m.Sketch = ms.summaries[key].Clone()
+			}
+			res = append(res, m)
+		}
+	}
+	return res
+}
+
+// Snapshot возвращает копии значений gauge и counter, ключи — ключи серий
+func (ms *MetricsStorage) Snapshot() (map[string]float64, map[string]int64) {
+	if ms.tel != nil {
+		defer observeSince(ms.tel.snapshot, time.Now())
+	}
+	ms.rlock()
+	defer ms.mu.RUnlock()
+
+	gauges := make(map[string]float64, len(ms.gauges))
+	for k, v := range ms.gauges {
+		gauges[k] = v
+	}
+	counters := make(map[string]int64, len(ms.counters))
+	for k, v := range ms.counters {
+		counters[k] = v
+	}
+	return gauges, counters
+}
+
+// Ping проверяет, что хранилище доступно: блокировку чтения удаётся взять до отмены ctx
+func (ms *MetricsStorage) Ping(ctx context.Context) error {
+	for !ms.mu.TryRLock() {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("storage lock is held: %w", ctx.Err())
+		case <-time.After(time.Millisecond):
+		}
+	}
+	ms.mu.RUnlock()
+	return nil
+}
+
+// SeriesByType возвращает число серий каждого типа
+func (ms *MetricsStorage) SeriesByType() map[string]int {
+	ms.rlock()
+	defer ms.mu.RUnlock()
+
+	res := make(map[string]int, len(ms.index))
+	for t, idx := range ms.index {
+		res[t] = idx.len()
+	}
+	return res
+}
+
+// SeriesCount возвращает общее число серий
+func (ms *MetricsStorage) SeriesCount() int {
+	ms.rlock()
+	defer ms.mu.RUnlock()
+
+	total := 0
+	for _, idx := range ms.index {
+		total += idx.len()
+	}
+	return total
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+)
+
+func TestSeriesIndexLookup(t *testing.T) {
+	idx := newSeriesIndex()
+	series := []struct {
+		name   string
+		labels models.Labels
+	}{
+		{"cpu", models.Labels{"host": "web1", "env": "prod"}},
+		{"cpu", models.Labels{"host": "web2", "env": "prod"}},
+		{"cpu", models.Labels{"host": "db1", "env": "staging"}},
+		{"cpu", nil},
+		{"mem", models.Labels{"host": "web1", "env": "prod"}},
+	}
+	for _, s := range series {
+		idx.add(models.SeriesKey(s.name, s.labels), s.name, s.labels)
+	}
+	// Повторное добавление серии не меняет индекс
+	idx.add(models.SeriesKey("cpu", nil), "cpu", nil)
+	if idx.len() != len(series) {
+		t.Fatalf("Expected %d series, got %d", len(series), idx.len())
+	}
+
+	key := func(name, labels string) string {
+		l, err := models.ParseLabels(labels)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return models.SeriesKey(name, l)
+	}
+	tests := []struct {
+		name, metric, match string
+		want                []string
+	}{
+		{"by name", "mem", "", []string{key("mem", "host=web1,env=prod")}},
+		{"unknown name", "disk", "", nil},
+		{"equal", "cpu", "host=web1", []string{key("cpu", "host=web1,env=prod")}},
+		{"equal across names", "", "host=web1", []string{key("cpu", "host=web1,env=prod"), key("mem", "host=web1,env=prod")}},
+		{"two equals", "cpu", "env=prod,host=web2", []string{key("cpu", "host=web2,env=prod")}},
+		{"equal empty matches missing label", "cpu", "host=", []string{"cpu"}},
+		{"not equal", "cpu", "env!=prod", []string{"cpu", key("cpu", "host=db1,env=staging")}},
+		{"regexp", "cpu", "host=~web.*", []string{key("cpu", "host=web1,env=prod"), key("cpu", "host=web2,env=prod")}},
+		{"not regexp", "cpu", "host!~web.*", []string{"cpu", key("cpu", "host=db1,env=staging")}},
+		{"equal and regexp", "cpu", "env=prod,host!~web1", []string{key("cpu", "host=web2,env=prod")}},
+		{"no match", "cpu", "env=dev", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matchers, err := models.ParseMatchers(tt.match)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := idx.lookup(tt.metric, matchers); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lookup(%q, %q) = %v, want %v", tt.metric, tt.match, got, tt.want)
+			}
+		})
+	}
+}
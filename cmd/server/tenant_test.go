@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/tenant"
+)
+
+func doTenantRequest(t *testing.T, h http.Handler, method, path, token, tenantID string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(""))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if tenantID != "" {
+		req.Header.Set(tenant.Header, tenantID)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestTenantIsolation(t *testing.T) {
+	s := NewServer(NewMetricsStorage(), &ServerConfig{InfluxCounterSuffixes: defaultInfluxCounterSuffixes, Tenants: "acme,globex"})
+	h := s.Router()
+
+	for _, tc := range []struct{ tenant, value string }{{"acme", "1"}, {"globex", "2"}, {"", "3"}} {
+		if w := doTenantRequest(t, h, http.MethodPost, "/update/gauge/load/"+tc.value, "", tc.tenant); w.Code != http.StatusOK {
+			t.Fatalf("update for %q: expected 200, got %d (%s)", tc.tenant, w.Code, w.Body)
+		}
+	}
+
+	for _, tc := range []struct{ tenant, value string }{{"acme", "1"}, {"globex", "2"}, {"", "3"}, {tenant.Default, "3"}} {
+		w := doTenantRequest(t, h, http.MethodGet, "/value/gauge/load", "", tc.tenant)
+		if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != tc.value {
+			t.Errorf("value for %q: expected %s, got %d %q", tc.tenant, tc.value, w.Code, w.Body)
+		}
+	}
+	if w := doTenantRequest(t, h, http.MethodGet, "/value/gauge/load", "", "initech"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown tenant, got %d", w.Code)
+	}
+	if w := doTenantRequest(t, h, http.MethodGet, "/metrics", "", "acme"); strings.Contains(w.Body.String(), "load 2") {
+		t.Errorf("Tenant acme must not see globex series:\n%s", w.Body)
+	}
+	if w := doTenantRequest(t, h, http.MethodGet, "/value/gauge/load", "", "bad tenant!"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid tenant id, got %d", w.Code)
+	}
+
+	// Чтение неизвестного арендатора не создаёт пространство
+	w := doTenantRequest(t, h, http.MethodGet, "/admin/tenants", "", "")
+	var list []tenantInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Invalid tenants response %q: %v", w.Body, err)
+	}
+	want := []tenantInfo{{"acme", 1}, {tenant.Default, 1}, {"globex", 1}}
+	if len(list) != len(want) {
+		t.Fatalf("Expected tenants %v, got %v", want, list)
+	}
+	for i := range want {
+		if list[i] != want[i] {
+			t.Errorf("Expected tenants %v, got %v", want, list)
+		}
+	}
+}
+
+func TestTenantBoundToken(t *testing.T) {
+	store, err := loadTokens("acme:acme-secret:write,read::acme;ops:admin-secret:admin", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(NewMetricsStorage(), &ServerConfig{InfluxCounterSuffixes: defaultInfluxCounterSuffixes, Auth: store})
+	h := s.Router()
+
+	if w := doTenantRequest(t, h, http.MethodPost, "/update/counter/jobs/5", "acme-secret", ""); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d (%s)", w.Code, w.Body)
+	}
+	if _, ok := s.storage.Counter("jobs", nil); ok {
+		t.Error("Token bound to acme must not write to the default tenant")
+	}
+	if w := doTenantRequest(t, h, http.MethodGet, "/value/counter/jobs", "acme-secret", "acme"); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 for own tenant, got %d", w.Code)
+	}
+	w := doTenantRequest(t, h, http.MethodGet, "/value/counter/jobs", "acme-secret", "globex")
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), `"error"`) {
+		t.Errorf("Expected JSON 403 for foreign tenant, got %d %q", w.Code, w.Body)
+	}
+	if w := doTenantRequest(t, h, http.MethodGet, "/value/counter/jobs", "admin-secret", "acme"); w.Code != http.StatusOK {
+		t.Errorf("Expected admin to read any tenant, got %d", w.Code)
+	}
+	if w := doTenantRequest(t, h, http.MethodGet, "/admin/tenants", "acme-secret", ""); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for /admin/tenants without admin scope, got %d", w.Code)
+	}
+}
+
+func TestTenantCreation(t *testing.T) {
+	store, err := loadTokens("ci:ci-secret:write,read", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(NewMetricsStorage(), &ServerConfig{
+		InfluxCounterSuffixes: defaultInfluxCounterSuffixes,
+		Auth:                  store,
+		Tenants:               "acme",
+		MaxTenants:            3,
+	})
+	h := s.Router()
+
+	// Без токена создаётся только арендатор из списка -tenants
+	w := doTenantRequest(t, h, http.MethodPost, "/update/gauge/load/1", "", "initech")
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for anonymous write with tokens configured, got %d", w.Code)
+	}
+	s.config.Auth = nil
+	h = s.Router()
+	w = doTenantRequest(t, h, http.MethodPost, "/update/gauge/load/1", "", "initech")
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), `"error"`) {
+		t.Errorf("Expected JSON 403 for anonymous write to a new tenant, got %d %q", w.Code, w.Body)
+	}
+	if w := doTenantRequest(t, h, http.MethodPost, "/update/gauge/load/1", "", "acme"); w.Code != http.StatusOK {
+		t.Errorf("Expected allowlisted tenant to be created, got %d (%s)", w.Code, w.Body)
+	}
+
+	// Запись с токеном создаёт арендатора, пока не достигнут предел
+	s.config.Auth = store
+	h = s.Router()
+	if w := doTenantRequest(t, h, http.MethodPost, "/update/gauge/load/2", "ci-secret", "globex"); w.Code != http.StatusOK {
+		t.Errorf("Expected authenticated write to create a tenant, got %d (%s)", w.Code, w.Body)
+	}
+	w = doTenantRequest(t, h, http.MethodPost, "/update/gauge/load/3", "ci-secret", "initech")
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 above the tenant limit, got %d (%s)", w.Code, w.Body)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/write", strings.NewReader("load value=1"))
+	req.Header.Set("Authorization", "Bearer ci-secret")
+	req.Header.Set(tenant.Header, "initech")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 on /write above the tenant limit, got %d (%s)", w.Code, w.Body)
+	}
+
+	// Чтение неизвестного арендатора — 404 без создания пространства
+	if w := doTenantRequest(t, h, http.MethodGet, "/metrics", "ci-secret", "initech"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown tenant, got %d", w.Code)
+	}
+	if _, ok := s.tenants.lookup("initech"); ok {
+		t.Error("Rejected writes and reads must not create a tenant")
+	}
+	if n := len(s.tenants.list()); n != 3 {
+		t.Errorf("Expected 3 tenants, got %d", n)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/auth"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/cumulative"
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/otlp"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/telemetry"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/tenant"
+)
+
+// tenantSpace — пространство имён арендатора: хранилище и состояние перевода
+// накопленных счётчиков в приращения (у разных арендаторов одинаковые ряды независимы)
+type tenantSpace struct {
+	storage    *MetricsStorage
+	cumulative *cumulative.Converter
+	otlp       *otlp.Converter
+}
+
+// Ошибки создания арендатора
+var (
+	errTenantNotAllowed = errors.New("tenant is not allowed")
+	errTenantLimit      = errors.New("tenant limit exceeded")
+)
+
+// tenantStore — пространства арендаторов. Пространство создаётся при первой записи
+// с токеном либо для арендатора из списка allowed; чтение несуществующего арендатора
+// пространство не создаёт. Число арендаторов ограничено max (0 — без ограничения).
+type tenantStore struct {
+	mu        sync.RWMutex
+	spaces    map[string]*tenantSpace
+	allowed   map[string]bool
+	max       int
+	opts      otlp.Options
+	telemetry *telemetry.Registry
+}
+
+func newTenantStore(def *tenantSpace, opts otlp.Options, reg *telemetry.Registry, allowed []string, max int) *tenantStore {
+	def.storage.SetTelemetry(reg)
+	ts := &tenantStore{
+		spaces:    map[string]*tenantSpace{tenant.Default: def},
+		allowed:   make(map[string]bool, len(allowed)),
+		max:       max,
+		opts:      opts,
+		telemetry: reg,
+	}
+	for _, id := range allowed {
+		ts.allowed[id] = true
+	}
+	return ts
+}
+
+func (ts *tenantStore) newSpace() *tenantSpace {
+	cum := cumulative.NewConverter()
+	storage := NewMetricsStorage()
+	storage.SetTelemetry(ts.telemetry)
+	return &tenantSpace{
+		storage:    storage,
+		cumulative: cum,
+		otlp:       otlp.NewConverter(ts.opts, cum),
+	}
+}
+
+// lookup возвращает пространство существующего арендатора id
+func (ts *tenantStore) lookup(id string) (*tenantSpace, bool) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	sp, ok := ts.spaces[id]
+	return sp, ok
+}
+
+// create возвращает пространство арендатора id, регистрируя отсутствующее.
+// Без токена (authenticated == false) создаются только арендаторы из списка allowed.
+func (ts *tenantStore) create(id string, authenticated bool) (*tenantSpace, error) {
+	if sp, ok := ts.lookup(id); ok {
+		return sp, nil
+	}
+	if !authenticated && !ts.allowed[id] {
+		return nil, errTenantNotAllowed
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if sp, ok := ts.spaces[id]; ok {
+		return sp, nil
+	}
+	if ts.max > 0 && len(ts.spaces) >= ts.max {
+		return nil, errTenantLimit
+	}
+	sp := ts.newSpace()
+	ts.spaces[id] = sp
+	return sp, nil
+}
+
+// seriesCount возвращает число серий всех арендаторов
+func (ts *tenantStore) seriesCount() int {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	total := 0
+	for _, sp := range ts.spaces {
+		total += sp.storage.SeriesCount()
+	}
+	return total
+}
+
+// ping проверяет доступность хранилищ всех арендаторов
+func (ts *tenantStore) ping(ctx context.Context) error {
+	ts.mu.RLock()
+	spaces := make(map[string]*tenantSpace, len(ts.spaces))
+	for id, sp := range ts.spaces {
+		spaces[id] = sp
+	}
+	ts.mu.RUnlock()
+	for id, sp := range spaces {
+		if err := sp.storage.Ping(ctx); err != nil {
+			return fmt.Errorf("tenant %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// collectStorageStats выставляет число серий по арендаторам и типам перед снимком
+// собственных метрик
+func (s *Server) collectStorageStats() {
+	s.tenants.mu.RLock()
+	spaces := make(map[string]*tenantSpace, len(s.tenants.spaces))
+	for id, sp := range s.tenants.spaces {
+		spaces[id] = sp
+	}
+	s.tenants.mu.RUnlock()
+
+	s.telemetry.Gauge("server_tenants", nil).Set(float64(len(spaces)))
+	for id, sp := range spaces {
+		for mtype, n := range sp.storage.SeriesByType() {
+			s.telemetry.Gauge("server_storage_series", models.Labels{"tenant": id, "type": mtype}).Set(float64(n))
+		}
+	}
+}
+
+// tenantInfo — строка списка арендаторов /admin/tenants
+type tenantInfo struct {
+	Tenant string `json:"tenant"`
+	Series int    `json:"series"`
+}
+
+// list возвращает арендаторов с числом рядов, отсортированных по имени
+func (ts *tenantStore) list() []tenantInfo {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	res := make([]tenantInfo, 0, len(ts.spaces))
+	for id, sp := range ts.spaces {
+		res = append(res, tenantInfo{Tenant: id, Series: sp.storage.SeriesCount()})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Tenant < res[j].Tenant })
+	return res
+}
+
+// TenantLogger — запись журнала запроса, в которую попадает арендатор
+type TenantLogger interface {
+	SetTenant(id string)
+}
+
+// tenantMiddleware определяет арендатора запроса: арендатор токена либо заголовок
+// X-Tenant-ID, по умолчанию default. Токен, привязанный к арендатору, не может
+// обратиться к другому (403).
+func (s *Server) tenantMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(tenant.Header)
+		if t, ok := auth.FromContext(r.Context()); ok && t.Tenant != "" {
+			if id != "" && id != t.Tenant {
+				auth.WriteError(w, http.StatusForbidden,
+					fmt.Sprintf("token %q is not allowed to access tenant %q", t.Name, id))
+				return
+			}
+			id = t.Tenant
+		}
+		if id == "" {
+			id = tenant.Default
+		}
+		if err := tenant.Validate(id); err != nil {
+			auth.WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if tl, ok := middleware.GetLogEntry(r).(TenantLogger); ok {
+			tl.SetTenant(id)
+		}
+		next.ServeHTTP(w, r.WithContext(tenant.WithTenant(r.Context(), id)))
+	})
+}
+
+// knownTenant отвечает 404 на чтение арендатора, у которого ещё нет пространства
+func (s *Server) knownTenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := tenant.FromContext(r.Context())
+		if _, ok := s.tenants.lookup(id); !ok {
+			auth.WriteError(w, http.StatusNotFound, fmt.Sprintf("unknown tenant %q", id))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeSpace возвращает пространство арендатора для записи, создавая его по правилам
+// tenantStore.create; отказ — limitError (403 или 429)
+func (s *Server) writeSpace(ctx context.Context) (*tenantSpace, error) {
+	_, authenticated := auth.FromContext(ctx)
+	sp, err := s.tenants.create(tenant.FromContext(ctx), authenticated)
+	switch {
+	case errors.Is(err, errTenantNotAllowed):
+		return nil, s.reject(rejectUnknownTenant, http.StatusForbidden,
+			"tenant %q is not allowed: write with an API token or add it to -tenants", tenant.FromContext(ctx))
+	case errors.Is(err, errTenantLimit):
+		return nil, s.reject(rejectTenantLimit, http.StatusTooManyRequests,
+			"tenant limit %d exceeded", s.tenants.max)
+	}
+	return sp, err
+}
+
+// storageFor возвращает хранилище арендатора запроса для чтения. Маршруты чтения
+// проходят knownTenant, поэтому пространство существует.
+func (s *Server) storageFor(r *http.Request) *MetricsStorage {
+	sp, _ := s.tenants.lookup(tenant.FromContext(r.Context()))
+	return sp.storage
+}
+
+// tenantsHandler возвращает арендаторов и число их рядов (GET /admin/tenants)
+func (s *Server) tenantsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.tenants.list())
+}
@@ -3,11 +3,65 @@ package agent
 import (
 	"bytes"
 	"compress/gzip"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"time"
 )
 
+// StatusError — ответ сервера с неуспешным статусом. RetryAfter — пауза,
+// которую сервер просит выдержать перед повтором (заголовок Retry-After).
+type StatusError struct {
+	Code       int
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("server returned status %d", e.Code)
+}
+
+// Retryable сообщает, стоит ли повторить отправку после ошибки: сетевые ошибки,
+// 5xx и 429 временные, остальные статусы означают, что сервер отклонил данные
+func Retryable(err error) bool {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Code >= http.StatusInternalServerError || se.Code == http.StatusTooManyRequests
+	}
+	return err != nil
+}
+
+// retryAfter возвращает паузу перед повтором, которую запросил сервер
+func retryAfter(err error) time.Duration {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.RetryAfter
+	}
+	return 0
+}
+
+// parseRetryAfter разбирает Retry-After: число секунд или HTTP дата
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
 func SendGzipJSON(url string, jsonData []byte) error {
+	return sendGzipJSON(&http.Client{}, url, "", jsonData)
+}
+
+// sendGzipJSON отправляет сжатое JSON тело заданным клиентом и проверяет статус ответа.
+// Непустой token передаётся в заголовке Authorization: Bearer.
+func sendGzipJSON(client *http.Client, url, token string, jsonData []byte) error {
 	var buf bytes.Buffer
 	gz := gzip.NewWriter(&buf)
 
@@ -26,8 +80,7 @@ func SendGzipJSON(url string, jsonData []byte) error {
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Content-Encoding", "gzip") // тело запроса в gzip
 	req.Header.Set("Accept-Encoding", "gzip")  // ожидаем gzipped ответ
-
-	client := http.Client{}
+	setToken(req, token)
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -35,6 +88,10 @@ func SendGzipJSON(url string, jsonData []byte) error {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{Code: resp.StatusCode, RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())}
+	}
+
 	var reader io.Reader = resp.Body
 
 	// Распаковываем gzip ответ, если он есть
@@ -51,3 +108,10 @@ func SendGzipJSON(url string, jsonData []byte) error {
 	_, err = io.ReadAll(reader)
 	return err
 }
+
+// setToken добавляет bearer токен к запросу, если он задан
+func setToken(req *http.Request, token string) {
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+}
@@ -0,0 +1,149 @@
+package agent
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+)
+
+// AggregationMode — способ передачи значений gauge, накопленных за окно отправки
+type AggregationMode string
+
+const (
+	// AggregateLast — отправляется только последнее значение (прежнее поведение)
+	AggregateLast AggregationMode = "last"
+	// AggregateSuffix — кроме последнего значения отправляются серии name_min, name_max,
+	// name_avg и name_count (число опросов за окно)
+	AggregateSuffix AggregationMode = "suffix"
+	// AggregateHistogram — кроме последнего значения отправляется histogram name_hist
+	// со всеми значениями за окно
+	AggregateHistogram AggregationMode = "histogram"
+)
+
+// Статистики режима suffix
+const (
+	StatMin   = "min"
+	StatMax   = "max"
+	StatAvg   = "avg"
+	StatCount = "count"
+)
+
+// HistogramSuffix — суффикс имени гистограммы значений gauge в режиме histogram
+const HistogramSuffix = "_hist"
+
+// AggregationConfig — агрегация gauge между отправками
+type AggregationConfig struct {
+	Mode AggregationMode `yaml:"mode"`
+	// Stats — статистики режима suffix, по умолчанию все
+	Stats []string `yaml:"stats"`
+	// Buckets — границы корзин режима histogram, по умолчанию models.DefaultBuckets
+	Buckets []float64 `yaml:"histogram_buckets"`
+	// Include — регулярные выражения имён gauge; пусто — агрегируются все gauge
+	Include []string `yaml:"include"`
+}
+
+type aggregator struct {
+	mode    AggregationMode
+	stats   []string
+	buckets []float64
+	include []*regexp.Regexp
+}
+
+func newAggregator(cfg AggregationConfig) (*aggregator, error) {
+	a := &aggregator{mode: cfg.Mode, stats: cfg.Stats, buckets: cfg.Buckets}
+	switch a.mode {
+	case "", AggregateLast:
+		return nil, nil
+	case AggregateSuffix:
+		if len(a.stats) == 0 {
+			a.stats = []string{StatMin, StatMax, StatAvg, StatCount}
+		}
+		for _, st := range a.stats {
+			switch st {
+			case StatMin, StatMax, StatAvg, StatCount:
+			default:
+				return nil, fmt.Errorf("unknown aggregation stat %q", st)
+			}
+		}
+	case AggregateHistogram:
+		if len(a.buckets) == 0 {
+			a.buckets = models.DefaultBuckets
+		}
+	default:
+		return nil, fmt.Errorf("unknown aggregation mode %q", a.mode)
+	}
+	for _, expr := range cfg.Include {
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("aggregation include %q: %w", expr, err)
+		}
+		a.include = append(a.include, re)
+	}
+	return a, nil
+}
+
+func (a *aggregator) applies(name string) bool {
+	if len(a.include) == 0 {
+		return true
+	}
+	for _, re := range a.include {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// gaugeWindow — значения одной серии gauge за окно отправки
+type gaugeWindow struct {
+	min, max, sum float64
+	count         int
+	hist          *models.HistogramValue
+}
+
+func (a *aggregator) newWindow() *gaugeWindow {
+	w := &gaugeWindow{min: math.Inf(1), max: math.Inf(-1)}
+	if a.mode == AggregateHistogram {
+		w.hist = models.NewHistogram(a.buckets)
+	}
+	return w
+}
+
+func (w *gaugeWindow) observe(v float64) {
+	w.min = math.Min(w.min, v)
+	w.max = math.Max(w.max, v)
+	w.sum += v
+	w.count++
+	if w.hist != nil {
+		w.hist.Observe(v)
+	}
+}
+
+// emit возвращает агрегаты окна для серии m (имя и метки берутся из неё)
+func (a *aggregator) emit(m models.Metrics, w *gaugeWindow) []models.Metrics {
+	if w.count == 0 {
+		return nil
+	}
+	if a.mode == AggregateHistogram {
+		return []models.Metrics{{ID: m.ID + HistogramSuffix, MType: models.Histogram, Histogram: w.hist, Labels: m.Labels}}
+	}
+
+	res := make([]models.Metrics, 0, len(a.stats))
+	for _, st := range a.stats {
+		var v float64
+		switch st {
+		case StatMin:
+			v = w.min
+		case StatMax:
+			v = w.max
+		case StatAvg:
+			v = w.sum / float64(w.count)
+		case StatCount:
+			v = float64(w.count)
+		}
+		res = append(res, models.Metrics{ID: m.ID + "_" + st, MType: models.Gauge, Value: &v, Labels: m.Labels})
+	}
+	return res
+}
@@ -0,0 +1,103 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+)
+
+// gaugeSeries возвращает источник, отдающий по одному значению values на каждый опрос
+func gaugeSeries(values ...float64) *funcSource {
+	i := 0
+	return &funcSource{name: "series", collect: func(ctx context.Context) ([]models.Metrics, error) {
+		v := values[i%len(values)]
+		i++
+		other := 1.0
+		return []models.Metrics{
+			{ID: "load", MType: models.Gauge, Value: &v, Labels: models.Labels{"host": "a"}},
+			{ID: "other", MType: models.Gauge, Value: &other},
+		}, nil
+	}}
+}
+
+func collectWindow(t *testing.T, cfg AggregationConfig, values ...float64) []models.Metrics {
+	t.Helper()
+	r := NewRegistry()
+	if err := r.SetAggregation(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Add(gaugeSeries(values...), time.Second, 0); err != nil {
+		t.Fatal(err)
+	}
+	for range values {
+		r.CollectOnce(context.Background())
+	}
+	return r.Take()
+}
+
+func TestAggregationSuffix(t *testing.T) {
+	metrics := collectWindow(t, AggregationConfig{Mode: AggregateSuffix, Include: []string{"lo.*"}}, 3, 9, 1, 7)
+	labels := models.Labels{"host": "a"}
+
+	want := map[string]float64{"load": 7, "load_min": 1, "load_max": 9, "load_avg": 5, "load_count": 4}
+	for id, v := range want {
+		if m := findMetric(metrics, models.Gauge, id, labels); m == nil || *m.Value != v {
+			t.Errorf("Expected %s=%v, got %+v", id, v, m)
+		}
+	}
+	// Gauge, не подходящие под include, отправляются без агрегатов
+	if findMetric(metrics, models.Gauge, "other_max", nil) != nil {
+		t.Error("Gauges outside include must not be aggregated")
+	}
+}
+
+func TestAggregationWindowReset(t *testing.T) {
+	r := NewRegistry()
+	if err := r.SetAggregation(AggregationConfig{Mode: AggregateSuffix, Stats: []string{StatMax}}); err != nil {
+		t.Fatal(err)
+	}
+	r.Add(gaugeSeries(10, 2), time.Second, 0)
+
+	r.CollectOnce(context.Background())
+	r.Take()
+	r.CollectOnce(context.Background())
+	metrics := r.Take()
+
+	if m := findMetric(metrics, models.Gauge, "load_max", models.Labels{"host": "a"}); m == nil || *m.Value != 2 {
+		t.Errorf("Expected max of the new window only, got %+v", m)
+	}
+	if findMetric(metrics, models.Gauge, "load_min", models.Labels{"host": "a"}) != nil {
+		t.Error("Only configured stats must be sent")
+	}
+}
+
+func TestAggregationHistogram(t *testing.T) {
+	cfg := AggregationConfig{Mode: AggregateHistogram, Buckets: []float64{5, 10}}
+	metrics := collectWindow(t, cfg, 3, 9, 1, 70)
+
+	m := findMetric(metrics, models.Histogram, "load"+HistogramSuffix, models.Labels{"host": "a"})
+	if m == nil {
+		t.Fatal("Expected window histogram")
+	}
+	if m.Histogram.Count != 4 || m.Histogram.Sum != 83 || m.Histogram.Counts[0] != 2 || m.Histogram.Counts[2] != 1 {
+		t.Errorf("Unexpected histogram %+v", m.Histogram)
+	}
+	if g := findMetric(metrics, models.Gauge, "load", models.Labels{"host": "a"}); g == nil || *g.Value != 70 {
+		t.Errorf("Last value must still be sent, got %+v", g)
+	}
+}
+
+func TestAggregationConfigErrors(t *testing.T) {
+	r := NewRegistry()
+	for _, cfg := range []AggregationConfig{
+		{Mode: "median"},
+		{Mode: AggregateSuffix, Stats: []string{"p99"}},
+		{Mode: AggregateSuffix, Include: []string{"("}},
+	} {
+		if err := r.SetAggregation(cfg); err == nil {
+			t.Errorf("Expected error for %+v", cfg)
+		}
+	}
+}
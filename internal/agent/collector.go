@@ -1,70 +1,99 @@
 package agent
 
 import (
-	"math/rand"
-	"runtime"
+	"context"
 	"sync"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/sketch"
+)
+
+const (
+	gcPauseHistogram = "GCPauseMs"
+	gcPauseSummary   = "GCPauseMsSummary"
 )
 
+// Collector хранит последние значения runtime и random источников в виде
+// отдельных карт gauge и counter. Используется там, где нужен прежний API;
+// агент опрашивает источники через Registry.
 type Collector struct {
 	mu      *sync.Mutex
 	gauge   map[string]float64
 	counter map[string]int64
-}
 
-func (c *Collector) UpdateMetrics() {
-	panic("unimplemented")
+	runtime *RuntimeSource
+	random  *RandomSource
+
+	// Распределение пауз GC между отправками
+	buckets   []float64
+	histogram *models.HistogramValue
+	sketch    *sketch.DDSketch
 }
 
 func NewCollector() *Collector {
 	return &Collector{
-		mu:      &sync.Mutex{},
-		gauge:   make(map[string]float64),
-		counter: make(map[string]int64),
+		mu:        &sync.Mutex{},
+		gauge:     make(map[string]float64),
+		counter:   make(map[string]int64),
+		runtime:   NewRuntimeSource("runtime"),
+		random:    &RandomSource{name: "random"},
+		buckets:   models.DefaultBuckets,
+		histogram: models.NewHistogram(models.DefaultBuckets),
+		sketch:    sketch.New(sketch.DefaultAlpha),
+	}
+}
+
+// SetHistogramBuckets задаёт границы корзин гистограммы пауз GC
+func (c *Collector) SetHistogramBuckets(bounds []float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.buckets = append([]float64(nil), bounds...)
+	c.histogram = models.NewHistogram(c.buckets)
+	c.runtime.SetHistogramBuckets(c.buckets)
+}
+
+// UpdateMetrics собирает runtime метрики и увеличивает PollCount
+func (c *Collector) UpdateMetrics() {
+	ctx := context.Background()
+	metrics, _ := c.runtime.Collect(ctx)
+	random, _ := c.random.Collect(ctx)
+	metrics = append(metrics, random...)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, m := range metrics {
+		switch m.MType {
+		case models.Gauge:
+			c.gauge[m.ID] = *m.Value
+		case models.Counter:
+			c.counter[m.ID] += *m.Delta
+		case models.Histogram:
+			if err := c.histogram.Merge(m.Histogram); err != nil {
+				c.histogram = m.Histogram
+			}
+		case models.Summary:
+			c.sketch.Merge(m.Sketch)
+		}
 	}
 }
 
-func (c *Collector) UdateMetrics() {
+// TakeDistributions возвращает накопленные с прошлого вызова histogram и summary
+// метрики и сбрасывает их: сервер сливает полученные распределения с сохранёнными
+func (c *Collector) TakeDistributions() []models.Metrics {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	var m runtime.MemStats
-	runtime.ReadMemStats(&m)
-
-	// Gauge метрики из runtime
-	c.gauge["Alloc"] = float64(m.Alloc)
-	c.gauge["BuckHashSys"] = float64(m.BuckHashSys)
-	c.gauge["Frees"] = float64(m.Frees)
-	c.gauge["GCCPUFraction"] = m.GCCPUFraction
-	c.gauge["GCSys"] = float64(m.GCSys)
-	c.gauge["HeapAlloc"] = float64(m.HeapAlloc)
-	c.gauge["HeapIdle"] = float64(m.HeapIdle)
-	c.gauge["HeapInuse"] = float64(m.HeapInuse)
-	c.gauge["HeapObjects"] = float64(m.HeapObjects)
-	c.gauge["HeapReleased"] = float64(m.HeapReleased)
-	c.gauge["HeapSys"] = float64(m.HeapSys)
-	c.gauge["LastGC"] = float64(m.LastGC)
-	c.gauge["Lookups"] = float64(m.Lookups)
-	c.gauge["MCacheInuse"] = float64(m.MCacheInuse)
-	c.gauge["MCacheSys"] = float64(m.MCacheSys)
-	c.gauge["MSpanInuse"] = float64(m.MSpanInuse)
-	c.gauge["MSpanSys"] = float64(m.MSpanSys)
-	c.gauge["Mallocs"] = float64(m.Mallocs)
-	c.gauge["NextGC"] = float64(m.NextGC)
-	c.gauge["NumForcedGC"] = float64(m.NumForcedGC)
-	c.gauge["NumGC"] = float64(m.NumGC)
-	c.gauge["OtherSys"] = float64(m.OtherSys)
-	c.gauge["PauseTotalNs"] = float64(m.PauseTotalNs)
-	c.gauge["StackInuse"] = float64(m.StackInuse)
-	c.gauge["StackSys"] = float64(m.StackSys)
-	c.gauge["Sys"] = float64(m.Sys)
-	c.gauge["TotalAlloc"] = float64(m.TotalAlloc)
-
-	//RandomValue (тип gauge) — обновляемое произвольное значение
-	c.gauge["RandomValue"] = rand.Float64()
-
-	// Counter метрики
-	c.counter["PollCount"]++
+	var res []models.Metrics
+	if c.histogram.Count > 0 {
+		res = append(res, models.Metrics{ID: gcPauseHistogram, MType: models.Histogram, Histogram: c.histogram})
+		c.histogram = models.NewHistogram(c.buckets)
+	}
+	if c.sketch.Count > 0 {
+		res = append(res, models.Metrics{ID: gcPauseSummary, MType: models.Summary, Sketch: c.sketch})
+		c.sketch = sketch.New(sketch.DefaultAlpha)
+	}
+	return res
 }
 
 // GetGauges возвращает копию всех gauge метрик
@@ -73,8 +102,8 @@ func (c *Collector) GetGauges() map[string]float64 {
 	defer c.mu.Unlock()
 
 	result := make(map[string]float64)
-	for k, v := range c.counter {
-		result[k] = float64(v)
+	for k, v := range c.gauge {
+		result[k] = v
 	}
 	return result
 }
@@ -1,6 +1,7 @@
 package agent
 
 import (
+	"runtime"
 	"sync"
 	"testing"
 )
@@ -219,3 +220,37 @@ func TestConcurrentAccess(t *testing.T) {
 		t.Errorf("Invalid RandomValue: %f", randomValue)
 	}
 }
+
+func TestTakeDistributions(t *testing.T) {
+	collector := NewCollector()
+	collector.SetHistogramBuckets([]float64{0.1, 1, 10})
+
+	collector.UpdateMetrics()
+	runtime.GC()
+	collector.UpdateMetrics()
+
+	distributions := collector.TakeDistributions()
+	if len(distributions) != 2 {
+		t.Fatalf("Expected histogram and summary after GC, got %d metrics", len(distributions))
+	}
+
+	for _, m := range distributions {
+		switch m.MType {
+		case "histogram":
+			if m.Histogram.Count == 0 || len(m.Histogram.Bounds) != 3 {
+				t.Errorf("Unexpected histogram: %+v", m.Histogram)
+			}
+		case "summary":
+			if m.Sketch.Count == 0 {
+				t.Error("Expected non-empty sketch")
+			}
+		default:
+			t.Errorf("Unexpected metric type %s", m.MType)
+		}
+	}
+
+	// После выдачи распределения сбрасываются
+	if len(collector.TakeDistributions()) != 0 {
+		t.Error("Expected distributions to be reset after TakeDistributions()")
+	}
+}
@@ -0,0 +1,240 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/influx"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/logger"
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+)
+
+// Форматы вывода команд exec источника
+const (
+	// ExecFormatSimple — строки вида `name type value [label=value,...]`, type: gauge или counter
+	ExecFormatSimple = "simple"
+	// ExecFormatInflux — InfluxDB line protocol, поля становятся gauge
+	ExecFormatInflux = "influx"
+)
+
+const (
+	// maxExecOutput — предел чтения stdout команды; остаток отбрасывается
+	maxExecOutput = 1 << 20
+	// execWaitDelay — сколько ждать закрытия вывода после завершения или убийства команды
+	execWaitDelay = time.Second
+)
+
+// ExecOptions — параметры источника типа exec
+type ExecOptions struct {
+	// Command — программа и аргументы; оболочка не используется
+	Command []string      `yaml:"command"`
+	Format  string        `yaml:"format"`
+	Dir     string        `yaml:"dir"`
+	Env     []string      `yaml:"env"`
+	Labels  models.Labels `yaml:"labels"`
+}
+
+// ExecSource периодически запускает команду и разбирает её stdout.
+// Ненулевой код выхода и таймаут не считаются ошибкой источника: они отражаются
+// метриками agent_exec_success и agent_exec_exit_code, вывод такой команды не используется.
+// По таймауту убивается вся группа процессов команды.
+type ExecSource struct {
+	name string
+	opts ExecOptions
+}
+
+func NewExecSource(name string, opts ExecOptions) (*ExecSource, error) {
+	if len(opts.Command) == 0 || opts.Command[0] == "" {
+		return nil, fmt.Errorf("exec source %s: missing command", name)
+	}
+	switch opts.Format {
+	case "":
+		opts.Format = ExecFormatSimple
+	case ExecFormatSimple, ExecFormatInflux:
+	default:
+		return nil, fmt.Errorf("exec source %s: unknown format %q", name, opts.Format)
+	}
+	if err := opts.Labels.Validate(); err != nil {
+		return nil, fmt.Errorf("exec source %s: %w", name, err)
+	}
+	return &ExecSource{name: name, opts: opts}, nil
+}
+
+func init() {
+	RegisterSource("exec", func(cfg SourceConfig) (Source, error) {
+		var opts ExecOptions
+		if err := cfg.DecodeOptions(&opts); err != nil {
+			return nil, err
+		}
+		return NewExecSource(cfg.Name, opts)
+	})
+}
+
+func (s *ExecSource) Name() string { return s.name }
+
+// HandlesTimeout сообщает реестру, что источник сам завершает команду по дедлайну
+// контекста и возвращает метрики о таймауте
+func (s *ExecSource) HandlesTimeout() bool { return true }
+
+func (s *ExecSource) Collect(ctx context.Context) ([]models.Metrics, error) {
+	cmd := exec.CommandContext(ctx, s.opts.Command[0], s.opts.Command[1:]...)
+	cmd.Dir = s.opts.Dir
+	if len(s.opts.Env) > 0 {
+		cmd.Env = append(cmd.Environ(), s.opts.Env...)
+	}
+	setProcessGroup(cmd)
+	cmd.WaitDelay = execWaitDelay
+
+	stdout := &limitedBuffer{limit: maxExecOutput}
+	stderr := &limitedBuffer{limit: 4096}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+
+	start := time.Now()
+	err := cmd.Run()
+	duration := time.Since(start).Seconds()
+
+	exitCode := 0
+	timedOut := ctx.Err() != nil
+	if err != nil {
+		var exitErr *exec.ExitError
+		switch {
+		case timedOut:
+			exitCode = -1
+		case errors.As(err, &exitErr):
+			exitCode = exitErr.ExitCode()
+		default:
+			// Команду не удалось запустить — это ошибка конфигурации источника
+			return nil, fmt.Errorf("exec %s: %w", s.opts.Command[0], err)
+		}
+	}
+
+	success := 1.0
+	var res []models.Metrics
+	var parseErrors int64
+	if err != nil {
+		success = 0
+		logger.FromContext(ctx).Info().Msgf("Exec source %s: command failed (exit code %d, timed out: %v): %s",
+			s.name, exitCode, timedOut, strings.TrimSpace(stderr.String()))
+	} else {
+		var perrs []error
+		res, perrs = s.parse(stdout.Bytes())
+		parseErrors = int64(len(perrs))
+		for _, pe := range perrs {
+			logger.FromContext(ctx).Debug().Msgf("Exec source %s: %v", s.name, pe)
+		}
+	}
+
+	labels := models.Labels{"source": s.name}
+	code := float64(exitCode)
+	var timeouts int64
+	if timedOut {
+		timeouts = 1
+	}
+	res = append(res,
+		models.Metrics{ID: "agent_exec_success", MType: models.Gauge, Value: &success, Labels: labels},
+		models.Metrics{ID: "agent_exec_exit_code", MType: models.Gauge, Value: &code, Labels: labels},
+		models.Metrics{ID: "agent_exec_duration_seconds", MType: models.Gauge, Value: &duration, Labels: labels},
+		models.Metrics{ID: "agent_exec_timeouts_total", MType: models.Counter, Delta: &timeouts, Labels: labels},
+		models.Metrics{ID: "agent_exec_parse_errors_total", MType: models.Counter, Delta: &parseErrors, Labels: labels},
+	)
+	return res, nil
+}
+
+// parse разбирает вывод команды; метки источника добавляются к каждой метрике
+func (s *ExecSource) parse(out []byte) ([]models.Metrics, []error) {
+	var (
+		metrics []models.Metrics
+		errs    []error
+	)
+	if s.opts.Format == ExecFormatInflux {
+		points, lineErrs := influx.Parse(out, influx.Second)
+		for _, le := range lineErrs {
+			errs = append(errs, le)
+		}
+		for _, p := range points {
+			metrics = append(metrics, influx.ToMetrics(p, influx.Options{})...)
+		}
+	} else {
+		sc := bufio.NewScanner(bytes.NewReader(out))
+		lineNo := 0
+		for sc.Scan() {
+			lineNo++
+			line := strings.TrimSpace(sc.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			m, err := ParseSimpleLine(line)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("line %d: %w", lineNo, err))
+				continue
+			}
+			metrics = append(metrics, m)
+		}
+	}
+
+	if len(s.opts.Labels) > 0 {
+		for i := range metrics {
+			metrics[i].Labels = s.opts.Labels.Merge(metrics[i].Labels)
+		}
+	}
+	return metrics, errs
+}
+
+// ParseSimpleLine разбирает строку `name type value [label=value,...]`.
+// Значение counter — приращение за один запуск команды.
+func ParseSimpleLine(line string) (models.Metrics, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || len(fields) > 4 {
+		return models.Metrics{}, fmt.Errorf("expected `name type value [labels]`, got %q", line)
+	}
+	m := models.Metrics{ID: fields[0], MType: fields[1]}
+	switch m.MType {
+	case models.Gauge:
+		v, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return m, fmt.Errorf("invalid gauge value %q", fields[2])
+		}
+		m.Value = &v
+	case models.Counter:
+		d, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return m, fmt.Errorf("invalid counter value %q", fields[2])
+		}
+		m.Delta = &d
+	default:
+		return m, fmt.Errorf("unknown metric type %q: expected gauge or counter", m.MType)
+	}
+	if len(fields) == 4 {
+		labels, err := models.ParseLabels(fields[3])
+		if err != nil {
+			return m, err
+		}
+		m.Labels = labels
+	}
+	return m, nil
+}
+
+// limitedBuffer сохраняет не более limit байт, остальное отбрасывает без ошибки,
+// чтобы команда не блокировалась на записи
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); room > 0 {
+		if len(p) > room {
+			b.Buffer.Write(p[:room])
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,145 @@
+//go:build unix
+
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+)
+
+func newShellSource(t *testing.T, script, format string) *ExecSource {
+	t.Helper()
+	s, err := NewExecSource("test", ExecOptions{
+		Command: []string{"/bin/sh", "-c", script},
+		Format:  format,
+		Labels:  models.Labels{"team": "ops"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestExecSourceSimple(t *testing.T) {
+	s := newShellSource(t, `echo "queue_depth gauge 12 queue=mail"; echo "# comment"; echo "jobs counter 3"; echo "bad line"`, "")
+	metrics, err := s.Collect(context.Background())
+	if err != nil {
+		t.Fatalf("Collect() failed: %v", err)
+	}
+
+	if m := findMetric(metrics, models.Gauge, "queue_depth", models.Labels{"queue": "mail", "team": "ops"}); m == nil || *m.Value != 12 {
+		t.Errorf("Expected queue_depth 12, got %+v", m)
+	}
+	if m := findMetric(metrics, models.Counter, "jobs", models.Labels{"team": "ops"}); m == nil || *m.Delta != 3 {
+		t.Errorf("Expected jobs 3, got %+v", m)
+	}
+	labels := models.Labels{"source": "test"}
+	if m := findMetric(metrics, models.Gauge, "agent_exec_success", labels); m == nil || *m.Value != 1 {
+		t.Errorf("Expected success 1, got %+v", m)
+	}
+	if m := findMetric(metrics, models.Counter, "agent_exec_parse_errors_total", labels); m == nil || *m.Delta != 1 {
+		t.Errorf("Expected 1 parse error, got %+v", m)
+	}
+}
+
+func TestExecSourceInflux(t *testing.T) {
+	s := newShellSource(t, `echo "cert,domain=example.com expiry_days=42i"`, ExecFormatInflux)
+	metrics, err := s.Collect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := models.Labels{"domain": "example.com", "team": "ops"}
+	if m := findMetric(metrics, models.Gauge, "cert_expiry_days", labels); m == nil || *m.Value != 42 {
+		t.Errorf("Expected cert_expiry_days 42, got %+v", m)
+	}
+}
+
+func TestExecSourceExitFailure(t *testing.T) {
+	s := newShellSource(t, `echo "ignored gauge 1"; exit 3`, "")
+	metrics, err := s.Collect(context.Background())
+	if err != nil {
+		t.Fatalf("Exit failure must be reported as metrics, got error %v", err)
+	}
+	labels := models.Labels{"source": "test"}
+	if m := findMetric(metrics, models.Gauge, "agent_exec_exit_code", labels); m == nil || *m.Value != 3 {
+		t.Errorf("Expected exit code 3, got %+v", m)
+	}
+	if m := findMetric(metrics, models.Gauge, "agent_exec_success", labels); m == nil || *m.Value != 0 {
+		t.Errorf("Expected success 0, got %+v", m)
+	}
+	if findMetric(metrics, models.Gauge, "ignored", models.Labels{"team": "ops"}) != nil {
+		t.Error("Output of a failed command must not be reported")
+	}
+}
+
+func TestExecSourceTimeoutKillsProcessGroup(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "child.pid")
+	s := newShellSource(t, "sleep 30 & echo $! > "+pidFile+"; sleep 30", "")
+
+	r := NewRegistry()
+	if err := r.Add(s, time.Minute, 200*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	r.CollectOnce(context.Background())
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Runaway command was not killed in time: %v", elapsed)
+	}
+
+	metrics := r.Take()
+	labels := models.Labels{"source": "test"}
+	if m := findMetric(metrics, models.Counter, "agent_exec_timeouts_total", labels); m == nil || *m.Delta != 1 {
+		t.Errorf("Expected 1 timeout, got %+v", m)
+	}
+	if m := findMetric(metrics, models.Gauge, "agent_exec_exit_code", labels); m == nil || *m.Value != -1 {
+		t.Errorf("Expected exit code -1, got %+v", m)
+	}
+
+	// Фоновый процесс скрипта убит вместе с группой
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	deadline := time.Now().Add(2 * time.Second)
+	for processAlive(pid) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Background child %d survived the timeout", pid)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// processAlive сообщает, что процесс существует и не является зомби
+func processAlive(pid int) bool {
+	if syscall.Kill(pid, 0) != nil {
+		return false
+	}
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return true
+	}
+	fields := strings.Fields(string(stat))
+	return len(fields) < 3 || fields[2] != "Z"
+}
+
+func TestNewExecSourceErrors(t *testing.T) {
+	if _, err := NewExecSource("x", ExecOptions{}); err == nil {
+		t.Error("Expected error for missing command")
+	}
+	if _, err := NewExecSource("x", ExecOptions{Command: []string{"true"}, Format: "xml"}); err == nil {
+		t.Error("Expected error for unknown format")
+	}
+	s, _ := NewExecSource("x", ExecOptions{Command: []string{"/nonexistent/command"}})
+	if _, err := s.Collect(context.Background()); err == nil {
+		t.Error("Expected error when command cannot be started")
+	}
+}
@@ -0,0 +1,402 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/logger"
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+)
+
+const (
+	// maxLogLine — строка длиннее обрабатывается частями
+	maxLogLine = 64 * 1024
+	// maxLogReadPerCollect — предел чтения одного файла за опрос, остаток читается в следующий раз
+	maxLogReadPerCollect = 8 << 20
+)
+
+// LogRule — правило разбора строки лога. Именованные группы regex становятся метками,
+// кроме группы Value, из которой берётся значение.
+type LogRule struct {
+	Name string `yaml:"name"`
+	// Type — counter (увеличивается на 1 или на значение группы Value) или gauge (значение группы Value)
+	Type   string        `yaml:"type"`
+	Regex  string        `yaml:"regex"`
+	Value  string        `yaml:"value"`
+	Labels models.Labels `yaml:"labels"`
+
+	re *regexp.Regexp
+}
+
+// LogTailOptions — параметры источника типа logtail
+type LogTailOptions struct {
+	Files []string  `yaml:"files"`
+	Rules []LogRule `yaml:"rules"`
+	// Checkpoint — файл с позициями чтения; без него после перезапуска чтение начинается с конца
+	Checkpoint string `yaml:"checkpoint"`
+	// FromBeginning — читать файлы без сохранённой позиции с начала, а не с конца
+	FromBeginning bool `yaml:"from_beginning"`
+}
+
+type tailedFile struct {
+	path   string
+	f      *os.File
+	id     uint64
+	offset int64
+}
+
+type logPosition struct {
+	ID     uint64 `json:"inode"`
+	Offset int64  `json:"offset"`
+}
+
+// LogTailSource читает новые строки файлов при каждом опросе. Ротация определяется
+// по смене inode: старый файл дочитывается до конца, новый читается с начала.
+// Уменьшение размера файла считается усечением (copytruncate) — чтение с начала.
+// Позиции сохраняются в checkpoint только после отправки посчитанных строк (Checkpoint).
+type LogTailSource struct {
+	name string
+	opts LogTailOptions
+
+	mu      sync.Mutex
+	files   []*tailedFile
+	saved   map[string]logPosition
+	started bool
+}
+
+func NewLogTailSource(name string, opts LogTailOptions) (*LogTailSource, error) {
+	if len(opts.Files) == 0 {
+		return nil, fmt.Errorf("logtail source %s: no files", name)
+	}
+	if len(opts.Rules) == 0 {
+		return nil, fmt.Errorf("logtail source %s: no rules", name)
+	}
+	for i := range opts.Rules {
+		r := &opts.Rules[i]
+		if r.Name == "" {
+			return nil, fmt.Errorf("logtail source %s: rule %d: missing name", name, i)
+		}
+		re, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("logtail source %s: rule %s: %w", name, r.Name, err)
+		}
+		r.re = re
+		switch r.Type {
+		case "":
+			r.Type = models.Counter
+		case models.Counter:
+		case models.Gauge:
+			if r.Value == "" {
+				return nil, fmt.Errorf("logtail source %s: gauge rule %s requires value group", name, r.Name)
+			}
+		default:
+			return nil, fmt.Errorf("logtail source %s: rule %s: unknown type %q", name, r.Name, r.Type)
+		}
+		if r.Value != "" && re.SubexpIndex(r.Value) < 0 {
+			return nil, fmt.Errorf("logtail source %s: rule %s: no group named %q", name, r.Name, r.Value)
+		}
+		if err := r.Labels.Validate(); err != nil {
+			return nil, fmt.Errorf("logtail source %s: rule %s: %w", name, r.Name, err)
+		}
+	}
+
+	s := &LogTailSource{name: name, opts: opts, saved: make(map[string]logPosition)}
+	for _, path := range opts.Files {
+		s.files = append(s.files, &tailedFile{path: path})
+	}
+	if opts.Checkpoint != "" {
+		data, err := os.ReadFile(opts.Checkpoint)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return nil, fmt.Errorf("logtail source %s: %w", name, err)
+		default:
+			if err := json.Unmarshal(data, &s.saved); err != nil {
+				return nil, fmt.Errorf("logtail source %s: invalid checkpoint: %w", name, err)
+			}
+		}
+	}
+	return s, nil
+}
+
+func init() {
+	RegisterSource("logtail", func(cfg SourceConfig) (Source, error) {
+		var opts LogTailOptions
+		if err := cfg.DecodeOptions(&opts); err != nil {
+			return nil, err
+		}
+		return NewLogTailSource(cfg.Name, opts)
+	})
+}
+
+func (s *LogTailSource) Name() string { return s.name }
+
+// Close закрывает открытые файлы
+func (s *LogTailSource) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.files {
+		if t.f != nil {
+			t.f.Close()
+			t.f = nil
+		}
+	}
+	return nil
+}
+
+// HandlesTimeout реализует timeoutHandler: по дедлайну Collect прекращает чтение
+// и возвращает посчитанное, позиции соответствуют возвращённым метрикам
+func (s *LogTailSource) HandlesTimeout() bool { return true }
+
+func (s *LogTailSource) Collect(ctx context.Context) ([]models.Metrics, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc := newLogAccumulator()
+	var errs []error
+	for _, t := range s.files {
+		if err := s.follow(ctx, t, acc); err != nil {
+			errs = append(errs, err)
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	s.started = true
+
+	for _, err := range errs {
+		logger.FromContext(ctx).Info().Msgf("Logtail source %s: %v", s.name, err)
+	}
+	return acc.metrics(), nil
+}
+
+// Checkpoint возвращает сохранение текущих позиций в checkpoint; вызывается, когда
+// метрики, посчитанные до этих позиций, приняты, а сохранение — после их отправки
+func (s *LogTailSource) Checkpoint() func() error {
+	if s.opts.Checkpoint == "" {
+		return nil
+	}
+	s.mu.Lock()
+	positions := make(map[string]logPosition, len(s.saved))
+	for path, pos := range s.saved {
+		positions[path] = pos
+	}
+	s.mu.Unlock()
+	return func() error {
+		return writeCheckpoint(s.opts.Checkpoint, positions)
+	}
+}
+
+// Inherit реализует inheritor: чтение продолжается с позиций prev, даже если они
+// ещё не сохранены в checkpoint, чтобы строки, посчитанные prev, не учитывались дважды
+func (s *LogTailSource) Inherit(prev Source) {
+	p, ok := prev.(*LogTailSource)
+	if !ok || p == s || p.opts.Checkpoint != s.opts.Checkpoint {
+		return
+	}
+	p.mu.Lock()
+	saved := make(map[string]logPosition, len(p.saved))
+	for path, pos := range p.saved {
+		saved[path] = pos
+	}
+	started := p.started
+	p.mu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for path, pos := range saved {
+		s.saved[path] = pos
+	}
+	s.started = s.started || started
+}
+
+// follow дочитывает файл t, обрабатывая ротацию и усечение
+func (s *LogTailSource) follow(ctx context.Context, t *tailedFile, acc *logAccumulator) error {
+	fi, err := os.Stat(t.path)
+	if errors.Is(err, os.ErrNotExist) {
+		// Файл ротирован, новый ещё не создан: дочитываем старый
+		if t.f != nil {
+			return s.read(ctx, t, acc)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	id := fileID(fi)
+
+	if t.f != nil && id != 0 && id != t.id {
+		if err := s.read(ctx, t, acc); err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			// Старый файл не дочитан: продолжим его в следующий раз
+			return nil
+		}
+		t.f.Close()
+		t.f = nil
+		t.offset = 0
+	}
+
+	if t.f == nil {
+		f, err := os.Open(t.path)
+		if err != nil {
+			return err
+		}
+		t.f, t.id = f, id
+		if pos, ok := s.saved[t.path]; ok && pos.ID == id && pos.Offset <= fi.Size() {
+			t.offset = pos.Offset
+		} else if !ok && !s.started && !s.opts.FromBeginning {
+			// Первый запуск без сохранённой позиции: историю не пересчитываем
+			t.offset = fi.Size()
+		} else {
+			t.offset = 0
+		}
+	} else if fi.Size() < t.offset {
+		t.offset = 0
+	}
+	return s.read(ctx, t, acc)
+}
+
+// read обрабатывает полные строки от текущей позиции; неполная последняя строка
+// остаётся до следующего опроса. При отмене ctx чтение прекращается на границе строки.
+func (s *LogTailSource) read(ctx context.Context, t *tailedFile, acc *logAccumulator) error {
+	buf := make([]byte, 0, 64*1024)
+	chunk := make([]byte, 64*1024)
+	read := 0
+	for read < maxLogReadPerCollect && ctx.Err() == nil {
+		n, err := t.f.ReadAt(chunk, t.offset+int64(len(buf)))
+		buf = append(buf, chunk[:n]...)
+		read += n
+
+		for {
+			i := bytes.IndexByte(buf, '\n')
+			if i < 0 {
+				if len(buf) < maxLogLine {
+					break
+				}
+				i = len(buf)
+			}
+			s.match(buf[:i], acc)
+			if i < len(buf) {
+				i++
+			}
+			t.offset += int64(i)
+			buf = buf[i:]
+		}
+
+		if errors.Is(err, io.EOF) || n == 0 {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	s.saved[t.path] = logPosition{ID: t.id, Offset: t.offset}
+	return nil
+}
+
+func (s *LogTailSource) match(line []byte, acc *logAccumulator) {
+	line = bytes.TrimSuffix(line, []byte{'\r'})
+	for i := range s.opts.Rules {
+		r := &s.opts.Rules[i]
+		m := r.re.FindSubmatch(line)
+		if m == nil {
+			continue
+		}
+
+		labels := r.Labels.Clone()
+		value := 1.0
+		hasValue := false
+		for gi, gname := range r.re.SubexpNames() {
+			if gname == "" || m[gi] == nil {
+				continue
+			}
+			if gname == r.Value {
+				v, err := strconv.ParseFloat(string(m[gi]), 64)
+				if err != nil {
+					continue
+				}
+				value, hasValue = v, true
+				continue
+			}
+			if labels == nil {
+				labels = make(models.Labels)
+			}
+			labels[models.SanitizeLabelName(gname)] = string(m[gi])
+		}
+		if r.Value != "" && !hasValue {
+			continue
+		}
+		acc.add(r, labels, value)
+	}
+}
+
+func writeCheckpoint(path string, positions map[string]logPosition) error {
+	data, err := json.Marshal(positions)
+	if err != nil {
+		return err
+	}
+	// Запись через временный файл, чтобы не оставить повреждённый checkpoint
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// logAccumulator суммирует совпадения за один опрос
+type logAccumulator struct {
+	order  []string
+	series map[string]models.Metrics
+}
+
+func newLogAccumulator() *logAccumulator {
+	return &logAccumulator{series: make(map[string]models.Metrics)}
+}
+
+func (a *logAccumulator) add(r *LogRule, labels models.Labels, value float64) {
+	key := r.Type + " " + models.SeriesKey(r.Name, labels)
+	m, ok := a.series[key]
+	if !ok {
+		m = models.Metrics{ID: r.Name, MType: r.Type, Labels: labels}
+		a.order = append(a.order, key)
+	}
+	if r.Type == models.Counter {
+		d := int64(math.Round(value))
+		if m.Delta != nil {
+			d += *m.Delta
+		}
+		m.Delta = &d
+	} else {
+		m.Value = &value
+	}
+	a.series[key] = m
+}
+
+func (a *logAccumulator) metrics() []models.Metrics {
+	res := make([]models.Metrics, 0, len(a.order))
+	for _, key := range a.order {
+		res = append(res, a.series[key])
+	}
+	return res
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package agent
+
+import "os"
+
+// fileID: без inode ротация определяется только по уменьшению размера файла
+func fileID(fi os.FileInfo) uint64 {
+	return 0
+}
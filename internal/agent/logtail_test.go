@@ -0,0 +1,197 @@
+//go:build unix
+
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+)
+
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestLogTail(t *testing.T, dir string) *LogTailSource {
+	t.Helper()
+	s, err := NewLogTailSource("nginx", LogTailOptions{
+		Files:         []string{filepath.Join(dir, "access.log")},
+		Checkpoint:    filepath.Join(dir, "positions.json"),
+		FromBeginning: true,
+		Rules: []LogRule{
+			{Name: "nginx_errors_total", Regex: `level=error`, Labels: models.Labels{"app": "nginx"}},
+			{Name: "nginx_requests_total", Regex: `status=(?P<status>\d{3})`},
+			{Name: "nginx_upstream_seconds", Type: models.Gauge, Regex: `upstream=(?P<v>[\d.]+)`, Value: "v"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func counterValue(metrics []models.Metrics, id string, labels models.Labels) int64 {
+	if m := findMetric(metrics, models.Counter, id, labels); m != nil {
+		return *m.Delta
+	}
+	return 0
+}
+
+func TestLogTailRules(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	appendFile(t, path, "level=error status=500 upstream=0.25\nlevel=info status=200\nlevel=error status=502 upstream=1.5\nlevel=info sta")
+
+	s := newTestLogTail(t, dir)
+	metrics, err := s.Collect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := counterValue(metrics, "nginx_errors_total", models.Labels{"app": "nginx"}); v != 2 {
+		t.Errorf("Expected 2 errors, got %d", v)
+	}
+	if v := counterValue(metrics, "nginx_requests_total", models.Labels{"status": "500"}); v != 1 {
+		t.Errorf("Expected 1 request with status 500, got %d", v)
+	}
+	if m := findMetric(metrics, models.Gauge, "nginx_upstream_seconds", nil); m == nil || *m.Value != 1.5 {
+		t.Errorf("Expected last upstream gauge 1.5, got %+v", m)
+	}
+
+	// Неполная строка обрабатывается после дописывания
+	appendFile(t, path, "tus=200\n")
+	metrics, _ = s.Collect(context.Background())
+	if v := counterValue(metrics, "nginx_requests_total", models.Labels{"status": "200"}); v != 1 {
+		t.Errorf("Expected completed line to be counted once, got %d", v)
+	}
+}
+
+func TestLogTailRotationAndTruncation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	appendFile(t, path, "level=error\n")
+
+	s := newTestLogTail(t, dir)
+	s.Collect(context.Background())
+
+	// Ротация переименованием: строки, дописанные в старый файл, не теряются
+	appendFile(t, path, "level=error\n")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path+".1", "level=error\n")
+	appendFile(t, path, "level=error\nlevel=error\nlevel=error\n")
+
+	metrics, _ := s.Collect(context.Background())
+	if v := counterValue(metrics, "nginx_errors_total", models.Labels{"app": "nginx"}); v != 5 {
+		t.Errorf("Expected 2 lines from the rotated file and 3 from the new one, got %d", v)
+	}
+
+	// Усечение (copytruncate): чтение с начала
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, "level=error\n")
+	metrics, _ = s.Collect(context.Background())
+	if v := counterValue(metrics, "nginx_errors_total", models.Labels{"app": "nginx"}); v != 1 {
+		t.Errorf("Expected 1 line after truncation, got %d", v)
+	}
+}
+
+func TestLogTailCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	appendFile(t, path, "level=error\nlevel=error\n")
+
+	s := newTestLogTail(t, dir)
+	s.Collect(context.Background())
+	save := s.Checkpoint()
+	appendFile(t, path, "level=error\n")
+	s.Collect(context.Background())
+	s.Close()
+	// Сохранена только позиция, для которой метрики отправлены: строка, посчитанная
+	// вторым опросом, но не отправленная, после перезапуска считается заново
+	if err := save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Перезапуск: уже отправленные строки не учитываются, остальные — учитываются
+	appendFile(t, path, "level=error\n")
+	restarted := newTestLogTail(t, dir)
+	metrics, _ := restarted.Collect(context.Background())
+	if v := counterValue(metrics, "nginx_errors_total", models.Labels{"app": "nginx"}); v != 2 {
+		t.Errorf("Expected the unsent and the new line, got %d", v)
+	}
+}
+
+func TestLogTailCollectStopsOnCancel(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	appendFile(t, path, "level=error\n")
+
+	s := newTestLogTail(t, dir)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	metrics, err := s.Collect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := counterValue(metrics, "nginx_errors_total", models.Labels{"app": "nginx"}); v != 0 {
+		t.Errorf("Cancelled collect must not read, got %d", v)
+	}
+	metrics, _ = s.Collect(context.Background())
+	if v := counterValue(metrics, "nginx_errors_total", models.Labels{"app": "nginx"}); v != 1 {
+		t.Errorf("Unread lines must be counted by the next collect, got %d", v)
+	}
+}
+
+func TestLogTailStartsAtEndWithoutCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	appendFile(t, path, "level=error\n")
+
+	s, err := NewLogTailSource("tail", LogTailOptions{
+		Files: []string{path},
+		Rules: []LogRule{{Name: "errors", Regex: "level=error"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	metrics, _ := s.Collect(context.Background())
+	if v := counterValue(metrics, "errors", nil); v != 0 {
+		t.Errorf("Existing lines must not be counted on first start, got %d", v)
+	}
+	appendFile(t, path, "level=error\n")
+	metrics, _ = s.Collect(context.Background())
+	if v := counterValue(metrics, "errors", nil); v != 1 {
+		t.Errorf("Expected 1 new line, got %d", v)
+	}
+}
+
+func TestNewLogTailSourceErrors(t *testing.T) {
+	for _, opts := range []LogTailOptions{
+		{Rules: []LogRule{{Name: "x", Regex: "x"}}},
+		{Files: []string{"a.log"}},
+		{Files: []string{"a.log"}, Rules: []LogRule{{Name: "x", Regex: "("}}},
+		{Files: []string{"a.log"}, Rules: []LogRule{{Name: "x", Type: models.Gauge, Regex: "x"}}},
+		{Files: []string{"a.log"}, Rules: []LogRule{{Name: "x", Regex: "x", Value: "missing"}}},
+	} {
+		if _, err := NewLogTailSource("x", opts); err == nil {
+			t.Errorf("NewLogTailSource(%+v): expected error", opts)
+		}
+	}
+}
@@ -0,0 +1,484 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/telemetry"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/tlsutil"
+)
+
+// SendMode — способ отправки метрик на несколько серверов
+type SendMode string
+
+const (
+	// SendFailover — метрики отправляются на первый здоровый сервер списка.
+	// Сервер с ошибкой отправки считается нездоровым, пока проверка здоровья не пройдёт.
+	SendFailover SendMode = "failover"
+	// SendFanout — каждый пакет отправляется на все серверы, у каждого своя очередь повторов
+	SendFanout SendMode = "fanout"
+)
+
+const (
+	DefaultHealthPath     = "/readyz"
+	DefaultHealthInterval = 5 * time.Second
+	DefaultOutboxSize     = 10000
+
+	healthCheckTimeout = 2 * time.Second
+)
+
+// ServersConfig — серверы, на которые агент отправляет метрики
+type ServersConfig struct {
+	Addresses []string `yaml:"addresses"`
+	Mode      SendMode `yaml:"mode"`
+	// HealthPath — путь GET проверки здоровья; сервер здоров, если ответил 2xx.
+	// 401 и 403 — нездоров: отправка с тем же токеном будет отклонена.
+	HealthPath string `yaml:"health_path"`
+	// HealthInterval — интервал проверок нездорового сервера
+	HealthInterval time.Duration `yaml:"health_interval"`
+	// Token — bearer токен API серверов
+	Token string `yaml:"token"`
+	// OutboxSize — максимальное число метрик в очереди повторов; при переполнении
+	// отбрасываются самые старые
+	OutboxSize int `yaml:"outbox_size"`
+	// TLS — CA и клиентский сертификат; адреса без схемы получают https://
+	TLS TLSConfig `yaml:"tls"`
+}
+
+// TLSConfig — параметры TLS соединений с серверами
+type TLSConfig struct {
+	// CA — доверенные CA серверов; пусто — системные
+	CA string `yaml:"ca"`
+	// Cert и Key — клиентский сертификат для mTLS
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+}
+
+// Enabled сообщает, задан ли какой-либо параметр TLS
+func (c TLSConfig) Enabled() bool {
+	return c.CA != "" || c.Cert != "" || c.Key != ""
+}
+
+// endpoint — сервер и состояние отправки на него
+type endpoint struct {
+	url    string
+	sender *Sender
+
+	healthy   bool
+	lastCheck time.Time
+	// До retryAt сервер не получает данных: он ответил Retry-After
+	retryAt time.Time
+	outbox  []models.Metrics
+	dropped int64
+	errors  int64
+
+	// Для Status: не сбрасываются при Metrics
+	totalErrors int64
+	lastError   string
+	lastSuccess time.Time
+}
+
+// ServerStatus — состояние сервера для страницы статуса агента
+type ServerStatus struct {
+	URL         string    `json:"url"`
+	Healthy     bool      `json:"healthy"`
+	Active      bool      `json:"active,omitempty"`
+	Outbox      int       `json:"outbox"`
+	Errors      int64     `json:"errors"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastSuccess time.Time `json:"last_success,omitzero"`
+}
+
+// MultiSender отправляет метрики на несколько серверов в режиме failover или fanout.
+// Неотправленные из-за временных ошибок метрики остаются в очереди повторов
+// и уходят со следующим пакетом.
+type MultiSender struct {
+	mode           SendMode
+	healthPath     string
+	healthInterval time.Duration
+	outboxSize     int
+	token          string
+	client         *http.Client
+	telemetry      *telemetry.Registry
+
+	mu        sync.Mutex
+	endpoints []*endpoint
+	// Очередь повторов режима failover общая: метрики уйдут на любой здоровый сервер
+	outbox  []models.Metrics
+	dropped int64
+	now     func() time.Time
+}
+
+// NewMultiSender создаёт отправитель для адресов cfg.Addresses; адрес без схемы дополняется
+// http://, а при заданном TLS — https://
+func NewMultiSender(cfg ServersConfig) (*MultiSender, error) {
+	if len(cfg.Addresses) == 0 {
+		return nil, errors.New("no server addresses")
+	}
+	ms := &MultiSender{
+		mode:           cfg.Mode,
+		healthPath:     cfg.HealthPath,
+		healthInterval: cfg.HealthInterval,
+		outboxSize:     cfg.OutboxSize,
+		token:          cfg.Token,
+		client:         &http.Client{Timeout: healthCheckTimeout},
+		now:            time.Now,
+	}
+	switch ms.mode {
+	case "":
+		ms.mode = SendFailover
+	case SendFailover, SendFanout:
+	default:
+		return nil, fmt.Errorf("unknown server mode %q", cfg.Mode)
+	}
+	if ms.healthPath == "" {
+		ms.healthPath = DefaultHealthPath
+	}
+	if ms.healthInterval <= 0 {
+		ms.healthInterval = DefaultHealthInterval
+	}
+	if ms.outboxSize <= 0 {
+		ms.outboxSize = DefaultOutboxSize
+	}
+
+	var transport http.RoundTripper
+	if cfg.TLS.Enabled() {
+		tlsConfig, err := tlsutil.ClientConfig(cfg.TLS.CA, cfg.TLS.Cert, cfg.TLS.Key)
+		if err != nil {
+			return nil, fmt.Errorf("tls: %w", err)
+		}
+		tr := http.DefaultTransport.(*http.Transport).Clone()
+		tr.TLSClientConfig = tlsConfig
+		transport = tr
+		ms.client.Transport = tr
+	}
+
+	seen := make(map[string]bool)
+	for _, addr := range cfg.Addresses {
+		url := ServerURL(addr, cfg.TLS.Enabled())
+		if seen[url] {
+			return nil, fmt.Errorf("duplicate server address %q", addr)
+		}
+		seen[url] = true
+		sender := NewSender(url)
+		sender.SetToken(cfg.Token)
+		sender.client.Transport = transport
+		ms.endpoints = append(ms.endpoints, &endpoint{url: url, sender: sender, healthy: true})
+	}
+	return ms, nil
+}
+
+// ServerURL добавляет схему к адресу сервера, если она не указана: https:// при secure
+func ServerURL(addr string, secure bool) string {
+	if strings.HasPrefix(addr, "http://") || strings.HasPrefix(addr, "https://") {
+		return addr
+	}
+	if secure {
+		return "https://" + addr
+	}
+	return "http://" + addr
+}
+
+// URLs возвращает адреса серверов
+func (ms *MultiSender) URLs() []string {
+	res := make([]string, len(ms.endpoints))
+	for i, ep := range ms.endpoints {
+		res[i] = ep.url
+	}
+	return res
+}
+
+// SetTelemetry включает учёт задержек и ошибок отправки на каждый сервер:
+// agent_server_send_duration_seconds и agent_server_send_failures_total с меткой server
+func (ms *MultiSender) SetTelemetry(reg *telemetry.Registry) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.telemetry = reg
+}
+
+// SetLogger задаёт журнал отправки для всех серверов
+func (ms *MultiSender) SetLogger(l zerolog.Logger) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for _, ep := range ms.endpoints {
+		ep.sender.SetLogger(l)
+	}
+}
+
+// SetLabels задаёт статические метки для всех серверов
+func (ms *MultiSender) SetLabels(labels models.Labels) {
+	for _, ep := range ms.endpoints {
+		ep.sender.SetLabels(labels)
+	}
+}
+
+// Inherit переносит очереди повторов и состояние здоровья из prev для серверов,
+// оставшихся в списке. Используется при перезагрузке конфигурации.
+func (ms *MultiSender) Inherit(prev *MultiSender) {
+	prev.mu.Lock()
+	defer prev.mu.Unlock()
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	byURL := make(map[string]*endpoint, len(prev.endpoints))
+	for _, ep := range prev.endpoints {
+		byURL[ep.url] = ep
+	}
+	for _, ep := range ms.endpoints {
+		if old, ok := byURL[ep.url]; ok {
+			ep.healthy, ep.lastCheck = old.healthy, old.lastCheck
+			ep.totalErrors, ep.lastError, ep.lastSuccess = old.totalErrors, old.lastError, old.lastSuccess
+			if ms.mode == SendFanout && prev.mode == SendFanout {
+				ep.outbox = old.outbox
+			}
+		}
+	}
+	// Очереди, которые не к кому привязать, уходят в общую очередь
+	if prev.mode == SendFailover {
+		ms.enqueue(prev.outbox)
+	}
+	if ms.mode == SendFailover && prev.mode == SendFanout && len(prev.endpoints) > 0 {
+		// В fanout очереди серверов дублируют друг друга, достаточно одной
+		ms.enqueue(prev.endpoints[0].outbox)
+	}
+}
+
+// enqueue добавляет метрики в очередь повторов. Вызывается под ms.mu.
+func (ms *MultiSender) enqueue(metrics []models.Metrics) {
+	ms.outbox, ms.dropped = appendOutbox(ms.outbox, metrics, ms.outboxSize, ms.dropped)
+	if ms.mode == SendFanout {
+		for _, ep := range ms.endpoints {
+			ep.outbox, ep.dropped = appendOutbox(ep.outbox, metrics, ms.outboxSize, ep.dropped)
+		}
+		ms.outbox = nil
+	}
+}
+
+func appendOutbox(outbox, metrics []models.Metrics, limit int, dropped int64) ([]models.Metrics, int64) {
+	outbox = append(outbox, metrics...)
+	if over := len(outbox) - limit; over > 0 {
+		outbox = append([]models.Metrics(nil), outbox[over:]...)
+		dropped += int64(over)
+	}
+	return outbox, dropped
+}
+
+// SendMetrics отправляет метрики вместе с очередью повторов. В режиме failover
+// ошибка возвращается, если пакет не удалось доставить ни на один сервер или сервер
+// отклонил метрики без повтора (4xx); в режиме fanout — при ошибке на любом сервере.
+func (ms *MultiSender) SendMetrics(metrics []models.Metrics) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.mode == SendFanout {
+		return ms.fanout(metrics)
+	}
+	return ms.failover(metrics)
+}
+
+func (ms *MultiSender) fanout(metrics []models.Metrics) error {
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, len(ms.endpoints))
+	)
+	for i, ep := range ms.endpoints {
+		wg.Add(1)
+		go func(i int, ep *endpoint) {
+			defer wg.Done()
+			batch := append(ep.outbox, metrics...)
+			if ms.now().Before(ep.retryAt) {
+				ep.outbox, ep.dropped = appendOutbox(nil, batch, ms.outboxSize, ep.dropped)
+				errs[i] = fmt.Errorf("%s: %d metrics queued for retry: server asked to retry after %s",
+					ep.url, len(batch), ep.retryAt.Format(time.RFC3339))
+				return
+			}
+			retry, err := ms.send(ep, batch)
+			ep.outbox, ep.dropped = appendOutbox(nil, retry, ms.outboxSize, ep.dropped)
+			ep.healthy = len(retry) == 0
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", ep.url, err)
+			}
+		}(i, ep)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (ms *MultiSender) failover(metrics []models.Metrics) error {
+	batch := append(ms.outbox, metrics...)
+	ms.outbox = nil
+
+	// rejected — отклонённые без повтора метрики: ошибка, даже если остаток доставлен
+	var errs, rejected []error
+	for _, ep := range ms.endpoints {
+		if len(batch) == 0 {
+			break
+		}
+		if ms.now().Before(ep.retryAt) {
+			continue
+		}
+		if !ep.healthy && !ms.checkHealth(ep) {
+			continue
+		}
+		retry, err := ms.send(ep, batch)
+		if err != nil {
+			err = fmt.Errorf("%s: %w", ep.url, err)
+			errs = append(errs, err)
+			if len(retry) == 0 {
+				rejected = append(rejected, err)
+			}
+		}
+		if len(retry) > 0 {
+			// Сервер недоступен: остаток пакета уходит на следующий
+			ep.healthy = false
+			ep.lastCheck = ms.now()
+		}
+		batch = retry
+	}
+	if len(batch) == 0 {
+		return errors.Join(rejected...)
+	}
+	ms.enqueue(batch)
+	errs = append(errs, fmt.Errorf("%d metrics queued for retry: no healthy server", len(batch)))
+	return errors.Join(errs...)
+}
+
+// send отправляет пакет на сервер и учитывает результат. Вызывается под ms.mu.
+func (ms *MultiSender) send(ep *endpoint, batch []models.Metrics) ([]models.Metrics, error) {
+	start := ms.now()
+	retry, err := ep.sender.sendBatch(batch, true)
+	elapsed := ms.now().Sub(start)
+
+	labels := models.Labels{"server": ep.url}
+	if ms.telemetry != nil {
+		ms.telemetry.Histogram("agent_server_send_duration_seconds", labels, models.DefaultBuckets).Observe(elapsed.Seconds())
+	}
+	if err != nil {
+		ep.errors++
+		ep.totalErrors++
+		ep.lastError = err.Error()
+		if wait := retryAfter(err); wait > 0 {
+			ep.retryAt = ms.now().Add(wait)
+		}
+		if ms.telemetry != nil {
+			ms.telemetry.Counter("agent_server_send_failures_total", labels).Inc()
+		}
+	} else {
+		ep.lastSuccess = ms.now()
+	}
+	return retry, err
+}
+
+// checkHealth проверяет нездоровый сервер не чаще healthInterval. Вызывается под ms.mu.
+func (ms *MultiSender) checkHealth(ep *endpoint) bool {
+	now := ms.now()
+	if now.Sub(ep.lastCheck) < ms.healthInterval {
+		return false
+	}
+	ep.lastCheck = now
+
+	req, err := http.NewRequest(http.MethodGet, ep.url+ms.healthPath, nil)
+	if err != nil {
+		return false
+	}
+	setToken(req, ms.token)
+	resp, err := ms.client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	ep.healthy = resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices
+	return ep.healthy
+}
+
+// Metrics возвращает состояние серверов: agent_server_up, agent_server_active (failover),
+// agent_server_outbox, agent_server_dropped_total и agent_server_errors_total с меткой server.
+// Счётчики возвращаются приращениями с прошлого вызова.
+func (ms *MultiSender) Metrics() []models.Metrics {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	var res []models.Metrics
+	gauge := func(id string, v float64, labels models.Labels) {
+		res = append(res, models.Metrics{ID: id, MType: models.Gauge, Value: &v, Labels: labels})
+	}
+	counter := func(id string, v int64, labels models.Labels) {
+		res = append(res, models.Metrics{ID: id, MType: models.Counter, Delta: &v, Labels: labels})
+	}
+
+	active := ms.active()
+	for i, ep := range ms.endpoints {
+		labels := models.Labels{"server": ep.url}
+		gauge("agent_server_up", boolValue(ep.healthy), labels)
+		if ms.mode == SendFailover {
+			gauge("agent_server_active", boolValue(ep.url == active), labels)
+		}
+		outbox, dropped := len(ep.outbox), ep.dropped
+		if ms.mode == SendFailover && i == 0 {
+			// Общая очередь режима failover учитывается у первого сервера
+			outbox, dropped = len(ms.outbox), ms.dropped
+			ms.dropped = 0
+		}
+		gauge("agent_server_outbox", float64(outbox), labels)
+		counter("agent_server_dropped_total", dropped, labels)
+		counter("agent_server_errors_total", ep.errors, labels)
+		ep.dropped, ep.errors = 0, 0
+	}
+	return res
+}
+
+// active возвращает адрес сервера, используемого в режиме failover. Вызывается под ms.mu.
+func (ms *MultiSender) active() string {
+	if ms.mode != SendFailover {
+		return ""
+	}
+	for _, ep := range ms.endpoints {
+		if ep.healthy {
+			return ep.url
+		}
+	}
+	return ""
+}
+
+// Mode возвращает режим отправки
+func (ms *MultiSender) Mode() SendMode {
+	return ms.mode
+}
+
+// Status возвращает состояние серверов
+func (ms *MultiSender) Status() []ServerStatus {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	active := ms.active()
+	res := make([]ServerStatus, len(ms.endpoints))
+	for i, ep := range ms.endpoints {
+		outbox := len(ep.outbox)
+		if ms.mode == SendFailover && i == 0 {
+			outbox = len(ms.outbox)
+		}
+		res[i] = ServerStatus{
+			URL:         ep.url,
+			Healthy:     ep.healthy,
+			Active:      ep.url == active,
+			Outbox:      outbox,
+			Errors:      ep.totalErrors,
+			LastError:   ep.lastError,
+			LastSuccess: ep.lastSuccess,
+		}
+	}
+	return res
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
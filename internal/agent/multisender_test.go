@@ -0,0 +1,320 @@
+package agent
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/tlsutil"
+)
+
+// fakeServer принимает метрики через URL API и JSON и запоминает их имена.
+// status != 200 возвращается на все запросы, включая проверку здоровья.
+type fakeServer struct {
+	*httptest.Server
+	status   atomic.Int32
+	retry    atomic.Int32 // Retry-After в секундах для ответов с ошибкой
+	checks   atomic.Int32 // число проверок здоровья GET DefaultHealthPath
+	mu       sync.Mutex
+	received []string
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	fs := &fakeServer{}
+	fs.status.Store(http.StatusOK)
+	fs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.URL.Path == DefaultHealthPath {
+			fs.checks.Add(1)
+		}
+		if code := int(fs.status.Load()); code != http.StatusOK {
+			if secs := fs.retry.Load(); secs > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(secs)))
+			}
+			w.WriteHeader(code)
+			return
+		}
+		var name string
+		switch {
+		case r.URL.Path == "/update":
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Errorf("Expected gzip body: %v", err)
+				return
+			}
+			var m models.Metrics
+			json.NewDecoder(gz).Decode(&m)
+			name = m.ID
+		case strings.HasPrefix(r.URL.Path, "/update/"):
+			name = strings.Split(r.URL.Path, "/")[3]
+		default:
+			return
+		}
+		fs.mu.Lock()
+		fs.received = append(fs.received, name)
+		fs.mu.Unlock()
+	}))
+	t.Cleanup(fs.Close)
+	return fs
+}
+
+func (fs *fakeServer) take() []string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	res := fs.received
+	fs.received = nil
+	return res
+}
+
+func gauges(names ...string) []models.Metrics {
+	res := make([]models.Metrics, len(names))
+	for i, name := range names {
+		v := float64(i)
+		res[i] = models.Metrics{ID: name, MType: models.Gauge, Value: &v}
+	}
+	return res
+}
+
+func TestMultiSenderFailover(t *testing.T) {
+	primary, secondary := newFakeServer(t), newFakeServer(t)
+	ms, err := NewMultiSender(ServersConfig{Addresses: []string{primary.URL, secondary.URL}, HealthInterval: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	ms.now = func() time.Time { return now }
+
+	primary.status.Store(http.StatusServiceUnavailable)
+	if err := ms.SendMetrics(gauges("a", "b")); err != nil {
+		t.Errorf("Batch delivered to secondary must not be an error, got %v", err)
+	}
+	if got := secondary.take(); len(got) != 2 {
+		t.Errorf("Expected batch to fail over to secondary, got %v", got)
+	}
+	metrics := ms.Metrics()
+	if m := findMetric(metrics, models.Gauge, "agent_server_active", models.Labels{"server": secondary.URL}); m == nil || *m.Value != 1 {
+		t.Errorf("Expected secondary to be active, got %+v", m)
+	}
+	if m := findMetric(metrics, models.Gauge, "agent_server_up", models.Labels{"server": primary.URL}); m == nil || *m.Value != 0 {
+		t.Errorf("Expected primary to be marked down, got %+v", m)
+	}
+
+	// Первичный сервер восстановился, но до проверки здоровья остаётся вторичный
+	primary.status.Store(http.StatusOK)
+	ms.SendMetrics(gauges("c"))
+	if len(primary.take()) != 0 || len(secondary.take()) != 1 {
+		t.Error("Expected secondary to be used until the next health check")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if err := ms.SendMetrics(gauges("d")); err != nil {
+		t.Fatal(err)
+	}
+	if got := primary.take(); len(got) != 1 || got[0] != "d" {
+		t.Errorf("Expected fail back to primary after health check, got %v", got)
+	}
+}
+
+func TestMultiSenderHealthCheckRejectsUnauthorized(t *testing.T) {
+	primary, secondary := newFakeServer(t), newFakeServer(t)
+	ms, err := NewMultiSender(ServersConfig{Addresses: []string{primary.URL, secondary.URL}, HealthInterval: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	ms.now = func() time.Time { return now }
+
+	primary.status.Store(http.StatusServiceUnavailable)
+	ms.SendMetrics(gauges("a"))
+
+	// Сервер работает, но не принимает токен агента: возвращаться на него нельзя
+	for _, code := range []int{http.StatusUnauthorized, http.StatusForbidden} {
+		primary.status.Store(int32(code))
+		now = now.Add(2 * time.Minute)
+		if err := ms.SendMetrics(gauges("b")); err != nil {
+			t.Fatal(err)
+		}
+		if got := primary.take(); len(got) != 0 {
+			t.Errorf("Expected no fail back after health check answered %d, got %v", code, got)
+		}
+	}
+	if n := primary.checks.Load(); n != 2 {
+		t.Errorf("Expected 2 health checks on %s, got %d", DefaultHealthPath, n)
+	}
+	if got := secondary.take(); len(got) != 3 {
+		t.Errorf("Expected secondary to receive all metrics, got %v", got)
+	}
+}
+
+func TestMultiSenderFailoverOutbox(t *testing.T) {
+	srv := newFakeServer(t)
+	ms, err := NewMultiSender(ServersConfig{Addresses: []string{srv.URL}, OutboxSize: 2, HealthInterval: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	ms.now = func() time.Time { return now }
+
+	srv.status.Store(http.StatusBadGateway)
+	ms.SendMetrics(gauges("a", "b", "c"))
+	metrics := ms.Metrics()
+	labels := models.Labels{"server": srv.URL}
+	if m := findMetric(metrics, models.Gauge, "agent_server_outbox", labels); m == nil || *m.Value != 2 {
+		t.Errorf("Expected outbox limited to 2, got %+v", m)
+	}
+	if m := findMetric(metrics, models.Counter, "agent_server_dropped_total", labels); m == nil || *m.Delta != 1 {
+		t.Errorf("Expected 1 dropped metric, got %+v", m)
+	}
+
+	srv.status.Store(http.StatusOK)
+	now = now.Add(2 * time.Minute)
+	ms.SendMetrics(gauges("d"))
+	if got := strings.Join(srv.take(), ","); got != "b,c,d" {
+		t.Errorf("Expected queued metrics before new ones, got %s", got)
+	}
+}
+
+func TestMultiSenderRetryAfter(t *testing.T) {
+	primary, secondary := newFakeServer(t), newFakeServer(t)
+	ms, err := NewMultiSender(ServersConfig{Addresses: []string{primary.URL, secondary.URL}, HealthInterval: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	ms.now = func() time.Time { return now }
+
+	primary.status.Store(http.StatusTooManyRequests)
+	primary.retry.Store(60)
+	if err := ms.SendMetrics(gauges("a")); err != nil {
+		t.Fatalf("Expected delivery to secondary, got %v", err)
+	}
+	primary.status.Store(http.StatusOK)
+
+	// Сервер здоров, но просил подождать минуту
+	now = now.Add(30 * time.Second)
+	ms.SendMetrics(gauges("b"))
+	if got := primary.take(); len(got) != 0 {
+		t.Errorf("Expected no sends to primary before Retry-After, got %v", got)
+	}
+	if got := strings.Join(secondary.take(), ","); got != "a,b" {
+		t.Errorf("Expected secondary to receive a,b, got %s", got)
+	}
+
+	now = now.Add(31 * time.Second)
+	ms.SendMetrics(gauges("c"))
+	if got := strings.Join(primary.take(), ","); got != "c" {
+		t.Errorf("Expected primary to be used after Retry-After, got %s", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := map[string]time.Duration{
+		"":                              0,
+		"5":                             5 * time.Second,
+		"-1":                            0,
+		"soon":                          0,
+		"Mon, 01 Jan 2024 00:00:30 GMT": 30 * time.Second,
+	}
+	for v, want := range tests {
+		if got := parseRetryAfter(v, now); got != want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", v, got, want)
+		}
+	}
+}
+
+func TestMultiSenderFanout(t *testing.T) {
+	first, second := newFakeServer(t), newFakeServer(t)
+	ms, err := NewMultiSender(ServersConfig{Addresses: []string{first.URL, second.URL}, Mode: SendFanout})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second.status.Store(http.StatusInternalServerError)
+	if err := ms.SendMetrics(gauges("a")); err == nil {
+		t.Error("Expected error from failing server")
+	}
+	second.status.Store(http.StatusOK)
+	if err := ms.SendMetrics(gauges("b")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(first.take(), ","); got != "a,b" {
+		t.Errorf("First server must receive each batch once, got %s", got)
+	}
+	if got := strings.Join(second.take(), ","); got != "a,b" {
+		t.Errorf("Second server must receive retried batch, got %s", got)
+	}
+}
+
+func TestMultiSenderRejectedNotRetried(t *testing.T) {
+	srv := newFakeServer(t)
+	ms, _ := NewMultiSender(ServersConfig{Addresses: []string{srv.URL}})
+
+	srv.status.Store(http.StatusBadRequest)
+	if err := ms.SendMetrics(gauges("a")); err == nil {
+		t.Error("Expected error for metrics rejected with 400")
+	}
+	srv.status.Store(http.StatusOK)
+	ms.SendMetrics(gauges("b"))
+	if got := strings.Join(srv.take(), ","); got != "b" {
+		t.Errorf("Rejected metrics must not be retried, got %s", got)
+	}
+}
+
+func TestMultiSenderConfigErrors(t *testing.T) {
+	for _, cfg := range []ServersConfig{
+		{},
+		{Addresses: []string{"a:1"}, Mode: "broadcast"},
+		{Addresses: []string{"a:1", "http://a:1"}},
+	} {
+		if _, err := NewMultiSender(cfg); err == nil {
+			t.Errorf("Expected error for %+v", cfg)
+		}
+	}
+}
+
+func TestMultiSenderMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	if err := tlsutil.GenerateDevCA(dir, []string{"127.0.0.1"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	path := func(name string) string { return filepath.Join(dir, name) }
+	serverTLS, err := tlsutil.ServerConfig(path(tlsutil.ServerFile), path(tlsutil.ServerKeyFile), path(tlsutil.CAFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var received atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+	}))
+	srv.TLS = serverTLS
+	srv.StartTLS()
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "https://")
+
+	ms, err := NewMultiSender(ServersConfig{Addresses: []string{addr}, TLS: TLSConfig{
+		CA: path(tlsutil.CAFile), Cert: path(tlsutil.ClientFile), Key: path(tlsutil.ClientKeyFile),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if urls := ms.URLs(); urls[0] != srv.URL {
+		t.Errorf("Expected https scheme for TLS servers, got %v", urls)
+	}
+	if err := ms.SendMetrics(gauges("a")); err != nil || received.Load() != 1 {
+		t.Errorf("Expected metric to be delivered over mTLS, got %v", err)
+	}
+
+	if _, err := NewMultiSender(ServersConfig{Addresses: []string{addr}, TLS: TLSConfig{Cert: path(tlsutil.ClientFile)}}); err == nil {
+		t.Error("Expected error for client certificate without key")
+	}
+}
@@ -0,0 +1,208 @@
+package agent
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog"
+
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/logger"
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/relabel"
+)
+
+// RuleAction — действие правила метрик
+type RuleAction string
+
+const (
+	// RuleKeep оставляет только метрики, совпавшие с regex
+	RuleKeep RuleAction = "keep"
+	// RuleDrop отбрасывает метрики, совпавшие с regex
+	RuleDrop RuleAction = "drop"
+	// RuleRename задаёт новое имя replacement (допускаются группы $1, ${name})
+	RuleRename RuleAction = "rename"
+	// RulePrefix добавляет prefix к имени совпавших метрик
+	RulePrefix RuleAction = "prefix"
+	// RuleLabel записывает replacement в метку target_label совпавших метрик;
+	// пустое значение удаляет метку
+	RuleLabel RuleAction = "label"
+	// RuleScale умножает значение совпавших метрик на factor
+	RuleScale RuleAction = "scale"
+)
+
+// MetricRule — правило фильтрации и переименования метрик перед отправкой.
+// По умолчанию regex сравнивается с именем метрики; source_labels позволяет
+// сравнивать значения меток (имя доступно как __name__). Действия relabel
+// (replace, labeldrop, labelkeep, labelmap) тоже поддерживаются.
+type MetricRule struct {
+	Action       RuleAction `yaml:"action"`
+	SourceLabels []string   `yaml:"source_labels"`
+	Separator    string     `yaml:"separator"`
+	Regex        string     `yaml:"regex"`
+	TargetLabel  string     `yaml:"target_label"`
+	Replacement  *string    `yaml:"replacement"`
+	Prefix       string     `yaml:"prefix"`
+	Factor       float64    `yaml:"factor"`
+}
+
+// ruleStep — скомпилированное правило: relabel правило либо масштабирование
+// совпавших с match метрик
+type ruleStep struct {
+	rule   *relabel.Rule
+	match  *relabel.Rule
+	factor float64
+}
+
+// MetricFilter применяет правила метрик по порядку
+type MetricFilter struct {
+	steps []ruleStep
+	log   zerolog.Logger
+}
+
+// NewMetricFilter компилирует правила. Пустой список даёт nil: метрики не меняются.
+func NewMetricFilter(rules []MetricRule) (*MetricFilter, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	f := &MetricFilter{log: logger.GetLogger()}
+	for i, r := range rules {
+		step, err := compileRule(r)
+		if err != nil {
+			return nil, fmt.Errorf("metric rule %d: %w", i, err)
+		}
+		f.steps = append(f.steps, step)
+	}
+	return f, nil
+}
+
+// SetLogger задаёт журнал правил; отброшенные метрики пишутся на уровне debug
+func (f *MetricFilter) SetLogger(l zerolog.Logger) {
+	if f != nil {
+		f.log = l
+	}
+}
+
+func compileRule(r MetricRule) (ruleStep, error) {
+	cfg := relabel.Config{
+		SourceLabels: r.SourceLabels,
+		Separator:    r.Separator,
+		Regex:        r.Regex,
+		TargetLabel:  r.TargetLabel,
+		Replacement:  r.Replacement,
+		Action:       relabel.Action(r.Action),
+	}
+	if len(cfg.SourceLabels) == 0 {
+		cfg.SourceLabels = []string{relabel.NameLabel}
+	}
+
+	switch r.Action {
+	case RuleKeep, RuleDrop:
+	case RuleRename:
+		if r.Replacement == nil || *r.Replacement == "" {
+			return ruleStep{}, fmt.Errorf("rename requires replacement")
+		}
+		cfg.Action, cfg.TargetLabel = relabel.Replace, relabel.NameLabel
+	case RulePrefix:
+		if r.Prefix == "" {
+			return ruleStep{}, fmt.Errorf("prefix requires prefix")
+		}
+		if len(r.SourceLabels) > 0 && (len(r.SourceLabels) != 1 || r.SourceLabels[0] != relabel.NameLabel) {
+			return ruleStep{}, fmt.Errorf("prefix matches metric name only")
+		}
+		// $0 — всё совпадение, то есть имя целиком
+		replacement := r.Prefix + "$0"
+		cfg.Action, cfg.TargetLabel, cfg.Replacement = relabel.Replace, relabel.NameLabel, &replacement
+	case RuleLabel:
+		if r.TargetLabel == "" || r.Replacement == nil {
+			return ruleStep{}, fmt.Errorf("label requires target_label and replacement")
+		}
+		cfg.Action = relabel.Replace
+	case RuleScale:
+		if r.Factor <= 0 {
+			return ruleStep{}, fmt.Errorf("scale requires positive factor")
+		}
+		cfg.Action = relabel.Keep
+		rules, err := relabel.Compile([]relabel.Config{cfg})
+		if err != nil {
+			return ruleStep{}, err
+		}
+		return ruleStep{match: rules[0], factor: r.Factor}, nil
+	default:
+		// Прочие действия передаются relabel как есть
+		cfg.SourceLabels = r.SourceLabels
+	}
+
+	rules, err := relabel.Compile([]relabel.Config{cfg})
+	if err != nil {
+		return ruleStep{}, err
+	}
+	return ruleStep{rule: rules[0]}, nil
+}
+
+// Apply применяет правила к метрикам и возвращает те, что нужно отправить.
+// Масштабируются gauge и histogram (сумма и границы корзин); counter и summary
+// не масштабируются.
+func (f *MetricFilter) Apply(metrics []models.Metrics) []models.Metrics {
+	if f == nil {
+		return metrics
+	}
+	res := make([]models.Metrics, 0, len(metrics))
+	for _, m := range metrics {
+		if out, ok := f.apply(m); ok {
+			res = append(res, out)
+		}
+	}
+	return res
+}
+
+func (f *MetricFilter) apply(m models.Metrics) (models.Metrics, bool) {
+	labels := m.Labels.Clone()
+	if labels == nil {
+		labels = make(models.Labels)
+	}
+	labels[relabel.NameLabel] = m.ID
+
+	factor := 1.0
+	for _, step := range f.steps {
+		if step.match != nil {
+			if _, ok := relabel.Process(labels, []*relabel.Rule{step.match}); ok {
+				factor *= step.factor
+			}
+			continue
+		}
+		var ok bool
+		if labels, ok = relabel.Process(labels, []*relabel.Rule{step.rule}); !ok {
+			return models.Metrics{}, false
+		}
+	}
+
+	name := labels[relabel.NameLabel]
+	if name == "" {
+		f.log.Debug().Msgf("Metric %s dropped: rules produced empty name", m.Key())
+		return models.Metrics{}, false
+	}
+	delete(labels, relabel.NameLabel)
+
+	out := cloneMetric(m)
+	out.ID = name
+	out.Labels = nil
+	if len(labels) > 0 {
+		out.Labels = labels
+	}
+	if factor != 1 {
+		scaleMetric(&out, factor)
+	}
+	return out, true
+}
+
+// scaleMetric умножает значение копии метрики на factor
+func scaleMetric(m *models.Metrics, factor float64) {
+	switch {
+	case m.MType == models.Gauge && m.Value != nil:
+		*m.Value *= factor
+	case m.MType == models.Histogram && m.Histogram != nil:
+		m.Histogram.Sum *= factor
+		for i := range m.Histogram.Bounds {
+			m.Histogram.Bounds[i] *= factor
+		}
+	}
+}
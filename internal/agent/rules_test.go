@@ -0,0 +1,106 @@
+package agent
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+)
+
+func TestMetricFilter(t *testing.T) {
+	var rules []MetricRule
+	err := yaml.Unmarshal([]byte(`
+- action: drop
+  regex: "Mallocs|Frees"
+- action: keep
+  regex: "Heap.*|Frees|PollCount|CPUutilization|Latency"
+- action: rename
+  regex: "Heap(.*)"
+  replacement: "heap_${1}_bytes"
+- action: scale
+  regex: "heap_.*_bytes"
+  factor: 0.5
+- action: scale
+  regex: "Latency"
+  factor: 1000
+- action: prefix
+  regex: "heap_.*|Latency"
+  prefix: "svc_"
+- action: label
+  target_label: team
+  replacement: core
+- action: label
+  source_labels: [cpu]
+  regex: "0"
+  target_label: cpu
+  replacement: "first"
+- action: labeldrop
+  regex: "tmp"
+`), &rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewMetricFilter(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := func(id string, v float64, labels models.Labels) models.Metrics {
+		return models.Metrics{ID: id, MType: models.Gauge, Value: &v, Labels: labels}
+	}
+	one := int64(1)
+	h := models.NewHistogram([]float64{0.1, 1})
+	h.Observe(0.5)
+	input := []models.Metrics{
+		g("HeapAlloc", 100, models.Labels{"tmp": "x"}),
+		g("Mallocs", 1, nil),
+		g("Frees", 1, nil),
+		g("Sys", 1, nil),
+		g("CPUutilization", 30, models.Labels{"cpu": "0"}),
+		{ID: "PollCount", MType: models.Counter, Delta: &one},
+		{ID: "Latency", MType: models.Histogram, Histogram: h},
+	}
+	out := f.Apply(input)
+
+	if len(out) != 4 {
+		t.Fatalf("Expected 4 metrics after keep/drop, got %d: %+v", len(out), out)
+	}
+	if m := findMetric(out, models.Gauge, "svc_heap_Alloc_bytes", models.Labels{"team": "core"}); m == nil || *m.Value != 50 {
+		t.Errorf("Expected renamed, scaled and prefixed HeapAlloc, got %+v", out[0])
+	}
+	if m := findMetric(out, models.Gauge, "CPUutilization", models.Labels{"cpu": "first", "team": "core"}); m == nil || *m.Value != 30 {
+		t.Errorf("Expected replaced cpu label, got %+v", m)
+	}
+	if m := findMetric(out, models.Counter, "PollCount", models.Labels{"team": "core"}); m == nil || *m.Delta != 1 {
+		t.Errorf("Expected counter to pass unchanged, got %+v", m)
+	}
+	if m := findMetric(out, models.Histogram, "svc_Latency", models.Labels{"team": "core"}); m == nil || m.Histogram.Bounds[1] != 1000 || m.Histogram.Sum != 500 {
+		t.Errorf("Expected scaled histogram, got %+v", m)
+	}
+
+	// Исходные метрики не меняются
+	if *input[0].Value != 100 || input[0].Labels["tmp"] != "x" || h.Bounds[1] != 1 {
+		t.Error("Apply must not modify input metrics")
+	}
+}
+
+func TestMetricFilterErrors(t *testing.T) {
+	empty := ""
+	for _, r := range []MetricRule{
+		{Action: "explode"},
+		{Action: RuleRename, Replacement: &empty},
+		{Action: RulePrefix},
+		{Action: RulePrefix, Prefix: "x_", SourceLabels: []string{"job"}},
+		{Action: RuleLabel, TargetLabel: "env"},
+		{Action: RuleScale, Factor: -1},
+		{Action: RuleDrop, Regex: "("},
+	} {
+		if _, err := NewMetricFilter([]MetricRule{r}); err == nil {
+			t.Errorf("Expected error for %+v", r)
+		}
+	}
+	if f, err := NewMetricFilter(nil); err != nil || f.Apply(nil) != nil {
+		t.Error("Empty rules must give a no-op filter")
+	}
+}
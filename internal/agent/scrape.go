@@ -0,0 +1,234 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/cumulative"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/logger"
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/promfmt"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/relabel"
+)
+
+// DefaultScrapeTimeout — таймаут опроса цели по умолчанию
+const DefaultScrapeTimeout = 5 * time.Second
+
+// ScrapeConfig — цель опроса Prometheus /metrics в YAML конфигурации агента
+type ScrapeConfig struct {
+	Job string `yaml:"job"`
+	URL string `yaml:"url"`
+	// Labels — метки, добавляемые ко всем сериям цели
+	Labels  models.Labels `yaml:"labels"`
+	Timeout time.Duration `yaml:"timeout"`
+	// RelabelConfigs применяются к каждой серии после добавления меток цели
+	RelabelConfigs []relabel.Config `yaml:"relabel_configs"`
+}
+
+// scraperOptions — параметры источника типа prometheus
+type scraperOptions struct {
+	Targets []ScrapeConfig `yaml:"targets"`
+}
+
+func newScraperFromConfig(cfg SourceConfig) (Source, error) {
+	var opts scraperOptions
+	if err := cfg.DecodeOptions(&opts); err != nil {
+		return nil, err
+	}
+	s, err := NewScraper(opts.Targets)
+	if err != nil {
+		return nil, err
+	}
+	s.name = cfg.Name
+	return s, nil
+}
+
+type scrapeTarget struct {
+	cfg    ScrapeConfig
+	labels models.Labels
+	rules  []*relabel.Rule
+
+	// latest — серии последнего опроса (пусто после ошибки), health — метрики состояния опроса
+	latest []models.Metrics
+	health []models.Metrics
+}
+
+// Scraper опрашивает Prometheus endpoint'ы локальных сервисов.
+// Результаты последнего опроса каждой цели хранятся до отправки; накопленные
+// counter и histogram переводятся в приращения в момент отправки.
+type Scraper struct {
+	name       string
+	client     *http.Client
+	targets    []*scrapeTarget
+	cumulative *cumulative.Converter
+
+	mu sync.Mutex
+}
+
+// NewScraper проверяет цели и компилирует правила переразметки.
+// К сериям цели добавляются метки job и instance (host:port из URL).
+func NewScraper(cfgs []ScrapeConfig) (*Scraper, error) {
+	s := &Scraper{
+		name:       "prometheus",
+		client:     &http.Client{},
+		cumulative: cumulative.NewConverter(),
+	}
+	for i, cfg := range cfgs {
+		u, err := url.Parse(cfg.URL)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("scrape target %d: invalid url %q", i, cfg.URL)
+		}
+		if cfg.Job == "" {
+			return nil, fmt.Errorf("scrape target %d: missing job", i)
+		}
+		if cfg.Timeout <= 0 {
+			cfg.Timeout = DefaultScrapeTimeout
+		}
+		if err := cfg.Labels.Validate(); err != nil {
+			return nil, fmt.Errorf("scrape target %s: %w", cfg.Job, err)
+		}
+		rules, err := relabel.Compile(cfg.RelabelConfigs)
+		if err != nil {
+			return nil, fmt.Errorf("scrape target %s: %w", cfg.Job, err)
+		}
+		labels := models.Labels{"job": cfg.Job, "instance": u.Host}.Merge(cfg.Labels)
+		s.targets = append(s.targets, &scrapeTarget{cfg: cfg, labels: labels, rules: rules})
+	}
+	return s, nil
+}
+
+func (s *Scraper) Name() string { return s.name }
+
+// Collect опрашивает цели и возвращает их серии в приращениях вместе с метриками состояния.
+// Ошибка отдельной цели отражается в её метрике up и не прерывает опрос остальных.
+func (s *Scraper) Collect(ctx context.Context) ([]models.Metrics, error) {
+	s.Scrape(ctx)
+	return s.TakeMetrics(), nil
+}
+
+// Scrape опрашивает все цели параллельно
+func (s *Scraper) Scrape(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, t := range s.targets {
+		wg.Add(1)
+		go func(t *scrapeTarget) {
+			defer wg.Done()
+			s.scrapeTarget(ctx, t)
+		}(t)
+	}
+	wg.Wait()
+}
+
+func (s *Scraper) scrapeTarget(ctx context.Context, t *scrapeTarget) {
+	start := time.Now()
+	metrics, scraped, err := s.fetch(ctx, t)
+	duration := time.Since(start).Seconds()
+
+	up := 1.0
+	if err != nil {
+		up = 0
+		logger.FromContext(ctx).Info().Msgf("Scrape of %s (%s) failed: %v", t.cfg.Job, t.cfg.URL, err)
+	}
+	samples, kept := float64(scraped), float64(len(metrics))
+	health := []models.Metrics{
+		{ID: "up", MType: models.Gauge, Value: &up, Labels: t.labels},
+		{ID: "scrape_duration_seconds", MType: models.Gauge, Value: &duration, Labels: t.labels},
+		{ID: "scrape_samples_scraped", MType: models.Gauge, Value: &samples, Labels: t.labels},
+		{ID: "scrape_samples_post_relabeling", MType: models.Gauge, Value: &kept, Labels: t.labels},
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t.health = health
+	t.latest = metrics
+}
+
+// fetch загружает и разбирает /metrics цели; возвращает серии после переразметки
+// и число разобранных значений
+func (s *Scraper) fetch(ctx context.Context, t *scrapeTarget) ([]models.Metrics, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.cfg.URL, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Accept", "text/plain;version=0.0.4")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil, 0, fmt.Errorf("target returned status %d", resp.StatusCode)
+	}
+
+	families, err := promfmt.Parse(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	scraped := 0
+	for _, f := range families {
+		scraped += len(f.Samples)
+	}
+
+	var res []models.Metrics
+	for _, m := range promfmt.ToMetrics(families) {
+		if m, ok := t.relabel(m); ok {
+			res = append(res, m)
+		}
+	}
+	return res, scraped, nil
+}
+
+// relabel добавляет метки цели и применяет правила. Метки сервиса, совпадающие
+// с метками цели, сохраняются с префиксом exported_, как в Prometheus.
+func (t *scrapeTarget) relabel(m models.Metrics) (models.Metrics, bool) {
+	labels := make(models.Labels, len(m.Labels)+len(t.labels)+1)
+	for k, v := range m.Labels {
+		if _, clash := t.labels[k]; clash {
+			k = "exported_" + k
+		}
+		labels[k] = v
+	}
+	for k, v := range t.labels {
+		labels[k] = v
+	}
+	labels[relabel.NameLabel] = m.ID
+
+	labels, ok := relabel.Process(labels, t.rules)
+	if !ok || labels[relabel.NameLabel] == "" {
+		return m, false
+	}
+	m.ID = labels[relabel.NameLabel]
+	for k := range labels {
+		if strings.HasPrefix(k, "__") {
+			delete(labels, k)
+		}
+	}
+	m.Labels = labels
+	return m, true
+}
+
+// TakeMetrics возвращает серии последних опросов и метрики состояния целей.
+// Накопленные counter и histogram заменяются приращениями с прошлой отправки.
+func (s *Scraper) TakeMetrics() []models.Metrics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var res []models.Metrics
+	for _, t := range s.targets {
+		for _, m := range t.latest {
+			res = append(res, s.cumulative.ToDelta(m))
+		}
+		res = append(res, t.health...)
+	}
+	return res
+}
@@ -0,0 +1,96 @@
+package agent_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/agent"
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/relabel"
+)
+
+func TestScraper(t *testing.T) {
+	total := 100
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "# TYPE requests_total counter\nrequests_total{job=\"app\"} %d\n", total)
+		fmt.Fprint(w, "# TYPE go_goroutines gauge\ngo_goroutines 12\n# TYPE queue_depth gauge\nqueue_depth 4\n")
+	}))
+	defer target.Close()
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	scraper, err := agent.NewScraper([]agent.ScrapeConfig{
+		{
+			Job:    "app",
+			URL:    target.URL + "/metrics",
+			Labels: models.Labels{"env": "prod"},
+			RelabelConfigs: []relabel.Config{
+				{SourceLabels: []string{relabel.NameLabel}, Regex: "go_.*", Action: relabel.Drop},
+			},
+		},
+		{Job: "down", URL: down.URL + "/metrics"},
+	})
+	if err != nil {
+		t.Fatalf("NewScraper() failed: %v", err)
+	}
+
+	u, _ := url.Parse(target.URL)
+	appLabels := models.Labels{"job": "app", "instance": u.Host, "env": "prod"}
+	find := func(metrics []models.Metrics, id string, labels models.Labels) *models.Metrics {
+		for i := range metrics {
+			if metrics[i].Key() == models.SeriesKey(id, labels) {
+				return &metrics[i]
+			}
+		}
+		return nil
+	}
+
+	scraper.Scrape(context.Background())
+	metrics := scraper.TakeMetrics()
+
+	// Метка job сервиса сохраняется как exported_job
+	reqLabels := appLabels.Merge(models.Labels{"exported_job": "app"})
+	if m := find(metrics, "requests_total", reqLabels); m == nil || *m.Delta != 100 {
+		t.Errorf("Expected requests_total 100, got %+v", m)
+	}
+	if m := find(metrics, "go_goroutines", appLabels); m != nil {
+		t.Error("Expected go_goroutines to be dropped by relabeling")
+	}
+	if m := find(metrics, "up", appLabels); m == nil || *m.Value != 1 {
+		t.Errorf("Expected up=1 for app, got %+v", m)
+	}
+	if m := find(metrics, "scrape_samples_post_relabeling", appLabels); m == nil || *m.Value != 2 {
+		t.Errorf("Expected 2 samples after relabeling, got %+v", m)
+	}
+
+	du, _ := url.Parse(down.URL)
+	if m := find(metrics, "up", models.Labels{"job": "down", "instance": du.Host}); m == nil || *m.Value != 0 {
+		t.Errorf("Expected up=0 for failing target, got %+v", m)
+	}
+
+	// Следующая отправка содержит приращение накопленного counter
+	total = 130
+	scraper.Scrape(context.Background())
+	if m := find(scraper.TakeMetrics(), "requests_total", reqLabels); m == nil || *m.Delta != 30 {
+		t.Errorf("Expected requests_total delta 30, got %+v", m)
+	}
+}
+
+func TestNewScraperErrors(t *testing.T) {
+	for _, cfg := range []agent.ScrapeConfig{
+		{Job: "x", URL: "not a url"},
+		{URL: "http://localhost:9100/metrics"},
+		{Job: "x", URL: "http://localhost:9100/metrics", RelabelConfigs: []relabel.Config{{Regex: "("}}},
+	} {
+		if _, err := agent.NewScraper([]agent.ScrapeConfig{cfg}); err == nil {
+			t.Errorf("NewScraper(%+v): expected error", cfg)
+		}
+	}
+}
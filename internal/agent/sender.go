@@ -1,16 +1,25 @@
 package agent
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
 	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/logger"
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
 )
 
 type Sender struct {
 	client  *http.Client
 	baseURL string
+	labels  models.Labels
+	token   string
+	log     zerolog.Logger
 }
 
 func NewSender(baseURL string) *Sender {
@@ -19,11 +28,31 @@ func NewSender(baseURL string) *Sender {
 			Timeout: 10 * time.Second,
 		},
 		baseURL: baseURL,
+		log:     logger.GetLogger(),
 	}
 }
 
+// SetLogger задаёт журнал отправки; каждая отправленная метрика пишется на уровне debug
+func (s *Sender) SetLogger(l zerolog.Logger) {
+	s.log = l
+}
+
+// SetLabels задаёт статические метки, которые добавляются ко всем отправляемым метрикам.
+// При наличии меток метрики отправляются в JSON формате на /update.
+func (s *Sender) SetLabels(labels models.Labels) {
+	s.labels = labels.Clone()
+}
+
+// SetToken задаёт bearer токен API сервера
+func (s *Sender) SetToken(token string) {
+	s.token = token
+}
+
 // SendGauge отправляет gauge метрику
 func (s *Sender) SendGauge(name string, value float64) error {
+	if len(s.labels) > 0 {
+		return s.SendMetric(models.Metrics{ID: name, MType: models.Gauge, Value: &value})
+	}
 	url := fmt.Sprintf("%s/update/gauge/%s/%s",
 		s.baseURL, name, strconv.FormatFloat(value, 'f', -1, 64))
 	return s.sendMetric(url, "gauge", name)
@@ -31,6 +60,9 @@ func (s *Sender) SendGauge(name string, value float64) error {
 
 // SendCounter отправляет counter метрику
 func (s *Sender) SendCounter(name string, value int64) error {
+	if len(s.labels) > 0 {
+		return s.SendMetric(models.Metrics{ID: name, MType: models.Counter, Delta: &value})
+	}
 	url := fmt.Sprintf("%s/update/counter/%s/%d", s.baseURL, name, value)
 	return s.sendMetric(url, "counter", name)
 }
@@ -40,7 +72,7 @@ func (s *Sender) SendAllMetrics(gauge map[string]float64, counter map[string]int
 	totalMetrics := len(gauge) + len(counter)
 	sentMetrics := 0
 
-	log.Printf("Sending %d gauge metrics and %d counter metrics", len(gauge), len(counter))
+	s.log.Info().Msgf("Sending %d gauge metrics and %d counter metrics", len(gauge), len(counter))
 
 	// Отправляем все gauge метрики
 	for name, value := range gauge {
@@ -58,7 +90,65 @@ func (s *Sender) SendAllMetrics(gauge map[string]float64, counter map[string]int
 		sentMetrics++
 	}
 
-	log.Printf("Successfully sent %d/%d metrics", sentMetrics, totalMetrics)
+	s.log.Info().Msgf("Successfully sent %d/%d metrics", sentMetrics, totalMetrics)
+	return nil
+}
+
+// SendMetrics отправляет метрики источников. Gauge и counter без меток отправляются
+// прежним способом через URL, остальные — в JSON. Ошибка отправки одной метрики
+// не прерывает отправку остальных; возвращаются все ошибки.
+func (s *Sender) SendMetrics(metrics []models.Metrics) error {
+	_, err := s.sendBatch(metrics, false)
+	return err
+}
+
+// sendBatch отправляет метрики и возвращает те из них, отправку которых стоит
+// повторить: при сетевой ошибке, 5xx или 429. Отклонённые сервером метрики не повторяются.
+// С stopOnRetryable после первой временной ошибки остальные метрики не отправляются,
+// а возвращаются для повтора: сервер, скорее всего, недоступен.
+func (s *Sender) sendBatch(metrics []models.Metrics, stopOnRetryable bool) ([]models.Metrics, error) {
+	var (
+		retry []models.Metrics
+		errs  []error
+	)
+	for i, m := range metrics {
+		var err error
+		switch {
+		case len(m.Labels) == 0 && m.MType == models.Gauge && m.Value != nil:
+			err = s.SendGauge(m.ID, *m.Value)
+		case len(m.Labels) == 0 && m.MType == models.Counter && m.Delta != nil:
+			err = s.SendCounter(m.ID, *m.Delta)
+		default:
+			err = s.SendMetric(m)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			if Retryable(err) {
+				retry = append(retry, m)
+				if stopOnRetryable {
+					retry = append(retry, metrics[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+	return retry, errors.Join(errs...)
+}
+
+// SendMetric отправляет метрику в JSON формате, дополняя её статическими метками.
+// Histogram и summary метрики отправляются только этим способом.
+func (s *Sender) SendMetric(m models.Metrics) error {
+	m.Labels = s.labels.Merge(m.Labels)
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metric: %w", err)
+	}
+	if err := sendGzipJSON(s.client, s.baseURL+"/update", s.token, data); err != nil {
+		return fmt.Errorf("failed to send %s %s: %w", m.MType, m.Key(), err)
+	}
+
+	s.log.Debug().Msgf("Sent %s metric: %s", m.MType, m.Key())
 	return nil
 }
 
@@ -69,6 +159,7 @@ func (s *Sender) sendMetric(url, metricType, metricName string) error {
 	}
 	//Устанавливаем требуемый заголовок
 	req.Header.Set("Content-Type", "text/plain")
+	setToken(req, s.token)
 	resp, err := s.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to send request: %w", err)
@@ -76,10 +167,10 @@ func (s *Sender) sendMetric(url, metricType, metricName string) error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned status %d for %s %s",
-			resp.StatusCode, metricType, metricName)
+		se := &StatusError{Code: resp.StatusCode, RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())}
+		return fmt.Errorf("%w for %s %s", se, metricType, metricName)
 	}
 
-	log.Printf("Sent %s metric: %s", metricType, metricName)
+	s.log.Debug().Msgf("Sent %s metric: %s", metricType, metricName)
 	return nil
 }
@@ -1,12 +1,15 @@
 package agent_test
 
 import (
+	"compress/gzip"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
 	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/agent"
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
 )
 
 func TestNewSender(t *testing.T) {
@@ -138,3 +141,67 @@ func TestSendMetricServerError(t *testing.T) {
 		t.Errorf("Expected error to contain '500', got: %v", err)
 	}
 }
+
+func TestSendGaugeWithLabels(t *testing.T) {
+	var received models.Metrics
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// С метками метрика отправляется в JSON на /update
+		if r.URL.Path != "/update" {
+			t.Errorf("Expected path '/update', got '%s'", r.URL.Path)
+		}
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Fatalf("Expected gzip body: %v", err)
+		}
+		if err := json.NewDecoder(gz).Decode(&received); err != nil {
+			t.Fatalf("Invalid JSON body: %v", err)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	sender := agent.NewSender(server.URL)
+	sender.SetLabels(models.Labels{"host": "web1", "env": "prod"})
+
+	if err := sender.SendGauge("HeapAlloc", 42.5); err != nil {
+		t.Fatalf("SendGauge() failed: %v", err)
+	}
+
+	if received.ID != "HeapAlloc" || received.MType != models.Gauge {
+		t.Errorf("Unexpected metric: %+v", received)
+	}
+	if received.Value == nil || *received.Value != 42.5 {
+		t.Errorf("Expected value 42.5, got %v", received.Value)
+	}
+	if received.Labels["host"] != "web1" || received.Labels["env"] != "prod" {
+		t.Errorf("Expected static labels, got %v", received.Labels)
+	}
+}
+
+func TestSenderToken(t *testing.T) {
+	var headers []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	sender := agent.NewSender(server.URL)
+	sender.SetToken("s3cret")
+	if err := sender.SendGauge("g", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.SendMetric(models.Metrics{ID: "c", MType: models.Counter, Delta: new(int64)}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, h := range headers {
+		if h != "Bearer s3cret" {
+			t.Errorf("Expected bearer token on every request, got %q", h)
+		}
+	}
+	if len(headers) != 2 {
+		t.Errorf("Expected 2 requests, got %d", len(headers))
+	}
+}
@@ -0,0 +1,551 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v3"
+
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/logger"
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+)
+
+// Source — источник метрик агента. Collect вызывается с интервалом источника;
+// counter метрики возвращаются приращениями с прошлого вызова, gauge — текущими
+// значениями, histogram и summary — наблюдениями с прошлого вызова.
+type Source interface {
+	Name() string
+	Collect(ctx context.Context) ([]models.Metrics, error)
+}
+
+// timeoutHandler реализуют источники, которые сами завершают работу по дедлайну
+// контекста и возвращают результат о таймауте (например, exec)
+type timeoutHandler interface {
+	HandlesTimeout() bool
+}
+
+// checkpointer реализуют источники с сохраняемой позицией чтения (logtail).
+// Checkpoint вызывается, когда результат Collect принят реестром, и возвращает
+// сохранение позиции, соответствующей этому результату (nil — сохранять нечего).
+type checkpointer interface {
+	Checkpoint() func() error
+}
+
+// SourceConfig — описание источника в YAML конфигурации агента
+type SourceConfig struct {
+	// Name — имя экземпляра источника, по умолчанию совпадает с Type
+	Name string `yaml:"name"`
+	Type string `yaml:"type"`
+	// Enabled — источник включён, если поле не задано
+	Enabled  *bool         `yaml:"enabled"`
+	Interval time.Duration `yaml:"interval"`
+	Timeout  time.Duration `yaml:"timeout"`
+	// Options — параметры конкретного типа источника
+	Options yaml.Node `yaml:"options"`
+}
+
+// IsEnabled сообщает, включён ли источник
+func (c SourceConfig) IsEnabled() bool {
+	return c.Enabled == nil || *c.Enabled
+}
+
+// DecodeOptions разбирает параметры источника в v; отсутствие параметров не ошибка
+func (c SourceConfig) DecodeOptions(v any) error {
+	if c.Options.IsZero() {
+		return nil
+	}
+	if err := c.Options.Decode(v); err != nil {
+		return fmt.Errorf("source %s: invalid options: %w", c.Name, err)
+	}
+	return nil
+}
+
+// SourceFactory создаёт источник по конфигурации
+type SourceFactory func(cfg SourceConfig) (Source, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]SourceFactory)
+)
+
+// RegisterSource регистрирует тип источника. Повторная регистрация типа — ошибка программы.
+func RegisterSource(typ string, f SourceFactory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	if _, ok := factories[typ]; ok {
+		panic("agent: source type " + typ + " registered twice")
+	}
+	factories[typ] = f
+}
+
+// SourceTypes возвращает отсортированный список зарегистрированных типов
+func SourceTypes() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	types := make([]string, 0, len(factories))
+	for t := range factories {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// NewSource создаёт источник зарегистрированного типа
+func NewSource(cfg SourceConfig) (Source, error) {
+	factoriesMu.RLock()
+	f, ok := factories[cfg.Type]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown source type %q (known: %v)", cfg.Type, SourceTypes())
+	}
+	if cfg.Name == "" {
+		cfg.Name = cfg.Type
+	}
+	return f(cfg)
+}
+
+type sourceRunner struct {
+	src      Source
+	interval time.Duration
+	timeout  time.Duration
+	busy     bool
+}
+
+// Registry опрашивает источники, каждый со своим интервалом и таймаутом,
+// и накапливает результаты до отправки. Ошибка, зависание или паника одного
+// источника не влияют на остальные.
+type Registry struct {
+	mu      sync.Mutex
+	sources []*sourceRunner
+	names   map[string]bool
+	pending map[string]models.Metrics
+	order   []string
+
+	// Агрегаты gauge за окно отправки; agg == nil — отправляется только последнее значение
+	agg     *aggregator
+	windows map[string]*gaugeWindow
+
+	// Состояние источников, отправляется вместе с метриками
+	health map[string]sourceHealth
+
+	// Сохранение позиций источников: marks — для накопленного, taken — для отданного
+	// Take и ещё не подтверждённого Commit
+	marks map[string]func() error
+	taken map[string]func() error
+
+	// log передаётся источникам через контекст Collect (logger.FromContext)
+	log zerolog.Logger
+}
+
+type sourceHealth struct {
+	up       float64
+	duration float64
+	errors   int64
+
+	// Для Status: не сбрасываются при Take
+	totalErrors int64
+	lastError   string
+	lastSuccess time.Time
+}
+
+// SourceStatus — состояние источника для страницы статуса агента
+type SourceStatus struct {
+	Name            string    `json:"name"`
+	Up              bool      `json:"up"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	Errors          int64     `json:"errors"`
+	LastError       string    `json:"last_error,omitempty"`
+	LastSuccess     time.Time `json:"last_success,omitzero"`
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		names:   make(map[string]bool),
+		pending: make(map[string]models.Metrics),
+		windows: make(map[string]*gaugeWindow),
+		health:  make(map[string]sourceHealth),
+		marks:   make(map[string]func() error),
+		taken:   make(map[string]func() error),
+		log:     logger.GetLogger(),
+	}
+}
+
+// SetLogger задаёт журнал реестра и его источников
+func (r *Registry) SetLogger(l zerolog.Logger) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.log = l
+}
+
+// SetAggregation задаёт агрегацию gauge между отправками
+func (r *Registry) SetAggregation(cfg AggregationConfig) error {
+	agg, err := newAggregator(cfg)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.agg = agg
+	r.windows = make(map[string]*gaugeWindow)
+	return nil
+}
+
+// Add добавляет источник. Нулевой timeout равен интервалу.
+func (r *Registry) Add(src Source, interval, timeout time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("source %s: interval must be positive", src.Name())
+	}
+	if timeout <= 0 || timeout > interval {
+		timeout = interval
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[src.Name()] {
+		return fmt.Errorf("duplicate source name %q", src.Name())
+	}
+	r.names[src.Name()] = true
+	r.sources = append(r.sources, &sourceRunner{src: src, interval: interval, timeout: timeout})
+	return nil
+}
+
+// Build создаёт и добавляет включённые источники из конфигурации.
+// Незаданные интервал и таймаут берутся из defaultInterval.
+func (r *Registry) Build(cfgs []SourceConfig, defaultInterval time.Duration) error {
+	for _, cfg := range cfgs {
+		if !cfg.IsEnabled() {
+			continue
+		}
+		src, err := NewSource(cfg)
+		if err != nil {
+			return err
+		}
+		interval := cfg.Interval
+		if interval <= 0 {
+			interval = defaultInterval
+		}
+		if err := r.Add(src, interval, cfg.Timeout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inheritor — источник, продолжающий работу одноимённого источника прежнего реестра
+// (logtail — с позиций, ещё не сохранённых в checkpoint)
+type inheritor interface {
+	Inherit(prev Source)
+}
+
+// Inherit передаёт источникам состояние одноимённых источников реестра prev.
+// Вызывается после остановки prev и до запуска опроса.
+func (r *Registry) Inherit(prev *Registry) {
+	old := make(map[string]Source)
+	for _, src := range prev.Sources() {
+		old[src.Name()] = src
+	}
+	for _, src := range r.Sources() {
+		in, ok := src.(inheritor)
+		if !ok {
+			continue
+		}
+		if p, ok := old[src.Name()]; ok {
+			in.Inherit(p)
+		}
+	}
+}
+
+// Sources возвращает добавленные источники
+func (r *Registry) Sources() []Source {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := make([]Source, len(r.sources))
+	for i, s := range r.sources {
+		res[i] = s.src
+	}
+	return res
+}
+
+// Status возвращает состояние опрошенных источников, отсортированное по имени
+func (r *Registry) Status() []SourceStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	res := make([]SourceStatus, 0, len(r.health))
+	for name, h := range r.health {
+		res = append(res, SourceStatus{
+			Name:            name,
+			Up:              h.up == 1,
+			DurationSeconds: h.duration,
+			Errors:          h.totalErrors,
+			LastError:       h.lastError,
+			LastSuccess:     h.lastSuccess,
+		})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+// Close закрывает источники, которые держат ресурсы (io.Closer), например logtail
+func (r *Registry) Close() error {
+	var errs []error
+	for _, src := range r.Sources() {
+		if c, ok := src.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("source %s: %w", src.Name(), err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Run опрашивает источники до отмены контекста. Первый опрос выполняется сразу.
+func (r *Registry) Run(ctx context.Context) {
+	r.mu.Lock()
+	runners := append([]*sourceRunner(nil), r.sources...)
+	r.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, sr := range runners {
+		wg.Add(1)
+		go func(sr *sourceRunner) {
+			defer wg.Done()
+			ticker := time.NewTicker(sr.interval)
+			defer ticker.Stop()
+			for {
+				r.poll(ctx, sr)
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}(sr)
+	}
+	wg.Wait()
+}
+
+// CollectOnce опрашивает все источники один раз и ждёт завершения
+func (r *Registry) CollectOnce(ctx context.Context) {
+	r.mu.Lock()
+	runners := append([]*sourceRunner(nil), r.sources...)
+	r.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, sr := range runners {
+		wg.Add(1)
+		go func(sr *sourceRunner) {
+			defer wg.Done()
+			r.poll(ctx, sr)
+		}(sr)
+	}
+	wg.Wait()
+}
+
+// poll выполняет Collect с таймаутом. Если источник не уложился в таймаут,
+// его результат отбрасывается, а следующий опрос пропускается до завершения текущего.
+func (r *Registry) poll(ctx context.Context, sr *sourceRunner) {
+	r.mu.Lock()
+	if sr.busy {
+		r.mu.Unlock()
+		r.recordFailure(sr.src.Name(), 0, errors.New("previous collection is still running"))
+		return
+	}
+	sr.busy = true
+	l := r.log
+	r.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(logger.WithContext(ctx, l), sr.timeout)
+	defer cancel()
+
+	type result struct {
+		metrics []models.Metrics
+		err     error
+	}
+	done := make(chan result, 1)
+	start := time.Now()
+	go func() {
+		defer func() {
+			r.mu.Lock()
+			sr.busy = false
+			r.mu.Unlock()
+			if p := recover(); p != nil {
+				done <- result{err: fmt.Errorf("panic: %v", p)}
+			}
+		}()
+		metrics, err := sr.src.Collect(ctx)
+		done <- result{metrics, err}
+	}()
+
+	expired := ctx.Done()
+	if th, ok := sr.src.(timeoutHandler); ok && th.HandlesTimeout() {
+		expired = nil
+	}
+
+	select {
+	case res := <-done:
+		if res.err != nil {
+			r.recordFailure(sr.src.Name(), time.Since(start), res.err)
+			return
+		}
+		var mark func() error
+		if cp, ok := sr.src.(checkpointer); ok {
+			mark = cp.Checkpoint()
+		}
+		r.store(sr.src.Name(), time.Since(start), res.metrics, mark)
+	case <-expired:
+		r.recordFailure(sr.src.Name(), time.Since(start), ctx.Err())
+	}
+}
+
+func (r *Registry) recordFailure(name string, d time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.log.Info().Msgf("Source %s failed: %v", name, err)
+	h := r.health[name]
+	h.up, h.duration = 0, d.Seconds()
+	h.errors++
+	h.totalErrors++
+	h.lastError = err.Error()
+	r.health[name] = h
+}
+
+// store добавляет результат источника к накопленным: counter суммируются,
+// gauge перезаписываются, распределения сливаются. mark — сохранение позиции
+// источника после этого результата.
+func (r *Registry) store(name string, d time.Duration, metrics []models.Metrics, mark func() error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if mark != nil {
+		r.marks[name] = mark
+	}
+
+	h := r.health[name]
+	h.up, h.duration = 1, d.Seconds()
+	h.lastSuccess = time.Now()
+	r.health[name] = h
+
+	for _, m := range metrics {
+		key := m.MType + " " + m.Key()
+		if r.agg != nil && m.MType == models.Gauge && m.Value != nil && r.agg.applies(m.ID) {
+			w, ok := r.windows[key]
+			if !ok {
+				w = r.agg.newWindow()
+				r.windows[key] = w
+			}
+			w.observe(*m.Value)
+		}
+		prev, ok := r.pending[key]
+		if !ok {
+			r.order = append(r.order, key)
+			r.pending[key] = cloneMetric(m)
+			continue
+		}
+		r.pending[key] = mergeMetric(prev, m)
+	}
+}
+
+// Take возвращает накопленные метрики, агрегаты gauge за окно и состояние источников,
+// очищая накопленное. Позиции источников для отданных метрик сохраняет Commit.
+func (r *Registry) Take() []models.Metrics {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for name, mark := range r.marks {
+		r.taken[name] = mark
+	}
+	r.marks = make(map[string]func() error)
+
+	res := make([]models.Metrics, 0, len(r.order)+3*len(r.health))
+	for _, key := range r.order {
+		m := r.pending[key]
+		res = append(res, m)
+		if w, ok := r.windows[key]; ok {
+			res = append(res, r.agg.emit(m, w)...)
+		}
+	}
+	r.pending = make(map[string]models.Metrics)
+	r.windows = make(map[string]*gaugeWindow)
+	r.order = nil
+
+	names := make([]string, 0, len(r.health))
+	for name := range r.health {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		h := r.health[name]
+		labels := models.Labels{"source": name}
+		up, duration, errs := h.up, h.duration, h.errors
+		res = append(res,
+			models.Metrics{ID: "agent_source_up", MType: models.Gauge, Value: &up, Labels: labels},
+			models.Metrics{ID: "agent_source_duration_seconds", MType: models.Gauge, Value: &duration, Labels: labels},
+			models.Metrics{ID: "agent_source_errors_total", MType: models.Counter, Delta: &errs, Labels: labels})
+		h.errors = 0
+		r.health[name] = h
+	}
+	return res
+}
+
+// Commit сохраняет позиции источников для метрик, отданных Take. Вызывается после
+// успешной отправки; если отправка не удалась, позиции сохранит следующий Commit.
+func (r *Registry) Commit() error {
+	r.mu.Lock()
+	taken := r.taken
+	r.taken = make(map[string]func() error)
+	r.mu.Unlock()
+
+	var errs []error
+	for name, save := range taken {
+		if err := save(); err != nil {
+			errs = append(errs, fmt.Errorf("source %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func cloneMetric(m models.Metrics) models.Metrics {
+	if m.Delta != nil {
+		d := *m.Delta
+		m.Delta = &d
+	}
+	if m.Value != nil {
+		v := *m.Value
+		m.Value = &v
+	}
+	if m.Histogram != nil {
+		m.Histogram = m.Histogram.Clone()
+	}
+	if m.Sketch != nil {
+		m.Sketch = m.Sketch.Clone()
+	}
+	return m
+}
+
+// mergeMetric объединяет накопленное значение prev с новым m.
+// При несовпадении корзин или точности распределение заменяется новым.
+func mergeMetric(prev, m models.Metrics) models.Metrics {
+	switch m.MType {
+	case models.Counter:
+		if prev.Delta != nil && m.Delta != nil {
+			*prev.Delta += *m.Delta
+			return prev
+		}
+	case models.Histogram:
+		if prev.Histogram != nil && m.Histogram != nil && prev.Histogram.Merge(m.Histogram) == nil {
+			return prev
+		}
+	case models.Summary:
+		if prev.Sketch != nil && m.Sketch != nil && prev.Sketch.Merge(m.Sketch) == nil {
+			return prev
+		}
+	}
+	return cloneMetric(m)
+}
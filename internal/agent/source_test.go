@@ -0,0 +1,208 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+)
+
+type funcSource struct {
+	name    string
+	collect func(ctx context.Context) ([]models.Metrics, error)
+}
+
+func (s *funcSource) Name() string { return s.name }
+
+func (s *funcSource) Collect(ctx context.Context) ([]models.Metrics, error) {
+	return s.collect(ctx)
+}
+
+func findMetric(metrics []models.Metrics, mtype, id string, labels models.Labels) *models.Metrics {
+	for i := range metrics {
+		if metrics[i].MType == mtype && metrics[i].Key() == models.SeriesKey(id, labels) {
+			return &metrics[i]
+		}
+	}
+	return nil
+}
+
+func TestRegistryAggregatesBetweenReports(t *testing.T) {
+	r := NewRegistry()
+	value := 0.0
+	err := r.Add(&funcSource{name: "test", collect: func(ctx context.Context) ([]models.Metrics, error) {
+		value++
+		v, one := value, int64(1)
+		h := models.NewHistogram([]float64{1})
+		h.Observe(0.5)
+		return []models.Metrics{
+			{ID: "g", MType: models.Gauge, Value: &v},
+			{ID: "c", MType: models.Counter, Delta: &one},
+			{ID: "h", MType: models.Histogram, Histogram: h},
+		}, nil
+	}}, time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		r.CollectOnce(context.Background())
+	}
+	metrics := r.Take()
+
+	if m := findMetric(metrics, models.Gauge, "g", nil); m == nil || *m.Value != 3 {
+		t.Errorf("Expected last gauge value 3, got %+v", m)
+	}
+	if m := findMetric(metrics, models.Counter, "c", nil); m == nil || *m.Delta != 3 {
+		t.Errorf("Expected counter sum 3, got %+v", m)
+	}
+	if m := findMetric(metrics, models.Histogram, "h", nil); m == nil || m.Histogram.Count != 3 {
+		t.Errorf("Expected merged histogram with 3 observations, got %+v", m)
+	}
+	if m := findMetric(metrics, models.Gauge, "agent_source_up", models.Labels{"source": "test"}); m == nil || *m.Value != 1 {
+		t.Errorf("Expected agent_source_up=1, got %+v", m)
+	}
+
+	// После Take накопленное очищается
+	if m := findMetric(r.Take(), models.Counter, "c", nil); m != nil {
+		t.Errorf("Expected counters to be reset after Take, got %+v", m)
+	}
+}
+
+func TestRegistryIsolatesFailures(t *testing.T) {
+	r := NewRegistry()
+	ok := &funcSource{name: "ok", collect: func(ctx context.Context) ([]models.Metrics, error) {
+		v := 1.0
+		return []models.Metrics{{ID: "alive", MType: models.Gauge, Value: &v}}, nil
+	}}
+	failing := &funcSource{name: "failing", collect: func(ctx context.Context) ([]models.Metrics, error) {
+		return nil, errors.New("boom")
+	}}
+	panicking := &funcSource{name: "panicking", collect: func(ctx context.Context) ([]models.Metrics, error) {
+		panic("unexpected")
+	}}
+	hanging := &funcSource{name: "hanging", collect: func(ctx context.Context) ([]models.Metrics, error) {
+		time.Sleep(time.Second)
+		return nil, nil
+	}}
+
+	r.Add(ok, time.Second, 0)
+	r.Add(failing, time.Second, 0)
+	r.Add(panicking, time.Second, 0)
+	r.Add(hanging, time.Second, 50*time.Millisecond)
+
+	start := time.Now()
+	r.CollectOnce(context.Background())
+	if time.Since(start) > 500*time.Millisecond {
+		t.Error("Hanging source must not block collection past its timeout")
+	}
+
+	metrics := r.Take()
+	if findMetric(metrics, models.Gauge, "alive", nil) == nil {
+		t.Error("Healthy source metrics must be collected despite failing sources")
+	}
+	for _, name := range []string{"failing", "panicking", "hanging"} {
+		labels := models.Labels{"source": name}
+		if m := findMetric(metrics, models.Gauge, "agent_source_up", labels); m == nil || *m.Value != 0 {
+			t.Errorf("Expected agent_source_up=0 for %s, got %+v", name, m)
+		}
+		if m := findMetric(metrics, models.Counter, "agent_source_errors_total", labels); m == nil || *m.Delta != 1 {
+			t.Errorf("Expected 1 error for %s, got %+v", name, m)
+		}
+	}
+}
+
+func TestRegistryBuildFromYAML(t *testing.T) {
+	var cfgs []SourceConfig
+	err := yaml.Unmarshal([]byte(`
+- type: runtime
+  interval: 5s
+  timeout: 1s
+  options:
+    histogram_buckets: [1, 10]
+- type: random
+  name: rnd
+- type: system
+  enabled: false
+`), &cfgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRegistry()
+	if err := r.Build(cfgs, 2*time.Second); err != nil {
+		t.Fatalf("Build() failed: %v", err)
+	}
+
+	sources := r.Sources()
+	if len(sources) != 2 || sources[0].Name() != "runtime" || sources[1].Name() != "rnd" {
+		t.Fatalf("Expected runtime and rnd sources, got %v", sources)
+	}
+	if rs := sources[0].(*RuntimeSource); len(rs.buckets) != 2 {
+		t.Errorf("Expected runtime buckets from options, got %v", rs.buckets)
+	}
+	if r.sources[0].interval != 5*time.Second || r.sources[0].timeout != time.Second {
+		t.Errorf("Unexpected runtime schedule %v/%v", r.sources[0].interval, r.sources[0].timeout)
+	}
+	if r.sources[1].interval != 2*time.Second {
+		t.Errorf("Expected default interval for rnd, got %v", r.sources[1].interval)
+	}
+
+	for _, bad := range []SourceConfig{{Type: "unknown"}, {Type: "random", Name: "rnd"}} {
+		if err := r.Build([]SourceConfig{bad}, time.Second); err == nil {
+			t.Errorf("Build(%+v): expected error", bad)
+		}
+	}
+}
+
+// checkpointSource — источник, позиция которого равна числу вызовов Collect
+type checkpointSource struct {
+	funcSource
+	pos, saved int
+}
+
+func (s *checkpointSource) Checkpoint() func() error {
+	pos := s.pos
+	return func() error {
+		s.saved = pos
+		return nil
+	}
+}
+
+func TestRegistryCommitsTakenCheckpoints(t *testing.T) {
+	r := NewRegistry()
+	src := &checkpointSource{}
+	src.funcSource = funcSource{name: "tail", collect: func(ctx context.Context) ([]models.Metrics, error) {
+		src.pos++
+		return nil, nil
+	}}
+	if err := r.Add(src, time.Second, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	r.CollectOnce(context.Background())
+	r.Take()
+	r.CollectOnce(context.Background())
+	if err := r.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if src.saved != 1 {
+		t.Errorf("Expected position of taken metrics to be saved, got %d", src.saved)
+	}
+
+	// Без Commit (неудачная отправка) позиция не сохраняется до следующего Take
+	r.Take()
+	if src.saved != 1 {
+		t.Errorf("Position must not be saved before Commit, got %d", src.saved)
+	}
+	r.CollectOnce(context.Background())
+	r.Take()
+	r.Commit()
+	if src.saved != 3 {
+		t.Errorf("Expected latest taken position 3, got %d", src.saved)
+	}
+}
@@ -0,0 +1,150 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"runtime"
+	"sync"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/sketch"
+)
+
+func init() {
+	RegisterSource("runtime", newRuntimeSourceFromConfig)
+	RegisterSource("random", func(cfg SourceConfig) (Source, error) {
+		return &RandomSource{name: cfg.Name}, nil
+	})
+	RegisterSource("system", func(cfg SourceConfig) (Source, error) {
+		return NewSystemSource(cfg.Name), nil
+	})
+	RegisterSource("prometheus", newScraperFromConfig)
+}
+
+// DefaultSources — источники, включаемые при отсутствии секции sources в конфигурации
+func DefaultSources() []SourceConfig {
+	return []SourceConfig{{Type: "runtime"}, {Type: "random"}, {Type: "system"}}
+}
+
+// RuntimeSource собирает runtime.MemStats, счётчик опросов PollCount
+// и распределение пауз GC (histogram GCPauseMs и summary GCPauseMsSummary)
+type RuntimeSource struct {
+	name string
+
+	mu        sync.Mutex
+	buckets   []float64
+	lastNumGC uint32
+}
+
+func NewRuntimeSource(name string) *RuntimeSource {
+	return &RuntimeSource{name: name, buckets: models.DefaultBuckets}
+}
+
+func newRuntimeSourceFromConfig(cfg SourceConfig) (Source, error) {
+	var opts struct {
+		Buckets []float64 `yaml:"histogram_buckets"`
+	}
+	if err := cfg.DecodeOptions(&opts); err != nil {
+		return nil, err
+	}
+	s := NewRuntimeSource(cfg.Name)
+	if len(opts.Buckets) > 0 {
+		s.SetHistogramBuckets(opts.Buckets)
+	}
+	return s, nil
+}
+
+func (s *RuntimeSource) Name() string { return s.name }
+
+// SetHistogramBuckets задаёт границы корзин гистограммы пауз GC
+func (s *RuntimeSource) SetHistogramBuckets(bounds []float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buckets = append([]float64(nil), bounds...)
+}
+
+func (s *RuntimeSource) Collect(ctx context.Context) ([]models.Metrics, error) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	gauges := []struct {
+		name  string
+		value float64
+	}{
+		{"Alloc", float64(m.Alloc)},
+		{"BuckHashSys", float64(m.BuckHashSys)},
+		{"Frees", float64(m.Frees)},
+		{"GCCPUFraction", m.GCCPUFraction},
+		{"GCSys", float64(m.GCSys)},
+		{"HeapAlloc", float64(m.HeapAlloc)},
+		{"HeapIdle", float64(m.HeapIdle)},
+		{"HeapInuse", float64(m.HeapInuse)},
+		{"HeapObjects", float64(m.HeapObjects)},
+		{"HeapReleased", float64(m.HeapReleased)},
+		{"HeapSys", float64(m.HeapSys)},
+		{"LastGC", float64(m.LastGC)},
+		{"Lookups", float64(m.Lookups)},
+		{"MCacheInuse", float64(m.MCacheInuse)},
+		{"MCacheSys", float64(m.MCacheSys)},
+		{"MSpanInuse", float64(m.MSpanInuse)},
+		{"MSpanSys", float64(m.MSpanSys)},
+		{"Mallocs", float64(m.Mallocs)},
+		{"NextGC", float64(m.NextGC)},
+		{"NumForcedGC", float64(m.NumForcedGC)},
+		{"NumGC", float64(m.NumGC)},
+		{"OtherSys", float64(m.OtherSys)},
+		{"PauseTotalNs", float64(m.PauseTotalNs)},
+		{"StackInuse", float64(m.StackInuse)},
+		{"StackSys", float64(m.StackSys)},
+		{"Sys", float64(m.Sys)},
+		{"TotalAlloc", float64(m.TotalAlloc)},
+	}
+
+	res := make([]models.Metrics, 0, len(gauges)+3)
+	for _, g := range gauges {
+		v := g.value
+		res = append(res, models.Metrics{ID: g.name, MType: models.Gauge, Value: &v})
+	}
+	one := int64(1)
+	res = append(res, models.Metrics{ID: "PollCount", MType: models.Counter, Delta: &one})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Паузы GC, случившиеся с прошлого опроса (в кольцевом буфере хранятся последние 256)
+	hist := models.NewHistogram(s.buckets)
+	sk := sketch.New(sketch.DefaultAlpha)
+	from := s.lastNumGC
+	if m.NumGC-from > uint32(len(m.PauseNs)) {
+		from = m.NumGC - uint32(len(m.PauseNs))
+	}
+	for i := from + 1; i <= m.NumGC; i++ {
+		pauseMs := float64(m.PauseNs[(i+255)%256]) / 1e6
+		hist.Observe(pauseMs)
+		sk.Add(pauseMs)
+	}
+	s.lastNumGC = m.NumGC
+
+	if hist.Count > 0 {
+		res = append(res,
+			models.Metrics{ID: gcPauseHistogram, MType: models.Histogram, Histogram: hist},
+			models.Metrics{ID: gcPauseSummary, MType: models.Summary, Sketch: sk})
+	}
+	return res, nil
+}
+
+// RandomSource выдаёт gauge RandomValue — произвольное значение в [0, 1)
+type RandomSource struct {
+	name string
+}
+
+func (s *RandomSource) Name() string { return s.name }
+
+func (s *RandomSource) Collect(ctx context.Context) ([]models.Metrics, error) {
+	v := rand.Float64()
+	return []models.Metrics{{ID: "RandomValue", MType: models.Gauge, Value: &v}}, nil
+}
+
+// ErrUnsupported — источник недоступен на текущей платформе
+var ErrUnsupported = errors.New("not supported on this platform")
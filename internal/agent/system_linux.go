@@ -0,0 +1,145 @@
+//go:build linux
+
+package agent
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+)
+
+// SystemSource читает состояние системы из /proc: TotalMemory, FreeMemory,
+// загрузку Load1/Load5/Load15 и CPUutilization{cpu="N"} — долю занятого
+// времени каждого ядра с прошлого опроса
+type SystemSource struct {
+	name string
+	proc string
+
+	mu   sync.Mutex
+	prev map[string]cpuTimes
+}
+
+type cpuTimes struct {
+	busy, total uint64
+}
+
+func NewSystemSource(name string) *SystemSource {
+	return &SystemSource{name: name, proc: "/proc", prev: make(map[string]cpuTimes)}
+}
+
+func (s *SystemSource) Name() string { return s.name }
+
+func (s *SystemSource) Collect(ctx context.Context) ([]models.Metrics, error) {
+	var res []models.Metrics
+	gauge := func(name string, v float64, labels models.Labels) {
+		res = append(res, models.Metrics{ID: name, MType: models.Gauge, Value: &v, Labels: labels})
+	}
+
+	mem, err := readKeyValues(s.proc + "/meminfo")
+	if err != nil {
+		return nil, err
+	}
+	// Значения /proc/meminfo — в килобайтах
+	gauge("TotalMemory", float64(mem["MemTotal"])*1024, nil)
+	if avail, ok := mem["MemAvailable"]; ok {
+		gauge("FreeMemory", float64(avail)*1024, nil)
+	} else {
+		gauge("FreeMemory", float64(mem["MemFree"])*1024, nil)
+	}
+
+	if data, err := os.ReadFile(s.proc + "/loadavg"); err == nil {
+		fields := strings.Fields(string(data))
+		for i, name := range []string{"Load1", "Load5", "Load15"} {
+			if i < len(fields) {
+				if v, err := strconv.ParseFloat(fields[i], 64); err == nil {
+					gauge(name, v, nil)
+				}
+			}
+		}
+	}
+
+	cpus, err := readCPUTimes(s.proc + "/stat")
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for cpu, cur := range cpus {
+		prev, ok := s.prev[cpu]
+		s.prev[cpu] = cur
+		if !ok || cur.total <= prev.total {
+			continue
+		}
+		util := 100 * float64(cur.busy-prev.busy) / float64(cur.total-prev.total)
+		gauge("CPUutilization", util, models.Labels{"cpu": cpu})
+	}
+	return res, nil
+}
+
+// readKeyValues читает файл вида "Key:   123 kB"
+func readKeyValues(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	res := make(map[string]uint64)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		key, rest, ok := strings.Cut(sc.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		if v, err := strconv.ParseUint(fields[0], 10, 64); err == nil {
+			res[key] = v
+		}
+	}
+	return res, sc.Err()
+}
+
+// readCPUTimes читает счётчики времени отдельных ядер из /proc/stat.
+// Занятым считается всё время, кроме idle и iowait; guest уже входит в user.
+func readCPUTimes(path string) (map[string]cpuTimes, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	res := make(map[string]cpuTimes)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 5 || !strings.HasPrefix(fields[0], "cpu") || fields[0] == "cpu" {
+			continue
+		}
+		var t cpuTimes
+		values := fields[1:]
+		if len(values) > 8 {
+			values = values[:8]
+		}
+		for i, f := range values {
+			v, err := strconv.ParseUint(f, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid value %q", path, f)
+			}
+			t.total += v
+			if i != 3 && i != 4 {
+				t.busy += v
+			}
+		}
+		res[strings.TrimPrefix(fields[0], "cpu")] = t
+	}
+	return res, sc.Err()
+}
@@ -0,0 +1,49 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+)
+
+func TestSystemSource(t *testing.T) {
+	proc := t.TempDir()
+	write := func(name, data string) {
+		if err := os.WriteFile(filepath.Join(proc, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("meminfo", "MemTotal:       16000 kB\nMemFree:         1000 kB\nMemAvailable:    4000 kB\n")
+	write("loadavg", "0.50 0.25 0.10 1/100 12345\n")
+	write("stat", "cpu  200 0 100 700 0 0 0 0 0 0\ncpu0 100 0 50 350 0 0 0 0 0 0\n")
+
+	s := NewSystemSource("system")
+	s.proc = proc
+
+	metrics, err := s.Collect(context.Background())
+	if err != nil {
+		t.Fatalf("Collect() failed: %v", err)
+	}
+	if m := findMetric(metrics, models.Gauge, "TotalMemory", nil); m == nil || *m.Value != 16000*1024 {
+		t.Errorf("Unexpected TotalMemory %+v", m)
+	}
+	if m := findMetric(metrics, models.Gauge, "FreeMemory", nil); m == nil || *m.Value != 4000*1024 {
+		t.Errorf("Expected FreeMemory from MemAvailable, got %+v", m)
+	}
+	if m := findMetric(metrics, models.Gauge, "Load1", nil); m == nil || *m.Value != 0.5 {
+		t.Errorf("Unexpected Load1 %+v", m)
+	}
+	// Загрузка CPU считается по разнице между опросами
+	if m := findMetric(metrics, models.Gauge, "CPUutilization", models.Labels{"cpu": "0"}); m != nil {
+		t.Error("CPUutilization must not be reported on the first collection")
+	}
+
+	write("stat", "cpu  260 0 120 720 0 0 0 0 0 0\ncpu0 130 0 60 360 0 0 0 0 0 0\n")
+	metrics, _ = s.Collect(context.Background())
+	if m := findMetric(metrics, models.Gauge, "CPUutilization", models.Labels{"cpu": "0"}); m == nil || *m.Value != 80 {
+		t.Errorf("Expected CPUutilization 80, got %+v", m)
+	}
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+
+package agent
+
+import (
+	"context"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+)
+
+// SystemSource на платформах без /proc не поддерживается:
+// Collect возвращает ErrUnsupported, остальные источники продолжают работу
+type SystemSource struct {
+	name string
+}
+
+func NewSystemSource(name string) *SystemSource {
+	return &SystemSource{name: name}
+}
+
+func (s *SystemSource) Name() string { return s.name }
+
+func (s *SystemSource) Collect(ctx context.Context) ([]models.Metrics, error) {
+	return nil, ErrUnsupported
+}
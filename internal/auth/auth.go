@@ -0,0 +1,194 @@
+// Package auth реализует аутентификацию API сервера по bearer токенам.
+// У каждого токена есть набор прав (write, read, admin) и необязательный список
+// префиксов имён метрик, которые токен может записывать.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/tenant"
+)
+
+// Scope — право токена
+type Scope string
+
+const (
+	ScopeWrite Scope = "write"
+	ScopeRead  Scope = "read"
+	// ScopeAdmin включает все остальные права
+	ScopeAdmin Scope = "admin"
+)
+
+// ErrMetricNotAllowed — токену не разрешена запись метрики с таким именем
+var ErrMetricNotAllowed = errors.New("metric name not allowed for token")
+
+// Token — API токен
+type Token struct {
+	Name   string  `yaml:"name"`
+	Secret string  `yaml:"token"`
+	Scopes []Scope `yaml:"scopes"`
+	// Prefixes ограничивает запись метриками с этими префиксами имени; пусто — без ограничений
+	Prefixes []string `yaml:"prefixes"`
+	// Tenant привязывает токен к арендатору; пусто — арендатор берётся из заголовка запроса
+	Tenant string `yaml:"tenant"`
+}
+
+// Has сообщает, есть ли у токена право scope
+func (t *Token) Has(scope Scope) bool {
+	for _, s := range t.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// CanWrite проверяет, может ли токен записывать метрику name
+func (t *Token) CanWrite(name string) error {
+	if !t.Has(ScopeWrite) {
+		return fmt.Errorf("token %q has no %s scope", t.Name, ScopeWrite)
+	}
+	if len(t.Prefixes) == 0 {
+		return nil
+	}
+	for _, p := range t.Prefixes {
+		if strings.HasPrefix(name, p) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: token %q may write only metrics prefixed with %s",
+		ErrMetricNotAllowed, t.Name, strings.Join(t.Prefixes, ", "))
+}
+
+// Store хранит токены по хешу секрета
+type Store struct {
+	tokens map[[sha256.Size]byte]*Token
+}
+
+// NewStore проверяет токены и создаёт хранилище
+func NewStore(tokens []Token) (*Store, error) {
+	s := &Store{tokens: make(map[[sha256.Size]byte]*Token, len(tokens))}
+	names := make(map[string]bool)
+	for i := range tokens {
+		t := tokens[i]
+		if t.Name == "" || t.Secret == "" {
+			return nil, fmt.Errorf("token %d: name and token are required", i)
+		}
+		if names[t.Name] {
+			return nil, fmt.Errorf("duplicate token name %q", t.Name)
+		}
+		names[t.Name] = true
+		if len(t.Scopes) == 0 {
+			return nil, fmt.Errorf("token %q: at least one scope is required", t.Name)
+		}
+		if t.Tenant != "" {
+			if err := tenant.Validate(t.Tenant); err != nil {
+				return nil, fmt.Errorf("token %q: %w", t.Name, err)
+			}
+		}
+		for _, sc := range t.Scopes {
+			switch sc {
+			case ScopeWrite, ScopeRead, ScopeAdmin:
+			default:
+				return nil, fmt.Errorf("token %q: unknown scope %q", t.Name, sc)
+			}
+		}
+		key := sha256.Sum256([]byte(t.Secret))
+		if _, ok := s.tokens[key]; ok {
+			return nil, fmt.Errorf("token %q: secret is already used", t.Name)
+		}
+		s.tokens[key] = &t
+	}
+	return s, nil
+}
+
+// Len возвращает число токенов
+func (s *Store) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.tokens)
+}
+
+// Lookup ищет токен по секрету
+func (s *Store) Lookup(secret string) (*Token, bool) {
+	t, ok := s.tokens[sha256.Sum256([]byte(secret))]
+	return t, ok
+}
+
+// ParseTokens разбирает токены из строки вида
+// "name:secret:scope,scope[:prefix,prefix[:tenant]];name2:secret2:admin"
+func ParseTokens(s string) ([]Token, error) {
+	var tokens []Token
+	for _, part := range strings.Split(s, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		fields := strings.Split(part, ":")
+		if len(fields) < 3 || len(fields) > 5 {
+			return nil, fmt.Errorf("invalid token %q: expected name:token:scopes[:prefixes[:tenant]]", fields[0])
+		}
+		t := Token{Name: fields[0], Secret: fields[1]}
+		for _, sc := range strings.Split(fields[2], ",") {
+			t.Scopes = append(t.Scopes, Scope(strings.TrimSpace(sc)))
+		}
+		if len(fields) == 5 {
+			t.Tenant = strings.TrimSpace(fields[4])
+		}
+		if len(fields) >= 4 {
+			for _, p := range strings.Split(fields[3], ",") {
+				if p = strings.TrimSpace(p); p != "" {
+					t.Prefixes = append(t.Prefixes, p)
+				}
+			}
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, nil
+}
+
+// LoadFile читает токены из YAML файла со списком tokens
+func LoadFile(path string) ([]Token, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Tokens []Token `yaml:"tokens"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return file.Tokens, nil
+}
+
+type contextKey struct{}
+
+// WithToken возвращает контекст с токеном запроса
+func WithToken(ctx context.Context, t *Token) context.Context {
+	return context.WithValue(ctx, contextKey{}, t)
+}
+
+// FromContext возвращает токен запроса, если запрос аутентифицирован
+func FromContext(ctx context.Context) (*Token, bool) {
+	t, ok := ctx.Value(contextKey{}).(*Token)
+	return t, ok
+}
+
+// CanWrite проверяет запись метрики name токеном из контекста.
+// Без токена (аутентификация выключена) запись разрешена.
+func CanWrite(ctx context.Context, name string) error {
+	t, ok := FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	return t.CanWrite(name)
+}
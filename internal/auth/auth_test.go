@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+func TestParseTokens(t *testing.T) {
+	tokens, err := ParseTokens("ci:s3cret:write,read:ci_,build_; ops:t0k:admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 2 {
+		t.Fatalf("Expected 2 tokens, got %d", len(tokens))
+	}
+	ci := tokens[0]
+	if ci.Name != "ci" || ci.Secret != "s3cret" || len(ci.Scopes) != 2 || len(ci.Prefixes) != 2 {
+		t.Errorf("Unexpected token %+v", ci)
+	}
+	if _, err := ParseTokens("broken"); err == nil {
+		t.Error("Expected error for token without scopes")
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.yaml")
+	os.WriteFile(path, []byte(`tokens:
+  - name: grafana
+    token: abc
+    scopes: [read]
+`), 0o600)
+	tokens, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 || tokens[0].Name != "grafana" || tokens[0].Scopes[0] != ScopeRead {
+		t.Errorf("Unexpected tokens %+v", tokens)
+	}
+}
+
+func TestNewStoreErrors(t *testing.T) {
+	for _, tokens := range [][]Token{
+		{{Name: "a", Scopes: []Scope{ScopeRead}}},
+		{{Name: "a", Secret: "x"}},
+		{{Name: "a", Secret: "x", Scopes: []Scope{"root"}}},
+		{{Name: "a", Secret: "x", Scopes: []Scope{ScopeRead}}, {Name: "a", Secret: "y", Scopes: []Scope{ScopeRead}}},
+		{{Name: "a", Secret: "x", Scopes: []Scope{ScopeRead}}, {Name: "b", Secret: "x", Scopes: []Scope{ScopeRead}}},
+	} {
+		if _, err := NewStore(tokens); err == nil {
+			t.Errorf("Expected error for %+v", tokens)
+		}
+	}
+}
+
+func TestTokenCanWrite(t *testing.T) {
+	tok := &Token{Name: "ci", Scopes: []Scope{ScopeWrite}, Prefixes: []string{"ci_"}}
+	if err := tok.CanWrite("ci_builds"); err != nil {
+		t.Errorf("Expected prefixed metric to be allowed: %v", err)
+	}
+	if err := tok.CanWrite("HeapAlloc"); err == nil {
+		t.Error("Expected metric outside prefixes to be rejected")
+	}
+	admin := &Token{Name: "ops", Scopes: []Scope{ScopeAdmin}}
+	if err := admin.CanWrite("anything"); err != nil || !admin.Has(ScopeRead) {
+		t.Error("Admin scope must include write and read")
+	}
+	reader := &Token{Name: "grafana", Scopes: []Scope{ScopeRead}}
+	if reader.CanWrite("x") == nil {
+		t.Error("Read-only token must not write")
+	}
+}
+
+// logEntry запоминает имя токена, как журнал запросов сервера
+type logEntry struct {
+	middleware.LogEntry
+	token string
+}
+
+func (e *logEntry) SetToken(name string) { e.token = name }
+
+func TestRequire(t *testing.T) {
+	store, err := NewStore([]Token{
+		{Name: "writer", Secret: "w", Scopes: []Scope{ScopeWrite}},
+		{Name: "reader", Secret: "r", Scopes: []Scope{ScopeRead}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seen string
+	h := Require(store, ScopeWrite)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tok, _ := FromContext(r.Context())
+		seen = tok.Name
+	}))
+
+	tests := []struct {
+		header string
+		code   int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Basic dXNlcg==", http.StatusUnauthorized},
+		{"Bearer nope", http.StatusUnauthorized},
+		{"Bearer r", http.StatusForbidden},
+		{"Bearer w", http.StatusOK},
+	}
+	for _, tt := range tests {
+		entry := &logEntry{}
+		req := httptest.NewRequest(http.MethodPost, "/update", nil)
+		req = middleware.WithLogEntry(req, entry)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != tt.code {
+			t.Errorf("%q: expected %d, got %d", tt.header, tt.code, w.Code)
+		}
+		if w.Code != http.StatusOK {
+			var body errorResponse
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil || body.Error == "" {
+				t.Errorf("%q: expected JSON error body", tt.header)
+			}
+		}
+		if tt.header == "Bearer r" && entry.token != "reader" {
+			t.Errorf("Expected token name in request log, got %q", entry.token)
+		}
+	}
+	if seen != "writer" {
+		t.Errorf("Expected token in handler context, got %q", seen)
+	}
+
+	// Без токенов проверка выключена
+	open := Require(nil, ScopeAdmin)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	w := httptest.NewRecorder()
+	open.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected open access without tokens, got %d", w.Code)
+	}
+}
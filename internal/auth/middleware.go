@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// TokenLogger — запись журнала запроса, в которую middleware сообщает имя токена
+type TokenLogger interface {
+	SetToken(name string)
+}
+
+// errorResponse — тело ответов 401 и 403
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// WriteError отвечает JSON ошибкой {"error": msg}
+func WriteError(w http.ResponseWriter, status int, msg string) {
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{Error: msg})
+}
+
+// Require возвращает middleware, пропускающий запросы с токеном из store, у которого
+// есть право scope. Без токена или с неизвестным токеном — 401, без права — 403.
+// Пустое хранилище выключает проверку.
+func Require(store *Store, scope Scope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if store.Len() == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			secret, ok := bearer(r.Header.Get("Authorization"))
+			if !ok {
+				WriteError(w, http.StatusUnauthorized, "missing bearer token")
+				return
+			}
+			t, ok := store.Lookup(secret)
+			if !ok {
+				WriteError(w, http.StatusUnauthorized, "invalid token")
+				return
+			}
+			if entry, ok := middleware.GetLogEntry(r).(TokenLogger); ok {
+				entry.SetToken(t.Name)
+			}
+			if !t.Has(scope) {
+				WriteError(w, http.StatusForbidden, "token "+t.Name+" has no "+string(scope)+" scope")
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithToken(r.Context(), t)))
+		})
+	}
+}
+
+// bearer извлекает токен из заголовка Authorization: Bearer <token>
+func bearer(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultWatchDebounce — пауза после последнего изменения файла перед вызовом onChange:
+// редакторы сохраняют файл несколькими операциями
+const DefaultWatchDebounce = 200 * time.Millisecond
+
+// Watch вызывает onChange при изменении файла path до отмены контекста.
+// Наблюдается каталог файла, поэтому замена файла через rename (как делают
+// редакторы) тоже отслеживается. ConfigMap в Kubernetes монтирует файл как
+// символическую ссылку через ..data и обновляется атомарной заменой ..data:
+// событий для самого path нет, поэтому при любом событии в каталоге
+// сравнивается файл, на который указывает path.
+func Watch(ctx context.Context, path string, debounce time.Duration, onChange func()) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := w.Add(filepath.Dir(path)); err != nil {
+		w.Close()
+		return err
+	}
+	if debounce <= 0 {
+		debounce = DefaultWatchDebounce
+	}
+
+	target := resolve(path)
+
+	go func() {
+		defer w.Close()
+		timer := time.NewTimer(debounce)
+		timer.Stop()
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(ev.Name) == path {
+					if ev.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+						continue
+					}
+				} else if t := resolve(path); t != target {
+					target = t
+				} else {
+					continue
+				}
+				timer.Reset(debounce)
+			case _, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+			case <-timer.C:
+				onChange()
+			}
+		}
+	}()
+	return nil
+}
+
+// resolve возвращает путь файла после раскрытия символических ссылок
+// или пустую строку, если файла нет
+func resolve(path string) string {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return ""
+	}
+	return target
+}
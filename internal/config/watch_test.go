@@ -0,0 +1,100 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "agent.yaml")
+	if err := os.WriteFile(path, []byte("a: 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan struct{}, 10)
+	if err := Watch(ctx, path, 20*time.Millisecond, func() { changes <- struct{}{} }); err != nil {
+		t.Fatal(err)
+	}
+
+	// Изменения соседних файлов игнорируются
+	os.WriteFile(filepath.Join(dir, "other.yaml"), []byte("x"), 0o644)
+	select {
+	case <-changes:
+		t.Error("Unexpected change notification for another file")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Замена файла через rename, как при сохранении редактором
+	tmp := filepath.Join(dir, "agent.yaml.tmp")
+	os.WriteFile(tmp, []byte("a: 2\n"), 0o644)
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changes:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected change notification after rename")
+	}
+
+	// Несколько записей подряд дают одно уведомление
+	for i := 0; i < 3; i++ {
+		os.WriteFile(path, []byte("a: 3\n"), 0o644)
+	}
+	select {
+	case <-changes:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected change notification after write")
+	}
+	select {
+	case <-changes:
+		t.Error("Expected writes to be debounced into one notification")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWatchSymlinkSwap(t *testing.T) {
+	// Раскладка ConfigMap: agent.yaml -> ..data/agent.yaml, ..data -> ..v1
+	dir := t.TempDir()
+	for _, v := range []string{"..v1", "..v2"} {
+		if err := os.Mkdir(filepath.Join(dir, v), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, v, "agent.yaml"), []byte("v: "+v+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("..v1", filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "agent.yaml")
+	if err := os.Symlink(filepath.Join("..data", "agent.yaml"), path); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan struct{}, 10)
+	if err := Watch(ctx, path, 20*time.Millisecond, func() { changes <- struct{}{} }); err != nil {
+		t.Fatal(err)
+	}
+
+	// Атомарная замена ..data, как при обновлении ConfigMap
+	tmp := filepath.Join(dir, "..data_tmp")
+	if err := os.Symlink("..v2", tmp); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changes:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected change notification after symlink swap")
+	}
+}
@@ -0,0 +1,103 @@
+// Package cumulative преобразует накопительные (cumulative) значения счётчиков,
+// которые присылают Telegraf и OpenTelemetry, в приращения для хранилища сервера.
+package cumulative
+
+import (
+	"sync"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+)
+
+// Converter помнит последнее накопленное значение каждой серии.
+// Первое значение серии передаётся целиком: хранилище сервера находится в памяти,
+// поэтому итоговый counter совпадает с накопленным значением клиента.
+// Уменьшение значения считается сбросом счётчика на клиенте.
+type Converter struct {
+	mu    sync.Mutex
+	last  map[string]int64
+	hists map[string]*models.HistogramValue
+	sums  map[string]float64
+}
+
+func NewConverter() *Converter {
+	return &Converter{
+		last:  make(map[string]int64),
+		hists: make(map[string]*models.HistogramValue),
+		sums:  make(map[string]float64),
+	}
+}
+
+// Delta возвращает приращение для накопленного значения серии key
+func (c *Converter) Delta(key string, total int64) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	prev, ok := c.last[key]
+	c.last[key] = total
+	if !ok || total < prev {
+		return total
+	}
+	return total - prev
+}
+
+// Accumulate прибавляет приращение delta к сумме серии key и возвращает сумму.
+// Используется для дробных сумм, которые хранятся как gauge: сброс на клиенте
+// не уменьшает сумму, как и у счётчиков.
+func (c *Converter) Accumulate(key string, delta float64) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sums[key] += delta
+	return c.sums[key]
+}
+
+// HistogramDelta возвращает приращение накопленной гистограммы серии key.
+// Сбросом считается уменьшение числа наблюдений или любой корзины,
+// а также смена границ корзин — тогда гистограмма передаётся целиком.
+func (c *Converter) HistogramDelta(key string, total *models.HistogramValue) *models.HistogramValue {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	prev, ok := c.hists[key]
+	c.hists[key] = total.Clone()
+	if !ok || !histogramGrew(prev, total) {
+		return total.Clone()
+	}
+
+	d := total.Clone()
+	for i := range d.Counts {
+		d.Counts[i] -= prev.Counts[i]
+	}
+	d.Count -= prev.Count
+	d.Sum -= prev.Sum
+	return d
+}
+
+func histogramGrew(prev, cur *models.HistogramValue) bool {
+	if len(prev.Bounds) != len(cur.Bounds) || len(prev.Counts) != len(cur.Counts) || cur.Count < prev.Count {
+		return false
+	}
+	for i := range prev.Bounds {
+		if prev.Bounds[i] != cur.Bounds[i] {
+			return false
+		}
+	}
+	for i := range prev.Counts {
+		if cur.Counts[i] < prev.Counts[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ToDelta заменяет накопленное значение counter или histogram метрики приращением.
+// Метрики других типов возвращаются без изменений.
+func (c *Converter) ToDelta(m models.Metrics) models.Metrics {
+	switch {
+	case m.MType == models.Counter && m.Delta != nil:
+		d := c.Delta(m.Key(), *m.Delta)
+		m.Delta = &d
+	case m.MType == models.Histogram && m.Histogram != nil:
+		m.Histogram = c.HistogramDelta(m.Key(), m.Histogram)
+	}
+	return m
+}
@@ -0,0 +1,74 @@
+package cumulative
+
+import (
+	"testing"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+)
+
+func TestDelta(t *testing.T) {
+	c := NewConverter()
+
+	steps := []struct {
+		total, delta int64
+	}{
+		{100, 100}, // первое значение передаётся целиком
+		{150, 50},
+		{150, 0},
+		{20, 20}, // сброс счётчика на клиенте
+		{25, 5},
+	}
+	for i, s := range steps {
+		if got := c.Delta("requests", s.total); got != s.delta {
+			t.Errorf("Step %d: Delta(%d) = %d, want %d", i, s.total, got, s.delta)
+		}
+	}
+
+	if got := c.Delta("other", 7); got != 7 {
+		t.Errorf("Series must be tracked independently, got %d", got)
+	}
+}
+
+func TestHistogramDelta(t *testing.T) {
+	c := NewConverter()
+	bounds := []float64{1, 5}
+
+	first := &models.HistogramValue{Bounds: bounds, Counts: []uint64{1, 2, 0}, Sum: 6, Count: 3}
+	if d := c.HistogramDelta("latency", first); d.Count != 3 || d.Counts[1] != 2 {
+		t.Errorf("First histogram must be passed whole, got %+v", d)
+	}
+
+	second := &models.HistogramValue{Bounds: bounds, Counts: []uint64{2, 2, 1}, Sum: 16, Count: 5}
+	d := c.HistogramDelta("latency", second)
+	if d.Count != 2 || d.Sum != 10 || d.Counts[0] != 1 || d.Counts[1] != 0 || d.Counts[2] != 1 {
+		t.Errorf("Unexpected delta %+v", d)
+	}
+	if second.Count != 5 {
+		t.Error("Input histogram must not be modified")
+	}
+
+	// Сброс на клиенте: счётчик корзины уменьшился
+	reset := &models.HistogramValue{Bounds: bounds, Counts: []uint64{0, 1, 0}, Sum: 2, Count: 1}
+	if d := c.HistogramDelta("latency", reset); d.Count != 1 || d.Sum != 2 {
+		t.Errorf("Reset histogram must be passed whole, got %+v", d)
+	}
+}
+
+func TestAccumulate(t *testing.T) {
+	c := NewConverter()
+	steps := []struct {
+		delta, total float64
+	}{
+		{1.5, 1.5},
+		{0.25, 1.75},
+		{3, 4.75},
+	}
+	for i, s := range steps {
+		if got := c.Accumulate("latency_sum", s.delta); got != s.total {
+			t.Errorf("Step %d: Accumulate(%v) = %v, want %v", i, s.delta, got, s.total)
+		}
+	}
+	if got := c.Accumulate("other_sum", 2); got != 2 {
+		t.Errorf("Series must be tracked independently, got %v", got)
+	}
+}
@@ -0,0 +1,232 @@
+package graphite
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/logger"
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/telemetry"
+)
+
+const (
+	// maxLineLength — максимальная длина строки; более длинные строки обрывают соединение
+	maxLineLength = 64 * 1024
+
+	DefaultMaxConns    = 100
+	DefaultIdleTimeout = 2 * time.Minute
+)
+
+// Writer — путь записи метрик сервера
+type Writer interface {
+	WriteMetric(m models.Metrics) error
+}
+
+// Config — параметры TCP приёмника
+type Config struct {
+	Addr string
+	// MaxConns — максимальное число одновременных соединений, лишние закрываются сразу
+	MaxConns int
+	// IdleTimeout — соединение закрывается, если за это время не пришло ни одной строки
+	IdleTimeout time.Duration
+}
+
+// Listener принимает строки Graphite plaintext по TCP и записывает их как gauge
+type Listener struct {
+	cfg    Config
+	mapper *Mapper
+	writer Writer
+
+	mu    sync.Mutex
+	ln    net.Listener
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+	slots chan struct{}
+
+	registry    *telemetry.Registry
+	active      *telemetry.Gauge
+	accepted    *telemetry.Counter
+	rejected    *telemetry.Counter
+	lines       *telemetry.Counter
+	writeErrors *telemetry.Counter
+	log         zerolog.Logger
+}
+
+func NewListener(cfg Config, mapper *Mapper, writer Writer, registry *telemetry.Registry) *Listener {
+	if cfg.MaxConns <= 0 {
+		cfg.MaxConns = DefaultMaxConns
+	}
+	return &Listener{
+		cfg:         cfg,
+		mapper:      mapper,
+		writer:      writer,
+		conns:       make(map[net.Conn]struct{}),
+		slots:       make(chan struct{}, cfg.MaxConns),
+		registry:    registry,
+		active:      registry.Gauge("graphite_connections_active", nil),
+		accepted:    registry.Counter("graphite_connections_accepted_total", nil),
+		rejected:    registry.Counter("graphite_connections_rejected_total", nil),
+		lines:       registry.Counter("graphite_lines_total", nil),
+		writeErrors: registry.Counter("graphite_write_errors_total", nil),
+		log:         logger.GetLogger(),
+	}
+}
+
+// Listen открывает TCP сокет
+func (l *Listener) Listen() error {
+	ln, err := net.Listen("tcp", l.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	l.ln = ln
+	l.mu.Unlock()
+	return nil
+}
+
+// Addr возвращает фактический адрес сокета (после Listen)
+func (l *Listener) Addr() net.Addr {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ln == nil {
+		return nil
+	}
+	return l.ln.Addr()
+}
+
+// Serve принимает соединения до отмены контекста или вызова Close.
+// При остановке закрываются все активные соединения.
+func (l *Listener) Serve(ctx context.Context) error {
+	l.mu.Lock()
+	ln := l.ln
+	l.mu.Unlock()
+	if ln == nil {
+		return errors.New("graphite: listener is not bound")
+	}
+
+	stop := context.AfterFunc(ctx, func() { l.Close() })
+	defer stop()
+
+	var err error
+	for {
+		var conn net.Conn
+		conn, err = ln.Accept()
+		if err != nil {
+			break
+		}
+
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			l.rejected.Inc()
+			conn.Close()
+			continue
+		}
+
+		l.mu.Lock()
+		l.conns[conn] = struct{}{}
+		l.mu.Unlock()
+		l.accepted.Inc()
+		l.active.Set(float64(len(l.slots)))
+
+		l.wg.Add(1)
+		go l.handleConn(conn)
+	}
+
+	l.closeConns()
+	l.wg.Wait()
+
+	if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// ListenAndServe открывает сокет и обслуживает его до отмены контекста
+func (l *Listener) ListenAndServe(ctx context.Context) error {
+	if err := l.Listen(); err != nil {
+		return err
+	}
+	return l.Serve(ctx)
+}
+
+// Close прекращает приём новых соединений
+func (l *Listener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ln == nil {
+		return nil
+	}
+	return l.ln.Close()
+}
+
+func (l *Listener) closeConns() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for conn := range l.conns {
+		conn.Close()
+	}
+}
+
+func (l *Listener) handleConn(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		l.mu.Lock()
+		delete(l.conns, conn)
+		l.mu.Unlock()
+		<-l.slots
+		l.active.Set(float64(len(l.slots)))
+		l.wg.Done()
+	}()
+
+	sc := bufio.NewScanner(conn)
+	sc.Buffer(make([]byte, 4096), maxLineLength)
+	for {
+		if l.cfg.IdleTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(l.cfg.IdleTimeout))
+		}
+		if !sc.Scan() {
+			var ne net.Error
+			if err := sc.Err(); errors.As(err, &ne) && ne.Timeout() {
+				l.registry.Counter("graphite_connections_idle_closed_total", nil).Inc()
+			}
+			return
+		}
+		l.handleLine(sc.Text())
+	}
+}
+
+func (l *Listener) handleLine(text string) {
+	l.lines.Inc()
+
+	line, err := ParseLine(text)
+	if err != nil {
+		l.registry.Counter("graphite_parse_errors_total", models.Labels{"reason": reasonOf(err)}).Inc()
+		return
+	}
+
+	name, labels := l.mapper.Map(line.Path)
+	value := line.Value
+	m := models.Metrics{ID: name, MType: models.Gauge, Value: &value, Labels: labels}
+	if err := l.writer.WriteMetric(m); err != nil {
+		l.writeErrors.Inc()
+		// Текст записи постоянный, чтобы повторяющиеся ошибки прореживались
+		l.log.Info().Err(err).Str("metric", m.Key()).Msg("graphite: failed to write metric")
+	}
+}
+
+func reasonOf(err error) string {
+	switch {
+	case errors.Is(err, ErrValue):
+		return "invalid_value"
+	case errors.Is(err, ErrTime):
+		return "invalid_timestamp"
+	}
+	return "invalid_format"
+}
@@ -0,0 +1,129 @@
+package graphite
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/telemetry"
+)
+
+type memWriter struct {
+	mu      sync.Mutex
+	metrics map[string]float64
+}
+
+func (w *memWriter) WriteMetric(m models.Metrics) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.metrics[m.Key()] = *m.Value
+	return nil
+}
+
+func (w *memWriter) get(key string) (float64, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	v, ok := w.metrics[key]
+	return v, ok
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func startListener(t *testing.T, cfg Config) (*Listener, *memWriter, *telemetry.Registry, context.CancelFunc) {
+	t.Helper()
+	mapper, err := NewMapper([]string{"servers.* .host.measurement*"}, "_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := &memWriter{metrics: make(map[string]float64)}
+	registry := telemetry.NewRegistry()
+	cfg.Addr = "127.0.0.1:0"
+	l := NewListener(cfg, mapper, writer, registry)
+	if err := l.Listen(); err != nil {
+		t.Fatalf("Listen() failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		l.Serve(ctx)
+		close(done)
+	}()
+	return l, writer, registry, func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestListenerWrites(t *testing.T) {
+	l, writer, registry, stop := startListener(t, Config{})
+	defer stop()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "servers.web1.cpu.load 0.5 1700000000\nbroken\nservers.web2.mem 42 -1\n")
+
+	key1 := models.SeriesKey("cpu_load", models.Labels{"host": "web1"})
+	key2 := models.SeriesKey("mem", models.Labels{"host": "web2"})
+	waitFor(t, func() bool {
+		_, ok1 := writer.get(key1)
+		_, ok2 := writer.get(key2)
+		return ok1 && ok2
+	})
+
+	if v, _ := writer.get(key1); v != 0.5 {
+		t.Errorf("Expected %s = 0.5, got %v", key1, v)
+	}
+	if v := registry.Counter("graphite_parse_errors_total", models.Labels{"reason": "invalid_format"}).Value(); v != 1 {
+		t.Errorf("Expected 1 parse error, got %d", v)
+	}
+}
+
+func TestListenerConnLimitAndIdleTimeout(t *testing.T) {
+	l, _, registry, stop := startListener(t, Config{MaxConns: 1, IdleTimeout: 100 * time.Millisecond})
+	defer stop()
+
+	first, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	waitFor(t, func() bool { return registry.Counter("graphite_connections_accepted_total", nil).Value() == 1 })
+
+	// Второе соединение сверх лимита закрывается сервером
+	second, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	second.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := second.Read(make([]byte, 1)); err == nil {
+		t.Error("Expected connection over the limit to be closed")
+	}
+	if v := registry.Counter("graphite_connections_rejected_total", nil).Value(); v != 1 {
+		t.Errorf("Expected 1 rejected connection, got %d", v)
+	}
+
+	// Простаивающее соединение закрывается по таймауту
+	first.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := first.Read(make([]byte, 1)); err == nil {
+		t.Error("Expected idle connection to be closed")
+	}
+	waitFor(t, func() bool { return registry.Counter("graphite_connections_idle_closed_total", nil).Value() == 1 })
+}
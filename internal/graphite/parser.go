@@ -0,0 +1,46 @@
+package graphite
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrFormat = errors.New("expected 'path value [timestamp]'")
+	ErrValue  = errors.New("invalid value")
+	ErrTime   = errors.New("invalid timestamp")
+)
+
+// Line — разобранная строка Graphite plaintext
+type Line struct {
+	Path  string
+	Value float64
+	// Time — нулевое значение, если метка времени не передана или равна -1
+	Time time.Time
+}
+
+// ParseLine разбирает строку `path.to.metric value [timestamp]`
+func ParseLine(s string) (Line, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 2 || len(fields) > 3 {
+		return Line{}, ErrFormat
+	}
+
+	v, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || math.IsNaN(v) {
+		return Line{}, ErrValue
+	}
+	l := Line{Path: fields[0], Value: v}
+
+	if len(fields) == 3 && fields[2] != "-1" {
+		ts, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return Line{}, ErrTime
+		}
+		l.Time = time.Unix(int64(ts), 0)
+	}
+	return l, nil
+}
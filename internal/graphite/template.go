@@ -0,0 +1,159 @@
+// Package graphite принимает метрики в формате Graphite plaintext
+// (`path.to.metric value timestamp`) по TCP.
+package graphite
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+)
+
+// DefaultSeparator — разделитель частей имени метрики по умолчанию
+const DefaultSeparator = "_"
+
+// Template описывает преобразование пути в имя метрики и метки.
+// Формат: "[фильтр] шаблон [метки]", например
+//
+//	servers.* .host.measurement* env=prod
+//
+// Части шаблона: "measurement" — часть имени, "measurement*" — все оставшиеся части имени,
+// пустая часть — пропустить сегмент, любое другое слово — имя метки.
+type Template struct {
+	filter    []string
+	parts     []string
+	tags      models.Labels
+	separator string
+}
+
+// ParseTemplate разбирает строку шаблона
+func ParseTemplate(s, separator string) (*Template, error) {
+	fields := strings.Fields(s)
+	t := &Template{separator: separator}
+
+	switch len(fields) {
+	case 1:
+		t.parts = strings.Split(fields[0], ".")
+	case 2:
+		// Второе поле — либо шаблон (первое тогда фильтр), либо метки
+		if strings.Contains(fields[1], "=") {
+			t.parts = strings.Split(fields[0], ".")
+			tags, err := models.ParseLabels(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("template %q: %w", s, err)
+			}
+			t.tags = tags
+		} else {
+			t.filter = strings.Split(fields[0], ".")
+			t.parts = strings.Split(fields[1], ".")
+		}
+	case 3:
+		t.filter = strings.Split(fields[0], ".")
+		t.parts = strings.Split(fields[1], ".")
+		tags, err := models.ParseLabels(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("template %q: %w", s, err)
+		}
+		t.tags = tags
+	default:
+		return nil, fmt.Errorf("invalid template %q", s)
+	}
+
+	hasMeasurement := false
+	for i, p := range t.parts {
+		switch {
+		case p == "measurement":
+			hasMeasurement = true
+		case p == "measurement*":
+			if i != len(t.parts)-1 {
+				return nil, fmt.Errorf("template %q: measurement* must be the last part", s)
+			}
+			hasMeasurement = true
+		case p != "" && models.SanitizeLabelName(p) != p:
+			return nil, fmt.Errorf("template %q: invalid tag name %q", s, p)
+		}
+	}
+	if !hasMeasurement {
+		return nil, fmt.Errorf("template %q: no measurement part", s)
+	}
+	for _, f := range t.filter {
+		if _, err := path.Match(f, ""); err != nil {
+			return nil, fmt.Errorf("template %q: invalid filter: %w", s, err)
+		}
+	}
+	return t, nil
+}
+
+// Matches проверяет, подходит ли путь под фильтр шаблона
+func (t *Template) Matches(segments []string) bool {
+	if len(t.filter) > len(segments) {
+		return false
+	}
+	for i, f := range t.filter {
+		if ok, _ := path.Match(f, segments[i]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply возвращает имя метрики и метки для пути
+func (t *Template) Apply(segments []string) (string, models.Labels) {
+	var nameParts []string
+	labels := t.tags.Clone()
+
+	for i, p := range t.parts {
+		if i >= len(segments) {
+			break
+		}
+		switch p {
+		case "":
+		case "measurement":
+			nameParts = append(nameParts, segments[i])
+		case "measurement*":
+			nameParts = append(nameParts, segments[i:]...)
+		default:
+			if labels == nil {
+				labels = make(models.Labels)
+			}
+			labels[p] = segments[i]
+		}
+	}
+	return strings.Join(nameParts, t.separator), labels
+}
+
+// Mapper выбирает первый подходящий шаблон. Если ни один не подошёл,
+// имя метрики — путь с заменой точек на разделитель.
+type Mapper struct {
+	templates []*Template
+	separator string
+}
+
+func NewMapper(templates []string, separator string) (*Mapper, error) {
+	if separator == "" {
+		separator = DefaultSeparator
+	}
+	m := &Mapper{separator: separator}
+	for _, s := range templates {
+		t, err := ParseTemplate(s, separator)
+		if err != nil {
+			return nil, err
+		}
+		m.templates = append(m.templates, t)
+	}
+	return m, nil
+}
+
+// Map преобразует путь Graphite в имя метрики и метки
+func (m *Mapper) Map(graphitePath string) (string, models.Labels) {
+	segments := strings.Split(graphitePath, ".")
+	for _, t := range m.templates {
+		if t.Matches(segments) {
+			if name, labels := t.Apply(segments); name != "" {
+				return name, labels
+			}
+		}
+	}
+	return strings.Join(segments, m.separator), nil
+}
@@ -0,0 +1,76 @@
+package graphite
+
+import "testing"
+
+func TestMapper(t *testing.T) {
+	mapper, err := NewMapper([]string{
+		"servers.* .host.measurement* env=prod",
+		"stats.*.* .service.measurement",
+		"measurement.measurement.region",
+	}, "_")
+	if err != nil {
+		t.Fatalf("NewMapper() failed: %v", err)
+	}
+
+	tests := []struct {
+		path   string
+		name   string
+		labels map[string]string
+	}{
+		{"servers.web1.cpu.load", "cpu_load", map[string]string{"host": "web1", "env": "prod"}},
+		{"stats.billing.latency.p99", "latency", map[string]string{"service": "billing"}},
+		{"disk.used.eu", "disk_used", map[string]string{"region": "eu"}},
+	}
+	for _, tt := range tests {
+		name, labels := mapper.Map(tt.path)
+		if name != tt.name {
+			t.Errorf("Map(%q): expected name %q, got %q", tt.path, tt.name, name)
+		}
+		if len(labels) != len(tt.labels) {
+			t.Errorf("Map(%q): expected labels %v, got %v", tt.path, tt.labels, labels)
+		}
+		for k, v := range tt.labels {
+			if labels[k] != v {
+				t.Errorf("Map(%q): expected %s=%s, got %v", tt.path, k, v, labels)
+			}
+		}
+	}
+}
+
+func TestMapperDefault(t *testing.T) {
+	mapper, _ := NewMapper(nil, "")
+	name, labels := mapper.Map("app.requests.count")
+	if name != "app_requests_count" || labels != nil {
+		t.Errorf("Expected default mapping to app_requests_count, got %q %v", name, labels)
+	}
+}
+
+func TestParseTemplateErrors(t *testing.T) {
+	for _, s := range []string{
+		"host.region",               // нет measurement
+		"measurement*.host",         // measurement* не последний
+		"a.* measurement bad-tag=1", // неверное имя метки
+		"a b c d",                   // слишком много полей
+		"host.measurement.bad-name", // неверное имя метки в шаблоне
+	} {
+		if _, err := ParseTemplate(s, "_"); err == nil {
+			t.Errorf("ParseTemplate(%q): expected error", s)
+		}
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	l, err := ParseLine("servers.web1.cpu 0.75 1700000000")
+	if err != nil {
+		t.Fatalf("ParseLine() failed: %v", err)
+	}
+	if l.Path != "servers.web1.cpu" || l.Value != 0.75 || l.Time.Unix() != 1700000000 {
+		t.Errorf("Unexpected line: %+v", l)
+	}
+
+	for _, s := range []string{"only.path", "a.b notanumber 1", "a.b 1 notatime", "a b c d"} {
+		if _, err := ParseLine(s); err == nil {
+			t.Errorf("ParseLine(%q): expected error", s)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Package health — реестр проверок состояния подсистем и HTTP эндпоинты
+// /livez, /readyz и /healthz.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout — таймаут одной проверки
+const DefaultTimeout = 2 * time.Second
+
+// Kind — вид проверки
+type Kind int
+
+const (
+	// Liveness — процесс работает; провал означает, что его нужно перезапустить
+	Liveness Kind = 1 << iota
+	// Readiness — процесс готов принимать трафик
+	Readiness
+)
+
+// Check проверяет подсистему; nil — подсистема в порядке
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	kind  Kind
+	check Check
+}
+
+// Registry — проверки подсистем. Подсистема регистрирует проверку при запуске.
+type Registry struct {
+	timeout time.Duration
+
+	mu     sync.RWMutex
+	checks []namedCheck
+}
+
+// NewRegistry создаёт пустой реестр проверок
+func NewRegistry() *Registry {
+	return &Registry{timeout: DefaultTimeout}
+}
+
+// Add регистрирует проверку name вида kind (Liveness, Readiness или оба)
+func (r *Registry) Add(name string, kind Kind, check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks = append(r.checks, namedCheck{name: name, kind: kind, check: check})
+}
+
+// Result — результат одной проверки
+type Result struct {
+	Name       string  `json:"name"`
+	OK         bool    `json:"ok"`
+	Error      string  `json:"error,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+// Report — результат всех проверок вида
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// OK сообщает, прошли ли все проверки
+func (rep Report) OK() bool {
+	return rep.Status == "ok"
+}
+
+// Run выполняет проверки, вид которых пересекается с kind
+func (r *Registry) Run(ctx context.Context, kind Kind) Report {
+	r.mu.RLock()
+	checks := make([]namedCheck, 0, len(r.checks))
+	for _, c := range r.checks {
+		if c.kind&kind != 0 {
+			checks = append(checks, c)
+		}
+	}
+	r.mu.RUnlock()
+
+	rep := Report{Status: "ok", Checks: make([]Result, len(checks))}
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cctx, cancel := context.WithTimeout(ctx, r.timeout)
+			defer cancel()
+			start := time.Now()
+			err := c.check(cctx)
+			res := Result{Name: c.name, OK: err == nil, DurationMs: float64(time.Since(start).Microseconds()) / 1000}
+			if err != nil {
+				res.Error = err.Error()
+			}
+			rep.Checks[i] = res
+		}()
+	}
+	wg.Wait()
+	for _, res := range rep.Checks {
+		if !res.OK {
+			rep.Status = "fail"
+		}
+	}
+	return rep
+}
+
+// Handler отвечает 200 или 503 по результатам проверок вида kind. Без параметра
+// verbose тело — "ok" или "fail", с ?verbose — JSON с результатом каждой проверки.
+func (r *Registry) Handler(kind Kind) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rep := r.Run(req.Context(), kind)
+		status := http.StatusOK
+		if !rep.OK() {
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		if _, verbose := req.URL.Query()["verbose"]; verbose {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(rep)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		w.Write([]byte(rep.Status + "\n"))
+	})
+}
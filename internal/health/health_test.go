@@ -0,0 +1,59 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.timeout = 20 * time.Millisecond
+	ready, hang := false, true
+	r.Add("process", Liveness, func(ctx context.Context) error { return nil })
+	r.Add("startup", Readiness, func(ctx context.Context) error {
+		if !ready {
+			return errors.New("starting")
+		}
+		return nil
+	})
+	r.Add("storage", Liveness|Readiness, func(ctx context.Context) error {
+		if hang {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	})
+
+	get := func(kind Kind, query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.Handler(kind).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+query, nil))
+		return w
+	}
+
+	if w := get(Liveness, ""); w.Code != http.StatusServiceUnavailable || strings.TrimSpace(w.Body.String()) != "fail" {
+		t.Errorf("Expected hanging check to time out, got %d %q", w.Code, w.Body)
+	}
+
+	w := get(Readiness, "?verbose")
+	var rep Report
+	if err := json.Unmarshal(w.Body.Bytes(), &rep); err != nil {
+		t.Fatalf("Invalid verbose response %q: %v", w.Body, err)
+	}
+	if w.Code != http.StatusServiceUnavailable || len(rep.Checks) != 2 {
+		t.Fatalf("Expected 2 failing readiness checks, got %d %+v", w.Code, rep)
+	}
+	if rep.Checks[0].Name != "startup" || rep.Checks[0].Error != "starting" {
+		t.Errorf("Unexpected startup check result %+v", rep.Checks[0])
+	}
+
+	ready, hang = true, false
+	if w := get(Readiness|Liveness, ""); w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "ok" {
+		t.Errorf("Expected all checks to pass, got %d %q", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,63 @@
+package influx
+
+import (
+	"math"
+	"strings"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+)
+
+// Options — правила преобразования точек в метрики
+type Options struct {
+	// CounterSuffixes — суффиксы имён метрик, для которых поля считаются
+	// накопительными счётчиками (counter); остальные поля — gauge
+	CounterSuffixes []string
+}
+
+// MetricName возвращает имя метрики для поля: measurement_field,
+// для поля "value" — просто measurement (как в выводе Telegraf в Prometheus)
+func MetricName(measurement, field string) string {
+	if field == "value" {
+		return measurement
+	}
+	return measurement + "_" + field
+}
+
+// ToMetrics преобразует точку в метрики. Теги становятся метками, строковые поля пропускаются.
+// Значения counter метрик — накопленные, их нужно перевести в приращения (см. пакет cumulative).
+func ToMetrics(p Point, opts Options) []models.Metrics {
+	var labels models.Labels
+	if len(p.Tags) > 0 {
+		labels = make(models.Labels, len(p.Tags))
+		for k, v := range p.Tags {
+			labels[models.SanitizeLabelName(k)] = v
+		}
+	}
+
+	res := make([]models.Metrics, 0, len(p.Fields))
+	for field, fv := range p.Fields {
+		v, ok := fv.Number()
+		if !ok {
+			continue
+		}
+		name := MetricName(p.Measurement, field)
+		m := models.Metrics{ID: name, Labels: labels}
+		if opts.isCounter(name) {
+			d := int64(math.Round(v))
+			m.MType, m.Delta = models.Counter, &d
+		} else {
+			m.MType, m.Value = models.Gauge, &v
+		}
+		res = append(res, m)
+	}
+	return res
+}
+
+func (o Options) isCounter(name string) bool {
+	for _, suffix := range o.CounterSuffixes {
+		if suffix != "" && strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,283 @@
+// Package influx разбирает InfluxDB line protocol и преобразует точки в метрики сервера.
+package influx
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldKind — тип значения поля
+type FieldKind int
+
+const (
+	KindFloat FieldKind = iota
+	KindInt
+	KindUint
+	KindBool
+	KindString
+)
+
+// FieldValue — значение поля точки
+type FieldValue struct {
+	Kind  FieldKind
+	Float float64
+	Int   int64
+	Uint  uint64
+	Bool  bool
+	Str   string
+}
+
+// Number возвращает числовое значение поля; для строк — false
+func (v FieldValue) Number() (float64, bool) {
+	switch v.Kind {
+	case KindFloat:
+		return v.Float, true
+	case KindInt:
+		return float64(v.Int), true
+	case KindUint:
+		return float64(v.Uint), true
+	case KindBool:
+		if v.Bool {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// Point — одна строка line protocol
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]FieldValue
+	// Time — метка времени; нулевое значение, если в строке её нет
+	Time time.Time
+}
+
+// LineError — ошибка разбора с номером строки (нумерация с 1)
+type LineError struct {
+	Line int
+	Text string
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("unable to parse line %d '%s': %v", e.Line, e.Text, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// Precision — единица измерения меток времени
+type Precision time.Duration
+
+const (
+	Nanosecond  = Precision(time.Nanosecond)
+	Microsecond = Precision(time.Microsecond)
+	Millisecond = Precision(time.Millisecond)
+	Second      = Precision(time.Second)
+)
+
+// ParsePrecision разбирает параметр precision ("ns", "u", "ms", "s"); пустая строка — наносекунды
+func ParsePrecision(s string) (Precision, error) {
+	switch s {
+	case "", "n", "ns":
+		return Nanosecond, nil
+	case "u", "us", "µ":
+		return Microsecond, nil
+	case "ms":
+		return Millisecond, nil
+	case "s":
+		return Second, nil
+	}
+	return 0, fmt.Errorf("invalid precision %q", s)
+}
+
+var (
+	errMissingFields = errors.New("missing fields")
+	errMissingTagVal = errors.New("missing tag value")
+	errMissingMeas   = errors.New("missing measurement")
+	errInvalidField  = errors.New("invalid field format")
+	errInvalidTime   = errors.New("invalid timestamp")
+	errUnterminated  = errors.New("unterminated string field")
+)
+
+// Parse разбирает тело запроса. Корректные строки возвращаются даже при наличии
+// ошибочных — как при частичной записи в InfluxDB.
+func Parse(body []byte, precision Precision) ([]Point, []*LineError) {
+	var (
+		points []Point
+		errs   []*LineError
+	)
+	sc := bufio.NewScanner(bytes.NewReader(body))
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p, err := ParseLine(line, precision)
+		if err != nil {
+			errs = append(errs, &LineError{Line: lineNo, Text: line, Err: err})
+			continue
+		}
+		points = append(points, p)
+	}
+	if err := sc.Err(); err != nil {
+		errs = append(errs, &LineError{Line: lineNo + 1, Err: err})
+	}
+	return points, errs
+}
+
+// ParseLine разбирает одну строку:
+// measurement[,tag=value...] field=value[,field2=value2...] [timestamp]
+func ParseLine(line string, precision Precision) (Point, error) {
+	p := Point{Tags: make(map[string]string), Fields: make(map[string]FieldValue)}
+
+	keyEnd := indexUnescaped(line, 0, ' ', false)
+	if keyEnd < 0 {
+		return p, errMissingFields
+	}
+	seriesPart := line[:keyEnd]
+
+	rest := strings.TrimLeft(line[keyEnd:], " ")
+	fieldsEnd := indexUnescaped(rest, 0, ' ', true)
+	fieldsPart, tsPart := rest, ""
+	if fieldsEnd >= 0 {
+		fieldsPart, tsPart = rest[:fieldsEnd], strings.TrimSpace(rest[fieldsEnd:])
+	}
+	if fieldsPart == "" {
+		return p, errMissingFields
+	}
+
+	// measurement и теги
+	parts := splitUnescaped(seriesPart, ',', false)
+	p.Measurement = unescape(parts[0])
+	if p.Measurement == "" {
+		return p, errMissingMeas
+	}
+	for _, kv := range parts[1:] {
+		eq := indexUnescaped(kv, 0, '=', false)
+		if eq <= 0 || eq == len(kv)-1 {
+			return p, errMissingTagVal
+		}
+		p.Tags[unescape(kv[:eq])] = unescape(kv[eq+1:])
+	}
+
+	// поля
+	for _, kv := range splitUnescaped(fieldsPart, ',', true) {
+		eq := indexUnescaped(kv, 0, '=', false)
+		if eq <= 0 || eq == len(kv)-1 {
+			return p, errInvalidField
+		}
+		v, err := parseFieldValue(kv[eq+1:])
+		if err != nil {
+			return p, err
+		}
+		p.Fields[unescape(kv[:eq])] = v
+	}
+
+	if tsPart != "" {
+		ts, err := strconv.ParseInt(tsPart, 10, 64)
+		if err != nil {
+			return p, errInvalidTime
+		}
+		p.Time = time.Unix(0, ts*int64(precision))
+	}
+	return p, nil
+}
+
+func parseFieldValue(raw string) (FieldValue, error) {
+	if strings.HasPrefix(raw, `"`) {
+		if len(raw) < 2 || raw[len(raw)-1] != '"' || escapedAt(raw, len(raw)-1) {
+			return FieldValue{}, errUnterminated
+		}
+		s := raw[1 : len(raw)-1]
+		s = strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(s)
+		return FieldValue{Kind: KindString, Str: s}, nil
+	}
+
+	switch raw {
+	case "t", "T", "true", "True", "TRUE":
+		return FieldValue{Kind: KindBool, Bool: true}, nil
+	case "f", "F", "false", "False", "FALSE":
+		return FieldValue{Kind: KindBool, Bool: false}, nil
+	}
+
+	switch raw[len(raw)-1] {
+	case 'i':
+		v, err := strconv.ParseInt(raw[:len(raw)-1], 10, 64)
+		if err != nil {
+			return FieldValue{}, fmt.Errorf("%w: invalid integer %q", errInvalidField, raw)
+		}
+		return FieldValue{Kind: KindInt, Int: v}, nil
+	case 'u':
+		v, err := strconv.ParseUint(raw[:len(raw)-1], 10, 64)
+		if err != nil {
+			return FieldValue{}, fmt.Errorf("%w: invalid unsigned integer %q", errInvalidField, raw)
+		}
+		return FieldValue{Kind: KindUint, Uint: v}, nil
+	}
+
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return FieldValue{}, fmt.Errorf("%w: invalid number %q", errInvalidField, raw)
+	}
+	return FieldValue{Kind: KindFloat, Float: v}, nil
+}
+
+// indexUnescaped ищет символ c, не экранированный обратным слэшем.
+// При quoted=true символы внутри двойных кавычек пропускаются.
+func indexUnescaped(s string, from int, c byte, quoted bool) int {
+	inQuotes := false
+	for i := from; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case quoted && s[i] == '"':
+			inQuotes = !inQuotes
+		case s[i] == c && !inQuotes:
+			return i
+		}
+	}
+	return -1
+}
+
+// escapedAt сообщает, экранирован ли символ s[i] нечётным числом обратных слэшей
+func escapedAt(s string, i int) bool {
+	n := 0
+	for j := i - 1; j >= 0 && s[j] == '\\'; j-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+func splitUnescaped(s string, sep byte, quoted bool) []string {
+	var parts []string
+	for {
+		i := indexUnescaped(s, 0, sep, quoted)
+		if i < 0 {
+			return append(parts, s)
+		}
+		parts = append(parts, s[:i])
+		s = s[i+1:]
+	}
+}
+
+var unescaper = strings.NewReplacer(`\,`, ",", `\ `, " ", `\=`, "=", `\"`, `"`)
+
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	return unescaper.Replace(s)
+}
@@ -0,0 +1,94 @@
+package influx
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseLine(t *testing.T) {
+	p, err := ParseLine(`cpu\ load,host=web\,1,region=us\ east usage=0.64,cores=4i,ok=t,note="a \"b\", c" 1700000000`, Second)
+	if err != nil {
+		t.Fatalf("ParseLine() failed: %v", err)
+	}
+
+	if p.Measurement != "cpu load" {
+		t.Errorf("Expected measurement 'cpu load', got %q", p.Measurement)
+	}
+	if p.Tags["host"] != "web,1" || p.Tags["region"] != "us east" {
+		t.Errorf("Unexpected tags: %v", p.Tags)
+	}
+	if f := p.Fields["usage"]; f.Kind != KindFloat || f.Float != 0.64 {
+		t.Errorf("Unexpected usage field: %+v", f)
+	}
+	if f := p.Fields["cores"]; f.Kind != KindInt || f.Int != 4 {
+		t.Errorf("Unexpected cores field: %+v", f)
+	}
+	if f := p.Fields["ok"]; f.Kind != KindBool || !f.Bool {
+		t.Errorf("Unexpected ok field: %+v", f)
+	}
+	if f := p.Fields["note"]; f.Kind != KindString || f.Str != `a "b", c` {
+		t.Errorf("Unexpected note field: %+v", f)
+	}
+	if !p.Time.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("Unexpected time: %v", p.Time)
+	}
+}
+
+func TestParseReportsLineNumbers(t *testing.T) {
+	body := []byte("mem used=1\n\n# comment\nmem used=\nmem,host used=2\nmem used=3u 123\ndisk free=1 notatime\n")
+	points, errs := Parse(body, Nanosecond)
+
+	if len(points) != 2 {
+		t.Errorf("Expected 2 valid points, got %d", len(points))
+	}
+	if len(errs) != 3 {
+		t.Fatalf("Expected 3 errors, got %d: %v", len(errs), errs)
+	}
+
+	expected := []struct {
+		line int
+		err  error
+	}{
+		{4, errInvalidField},
+		{5, errMissingTagVal},
+		{7, errInvalidTime},
+	}
+	for i, e := range expected {
+		if errs[i].Line != e.line {
+			t.Errorf("Error %d: expected line %d, got %d", i, e.line, errs[i].Line)
+		}
+		if !errors.Is(errs[i], e.err) {
+			t.Errorf("Error %d: expected %v, got %v", i, e.err, errs[i].Err)
+		}
+	}
+}
+
+func TestToMetrics(t *testing.T) {
+	p, err := ParseLine(`net,host=a,interface-name=eth0 bytes_total=1024i,rate=1.5,value=3,label="x"`, Nanosecond)
+	if err != nil {
+		t.Fatalf("ParseLine() failed: %v", err)
+	}
+
+	metrics := ToMetrics(p, Options{CounterSuffixes: []string{"_total"}})
+	if len(metrics) != 3 {
+		t.Fatalf("Expected 3 metrics (string field skipped), got %d", len(metrics))
+	}
+
+	byName := make(map[string]string)
+	for _, m := range metrics {
+		byName[m.ID] = m.MType
+		if m.Labels["interface_name"] != "eth0" || m.Labels["host"] != "a" {
+			t.Errorf("Expected sanitized tags as labels, got %v", m.Labels)
+		}
+	}
+	if byName["net_bytes_total"] != "counter" {
+		t.Errorf("Expected net_bytes_total to be counter, got %q", byName["net_bytes_total"])
+	}
+	if byName["net_rate"] != "gauge" {
+		t.Errorf("Expected net_rate to be gauge, got %q", byName["net_rate"])
+	}
+	if byName["net"] != "gauge" {
+		t.Errorf("Expected field 'value' to map to measurement name, got %v", byName)
+	}
+}
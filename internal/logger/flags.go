@@ -0,0 +1,66 @@
+package logger
+
+import (
+	"flag"
+	"os"
+	"strings"
+	"time"
+)
+
+// Flags — флаги командной строки журнала. Apply применяет заданные флаги поверх
+// YAML, только если соответствующая переменная окружения не задана (приоритет env выше).
+type Flags struct {
+	Level        string
+	Format       string
+	Output       string
+	File         string
+	MaxSizeMB    int
+	MaxBackups   int
+	MaxAgeDays   int
+	SampleBurst  int
+	SamplePeriod time.Duration
+}
+
+// Register регистрирует флаги -log-* в fs
+func (f *Flags) Register(fs *flag.FlagSet) {
+	fs.StringVar(&f.Level, "log-level", "", "Log level: trace, debug, info, warn or error (default info)")
+	fs.StringVar(&f.Format, "log-format", "", "Log format: json or console (default json)")
+	fs.StringVar(&f.Output, "log-output", "", "Comma-separated log sinks: stdout, stderr, file")
+	fs.StringVar(&f.File, "log-file", "", "Rotated log file for the file sink")
+	fs.IntVar(&f.MaxSizeMB, "log-max-size", 0, "Rotate the log file after this many megabytes")
+	fs.IntVar(&f.MaxBackups, "log-max-backups", 0, "Number of rotated log files to keep")
+	fs.IntVar(&f.MaxAgeDays, "log-max-age", 0, "Days to keep rotated log files")
+	fs.IntVar(&f.SampleBurst, "log-sample-burst", 0, "Log at most this many identical messages per sample period (0 = no sampling)")
+	fs.DurationVar(&f.SamplePeriod, "log-sample-period", 0, "Log sampling period (default 1s)")
+}
+
+// Apply переносит заданные флаги в cfg
+func (f *Flags) Apply(cfg *Config) {
+	if os.Getenv("LOG_LEVEL") == "" && f.Level != "" {
+		cfg.Level = f.Level
+	}
+	if os.Getenv("LOG_FORMAT") == "" && f.Format != "" {
+		cfg.Format = f.Format
+	}
+	if os.Getenv("LOG_OUTPUT") == "" && f.Output != "" {
+		cfg.Sinks = strings.Split(f.Output, ",")
+	}
+	if os.Getenv("LOG_FILE") == "" && f.File != "" {
+		cfg.File.Path = f.File
+	}
+	if os.Getenv("LOG_MAX_SIZE_MB") == "" && f.MaxSizeMB > 0 {
+		cfg.File.MaxSizeMB = f.MaxSizeMB
+	}
+	if os.Getenv("LOG_MAX_BACKUPS") == "" && f.MaxBackups > 0 {
+		cfg.File.MaxBackups = f.MaxBackups
+	}
+	if os.Getenv("LOG_MAX_AGE_DAYS") == "" && f.MaxAgeDays > 0 {
+		cfg.File.MaxAgeDays = f.MaxAgeDays
+	}
+	if os.Getenv("LOG_SAMPLE_BURST") == "" && f.SampleBurst > 0 {
+		cfg.Sampling.Burst = f.SampleBurst
+	}
+	if os.Getenv("LOG_SAMPLE_PERIOD") == "" && f.SamplePeriod > 0 {
+		cfg.Sampling.Period = f.SamplePeriod
+	}
+}
@@ -1,45 +1,199 @@
 package logger
 
 import (
+	"context"
+	"fmt"
 	"io"
+	stdlog "log"
 	"os"
 	"path/filepath"
-	"sync"
+	"strings"
+	"time"
 
 	"github.com/natefinch/lumberjack"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
-var once sync.Once
+// Форматы журнала
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
+)
 
-// Init инициализирует глобальный zerolog с выводом в ротационный файл logs/app.log
-func Init() {
-	once.Do(func() {
-		// Создаем папку logs при необходимости
-		err := os.MkdirAll("logs", 0o755)
-		if err != nil {
-			_, _ = os.Stderr.WriteString("Failed to create logs directory: " + err.Error() + "\n")
-		}
+// Направления вывода журнала (Config.Sinks)
+const (
+	SinkStdout = "stdout"
+	SinkStderr = "stderr"
+	SinkFile   = "file" // ротационный файл Config.File
+)
+
+// Config — настройки журнала. Заполняется из YAML (секция logging), флагов (Flags)
+// и переменных окружения (env теги, caarlos0/env).
+type Config struct {
+	Level    string         `yaml:"level" env:"LOG_LEVEL"`   // trace, debug, info, warn, error
+	Format   string         `yaml:"format" env:"LOG_FORMAT"` // json или console
+	Sinks    []string       `yaml:"sinks" env:"LOG_OUTPUT" envSeparator:","`
+	File     FileConfig     `yaml:"file"`
+	Sampling SamplingConfig `yaml:"sampling"`
+}
+
+// FileConfig — файл журнала и его ротация
+type FileConfig struct {
+	Path       string `yaml:"path" env:"LOG_FILE"`
+	MaxSizeMB  int    `yaml:"max_size_mb" env:"LOG_MAX_SIZE_MB"`   // размер, после которого файл ротируется
+	MaxBackups int    `yaml:"max_backups" env:"LOG_MAX_BACKUPS"`   // число хранимых старых файлов, 0 — все
+	MaxAgeDays int    `yaml:"max_age_days" env:"LOG_MAX_AGE_DAYS"` // возраст старых файлов в днях, 0 — без ограничения
+	Compress   bool   `yaml:"compress" env:"LOG_COMPRESS"`
+}
 
-		logFile := &lumberjack.Logger{
-			Filename:   filepath.Join("logs", "app.log"),
-			MaxSize:    100, // Мегабайты
-			MaxBackups: 7,   // Количество резервных файлов
-			MaxAge:     30,  // Максимальный возраст в днях
+// SamplingConfig — прореживание повторяющихся сообщений: за Period пишутся первые
+// Burst записей с одним текстом, остальные отбрасываются. Сообщения уровня выше Level
+// (по умолчанию — предупреждения и ошибки) пишутся всегда. Burst 0 — без прореживания.
+type SamplingConfig struct {
+	Burst  int           `yaml:"burst" env:"LOG_SAMPLE_BURST"`
+	Period time.Duration `yaml:"period" env:"LOG_SAMPLE_PERIOD"`
+	Level  string        `yaml:"level" env:"LOG_SAMPLE_LEVEL"`
+}
+
+// DefaultConfig — info в JSON на stdout; файл logs/app.log ротируется по 100MB,
+// хранится 7 сжатых копий не старше 30 дней
+func DefaultConfig() Config {
+	return Config{
+		Level:  zerolog.InfoLevel.String(),
+		Format: FormatJSON,
+		Sinks:  []string{SinkStdout},
+		File: FileConfig{
+			Path:       filepath.Join("logs", "app.log"),
+			MaxSizeMB:  100,
+			MaxBackups: 7,
+			MaxAgeDays: 30,
 			Compress:   true,
+		},
+		Sampling: SamplingConfig{
+			Period: time.Second,
+			Level:  zerolog.InfoLevel.String(),
+		},
+	}
+}
+
+// New создаёт логгер по cfg
+func New(cfg Config) (zerolog.Logger, error) {
+	level, err := parseLevel(cfg.Level, zerolog.InfoLevel)
+	if err != nil {
+		return zerolog.Logger{}, fmt.Errorf("log level: %w", err)
+	}
+	switch cfg.Format {
+	case "":
+		cfg.Format = FormatJSON
+	case FormatJSON, FormatConsole:
+	default:
+		return zerolog.Logger{}, fmt.Errorf("unknown log format %q (want json or console)", cfg.Format)
+	}
+	if len(cfg.Sinks) == 0 {
+		return zerolog.Logger{}, fmt.Errorf("no log sinks")
+	}
+
+	var writers []io.Writer
+	for _, sink := range cfg.Sinks {
+		switch sink = strings.TrimSpace(sink); sink {
+		case SinkStdout:
+			writers = append(writers, formatWriter(os.Stdout, cfg.Format, false))
+		case SinkStderr:
+			writers = append(writers, formatWriter(os.Stderr, cfg.Format, false))
+		case SinkFile:
+			w, err := newFileWriter(cfg.File)
+			if err != nil {
+				return zerolog.Logger{}, err
+			}
+			writers = append(writers, formatWriter(w, cfg.Format, true))
+		default:
+			return zerolog.Logger{}, fmt.Errorf("unknown log sink %q (want stdout, stderr or file)", sink)
+		}
+	}
+
+	l := zerolog.New(zerolog.MultiLevelWriter(writers...)).Level(level).With().Timestamp().Logger()
+	if cfg.Sampling.Burst != 0 {
+		sampler, err := newMessageSampler(cfg.Sampling)
+		if err != nil {
+			return zerolog.Logger{}, fmt.Errorf("log sampling: %w", err)
 		}
+		l = l.Hook(sampler)
+	}
+	return l, nil
+}
+
+// parseLevel разбирает уровень; пустая строка — def
+func parseLevel(s string, def zerolog.Level) (zerolog.Level, error) {
+	if s == "" {
+		return def, nil
+	}
+	return zerolog.ParseLevel(s)
+}
 
-		multi := io.MultiWriter(logFile)
+// formatWriter оборачивает w в ConsoleWriter для формата console (в файл — без цветов)
+func formatWriter(w io.Writer, format string, noColor bool) io.Writer {
+	if format == FormatConsole {
+		return zerolog.ConsoleWriter{Out: w, TimeFormat: time.RFC3339, NoColor: noColor}
+	}
+	return w
+}
+
+// newFileWriter — ротационный файл журнала
+func newFileWriter(cfg FileConfig) (io.Writer, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("log sink file requires a log file path")
+	}
+	if cfg.MaxSizeMB < 0 || cfg.MaxBackups < 0 || cfg.MaxAgeDays < 0 {
+		return nil, fmt.Errorf("log rotation settings must not be negative")
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0o755); err != nil {
+		return nil, fmt.Errorf("log directory: %w", err)
+	}
+	return &lumberjack.Logger{
+		Filename:   cfg.Path,
+		MaxSize:    cfg.MaxSizeMB,
+		MaxBackups: cfg.MaxBackups,
+		MaxAge:     cfg.MaxAgeDays,
+		Compress:   cfg.Compress,
+	}, nil
+}
 
-		zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
-		log.Logger = zerolog.New(multi).With().Timestamp().Logger()
+// SetDefault делает l глобальным логгером (log.Logger, GetLogger, FromContext без
+// логгера в контексте) и перенаправляет в него стандартный пакет log на уровне info
+func SetDefault(l zerolog.Logger) {
+	log.Logger = l
+	stdlog.SetFlags(0)
+	stdlog.SetOutput(stdWriter{l})
+}
 
-		log.Logger.Info().Msg("Logger initialized and writing to logs/app.log")
-	})
+// stdWriter пишет строки стандартного пакета log записями уровня info: без уровня
+// они обходили бы фильтр уровня и прореживание
+type stdWriter struct {
+	l zerolog.Logger
+}
+
+func (w stdWriter) Write(p []byte) (int, error) {
+	w.l.Info().Msg(strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
 }
 
 // GetLogger возвращает глобальный zerolog.Logger
 func GetLogger() zerolog.Logger {
 	return log.Logger
 }
+
+type ctxKey struct{}
+
+// WithContext возвращает контекст, несущий логгер l
+func WithContext(ctx context.Context, l zerolog.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, &l)
+}
+
+// FromContext возвращает логгер из контекста или глобальный, если его там нет
+func FromContext(ctx context.Context) *zerolog.Logger {
+	if l, ok := ctx.Value(ctxKey{}).(*zerolog.Logger); ok {
+		return l
+	}
+	return &log.Logger
+}
@@ -0,0 +1,161 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	stdlog "log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestNewFileSink(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Level = "warn"
+	cfg.Sinks = []string{SinkFile}
+	cfg.File.Path = filepath.Join(t.TempDir(), "nested", "app.log")
+
+	l, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Info().Msg("quiet")
+	l.Warn().Msg("loud")
+
+	data, err := os.ReadFile(cfg.File.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "quiet") || !strings.Contains(string(data), `"message":"loud"`) {
+		t.Errorf("Expected only warn record in file, got %q", data)
+	}
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	tests := map[string]func(*Config){
+		"level":     func(c *Config) { c.Level = "loud" },
+		"format":    func(c *Config) { c.Format = "xml" },
+		"no sinks":  func(c *Config) { c.Sinks = nil },
+		"sink":      func(c *Config) { c.Sinks = []string{"syslog"} },
+		"file path": func(c *Config) { c.Sinks = []string{SinkFile}; c.File.Path = "" },
+		"rotation":  func(c *Config) { c.Sinks = []string{SinkFile}; c.File.MaxBackups = -1 },
+		"period":    func(c *Config) { c.Sampling.Burst = 1; c.Sampling.Period = 0 },
+	}
+	for name, mutate := range tests {
+		cfg := DefaultConfig()
+		cfg.File.Path = filepath.Join(t.TempDir(), "app.log")
+		mutate(&cfg)
+		if _, err := New(cfg); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestSampling(t *testing.T) {
+	sampler, err := newMessageSampler(SamplingConfig{Burst: 2, Period: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	l := zerolog.New(&buf).Hook(sampler)
+
+	for i := 0; i < 5; i++ {
+		l.Info().Msg("noisy")
+	}
+	l.Info().Msg("other")
+	l.Error().Msg("noisy")
+	if got := strings.Count(buf.String(), `"message":"noisy"`); got != 3 {
+		t.Errorf("Expected 2 sampled info and 1 error record, got %d:\n%s", got, buf.String())
+	}
+	if !strings.Contains(buf.String(), "other") {
+		t.Error("Distinct messages must be sampled separately")
+	}
+
+	buf.Reset()
+	sampler.windows["noisy"].start = time.Now().Add(-time.Hour)
+	l.Info().Msg("noisy")
+	if !strings.Contains(buf.String(), `"sampled_out":3`) {
+		t.Errorf("Expected dropped count in next window, got %q", buf.String())
+	}
+}
+
+func TestStdlibOutputLeveled(t *testing.T) {
+	sampler, err := newMessageSampler(SamplingConfig{Burst: 1, Period: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	std := stdlog.New(stdWriter{zerolog.New(&buf).Hook(sampler)}, "", 0)
+	for i := 0; i < 3; i++ {
+		std.Printf("Sent gauge metric: %s", "Alloc")
+	}
+	if got := strings.Count(buf.String(), `"level":"info","message":"Sent gauge metric: Alloc"`); got != 1 {
+		t.Errorf("Expected one sampled info record, got %d:\n%s", got, buf.String())
+	}
+
+	buf.Reset()
+	std = stdlog.New(stdWriter{zerolog.New(&buf).Level(zerolog.WarnLevel)}, "", 0)
+	std.Print("filtered")
+	if buf.Len() != 0 {
+		t.Errorf("Expected stdlib output to honour the level filter, got %q", buf.String())
+	}
+}
+
+func TestSamplingPrune(t *testing.T) {
+	sampler, err := newMessageSampler(SamplingConfig{Burst: 1, Period: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	l := zerolog.New(&buf).Hook(sampler)
+
+	// Окна с отброшенными записями тоже удаляются, когда истекают
+	for i := 0; i < maxSampledMessages; i++ {
+		msg := "msg " + strconv.Itoa(i)
+		l.Info().Msg(msg)
+		l.Info().Msg(msg)
+	}
+	for _, w := range sampler.windows {
+		w.start = time.Now().Add(-time.Hour)
+	}
+	buf.Reset()
+	l.Info().Msg("fresh")
+	if len(sampler.windows) != 1 {
+		t.Errorf("Expected expired windows to be pruned, %d left", len(sampler.windows))
+	}
+	if want := `"sampled_out_expired":` + strconv.Itoa(maxSampledMessages); !strings.Contains(buf.String(), want) {
+		t.Errorf("Expected %s in next record, got %q", want, buf.String())
+	}
+
+	// Все окна активны: новые сообщения пишутся без прореживания и без новых окон
+	for i := 1; i < maxSampledMessages; i++ {
+		l.Info().Msg("active " + strconv.Itoa(i))
+	}
+	buf.Reset()
+	for i := 0; i < 3; i++ {
+		l.Info().Msg("overflow")
+	}
+	if got := strings.Count(buf.String(), "overflow"); got != 3 {
+		t.Errorf("Expected untracked message to pass unsampled, got %d records", got)
+	}
+	if len(sampler.windows) != maxSampledMessages {
+		t.Errorf("Expected at most %d windows, got %d", maxSampledMessages, len(sampler.windows))
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if FromContext(context.Background()) == nil {
+		t.Fatal("Expected global logger without a logger in context")
+	}
+	var buf bytes.Buffer
+	ctx := WithContext(context.Background(), zerolog.New(&buf).With().Str("request_id", "r1").Logger())
+	FromContext(ctx).Info().Msg("hello")
+	if !strings.Contains(buf.String(), `"request_id":"r1"`) {
+		t.Errorf("Expected context logger to be used, got %q", buf.String())
+	}
+}
@@ -3,6 +3,9 @@ package logger
 import (
 	"net/http"
 	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog/log"
 )
 
 type responseLogger struct {
@@ -45,3 +48,13 @@ func Middleware(next http.Handler) http.Handler {
 			Msg("HTTP request handled")
 	})
 }
+
+// WithRequestID кладёт в контекст запроса логгер с полем request_id, выданным
+// middleware.RequestID: его получают все записи, сделанные через FromContext.
+// Подключается после middleware.RequestID.
+func WithRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l := log.Logger.With().Str("request_id", middleware.GetReqID(r.Context())).Logger()
+		next.ServeHTTP(w, r.WithContext(WithContext(r.Context(), l)))
+	})
+}
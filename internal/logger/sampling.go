@@ -0,0 +1,107 @@
+package logger
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// maxSampledMessages — после стольких разных сообщений истёкшие окна удаляются.
+// Если все окна ещё активны, записи новых сообщений не прореживаются, чтобы
+// число окон не росло.
+const maxSampledMessages = 1024
+
+// messageSampler — zerolog.Hook, прореживающий записи с одинаковым текстом.
+// Первая запись нового окна получает поле sampled_out с числом отброшенных в прошлом.
+// Отброшенные записи удалённых окон сообщаются полем sampled_out_expired следующей
+// записи.
+type messageSampler struct {
+	burst  int
+	period time.Duration
+	level  zerolog.Level
+
+	mu      sync.Mutex
+	windows map[string]*sampleWindow
+	expired int // отброшено в удалённых окнах и ещё не сообщено
+}
+
+type sampleWindow struct {
+	start   time.Time
+	count   int
+	dropped int
+}
+
+func newMessageSampler(cfg SamplingConfig) (*messageSampler, error) {
+	if cfg.Burst < 0 {
+		return nil, errors.New("burst must not be negative")
+	}
+	if cfg.Period <= 0 {
+		return nil, errors.New("period must be positive")
+	}
+	level, err := parseLevel(cfg.Level, zerolog.InfoLevel)
+	if err != nil {
+		return nil, err
+	}
+	return &messageSampler{
+		burst:   cfg.Burst,
+		period:  cfg.Period,
+		level:   level,
+		windows: make(map[string]*sampleWindow),
+	}, nil
+}
+
+// Run реализует zerolog.Hook
+func (s *messageSampler) Run(e *zerolog.Event, level zerolog.Level, msg string) {
+	if level > s.level || !e.Enabled() {
+		return
+	}
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w, ok := s.windows[msg]
+	if !ok {
+		if len(s.windows) >= maxSampledMessages {
+			s.prune(now)
+		}
+		if len(s.windows) >= maxSampledMessages {
+			s.reportExpired(e)
+			return
+		}
+		w = &sampleWindow{start: now}
+		s.windows[msg] = w
+	}
+	if now.Sub(w.start) >= s.period {
+		if w.dropped > 0 {
+			e.Int("sampled_out", w.dropped)
+		}
+		*w = sampleWindow{start: now}
+	}
+	w.count++
+	if w.count > s.burst {
+		w.dropped++
+		e.Discard()
+		return
+	}
+	s.reportExpired(e)
+}
+
+// prune удаляет истёкшие окна; их отброшенные записи учитываются в s.expired
+func (s *messageSampler) prune(now time.Time) {
+	for msg, w := range s.windows {
+		if now.Sub(w.start) >= s.period {
+			s.expired += w.dropped
+			delete(s.windows, msg)
+		}
+	}
+}
+
+// reportExpired добавляет к записи число отброшенных в удалённых окнах
+func (s *messageSampler) reportExpired(e *zerolog.Event) {
+	if s.expired > 0 {
+		e.Int("sampled_out_expired", s.expired)
+		s.expired = 0
+	}
+}
@@ -0,0 +1,133 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// DefaultBuckets — верхние границы корзин гистограммы по умолчанию
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+var ErrBucketsMismatch = errors.New("histogram buckets mismatch")
+
+// HistogramValue — гистограмма с фиксированными корзинами.
+// Bounds — отсортированные верхние границы корзин, корзина +Inf подразумевается.
+// Counts — некумулятивные счётчики корзин, len(Counts) == len(Bounds)+1.
+type HistogramValue struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []uint64  `json:"counts"`
+	Sum    float64   `json:"sum"`
+	Count  uint64    `json:"count"`
+}
+
+// NewHistogram создаёт пустую гистограмму с заданными границами корзин
+func NewHistogram(bounds []float64) *HistogramValue {
+	b := append([]float64(nil), bounds...)
+	sort.Float64s(b)
+	return &HistogramValue{
+		Bounds: b,
+		Counts: make([]uint64, len(b)+1),
+	}
+}
+
+// Validate проверяет согласованность границ и счётчиков
+func (h *HistogramValue) Validate() error {
+	if len(h.Counts) != len(h.Bounds)+1 {
+		return fmt.Errorf("histogram must have %d counts for %d bounds, got %d",
+			len(h.Bounds)+1, len(h.Bounds), len(h.Counts))
+	}
+	if !sort.Float64sAreSorted(h.Bounds) {
+		return errors.New("histogram bounds must be sorted")
+	}
+	var total uint64
+	for _, c := range h.Counts {
+		total += c
+	}
+	if total != h.Count {
+		return fmt.Errorf("histogram count %d does not match buckets total %d", h.Count, total)
+	}
+	return nil
+}
+
+// Observe добавляет наблюдение
+func (h *HistogramValue) Observe(v float64) {
+	i := sort.SearchFloat64s(h.Bounds, v)
+	h.Counts[i]++
+	h.Sum += v
+	h.Count++
+}
+
+// Merge прибавляет счётчики other. Границы корзин должны совпадать.
+func (h *HistogramValue) Merge(other *HistogramValue) error {
+	if len(h.Bounds) != len(other.Bounds) {
+		return ErrBucketsMismatch
+	}
+	for i := range h.Bounds {
+		if h.Bounds[i] != other.Bounds[i] {
+			return ErrBucketsMismatch
+		}
+	}
+	for i := range h.Counts {
+		h.Counts[i] += other.Counts[i]
+	}
+	h.Sum += other.Sum
+	h.Count += other.Count
+	return nil
+}
+
+// Clone возвращает глубокую копию гистограммы
+func (h *HistogramValue) Clone() *HistogramValue {
+	return &HistogramValue{
+		Bounds: append([]float64(nil), h.Bounds...),
+		Counts: append([]uint64(nil), h.Counts...),
+		Sum:    h.Sum,
+		Count:  h.Count,
+	}
+}
+
+// Cumulative возвращает кумулятивные счётчики корзин (как в формате Prometheus)
+func (h *HistogramValue) Cumulative() []uint64 {
+	res := make([]uint64, len(h.Counts))
+	var acc uint64
+	for i, c := range h.Counts {
+		acc += c
+		res[i] = acc
+	}
+	return res
+}
+
+// Quantile оценивает квантиль линейной интерполяцией внутри корзины
+func (h *HistogramValue) Quantile(q float64) (float64, error) {
+	if h.Count == 0 {
+		return 0, errors.New("histogram is empty")
+	}
+	if q < 0 || q > 1 {
+		return 0, fmt.Errorf("quantile %v out of range [0, 1]", q)
+	}
+
+	rank := q * float64(h.Count)
+	var acc float64
+	for i, c := range h.Counts {
+		prev := acc
+		acc += float64(c)
+		if acc < rank || c == 0 {
+			continue
+		}
+		if i == len(h.Bounds) {
+			// Корзина +Inf: возвращаем последнюю известную границу
+			if len(h.Bounds) == 0 {
+				return math.Inf(1), nil
+			}
+			return h.Bounds[len(h.Bounds)-1], nil
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = h.Bounds[i-1]
+		}
+		upper := h.Bounds[i]
+		return lower + (upper-lower)*(rank-prev)/float64(c), nil
+	}
+	return 0, errors.New("histogram counts are inconsistent")
+}
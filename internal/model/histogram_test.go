@@ -0,0 +1,65 @@
+package models
+
+import "testing"
+
+func TestHistogramObserveAndMerge(t *testing.T) {
+	a := NewHistogram([]float64{1, 5, 10})
+	for _, v := range []float64{0.5, 1, 3, 7, 20} {
+		a.Observe(v)
+	}
+
+	// Граница включается в корзину: 1 попадает в le=1
+	expected := []uint64{2, 1, 1, 1}
+	for i, c := range expected {
+		if a.Counts[i] != c {
+			t.Errorf("Bucket %d: expected %d, got %d", i, c, a.Counts[i])
+		}
+	}
+	if err := a.Validate(); err != nil {
+		t.Errorf("Validate() failed: %v", err)
+	}
+
+	b := NewHistogram([]float64{1, 5, 10})
+	b.Observe(2)
+	if err := a.Merge(b); err != nil {
+		t.Fatalf("Merge() failed: %v", err)
+	}
+	if a.Count != 6 || a.Sum != 33.5 {
+		t.Errorf("Expected count 6 and sum 33.5, got %d and %v", a.Count, a.Sum)
+	}
+
+	cum := a.Cumulative()
+	if cum[len(cum)-1] != a.Count {
+		t.Errorf("Last cumulative bucket must equal count, got %d", cum[len(cum)-1])
+	}
+
+	if err := a.Merge(NewHistogram([]float64{1, 2})); err != ErrBucketsMismatch {
+		t.Errorf("Expected ErrBucketsMismatch, got %v", err)
+	}
+}
+
+func TestHistogramValidate(t *testing.T) {
+	h := &HistogramValue{Bounds: []float64{1, 2}, Counts: []uint64{1, 1}, Count: 2}
+	if err := h.Validate(); err == nil {
+		t.Error("Expected error for wrong number of counts")
+	}
+
+	h = &HistogramValue{Bounds: []float64{1, 2}, Counts: []uint64{1, 1, 1}, Count: 5}
+	if err := h.Validate(); err == nil {
+		t.Error("Expected error for count mismatch")
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	h := NewHistogram([]float64{10, 20, 30})
+	for i := 0; i < 10; i++ {
+		h.Observe(15)
+	}
+	got, err := h.Quantile(0.5)
+	if err != nil {
+		t.Fatalf("Quantile() failed: %v", err)
+	}
+	if got != 15 {
+		t.Errorf("Expected interpolated median 15, got %v", got)
+	}
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Labels — набор меток серии (host, env, service ...).
+// Серия однозначно определяется именем метрики и отсортированным набором меток.
+type Labels map[string]string
+
+var labelNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Names возвращает отсортированный список имён меток
+func (l Labels) Names() []string {
+	names := make([]string, 0, len(l))
+	for k := range l {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// String возвращает каноническое представление меток вида {a="1",b="2"}.
+// Для пустого набора возвращается пустая строка.
+func (l Labels) String() string {
+	if len(l) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, name := range l.Names() {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		fmt.Fprintf(&sb, "%s=%q", name, l[name])
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+// Clone возвращает копию набора меток
+func (l Labels) Clone() Labels {
+	if l == nil {
+		return nil
+	}
+	c := make(Labels, len(l))
+	for k, v := range l {
+		c[k] = v
+	}
+	return c
+}
+
+// Merge возвращает новый набор, в котором метки other перекрывают метки l
+func (l Labels) Merge(other Labels) Labels {
+	if len(other) == 0 {
+		return l.Clone()
+	}
+	res := make(Labels, len(l)+len(other))
+	for k, v := range l {
+		res[k] = v
+	}
+	for k, v := range other {
+		res[k] = v
+	}
+	return res
+}
+
+// Validate проверяет имена меток
+func (l Labels) Validate() error {
+	for k := range l {
+		if !labelNameRe.MatchString(k) {
+			return fmt.Errorf("invalid label name %q", k)
+		}
+	}
+	return nil
+}
+
+// SeriesKey возвращает ключ серии: имя метрики и отсортированные метки.
+// Для серии без меток ключ совпадает с именем, что сохраняет совместимость
+// со старыми клиентами.
+func SeriesKey(name string, labels Labels) string {
+	return name + labels.String()
+}
+
+// ParseLabels разбирает строку вида "host=web1,env=prod"
+func ParseLabels(s string) (Labels, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	labels := make(Labels)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid label %q: expected name=value", pair)
+		}
+		name = strings.TrimSpace(name)
+		labels[name] = unquote(strings.TrimSpace(value))
+	}
+	if err := labels.Validate(); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+// SanitizeLabelName приводит произвольную строку (тег StatsD, Influx, Graphite)
+// к допустимому имени метки, заменяя недопустимые символы на '_'
+func SanitizeLabelName(s string) string {
+	var sb strings.Builder
+	for i, r := range s {
+		valid := r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') ||
+			(i > 0 && r >= '0' && r <= '9')
+		if valid {
+			sb.WriteRune(r)
+		} else {
+			sb.WriteByte('_')
+		}
+	}
+	return sb.String()
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
@@ -0,0 +1,66 @@
+package models
+
+import "testing"
+
+func TestSeriesKey(t *testing.T) {
+	if got := SeriesKey("HeapAlloc", nil); got != "HeapAlloc" {
+		t.Errorf("Expected unlabeled key 'HeapAlloc', got '%s'", got)
+	}
+
+	// Порядок меток не должен влиять на ключ серии
+	a := SeriesKey("HeapAlloc", Labels{"host": "web1", "env": "prod"})
+	b := SeriesKey("HeapAlloc", Labels{"env": "prod", "host": "web1"})
+	if a != b {
+		t.Errorf("Expected equal keys, got '%s' and '%s'", a, b)
+	}
+	if expected := `HeapAlloc{env="prod",host="web1"}`; a != expected {
+		t.Errorf("Expected key '%s', got '%s'", expected, a)
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	labels, err := ParseLabels(`host=web1, env="prod"`)
+	if err != nil {
+		t.Fatalf("ParseLabels() failed: %v", err)
+	}
+	if labels["host"] != "web1" || labels["env"] != "prod" {
+		t.Errorf("Unexpected labels: %v", labels)
+	}
+
+	for _, bad := range []string{"host", "1host=a", "ho-st=a"} {
+		if _, err := ParseLabels(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+func TestMatchers(t *testing.T) {
+	matchers, err := ParseMatchers(`host=web1,env=~prod|stage,dc!="eu",role!~db.*`)
+	if err != nil {
+		t.Fatalf("ParseMatchers() failed: %v", err)
+	}
+	if len(matchers) != 4 {
+		t.Fatalf("Expected 4 matchers, got %d", len(matchers))
+	}
+
+	tests := []struct {
+		labels Labels
+		want   bool
+	}{
+		{Labels{"host": "web1", "env": "prod", "dc": "us", "role": "web"}, true},
+		{Labels{"host": "web1", "env": "stage"}, true},
+		{Labels{"host": "web2", "env": "prod"}, false},
+		{Labels{"host": "web1", "env": "production"}, false},
+		{Labels{"host": "web1", "env": "prod", "dc": "eu"}, false},
+		{Labels{"host": "web1", "env": "prod", "role": "db-main"}, false},
+	}
+	for _, tt := range tests {
+		if got := MatchLabels(matchers, tt.labels); got != tt.want {
+			t.Errorf("MatchLabels(%v) = %v, want %v", tt.labels, got, tt.want)
+		}
+	}
+
+	if _, err := ParseMatchers("host=~("); err == nil {
+		t.Error("Expected error for invalid regexp")
+	}
+}
@@ -0,0 +1,130 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// MatchType — тип сравнения в матчере меток
+type MatchType int
+
+const (
+	MatchEqual MatchType = iota
+	MatchNotEqual
+	MatchRegexp
+	MatchNotRegexp
+)
+
+func (t MatchType) String() string {
+	switch t {
+	case MatchEqual:
+		return "="
+	case MatchNotEqual:
+		return "!="
+	case MatchRegexp:
+		return "=~"
+	case MatchNotRegexp:
+		return "!~"
+	}
+	return "?"
+}
+
+// Matcher описывает условие на значение одной метки.
+// Отсутствующая метка считается равной пустой строке.
+type Matcher struct {
+	Name  string
+	Type  MatchType
+	Value string
+	re    *regexp.Regexp
+}
+
+// NewMatcher создаёт матчер, для регулярных выражений компилирует шаблон
+func NewMatcher(t MatchType, name, value string) (*Matcher, error) {
+	m := &Matcher{Name: name, Type: t, Value: value}
+	if t == MatchRegexp || t == MatchNotRegexp {
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid regexp for label %q: %w", name, err)
+		}
+		m.re = re
+	}
+	return m, nil
+}
+
+// Matches проверяет значение метки
+func (m *Matcher) Matches(v string) bool {
+	switch m.Type {
+	case MatchEqual:
+		return v == m.Value
+	case MatchNotEqual:
+		return v != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(v)
+	case MatchNotRegexp:
+		return !m.re.MatchString(v)
+	}
+	return false
+}
+
+func (m *Matcher) String() string {
+	return fmt.Sprintf("%s%s%q", m.Name, m.Type, m.Value)
+}
+
+// MatchLabels проверяет, что набор меток удовлетворяет всем матчерам
+func MatchLabels(matchers []*Matcher, labels Labels) bool {
+	for _, m := range matchers {
+		if !m.Matches(labels[m.Name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseMatchers разбирает строку вида `host=web1,env=~prod.*,dc!="eu"`
+func ParseMatchers(s string) ([]*Matcher, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	var matchers []*Matcher
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		m, err := parseMatcher(part)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers, nil
+}
+
+func parseMatcher(s string) (*Matcher, error) {
+	idx := strings.IndexAny(s, "=!")
+	if idx <= 0 {
+		return nil, fmt.Errorf("invalid matcher %q", s)
+	}
+	name := strings.TrimSpace(s[:idx])
+	rest := s[idx:]
+
+	var t MatchType
+	switch {
+	case strings.HasPrefix(rest, "=~"):
+		t, rest = MatchRegexp, rest[2:]
+	case strings.HasPrefix(rest, "!~"):
+		t, rest = MatchNotRegexp, rest[2:]
+	case strings.HasPrefix(rest, "!="):
+		t, rest = MatchNotEqual, rest[2:]
+	case strings.HasPrefix(rest, "="):
+		t, rest = MatchEqual, rest[1:]
+	default:
+		return nil, fmt.Errorf("invalid matcher %q", s)
+	}
+	if !labelNameRe.MatchString(name) {
+		return nil, fmt.Errorf("invalid label name %q", name)
+	}
+	return NewMatcher(t, name, unquote(strings.TrimSpace(rest)))
+}
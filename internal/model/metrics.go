@@ -1,10 +1,23 @@
 package models
 
+import "github.com/kvsukharev/go-musthave-metrics-tpl/internal/sketch"
+
 const (
-	Counter = "counter"
-	Gauge   = "gauge"
+	Counter   = "counter"
+	Gauge     = "gauge"
+	Histogram = "histogram"
+	Summary   = "summary"
 )
 
+// ValidType проверяет, что тип метрики поддерживается
+func ValidType(t string) bool {
+	switch t {
+	case Counter, Gauge, Histogram, Summary:
+		return true
+	}
+	return false
+}
+
 // NOTE: Не усложняем пример, вводя иерархическую вложенность структур.
 // Органичиваясь плоской моделью.
 // Delta и Value объявлены через указатели,
@@ -16,4 +29,15 @@ type Metrics struct {
 	Delta *int64   `json:"delta,omitempty"`
 	Value *float64 `json:"value,omitempty"`
 	Hash  string   `json:"hash,omitempty"`
+	// Labels — необязательные метки серии; клиенты без меток продолжают работать
+	Labels Labels `json:"labels,omitempty"`
+	// Histogram — значение метрики в случае передачи histogram
+	Histogram *HistogramValue `json:"histogram,omitempty"`
+	// Sketch — значение метрики в случае передачи summary
+	Sketch *sketch.DDSketch `json:"sketch,omitempty"`
+}
+
+// Key возвращает ключ серии метрики
+func (m Metrics) Key() string {
+	return SeriesKey(m.ID, m.Labels)
 }
@@ -0,0 +1,315 @@
+package otlp
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/cumulative"
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/promfmt"
+)
+
+// HistogramMode — способ хранения OTLP гистограмм
+type HistogramMode int
+
+const (
+	// HistogramNative сохраняет гистограмму как метрику типа histogram
+	HistogramNative HistogramMode = iota
+	// HistogramBuckets разворачивает гистограмму в серии name_bucket{le=...}, name_count и name_sum
+	HistogramBuckets
+)
+
+// ParseHistogramMode разбирает значение "native" или "buckets"
+func ParseHistogramMode(s string) (HistogramMode, error) {
+	switch s {
+	case "", "native":
+		return HistogramNative, nil
+	case "buckets":
+		return HistogramBuckets, nil
+	}
+	return 0, fmt.Errorf("invalid histogram mode %q: expected native or buckets", s)
+}
+
+// Options — правила преобразования точек в метрики
+type Options struct {
+	Histograms HistogramMode
+}
+
+// Result — итог разбора запроса
+type Result struct {
+	Points []Point
+	// Rejected — число точек, которые нельзя сохранить (неподдерживаемый тип данных)
+	Rejected int64
+	Errors   []string
+}
+
+// Point — метрика точки OTLP до перевода накопленного значения в приращение.
+// Состояние cumulative меняет только Converter.Metrics, поэтому точки,
+// не прошедшие проверки и лимиты сервера, его не сдвигают.
+type Point struct {
+	Metric models.Metrics
+	// cumulative — значение накоплено клиентом и переводится в приращение
+	cumulative bool
+}
+
+// Series возвращает метрики, которые запишет точка p, без изменения состояния:
+// по ним проверяются права, формат и лимит серий до записи
+func (o Options) Series(p Point) []models.Metrics {
+	return o.series(p.Metric)
+}
+
+// series разворачивает гистограмму m в режиме buckets; name_sum — последняя метрика
+func (o Options) series(m models.Metrics) []models.Metrics {
+	if m.MType != models.Histogram || o.Histograms == HistogramNative {
+		return []models.Metrics{m}
+	}
+
+	// Развёрнутые корзины: счётчики кумулятивны по le, как в Prometheus
+	h := m.Histogram
+	res := make([]models.Metrics, 0, len(h.Counts)+2)
+	for i, n := range h.Cumulative() {
+		le := "+Inf"
+		if i < len(h.Bounds) {
+			le = promfmt.FormatFloat(h.Bounds[i])
+		}
+		v := int64(n)
+		res = append(res, models.Metrics{ID: m.ID + "_bucket", MType: models.Counter,
+			Delta: &v, Labels: m.Labels.Merge(models.Labels{"le": le})})
+	}
+	count := int64(h.Count)
+	sum := h.Sum
+	return append(res,
+		models.Metrics{ID: m.ID + "_count", MType: models.Counter, Delta: &count, Labels: m.Labels},
+		models.Metrics{ID: m.ID + "_sum", MType: models.Gauge, Value: &sum, Labels: m.Labels})
+}
+
+// Converter переводит точки в записываемые метрики с учётом temporality.
+// Накопленные (cumulative) суммы и гистограммы переводятся в приращения,
+// delta значения передаются как есть.
+type Converter struct {
+	opts       Options
+	cumulative *cumulative.Converter
+}
+
+func NewConverter(opts Options, cum *cumulative.Converter) *Converter {
+	return &Converter{opts: opts, cumulative: cum}
+}
+
+// Metrics возвращает метрики точки p для записи. Вызывается только для точек,
+// которые будут записаны: накопленное значение сдвигает состояние серии.
+func (c *Converter) Metrics(p Point) []models.Metrics {
+	m := p.Metric
+	if p.cumulative {
+		m = c.cumulative.ToDelta(m)
+	}
+	res := c.opts.series(m)
+	if m.MType == models.Histogram && c.opts.Histograms == HistogramBuckets {
+		// Сервер хранит счётчики целыми, поэтому дробная name_sum складывается
+		// из приращений здесь и записывается как gauge: как и name_count, она
+		// растёт на сумму за интервал для delta и для cumulative точек
+		sum := &res[len(res)-1]
+		v := c.cumulative.Accumulate(sum.MType+" "+sum.Key(), *sum.Value)
+		sum.Value = &v
+	}
+	return res
+}
+
+// Convert разбирает запрос экспорта на точки. Атрибуты ресурса и точки становятся
+// метками, атрибуты точки перекрывают атрибуты ресурса.
+func Convert(md *metricspb.MetricsData) Result {
+	var res Result
+	for _, rm := range md.GetResourceMetrics() {
+		resLabels := attributesToLabels(rm.GetResource().GetAttributes())
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, m := range sm.GetMetrics() {
+				res.convertMetric(m, resLabels)
+			}
+		}
+	}
+	return res
+}
+
+func (res *Result) convertMetric(m *metricspb.Metric, resLabels models.Labels) {
+	name := promfmt.SanitizeName(m.GetName())
+	if name == "" {
+		res.reject(1, "metric without name")
+		return
+	}
+
+	switch data := m.GetData().(type) {
+	case *metricspb.Metric_Gauge:
+		for _, p := range data.Gauge.GetDataPoints() {
+			if v, ok := numberValue(p); ok {
+				labels := pointLabels(resLabels, p.GetAttributes())
+				res.add(models.Metrics{ID: name, MType: models.Gauge, Value: &v, Labels: labels}, false)
+			}
+		}
+
+	case *metricspb.Metric_Sum:
+		res.convertSum(name, data.Sum, resLabels)
+
+	case *metricspb.Metric_Histogram:
+		res.convertHistogram(name, data.Histogram, resLabels)
+
+	case *metricspb.Metric_Summary:
+		// Готовые квантили нельзя объединять, поэтому summary разворачивается в gauge
+		for _, p := range data.Summary.GetDataPoints() {
+			if noRecordedValue(p.GetFlags()) {
+				continue
+			}
+			labels := pointLabels(resLabels, p.GetAttributes())
+			for _, q := range p.GetQuantileValues() {
+				v := q.GetValue()
+				ql := labels.Merge(models.Labels{"quantile": promfmt.FormatFloat(q.GetQuantile())})
+				res.add(models.Metrics{ID: name, MType: models.Gauge, Value: &v, Labels: ql}, false)
+			}
+			sum, count := p.GetSum(), float64(p.GetCount())
+			res.add(models.Metrics{ID: name + "_sum", MType: models.Gauge, Value: &sum, Labels: labels}, false)
+			res.add(models.Metrics{ID: name + "_count", MType: models.Gauge, Value: &count, Labels: labels}, false)
+		}
+
+	case *metricspb.Metric_ExponentialHistogram:
+		res.reject(len(data.ExponentialHistogram.GetDataPoints()),
+			fmt.Sprintf("%s: exponential histograms are not supported", m.GetName()))
+
+	default:
+		res.reject(1, fmt.Sprintf("%s: metric without data", m.GetName()))
+	}
+}
+
+func (res *Result) convertSum(name string, sum *metricspb.Sum, resLabels models.Labels) {
+	points := sum.GetDataPoints()
+	delta := sum.GetAggregationTemporality() == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+
+	if !sum.GetIsMonotonic() {
+		// UpDownCounter: накопленное значение — текущее состояние, т.е. gauge.
+		// Delta приращения без хранения суммы на сервере применить нельзя.
+		if delta {
+			res.reject(len(points), fmt.Sprintf("%s: non-monotonic delta sums are not supported", name))
+			return
+		}
+		for _, p := range points {
+			if v, ok := numberValue(p); ok {
+				labels := pointLabels(resLabels, p.GetAttributes())
+				res.add(models.Metrics{ID: name, MType: models.Gauge, Value: &v, Labels: labels}, false)
+			}
+		}
+		return
+	}
+
+	for _, p := range points {
+		v, ok := numberValue(p)
+		if !ok {
+			continue
+		}
+		d := int64(math.Round(v))
+		res.add(models.Metrics{ID: name, MType: models.Counter, Delta: &d, Labels: pointLabels(resLabels, p.GetAttributes())}, !delta)
+	}
+}
+
+func (res *Result) convertHistogram(name string, hist *metricspb.Histogram, resLabels models.Labels) {
+	delta := hist.GetAggregationTemporality() == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+
+	for _, p := range hist.GetDataPoints() {
+		if noRecordedValue(p.GetFlags()) {
+			continue
+		}
+		h, err := toHistogram(p)
+		if err != nil {
+			res.reject(1, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		labels := pointLabels(resLabels, p.GetAttributes())
+		res.add(models.Metrics{ID: name, MType: models.Histogram, Histogram: h, Labels: labels}, !delta)
+	}
+}
+
+// toHistogram переводит точку OTLP в гистограмму сервера.
+// Точка без корзин превращается в гистограмму с единственной корзиной +Inf.
+func toHistogram(p *metricspb.HistogramDataPoint) (*models.HistogramValue, error) {
+	h := &models.HistogramValue{
+		Bounds: append([]float64(nil), p.GetExplicitBounds()...),
+		Counts: append([]uint64(nil), p.GetBucketCounts()...),
+		Sum:    p.GetSum(),
+		Count:  p.GetCount(),
+	}
+	if len(h.Counts) == 0 && len(h.Bounds) == 0 {
+		h.Counts = []uint64{h.Count}
+	}
+	if err := h.Validate(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (r *Result) add(m models.Metrics, cumulative bool) {
+	r.Points = append(r.Points, Point{Metric: m, cumulative: cumulative})
+}
+
+func (r *Result) reject(n int, msg string) {
+	if n == 0 {
+		return
+	}
+	r.Rejected += int64(n)
+	r.Errors = append(r.Errors, msg)
+}
+
+// noRecordedValue — флаг FLAG_NO_RECORDED_VALUE: точка явно помечена как отсутствующая
+func noRecordedValue(flags uint32) bool {
+	return flags&uint32(metricspb.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK) != 0
+}
+
+func numberValue(p *metricspb.NumberDataPoint) (float64, bool) {
+	if noRecordedValue(p.GetFlags()) {
+		return 0, false
+	}
+	switch v := p.GetValue().(type) {
+	case *metricspb.NumberDataPoint_AsDouble:
+		if math.IsNaN(v.AsDouble) {
+			return 0, false
+		}
+		return v.AsDouble, true
+	case *metricspb.NumberDataPoint_AsInt:
+		return float64(v.AsInt), true
+	}
+	return 0, false
+}
+
+func pointLabels(resLabels models.Labels, attrs []*commonpb.KeyValue) models.Labels {
+	return resLabels.Merge(attributesToLabels(attrs))
+}
+
+// attributesToLabels переводит атрибуты в метки; точки в именах (service.name)
+// заменяются на '_'. Массивы и вложенные структуры пропускаются.
+func attributesToLabels(attrs []*commonpb.KeyValue) models.Labels {
+	if len(attrs) == 0 {
+		return nil
+	}
+	labels := make(models.Labels, len(attrs))
+	for _, kv := range attrs {
+		v, ok := anyValueString(kv.GetValue())
+		if !ok || kv.GetKey() == "" {
+			continue
+		}
+		labels[models.SanitizeLabelName(kv.GetKey())] = v
+	}
+	return labels
+}
+
+func anyValueString(v *commonpb.AnyValue) (string, bool) {
+	switch x := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return x.StringValue, true
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(x.BoolValue), true
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(x.IntValue, 10), true
+	case *commonpb.AnyValue_DoubleValue:
+		return promfmt.FormatFloat(x.DoubleValue), true
+	}
+	return "", false
+}
@@ -0,0 +1,213 @@
+package otlp
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/cumulative"
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+)
+
+// Фикстуры — экспорт OpenTelemetry Go SDK; metrics.pb содержит те же данные в protobuf
+var fixtures = map[string]string{
+	"metrics.json": ContentTypeJSON,
+	"metrics.pb":   ContentTypeProtobuf,
+}
+
+func loadFixture(t *testing.T, name string) *metricspb.MetricsData {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, err := Decode(body, fixtures[name])
+	if err != nil {
+		t.Fatalf("Decode(%s) failed: %v", name, err)
+	}
+	return md
+}
+
+func byKey(metrics []models.Metrics) map[string]models.Metrics {
+	res := make(map[string]models.Metrics, len(metrics))
+	for _, m := range metrics {
+		res[m.MType+" "+m.Key()] = m
+	}
+	return res
+}
+
+// write переводит все точки запроса в метрики, как при записи на сервере
+func write(c *Converter, md *metricspb.MetricsData) []models.Metrics {
+	var res []models.Metrics
+	for _, p := range Convert(md).Points {
+		res = append(res, c.Metrics(p)...)
+	}
+	return res
+}
+
+func TestDecodeFixturesEqual(t *testing.T) {
+	fromJSON := loadFixture(t, "metrics.json")
+	fromPB := loadFixture(t, "metrics.pb")
+	if !proto.Equal(fromJSON, fromPB) {
+		t.Error("JSON and protobuf fixtures must decode to the same request")
+	}
+}
+
+func TestConvertFixture(t *testing.T) {
+	for name := range fixtures {
+		md := loadFixture(t, name)
+		res := Convert(md)
+
+		if res.Rejected != 1 || len(res.Errors) != 1 {
+			t.Errorf("%s: expected exponential histogram point to be rejected, got %d %v", name, res.Rejected, res.Errors)
+		}
+
+		got := byKey(write(NewConverter(Options{}, cumulative.NewConverter()), md))
+		resource := models.Labels{"service_name": "checkout", "host_name": "web1", "process_pid": "4242"}
+		get := func(mtype, id string, extra models.Labels) models.Metrics {
+			key := mtype + " " + models.SeriesKey(id, resource.Merge(extra))
+			m, ok := got[key]
+			if !ok {
+				t.Fatalf("%s: missing %s", name, key)
+			}
+			return m
+		}
+
+		if m := get(models.Counter, "http_server_requests", models.Labels{"http_method": "GET"}); *m.Delta != 42 {
+			t.Errorf("%s: expected cumulative counter 42, got %d", name, *m.Delta)
+		}
+		if m := get(models.Counter, "jobs_processed", nil); *m.Delta != 5 {
+			t.Errorf("%s: expected delta counter 5, got %d", name, *m.Delta)
+		}
+		if m := get(models.Gauge, "queue_size", nil); *m.Value != 7 {
+			t.Errorf("%s: expected non-monotonic sum as gauge 7, got %v", name, *m.Value)
+		}
+		if m := get(models.Gauge, "process_memory_usage", nil); *m.Value != 1048576 {
+			t.Errorf("%s: expected gauge 1048576, got %v", name, *m.Value)
+		}
+		if m := get(models.Histogram, "http_server_duration", models.Labels{"http_method": "GET"}); m.Histogram.Count != 10 || len(m.Histogram.Counts) != 4 {
+			t.Errorf("%s: unexpected histogram %+v", name, m.Histogram)
+		}
+		if m := get(models.Gauge, "gc_pause", models.Labels{"quantile": "0.99"}); *m.Value != 0.009 {
+			t.Errorf("%s: expected summary quantile 0.009, got %v", name, *m.Value)
+		}
+	}
+}
+
+func TestConvertCumulativeToDelta(t *testing.T) {
+	c := NewConverter(Options{}, cumulative.NewConverter())
+	md := loadFixture(t, "metrics.json")
+	write(c, md)
+
+	// Повторный экспорт: накопленные значения выросли
+	metric := md.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	metric[0].GetSum().DataPoints[0].Value = &metricspb.NumberDataPoint_AsInt{AsInt: 50}
+	hp := metric[4].GetHistogram().DataPoints[0]
+	hp.BucketCounts = []uint64{4, 6, 1, 1}
+	hp.Count, hp.Sum = 12, proto.Float64(4.5)
+
+	got := byKey(write(c, md))
+	labels := models.Labels{"service_name": "checkout", "host_name": "web1", "process_pid": "4242", "http_method": "GET"}
+
+	if m := got[models.Counter+" "+models.SeriesKey("http_server_requests", labels)]; m.Delta == nil || *m.Delta != 8 {
+		t.Errorf("Expected counter delta 8, got %+v", m)
+	}
+	h := got[models.Histogram+" "+models.SeriesKey("http_server_duration", labels)].Histogram
+	if h == nil || h.Count != 2 || h.Counts[0] != 1 || h.Counts[1] != 1 {
+		t.Errorf("Expected histogram delta of 2 observations, got %+v", h)
+	}
+	// Delta сумма не накапливается конвертером
+	if m := got[models.Counter+" "+models.SeriesKey("jobs_processed", models.Labels{"service_name": "checkout", "host_name": "web1", "process_pid": "4242"})]; *m.Delta != 5 {
+		t.Errorf("Expected delta counter 5, got %d", *m.Delta)
+	}
+}
+
+func TestConvertKeepsStateUntilWritten(t *testing.T) {
+	c := NewConverter(Options{Histograms: HistogramBuckets}, cumulative.NewConverter())
+	md := loadFixture(t, "metrics.json")
+	res := Convert(md)
+	labels := models.Labels{"service_name": "checkout", "host_name": "web1", "process_pid": "4242", "http_method": "GET"}
+
+	// Разбор и список серий не сдвигают накопленное состояние
+	for _, p := range res.Points {
+		series := Options{Histograms: HistogramBuckets}.Series(p)
+		if p.Metric.ID == "http_server_duration" && len(series) != 6 {
+			t.Errorf("Expected 4 buckets, _count and _sum, got %d series", len(series))
+		}
+	}
+	got := byKey(write(c, md))
+	if m := got[models.Counter+" "+models.SeriesKey("http_server_requests", labels)]; m.Delta == nil || *m.Delta != 42 {
+		t.Errorf("First written point must be passed whole, got %+v", m)
+	}
+}
+
+func TestConvertHistogramBuckets(t *testing.T) {
+	c := NewConverter(Options{Histograms: HistogramBuckets}, cumulative.NewConverter())
+	got := byKey(write(c, loadFixture(t, "metrics.pb")))
+	labels := models.Labels{"service_name": "checkout", "host_name": "web1", "process_pid": "4242", "http_method": "GET"}
+
+	for le, want := range map[string]int64{"0.1": 3, "0.5": 8, "1": 9, "+Inf": 10} {
+		key := models.Counter + " " + models.SeriesKey("http_server_duration_bucket", labels.Merge(models.Labels{"le": le}))
+		if m, ok := got[key]; !ok || *m.Delta != want {
+			t.Errorf("Expected %s = %d, got %+v", key, want, m)
+		}
+	}
+	if m := got[models.Counter+" "+models.SeriesKey("http_server_duration_count", labels)]; m.Delta == nil || *m.Delta != 10 {
+		t.Errorf("Expected _count 10, got %+v", m)
+	}
+	if m := got[models.Gauge+" "+models.SeriesKey("http_server_duration_sum", labels)]; m.Value == nil || *m.Value != 4.2 {
+		t.Errorf("Expected _sum 4.2, got %+v", m)
+	}
+	if _, ok := got[models.Histogram+" "+models.SeriesKey("http_server_duration", labels)]; ok {
+		t.Error("Native histogram must not be emitted in buckets mode")
+	}
+}
+
+func TestConvertHistogramBucketsCumulativeSum(t *testing.T) {
+	c := NewConverter(Options{Histograms: HistogramBuckets}, cumulative.NewConverter())
+	md := loadFixture(t, "metrics.json")
+	hp := md.ResourceMetrics[0].ScopeMetrics[0].Metrics[4].GetHistogram().DataPoints[0]
+	labels := models.Labels{"service_name": "checkout", "host_name": "web1", "process_pid": "4242", "http_method": "GET"}
+	sumKey := models.Gauge + " " + models.SeriesKey("http_server_duration_sum", labels)
+	countKey := models.Counter + " " + models.SeriesKey("http_server_duration_count", labels)
+
+	steps := []struct {
+		counts []uint64
+		count  uint64
+		sum    float64
+		// wantSum — накопленная на сервере сумма, wantCount — приращение _count
+		wantSum   float64
+		wantCount int64
+	}{
+		{[]uint64{3, 5, 1, 1}, 10, 4.2, 4.2, 10},
+		{[]uint64{4, 6, 1, 1}, 12, 4.5, 4.5, 2},
+		// Сброс на клиенте: сумма, как и _count, продолжает расти
+		{[]uint64{1, 0, 0, 0}, 1, 0.1, 4.6, 1},
+	}
+	for i, s := range steps {
+		hp.BucketCounts, hp.Count, hp.Sum = s.counts, s.count, proto.Float64(s.sum)
+		got := byKey(write(c, md))
+		if m := got[sumKey]; m.Value == nil || math.Abs(*m.Value-s.wantSum) > 1e-9 {
+			t.Errorf("Step %d: expected _sum %v, got %+v", i, s.wantSum, m)
+		}
+		if m := got[countKey]; m.Delta == nil || *m.Delta != s.wantCount {
+			t.Errorf("Step %d: expected _count delta %d, got %+v", i, s.wantCount, m)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	if _, err := Decode([]byte("{}"), "text/plain"); err == nil {
+		t.Error("Expected error for unsupported content type")
+	}
+	if _, err := Decode([]byte("{not json"), ContentTypeJSON+"; charset=utf-8"); err == nil {
+		t.Error("Expected error for invalid JSON")
+	}
+	if _, err := Decode([]byte{0xff, 0xff}, ContentTypeProtobuf); err == nil {
+		t.Error("Expected error for invalid protobuf")
+	}
+}
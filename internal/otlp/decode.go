@@ -0,0 +1,116 @@
+// Package otlp принимает экспорт метрик OpenTelemetry (OTLP/HTTP) в кодировках
+// protobuf и JSON и преобразует точки в метрики сервера.
+package otlp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// Типы содержимого OTLP/HTTP
+const (
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeJSON     = "application/json"
+)
+
+var ErrUnsupportedContentType = errors.New("unsupported content type")
+
+// MediaType возвращает тип содержимого без параметров либо ErrUnsupportedContentType
+func MediaType(contentType string) (string, error) {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", fmt.Errorf("%w %q", ErrUnsupportedContentType, contentType)
+	}
+	switch mt {
+	case ContentTypeProtobuf, ContentTypeJSON:
+		return mt, nil
+	}
+	return "", fmt.Errorf("%w %q", ErrUnsupportedContentType, mt)
+}
+
+// Decode разбирает тело ExportMetricsServiceRequest.
+// Запрос имеет ту же схему, что и MetricsData (repeated ResourceMetrics = 1),
+// поэтому используется тип из пакета metrics/v1 без зависимости от gRPC сервиса.
+// В JSON идентификаторы трассировки в exemplars ожидаются в base64, как в protojson.
+func Decode(body []byte, contentType string) (*metricspb.MetricsData, error) {
+	mt, err := MediaType(contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	md := &metricspb.MetricsData{}
+	if mt == ContentTypeJSON {
+		err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(body, md)
+	} else {
+		err = proto.Unmarshal(body, md)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode OTLP request: %w", err)
+	}
+	return md, nil
+}
+
+// jsonPartialSuccess — ExportMetricsPartialSuccess в JSON кодировке OTLP (int64 — строкой)
+type jsonPartialSuccess struct {
+	RejectedDataPoints string `json:"rejectedDataPoints,omitempty"`
+	ErrorMessage       string `json:"errorMessage,omitempty"`
+}
+
+type jsonExportResponse struct {
+	PartialSuccess *jsonPartialSuccess `json:"partialSuccess,omitempty"`
+}
+
+// EncodeResponse кодирует ExportMetricsServiceResponse. При rejected == 0 и пустом
+// сообщении partial_success не заполняется, как требует спецификация.
+func EncodeResponse(mediaType string, rejected int64, msg string) []byte {
+	if mediaType == ContentTypeJSON {
+		resp := jsonExportResponse{}
+		if rejected > 0 || msg != "" {
+			resp.PartialSuccess = &jsonPartialSuccess{ErrorMessage: msg}
+			if rejected > 0 {
+				resp.PartialSuccess.RejectedDataPoints = fmt.Sprint(rejected)
+			}
+		}
+		b, _ := json.Marshal(resp)
+		return b
+	}
+
+	if rejected == 0 && msg == "" {
+		return []byte{}
+	}
+	var ps []byte
+	if rejected > 0 {
+		ps = protowire.AppendTag(ps, 1, protowire.VarintType)
+		ps = protowire.AppendVarint(ps, uint64(rejected))
+	}
+	if msg != "" {
+		ps = protowire.AppendTag(ps, 2, protowire.BytesType)
+		ps = protowire.AppendString(ps, msg)
+	}
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	return protowire.AppendBytes(b, ps)
+}
+
+// EncodeStatus кодирует google.rpc.Status — тело ответа OTLP/HTTP при ошибке запроса
+func EncodeStatus(mediaType string, code int32, msg string) []byte {
+	if mediaType == ContentTypeJSON {
+		b, _ := json.Marshal(struct {
+			Code    int32  `json:"code"`
+			Message string `json:"message"`
+		}{code, msg})
+		return b
+	}
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(code))
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	return protowire.AppendString(b, msg)
+}
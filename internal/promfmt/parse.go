@@ -0,0 +1,331 @@
+package promfmt
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+)
+
+// Типы семейств метрик в формате экспозиции
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+	TypeSummary   = "summary"
+	TypeUntyped   = "untyped"
+)
+
+// Sample — одна строка с значением
+type Sample struct {
+	Name   string
+	Labels models.Labels
+	Value  float64
+}
+
+// Family — семейство метрик: строки # HELP/# TYPE и относящиеся к ним значения
+type Family struct {
+	Name    string
+	Type    string
+	Help    string
+	Samples []Sample
+}
+
+// ParseError — ошибка разбора с номером строки (нумерация с 1)
+type ParseError struct {
+	Line int
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Parse разбирает текстовый формат экспозиции Prometheus (версия 0.0.4).
+// Метки времени в строках игнорируются. Значения _bucket, _sum, _count
+// относятся к семейству histogram/summary с базовым именем.
+func Parse(r io.Reader) ([]Family, error) {
+	var (
+		families []Family
+		index    = make(map[string]int)
+	)
+	family := func(name string) *Family {
+		i, ok := index[name]
+		if !ok {
+			i = len(families)
+			index[name] = i
+			families = append(families, Family{Name: name, Type: TypeUntyped})
+		}
+		return &families[i]
+	}
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line[1:])
+			if len(fields) < 3 {
+				continue
+			}
+			switch fields[0] {
+			case "TYPE":
+				switch fields[2] {
+				case TypeCounter, TypeGauge, TypeHistogram, TypeSummary, TypeUntyped:
+				default:
+					return nil, &ParseError{Line: lineNo, Err: fmt.Errorf("unknown metric type %q", fields[2])}
+				}
+				family(fields[1]).Type = fields[2]
+			case "HELP":
+				_, help, _ := strings.Cut(strings.TrimSpace(line[1:])[len("HELP "):], " ")
+				family(fields[1]).Help = help
+			}
+			continue
+		}
+
+		s, err := parseSample(line)
+		if err != nil {
+			return nil, &ParseError{Line: lineNo, Err: err}
+		}
+		f := family(familyName(s.Name, index, families))
+		f.Samples = append(f.Samples, s)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return families, nil
+}
+
+// familyName находит семейство для имени значения с учётом суффиксов histogram/summary
+// и суффикса _total у counter (OpenMetrics объявляет counter без него)
+func familyName(name string, index map[string]int, families []Family) string {
+	if _, ok := index[name]; ok {
+		return name
+	}
+	for _, suffix := range []string{"_bucket", "_sum", "_count", "_total"} {
+		base, ok := strings.CutSuffix(name, suffix)
+		if !ok {
+			continue
+		}
+		i, ok := index[base]
+		if !ok {
+			continue
+		}
+		switch t := families[i].Type; {
+		case suffix == "_total" && t == TypeCounter:
+			return base
+		case suffix != "_total" && (t == TypeHistogram || t == TypeSummary):
+			return base
+		}
+	}
+	return name
+}
+
+func parseSample(line string) (Sample, error) {
+	s := Sample{}
+	i := strings.IndexAny(line, "{ \t")
+	if i <= 0 {
+		return s, errors.New("expected metric name and value")
+	}
+	s.Name = line[:i]
+	rest := line[i:]
+
+	if rest[0] == '{' {
+		labels, n, err := parseLabels(rest)
+		if err != nil {
+			return s, err
+		}
+		s.Labels = labels
+		rest = rest[n:]
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return s, errors.New("expected value and optional timestamp")
+	}
+	v, err := parseValue(fields[0])
+	if err != nil {
+		return s, err
+	}
+	s.Value = v
+	return s, nil
+}
+
+// parseLabels разбирает блок {a="1",b="2"} и возвращает число прочитанных байт
+func parseLabels(s string) (models.Labels, int, error) {
+	labels := make(models.Labels)
+	i := 1
+	for {
+		for i < len(s) && (s[i] == ' ' || s[i] == ',') {
+			i++
+		}
+		if i >= len(s) {
+			return nil, 0, errors.New("unterminated label set")
+		}
+		if s[i] == '}' {
+			return labels, i + 1, nil
+		}
+
+		eq := strings.IndexByte(s[i:], '=')
+		if eq <= 0 {
+			return nil, 0, errors.New("expected label name")
+		}
+		name := strings.TrimSpace(s[i : i+eq])
+		i += eq + 1
+		if i >= len(s) || s[i] != '"' {
+			return nil, 0, fmt.Errorf("expected quoted value for label %q", name)
+		}
+		i++
+
+		var sb strings.Builder
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					sb.WriteByte('\n')
+				default:
+					sb.WriteByte(s[i])
+				}
+				continue
+			}
+			sb.WriteByte(s[i])
+		}
+		if i >= len(s) {
+			return nil, 0, fmt.Errorf("unterminated value for label %q", name)
+		}
+		i++
+		labels[name] = sb.String()
+	}
+}
+
+func parseValue(s string) (float64, error) {
+	switch s {
+	case "+Inf", "Inf":
+		return math.Inf(1), nil
+	case "-Inf":
+		return math.Inf(-1), nil
+	case "NaN":
+		return math.NaN(), nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return v, nil
+}
+
+// ToMetrics преобразует семейства в метрики. Counter значения — накопленные,
+// их нужно перевести в приращения (см. пакет cumulative). Histogram собирается
+// из серий _bucket/_sum/_count, summary разворачивается в gauge с меткой quantile.
+func ToMetrics(families []Family) []models.Metrics {
+	var res []models.Metrics
+	for _, f := range families {
+		switch f.Type {
+		case TypeCounter:
+			for _, s := range f.Samples {
+				if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+					continue
+				}
+				d := int64(math.Round(s.Value))
+				res = append(res, models.Metrics{ID: s.Name, MType: models.Counter, Delta: &d, Labels: s.Labels})
+			}
+		case TypeHistogram:
+			res = append(res, histograms(f)...)
+		default:
+			// gauge, untyped и развёрнутый summary
+			for _, s := range f.Samples {
+				v := s.Value
+				res = append(res, models.Metrics{ID: s.Name, MType: models.Gauge, Value: &v, Labels: s.Labels})
+			}
+		}
+	}
+	return res
+}
+
+// histograms собирает гистограммы семейства, группируя серии по меткам без le
+func histograms(f Family) []models.Metrics {
+	type acc struct {
+		labels  models.Labels
+		buckets map[float64]uint64
+		sum     float64
+		count   uint64
+	}
+	groups := make(map[string]*acc)
+	var order []string
+
+	for _, s := range f.Samples {
+		labels := s.Labels.Clone()
+		le := labels["le"]
+		delete(labels, "le")
+		key := labels.String()
+		a, ok := groups[key]
+		if !ok {
+			a = &acc{labels: labels, buckets: make(map[float64]uint64)}
+			groups[key] = a
+			order = append(order, key)
+		}
+		switch s.Name {
+		case f.Name + "_bucket":
+			bound, err := parseValue(le)
+			if err != nil {
+				continue
+			}
+			a.buckets[bound] = uint64(s.Value)
+		case f.Name + "_sum":
+			a.sum = s.Value
+		case f.Name + "_count":
+			a.count = uint64(s.Value)
+		}
+	}
+
+	var res []models.Metrics
+	for _, key := range order {
+		a := groups[key]
+		var bounds []float64
+		for b := range a.buckets {
+			if !math.IsInf(b, 1) {
+				bounds = append(bounds, b)
+			}
+		}
+		sort.Float64s(bounds)
+
+		h := models.NewHistogram(bounds)
+		var prev uint64
+		for i, b := range bounds {
+			c := a.buckets[b]
+			if c < prev {
+				c = prev
+			}
+			h.Counts[i] = c - prev
+			prev = c
+		}
+		if a.count < prev {
+			a.count = prev
+		}
+		h.Counts[len(bounds)] = a.count - prev
+		h.Count, h.Sum = a.count, a.sum
+
+		if len(a.labels) == 0 {
+			a.labels = nil
+		}
+		res = append(res, models.Metrics{ID: f.Name, MType: models.Histogram, Histogram: h, Labels: a.labels})
+	}
+	return res
+}
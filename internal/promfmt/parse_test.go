@@ -0,0 +1,103 @@
+package promfmt
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+)
+
+const exposition = `# HELP http_requests_total Total requests.
+# TYPE http_requests_total counter
+http_requests_total{method="GET",path="/a\"b"} 1027 1395066363000
+http_requests_total{method="POST"} 3
+# TYPE temperature gauge
+temperature -1.5
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 2
+latency_seconds_bucket{le="0.5"} 5
+latency_seconds_bucket{le="+Inf"} 6
+latency_seconds_sum 1.7
+latency_seconds_count 6
+# TYPE rpc_seconds summary
+rpc_seconds{quantile="0.5"} 0.01
+rpc_seconds_sum 12
+rpc_seconds_count 100
+# TYPE events counter
+events_total 7
+untyped_metric NaN
+`
+
+func TestParse(t *testing.T) {
+	families, err := Parse(strings.NewReader(exposition))
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+
+	byName := make(map[string]Family)
+	for _, f := range families {
+		byName[f.Name] = f
+	}
+
+	f := byName["http_requests_total"]
+	if f.Type != TypeCounter || f.Help != "Total requests." || len(f.Samples) != 2 {
+		t.Fatalf("Unexpected counter family %+v", f)
+	}
+	if f.Samples[0].Labels["path"] != `/a"b` || f.Samples[0].Value != 1027 {
+		t.Errorf("Unexpected sample %+v", f.Samples[0])
+	}
+	if len(byName["latency_seconds"].Samples) != 5 {
+		t.Errorf("Expected histogram series to be grouped, got %+v", byName["latency_seconds"])
+	}
+	if len(byName["rpc_seconds"].Samples) != 3 {
+		t.Errorf("Expected summary series to be grouped, got %+v", byName["rpc_seconds"])
+	}
+	if len(byName["events"].Samples) != 1 {
+		t.Errorf("Expected events_total to belong to counter family events")
+	}
+	if f := byName["untyped_metric"]; f.Type != TypeUntyped || !math.IsNaN(f.Samples[0].Value) {
+		t.Errorf("Unexpected untyped family %+v", f)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, s := range []string{
+		"metric{a=\"1\" 1",
+		"metric{a=1} 1",
+		"metric abc",
+		"# TYPE metric bogus",
+	} {
+		if _, err := Parse(strings.NewReader(s)); err == nil {
+			t.Errorf("Parse(%q): expected error", s)
+		}
+	}
+}
+
+func TestToMetrics(t *testing.T) {
+	families, err := Parse(strings.NewReader(exposition))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]models.Metrics)
+	for _, m := range ToMetrics(families) {
+		got[m.MType+" "+m.Key()] = m
+	}
+
+	if m, ok := got[models.Counter+` http_requests_total{method="POST"}`]; !ok || *m.Delta != 3 {
+		t.Errorf("Expected counter 3, got %+v", m)
+	}
+	if m, ok := got[models.Gauge+" temperature"]; !ok || *m.Value != -1.5 {
+		t.Errorf("Expected gauge -1.5, got %+v", m)
+	}
+	h := got[models.Histogram+" latency_seconds"].Histogram
+	if h == nil || h.Count != 6 || h.Sum != 1.7 || h.Counts[0] != 2 || h.Counts[1] != 3 || h.Counts[2] != 1 {
+		t.Errorf("Unexpected histogram %+v", h)
+	}
+	if h != nil && h.Validate() != nil {
+		t.Errorf("Histogram must be valid: %v", h.Validate())
+	}
+	if m, ok := got[models.Gauge+` rpc_seconds{quantile="0.5"}`]; !ok || *m.Value != 0.01 {
+		t.Errorf("Expected summary quantile as gauge, got %+v", m)
+	}
+}
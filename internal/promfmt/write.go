@@ -0,0 +1,183 @@
+// Package promfmt реализует текстовый формат экспозиции Prometheus.
+package promfmt
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+)
+
+// ContentType — тип содержимого текстового формата экспозиции
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// SummaryQuantiles — квантили, выводимые для метрик типа summary
+var SummaryQuantiles = []float64{0.5, 0.9, 0.95, 0.99}
+
+// Write выводит метрики в текстовом формате Prometheus. Серии группируются
+// в семейства по имени после SanitizeName и типу, строка # TYPE выводится один раз
+// на семейство. Серии, чьё имя занято семейством другого типа (в том числе
+// именами name_bucket, name_sum и name_count гистограмм и summary), и серии,
+// совпавшие после приведения имён (a.b и a_b), не выводятся: вывод остаётся
+// корректным, а число отброшенных серий возвращается в ошибке.
+func Write(w io.Writer, metrics []models.Metrics) error {
+	sorted := append([]models.Metrics(nil), metrics...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ni, nj := SanitizeName(sorted[i].ID), SanitizeName(sorted[j].ID)
+		if ni != nj {
+			return ni < nj
+		}
+		return sorted[i].Key() < sorted[j].Key()
+	})
+
+	bw := bufio.NewWriter(w)
+	// owners — семейство (тип и имя), которому принадлежит имя сэмпла
+	owners := make(map[string]string)
+	series := make(map[string]bool)
+	dropped := 0
+
+	for _, m := range sorted {
+		name := SanitizeName(m.ID)
+		family := m.MType + " " + name
+		owner, ok := owners[name]
+		if (ok && owner != family) || (!ok && !claim(owners, family, name, m.MType)) {
+			dropped++
+			continue
+		}
+		if !ok {
+			bw.WriteString("# TYPE " + name + " " + m.MType + "\n")
+		}
+		key := family + " " + models.SeriesKey(name, m.Labels)
+		if series[key] {
+			dropped++
+			continue
+		}
+		series[key] = true
+
+		switch m.MType {
+		case models.Gauge:
+			if m.Value != nil {
+				writeSample(bw, name, m.Labels, "", "", *m.Value)
+			}
+		case models.Counter:
+			if m.Delta != nil {
+				writeSample(bw, name, m.Labels, "", "", float64(*m.Delta))
+			}
+		case models.Histogram:
+			if h := m.Histogram; h != nil {
+				cum := h.Cumulative()
+				for i, bound := range h.Bounds {
+					writeSample(bw, name+"_bucket", m.Labels, "le", FormatFloat(bound), float64(cum[i]))
+				}
+				writeSample(bw, name+"_bucket", m.Labels, "le", "+Inf", float64(h.Count))
+				writeSample(bw, name+"_sum", m.Labels, "", "", h.Sum)
+				writeSample(bw, name+"_count", m.Labels, "", "", float64(h.Count))
+			}
+		case models.Summary:
+			if sk := m.Sketch; sk != nil {
+				for _, q := range SummaryQuantiles {
+					v, err := sk.Quantile(q)
+					if err != nil {
+						v = math.NaN()
+					}
+					writeSample(bw, name, m.Labels, "quantile", FormatFloat(q), v)
+				}
+				writeSample(bw, name+"_sum", m.Labels, "", "", sk.Sum)
+				writeSample(bw, name+"_count", m.Labels, "", "", float64(sk.Count))
+			}
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if dropped > 0 {
+		return fmt.Errorf("%d series dropped: metric names conflict after sanitizing", dropped)
+	}
+	return nil
+}
+
+// claim закрепляет имена сэмплов семейства family за ним; false — одно из имён
+// уже занято другим семейством
+func claim(owners map[string]string, family, name, mtype string) bool {
+	names := []string{name}
+	switch mtype {
+	case models.Histogram:
+		names = append(names, name+"_bucket", name+"_sum", name+"_count")
+	case models.Summary:
+		names = append(names, name+"_sum", name+"_count")
+	}
+	for _, n := range names {
+		if _, ok := owners[n]; ok {
+			return false
+		}
+	}
+	for _, n := range names {
+		owners[n] = family
+	}
+	return true
+}
+
+func writeSample(w *bufio.Writer, name string, labels models.Labels, extraName, extraValue string, value float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraName != "" {
+		w.WriteByte('{')
+		first := true
+		for _, k := range labels.Names() {
+			if !first {
+				w.WriteByte(',')
+			}
+			first = false
+			w.WriteString(k + `="` + escapeLabelValue(labels[k]) + `"`)
+		}
+		if extraName != "" {
+			if !first {
+				w.WriteByte(',')
+			}
+			w.WriteString(extraName + `="` + extraValue + `"`)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(FormatFloat(value))
+	w.WriteByte('\n')
+}
+
+// FormatFloat форматирует значение так, как его ожидает Prometheus
+func FormatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// SanitizeName заменяет недопустимые в имени метрики символы на '_'
+func SanitizeName(name string) string {
+	var sb strings.Builder
+	for i, r := range name {
+		valid := r == '_' || r == ':' ||
+			(r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') ||
+			(i > 0 && r >= '0' && r <= '9')
+		if valid {
+			sb.WriteRune(r)
+		} else {
+			sb.WriteByte('_')
+		}
+	}
+	return sb.String()
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(v string) string {
+	return labelValueEscaper.Replace(v)
+}
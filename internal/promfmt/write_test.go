@@ -0,0 +1,101 @@
+package promfmt
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/sketch"
+)
+
+func TestWrite(t *testing.T) {
+	value := 1.5
+	delta := int64(7)
+	h := models.NewHistogram([]float64{1, 5})
+	h.Observe(0.5)
+	h.Observe(3)
+	sk := sketch.New(sketch.DefaultAlpha)
+	sk.Add(2)
+
+	metrics := []models.Metrics{
+		{ID: "HeapAlloc", MType: models.Gauge, Value: &value, Labels: models.Labels{"host": "web1"}},
+		{ID: "PollCount", MType: models.Counter, Delta: &delta},
+		{ID: "GCPauseMs", MType: models.Histogram, Histogram: h},
+		{ID: "Latency", MType: models.Summary, Sketch: sk},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, metrics); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+	out := buf.String()
+
+	expectedLines := []string{
+		"# TYPE HeapAlloc gauge",
+		`HeapAlloc{host="web1"} 1.5`,
+		"# TYPE PollCount counter",
+		"PollCount 7",
+		"# TYPE GCPauseMs histogram",
+		`GCPauseMs_bucket{le="1"} 1`,
+		`GCPauseMs_bucket{le="5"} 2`,
+		`GCPauseMs_bucket{le="+Inf"} 2`,
+		"GCPauseMs_sum 3.5",
+		"GCPauseMs_count 2",
+		"# TYPE Latency summary",
+		`Latency{quantile="0.5"} 2`,
+		"Latency_count 1",
+	}
+	for _, line := range expectedLines {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("Expected line %q in output:\n%s", line, out)
+		}
+	}
+}
+
+func TestWriteNameConflicts(t *testing.T) {
+	one, two := 1.0, 2.0
+	delta := int64(3)
+	h := models.NewHistogram([]float64{1})
+	h.Observe(0.5)
+
+	metrics := []models.Metrics{
+		{ID: "a.b", MType: models.Gauge, Value: &one},
+		{ID: "a_b", MType: models.Gauge, Value: &two},                                  // та же серия после приведения имени
+		{ID: "a_b", MType: models.Gauge, Value: &two, Labels: models.Labels{"x": "1"}}, // другая серия того же семейства
+		{ID: "a_b", MType: models.Counter, Delta: &delta},                              // то же имя, другой тип
+		{ID: "latency", MType: models.Histogram, Histogram: h},
+		{ID: "latency_sum", MType: models.Gauge, Value: &one}, // занято сэмплом гистограммы
+	}
+
+	var buf bytes.Buffer
+	err := Write(&buf, metrics)
+	if err == nil || !strings.Contains(err.Error(), "3 series dropped") {
+		t.Errorf("Expected 3 dropped series in error, got %v", err)
+	}
+	out := buf.String()
+	if n := strings.Count(out, "# TYPE a_b "); n != 1 {
+		t.Errorf("Expected one TYPE line for a_b, got %d:\n%s", n, out)
+	}
+	if strings.Contains(out, "# TYPE latency_sum") || strings.Count(out, "latency_sum ") != 1 {
+		t.Errorf("Expected latency_sum only as histogram sample:\n%s", out)
+	}
+
+	// Вывод остаётся корректным для парсера
+	families, err := Parse(strings.NewReader(out))
+	if err != nil {
+		t.Fatalf("Output is not valid: %v\n%s", err, out)
+	}
+	if len(families) != 2 {
+		t.Errorf("Expected families a_b and latency, got %+v", families)
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	if got := SanitizeName("cpu.load-1m"); got != "cpu_load_1m" {
+		t.Errorf("Expected 'cpu_load_1m', got '%s'", got)
+	}
+	if got := SanitizeName("1abc"); got != "_abc" {
+		t.Errorf("Expected '_abc', got '%s'", got)
+	}
+}
@@ -0,0 +1,122 @@
+// Package ratelimit реализует ограничение частоты по ключам (клиент, токен, арендатор)
+// на основе token bucket.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter — набор token bucket по ключам: rate токенов в секунду, не больше burst.
+// Нулевой или nil Limiter ничего не ограничивает.
+type Limiter struct {
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// New создаёт Limiter. rate <= 0 отключает ограничение (возвращается nil);
+// burst < 1 заменяется на max(rate, 1).
+func New(rate float64, burst int) *Limiter {
+	if rate <= 0 {
+		return nil
+	}
+	b := float64(burst)
+	if b < 1 {
+		b = math.Max(rate, 1)
+	}
+	return &Limiter{
+		rate:    rate,
+		burst:   b,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow расходует один токен ключа key
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	return l.AllowN(key, 1)
+}
+
+// AllowN расходует n токенов ключа key. Если токенов не хватает, ничего не расходуется
+// и возвращается время до их появления. Запрос больше burst требует полного bucket.
+func (l *Limiter) AllowN(key string, n int) (bool, time.Duration) {
+	if l == nil || n <= 0 {
+		return true, 0
+	}
+	cost := math.Min(float64(n), l.burst)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < cost {
+		wait := (cost - b.tokens) / l.rate
+		return false, time.Duration(wait * float64(time.Second))
+	}
+	b.tokens -= cost
+	return true, 0
+}
+
+// GC удаляет bucket, которые успели заполниться: такой ключ неотличим от нового.
+// Возвращает число удалённых.
+func (l *Limiter) GC() int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	removed := 0
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Len возвращает число bucket
+func (l *Limiter) Len() int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// RunGC вызывает GC с интервалом interval до отмены контекста
+func (l *Limiter) RunGC(ctx context.Context, interval time.Duration) {
+	if l == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.GC()
+		}
+	}
+}
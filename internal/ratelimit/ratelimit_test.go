@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterAllowN(t *testing.T) {
+	l := New(10, 5)
+	now := time.Unix(1700000000, 0)
+	l.now = func() time.Time { return now }
+
+	if ok, _ := l.AllowN("a", 5); !ok {
+		t.Fatal("Expected full bucket to allow burst")
+	}
+	ok, wait := l.Allow("a")
+	if ok {
+		t.Fatal("Expected empty bucket to reject")
+	}
+	if wait != 100*time.Millisecond {
+		t.Errorf("Expected retry after 100ms, got %v", wait)
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Error("Buckets of different keys must be independent")
+	}
+
+	now = now.Add(200 * time.Millisecond)
+	if ok, _ := l.AllowN("a", 2); !ok {
+		t.Error("Expected 2 tokens to be refilled after 200ms")
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Error("Expected bucket to be empty again")
+	}
+
+	// Запрос больше burst проходит только при полном bucket
+	now = now.Add(time.Second)
+	if ok, _ := l.AllowN("a", 100); !ok {
+		t.Error("Expected oversized request to pass with a full bucket")
+	}
+}
+
+func TestLimiterDisabled(t *testing.T) {
+	l := New(0, 10)
+	if l != nil {
+		t.Fatal("Expected nil limiter for zero rate")
+	}
+	for i := 0; i < 100; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatal("Nil limiter must allow everything")
+		}
+	}
+}
+
+func TestLimiterGC(t *testing.T) {
+	l := New(1, 2)
+	now := time.Unix(1700000000, 0)
+	l.now = func() time.Time { return now }
+
+	l.AllowN("idle", 2)
+	l.AllowN("busy", 2)
+	now = now.Add(2 * time.Second)
+	l.AllowN("busy", 2)
+
+	if removed := l.GC(); removed != 1 || l.Len() != 1 {
+		t.Errorf("Expected only refilled bucket to be removed, removed %d, left %d", removed, l.Len())
+	}
+	if ok, _ := l.Allow("busy"); ok {
+		t.Error("GC must keep state of non-full buckets")
+	}
+}
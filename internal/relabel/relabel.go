@@ -0,0 +1,168 @@
+// Package relabel реализует правила переразметки меток в духе relabel_configs Prometheus.
+// Имя метрики доступно правилам как метка __name__.
+package relabel
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+)
+
+// NameLabel — служебная метка с именем метрики
+const NameLabel = "__name__"
+
+// Action — действие правила
+type Action string
+
+const (
+	// Replace записывает в target_label замену по regex от значения source_labels
+	Replace Action = "replace"
+	// Keep оставляет серию, только если значение source_labels совпадает с regex
+	Keep Action = "keep"
+	// Drop отбрасывает серию, если значение source_labels совпадает с regex
+	Drop Action = "drop"
+	// LabelDrop удаляет метки, имена которых совпадают с regex
+	LabelDrop Action = "labeldrop"
+	// LabelKeep оставляет только метки, имена которых совпадают с regex
+	LabelKeep Action = "labelkeep"
+	// LabelMap копирует метки, имена которых совпадают с regex, под именем replacement
+	LabelMap Action = "labelmap"
+)
+
+// Config — правило в формате YAML конфигурации
+type Config struct {
+	SourceLabels []string `yaml:"source_labels"`
+	Separator    string   `yaml:"separator"`
+	Regex        string   `yaml:"regex"`
+	TargetLabel  string   `yaml:"target_label"`
+	Replacement  *string  `yaml:"replacement"`
+	Action       Action   `yaml:"action"`
+}
+
+// Rule — скомпилированное правило
+type Rule struct {
+	sourceLabels []string
+	separator    string
+	regex        *regexp.Regexp
+	targetLabel  string
+	replacement  string
+	action       Action
+}
+
+// Compile проверяет правила и компилирует регулярные выражения.
+// Умолчания как в Prometheus: regex "(.*)", separator ";", replacement "$1", action replace.
+func Compile(cfgs []Config) ([]*Rule, error) {
+	rules := make([]*Rule, 0, len(cfgs))
+	for i, c := range cfgs {
+		r := &Rule{
+			sourceLabels: c.SourceLabels,
+			separator:    c.Separator,
+			targetLabel:  c.TargetLabel,
+			replacement:  "$1",
+			action:       c.Action,
+		}
+		if r.separator == "" {
+			r.separator = ";"
+		}
+		if c.Replacement != nil {
+			r.replacement = *c.Replacement
+		}
+		if r.action == "" {
+			r.action = Replace
+		}
+		expr := c.Regex
+		if expr == "" {
+			expr = "(.*)"
+		}
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("relabel rule %d: invalid regex: %w", i, err)
+		}
+		r.regex = re
+
+		switch r.action {
+		case Replace:
+			if r.targetLabel == "" {
+				return nil, fmt.Errorf("relabel rule %d: replace requires target_label", i)
+			}
+		case Keep, Drop:
+			if len(r.sourceLabels) == 0 {
+				return nil, fmt.Errorf("relabel rule %d: %s requires source_labels", i, r.action)
+			}
+		case LabelDrop, LabelKeep, LabelMap:
+		default:
+			return nil, fmt.Errorf("relabel rule %d: unknown action %q", i, r.action)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// Process применяет правила по порядку к копии меток.
+// Возвращает false, если серия отброшена правилом keep/drop.
+// Метки с пустым значением после применения удаляются.
+func Process(labels models.Labels, rules []*Rule) (models.Labels, bool) {
+	labels = labels.Clone()
+	if labels == nil {
+		labels = make(models.Labels)
+	}
+	for _, r := range rules {
+		if !r.apply(labels) {
+			return nil, false
+		}
+	}
+	for k, v := range labels {
+		if v == "" {
+			delete(labels, k)
+		}
+	}
+	return labels, true
+}
+
+func (r *Rule) apply(labels models.Labels) bool {
+	values := make([]string, len(r.sourceLabels))
+	for i, name := range r.sourceLabels {
+		values[i] = labels[name]
+	}
+	value := strings.Join(values, r.separator)
+
+	switch r.action {
+	case Keep:
+		return r.regex.MatchString(value)
+	case Drop:
+		return !r.regex.MatchString(value)
+	case Replace:
+		m := r.regex.FindStringSubmatchIndex(value)
+		if m == nil {
+			return true
+		}
+		target := string(r.regex.ExpandString(nil, r.targetLabel, value, m))
+		res := string(r.regex.ExpandString(nil, r.replacement, value, m))
+		if res == "" {
+			delete(labels, target)
+		} else {
+			labels[target] = res
+		}
+	case LabelDrop:
+		for name := range labels {
+			if name != NameLabel && r.regex.MatchString(name) {
+				delete(labels, name)
+			}
+		}
+	case LabelKeep:
+		for name := range labels {
+			if name != NameLabel && !r.regex.MatchString(name) {
+				delete(labels, name)
+			}
+		}
+	case LabelMap:
+		for name, v := range labels {
+			if r.regex.MatchString(name) {
+				labels[r.regex.ReplaceAllString(name, r.replacement)] = v
+			}
+		}
+	}
+	return true
+}
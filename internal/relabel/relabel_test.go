@@ -0,0 +1,67 @@
+package relabel
+
+import (
+	"testing"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+)
+
+func strPtr(s string) *string { return &s }
+
+func TestProcess(t *testing.T) {
+	rules, err := Compile([]Config{
+		{SourceLabels: []string{NameLabel}, Regex: "go_.*", Action: Drop},
+		{SourceLabels: []string{"device"}, Regex: `(sd[a-z]+)\d*`, TargetLabel: "disk"},
+		{SourceLabels: []string{NameLabel}, Regex: "node_(.*)", TargetLabel: NameLabel, Replacement: strPtr("host_$1")},
+		{Regex: "device", Action: LabelDrop},
+	})
+	if err != nil {
+		t.Fatalf("Compile() failed: %v", err)
+	}
+
+	labels, keep := Process(models.Labels{NameLabel: "node_disk_reads", "device": "sda1"}, rules)
+	if !keep {
+		t.Fatal("Expected series to be kept")
+	}
+	if labels[NameLabel] != "host_disk_reads" || labels["disk"] != "sda" {
+		t.Errorf("Unexpected labels %v", labels)
+	}
+	if _, ok := labels["device"]; ok {
+		t.Error("Expected device label to be dropped")
+	}
+
+	if _, keep := Process(models.Labels{NameLabel: "go_goroutines"}, rules); keep {
+		t.Error("Expected go_* series to be dropped")
+	}
+}
+
+func TestProcessKeepAndLabelMap(t *testing.T) {
+	rules, err := Compile([]Config{
+		{SourceLabels: []string{"env", "team"}, Separator: "/", Regex: "prod/.*", Action: Keep},
+		{Regex: "team", Replacement: strPtr("owner"), Action: LabelMap},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	labels, keep := Process(models.Labels{"env": "prod", "team": "billing"}, rules)
+	if !keep || labels["owner"] != "billing" || labels["team"] != "billing" {
+		t.Errorf("Unexpected result %v keep=%v", labels, keep)
+	}
+	if _, keep := Process(models.Labels{"env": "dev"}, rules); keep {
+		t.Error("Expected non-prod series to be dropped")
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, cfg := range []Config{
+		{Regex: "("},
+		{Action: Replace},
+		{Action: Keep},
+		{Action: "hashmod"},
+	} {
+		if _, err := Compile([]Config{cfg}); err == nil {
+			t.Errorf("Compile(%+v): expected error", cfg)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+// Package sketch реализует DDSketch — сливаемую структуру для оценки квантилей
+// с гарантированной относительной точностью.
+//
+// Значение v > 0 попадает в корзину с индексом ceil(log_γ(v)), где γ = (1+α)/(1-α).
+// Оценка квантиля по корзине отличается от истинного значения не более чем на α·v.
+// Скетчи с одинаковым α сливаются сложением счётчиков корзин, поэтому квантили
+// можно считать по данным нескольких агентов.
+package sketch
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// DefaultAlpha — относительная точность по умолчанию (1%)
+const DefaultAlpha = 0.01
+
+// minIndexable — значения по модулю меньше считаются нулём
+const minIndexable = 1e-9
+
+var (
+	ErrAlphaMismatch = errors.New("sketch relative accuracy mismatch")
+	ErrEmpty         = errors.New("sketch is empty")
+)
+
+// DDSketch хранит счётчики логарифмических корзин для положительных и отрицательных значений.
+// Поля экспортированы для передачи скетча в JSON.
+type DDSketch struct {
+	Alpha float64        `json:"alpha"`
+	Pos   map[int]uint64 `json:"pos,omitempty"`
+	Neg   map[int]uint64 `json:"neg,omitempty"`
+	Zero  uint64         `json:"zero,omitempty"`
+	Count uint64         `json:"count"`
+	Sum   float64        `json:"sum"`
+	Min   float64        `json:"min"`
+	Max   float64        `json:"max"`
+
+	// carry — дробная часть весов AddWithCount, ещё не попавшая в корзины
+	carry float64
+}
+
+// New создаёт пустой скетч с относительной точностью alpha
+func New(alpha float64) *DDSketch {
+	return &DDSketch{
+		Alpha: alpha,
+		Pos:   make(map[int]uint64),
+		Neg:   make(map[int]uint64),
+	}
+}
+
+func (s *DDSketch) gamma() float64 {
+	return (1 + s.Alpha) / (1 - s.Alpha)
+}
+
+func (s *DDSketch) index(v float64) int {
+	return int(math.Ceil(math.Log(v) / math.Log(s.gamma())))
+}
+
+// value возвращает представителя корзины с индексом i
+func (s *DDSketch) value(i int) float64 {
+	g := s.gamma()
+	return 2 * math.Pow(g, float64(i)) / (g + 1)
+}
+
+// Validate проверяет корректность скетча, полученного извне
+func (s *DDSketch) Validate() error {
+	if s.Alpha <= 0 || s.Alpha >= 1 {
+		return fmt.Errorf("invalid sketch alpha %v", s.Alpha)
+	}
+	total := s.Zero
+	for _, c := range s.Pos {
+		total += c
+	}
+	for _, c := range s.Neg {
+		total += c
+	}
+	if total != s.Count {
+		return fmt.Errorf("sketch count %d does not match bins total %d", s.Count, total)
+	}
+	return nil
+}
+
+// Add добавляет наблюдение
+func (s *DDSketch) Add(v float64) {
+	s.add(v, 1)
+}
+
+// AddWithCount добавляет наблюдение с весом count, например 1/rate для семплированных
+// значений. Счётчики корзин целые: дробная часть веса накапливается и переходит
+// в следующие наблюдения, поэтому суммарный вес сохраняется и при нецелом count.
+func (s *DDSketch) AddWithCount(v, count float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) || !(count > 0) || math.IsInf(count, 0) {
+		return
+	}
+	w := s.carry + count
+	n := math.Floor(w)
+	s.carry = w - n
+	if n > 0 {
+		s.add(v, uint64(n))
+	}
+}
+
+// add добавляет n одинаковых наблюдений v
+func (s *DDSketch) add(v float64, n uint64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+	switch {
+	case v > minIndexable:
+		if s.Pos == nil {
+			s.Pos = make(map[int]uint64)
+		}
+		s.Pos[s.index(v)] += n
+	case v < -minIndexable:
+		if s.Neg == nil {
+			s.Neg = make(map[int]uint64)
+		}
+		s.Neg[s.index(-v)] += n
+	default:
+		s.Zero += n
+	}
+
+	if s.Count == 0 || v < s.Min {
+		s.Min = v
+	}
+	if s.Count == 0 || v > s.Max {
+		s.Max = v
+	}
+	s.Count += n
+	s.Sum += v * float64(n)
+}
+
+// Merge добавляет к скетчу наблюдения other. Точность скетчей должна совпадать.
+func (s *DDSketch) Merge(other *DDSketch) error {
+	if other == nil || other.Count == 0 {
+		return nil
+	}
+	if s.Alpha != other.Alpha {
+		return ErrAlphaMismatch
+	}
+	if s.Pos == nil {
+		s.Pos = make(map[int]uint64)
+	}
+	if s.Neg == nil {
+		s.Neg = make(map[int]uint64)
+	}
+	for i, c := range other.Pos {
+		s.Pos[i] += c
+	}
+	for i, c := range other.Neg {
+		s.Neg[i] += c
+	}
+	s.Zero += other.Zero
+
+	if s.Count == 0 || other.Min < s.Min {
+		s.Min = other.Min
+	}
+	if s.Count == 0 || other.Max > s.Max {
+		s.Max = other.Max
+	}
+	s.Count += other.Count
+	s.Sum += other.Sum
+	return nil
+}
+
+// Clone возвращает глубокую копию скетча
+func (s *DDSketch) Clone() *DDSketch {
+	c := *s
+	c.Pos = make(map[int]uint64, len(s.Pos))
+	for i, v := range s.Pos {
+		c.Pos[i] = v
+	}
+	c.Neg = make(map[int]uint64, len(s.Neg))
+	for i, v := range s.Neg {
+		c.Neg[i] = v
+	}
+	return &c
+}
+
+// Quantile возвращает оценку квантиля q из [0, 1]
+func (s *DDSketch) Quantile(q float64) (float64, error) {
+	if s.Count == 0 {
+		return 0, ErrEmpty
+	}
+	if q < 0 || q > 1 {
+		return 0, fmt.Errorf("quantile %v out of range [0, 1]", q)
+	}
+
+	rank := q * float64(s.Count-1)
+	var seen float64
+
+	// Отрицательные значения: от больших по модулю к меньшим
+	negIdx := sortedKeys(s.Neg)
+	for i := len(negIdx) - 1; i >= 0; i-- {
+		seen += float64(s.Neg[negIdx[i]])
+		if seen > rank {
+			return s.clamp(-s.value(negIdx[i])), nil
+		}
+	}
+
+	seen += float64(s.Zero)
+	if seen > rank {
+		return s.clamp(0), nil
+	}
+
+	for _, i := range sortedKeys(s.Pos) {
+		seen += float64(s.Pos[i])
+		if seen > rank {
+			return s.clamp(s.value(i)), nil
+		}
+	}
+	return s.Max, nil
+}
+
+func (s *DDSketch) clamp(v float64) float64 {
+	return math.Max(s.Min, math.Min(s.Max, v))
+}
+
+func sortedKeys(m map[int]uint64) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
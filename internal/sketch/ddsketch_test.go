@@ -0,0 +1,138 @@
+package sketch
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestQuantileAccuracy(t *testing.T) {
+	s := New(DefaultAlpha)
+	for i := 1; i <= 10000; i++ {
+		s.Add(float64(i))
+	}
+
+	for _, q := range []float64{0.5, 0.95, 0.99} {
+		got, err := s.Quantile(q)
+		if err != nil {
+			t.Fatalf("Quantile(%v) failed: %v", q, err)
+		}
+		expected := q*9999 + 1
+		if math.Abs(got-expected)/expected > DefaultAlpha {
+			t.Errorf("Quantile(%v) = %v, expected %v within %v relative error", q, got, expected, DefaultAlpha)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	// Два "агента" отправляют половины одного и того же набора наблюдений
+	a, b, all := New(DefaultAlpha), New(DefaultAlpha), New(DefaultAlpha)
+	for i := 1; i <= 1000; i++ {
+		v := float64(i) / 10
+		if i%2 == 0 {
+			a.Add(v)
+		} else {
+			b.Add(v)
+		}
+		all.Add(v)
+	}
+
+	if err := a.Merge(b); err != nil {
+		t.Fatalf("Merge() failed: %v", err)
+	}
+	if a.Count != all.Count {
+		t.Errorf("Expected count %d, got %d", all.Count, a.Count)
+	}
+	for _, q := range []float64{0.5, 0.99} {
+		got, _ := a.Quantile(q)
+		want, _ := all.Quantile(q)
+		if got != want {
+			t.Errorf("Quantile(%v) after merge = %v, expected %v", q, got, want)
+		}
+	}
+
+	if err := a.Merge(New(0.05)); err != nil {
+		t.Errorf("Merging empty sketch should be a no-op, got %v", err)
+	}
+	other := New(0.05)
+	other.Add(1)
+	if err := a.Merge(other); err != ErrAlphaMismatch {
+		t.Errorf("Expected ErrAlphaMismatch, got %v", err)
+	}
+}
+
+func TestNegativeAndZero(t *testing.T) {
+	s := New(DefaultAlpha)
+	for _, v := range []float64{-10, -1, 0, 1, 10} {
+		s.Add(v)
+	}
+
+	if got, _ := s.Quantile(0); got != -10 {
+		t.Errorf("Expected min -10, got %v", got)
+	}
+	if got, _ := s.Quantile(0.5); got != 0 {
+		t.Errorf("Expected median 0, got %v", got)
+	}
+	if got, _ := s.Quantile(1); got != 10 {
+		t.Errorf("Expected max 10, got %v", got)
+	}
+}
+
+func TestAddWithCount(t *testing.T) {
+	// Вес 1/0.3: за 30 наблюдений накапливается ровно 100 без потерь на округлении
+	s := New(DefaultAlpha)
+	for i := 0; i < 30; i++ {
+		s.AddWithCount(float64(i%3+1), 1/0.3)
+	}
+	if s.Count != 100 {
+		t.Errorf("Expected total weight 100, got %d", s.Count)
+	}
+	if err := s.Validate(); err != nil {
+		t.Errorf("Weighted sketch is invalid: %v", err)
+	}
+	if s.Min != 1 || s.Max != 3 {
+		t.Errorf("Expected min 1 and max 3, got %v %v", s.Min, s.Max)
+	}
+
+	// Целый вес равен повторному Add
+	weighted, repeated := New(DefaultAlpha), New(DefaultAlpha)
+	weighted.AddWithCount(42, 4)
+	for i := 0; i < 4; i++ {
+		repeated.Add(42)
+	}
+	if weighted.Count != repeated.Count || weighted.Sum != repeated.Sum || weighted.Pos[weighted.index(42)] != 4 {
+		t.Errorf("Expected AddWithCount(v, 4) to match four Add calls, got %+v", weighted)
+	}
+
+	// Недопустимый вес игнорируется
+	weighted.AddWithCount(1, 0)
+	weighted.AddWithCount(1, -1)
+	if weighted.Count != 4 {
+		t.Errorf("Expected non-positive weights to be ignored, got count %d", weighted.Count)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	s := New(DefaultAlpha)
+	for i := 1; i <= 100; i++ {
+		s.Add(float64(i))
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var decoded DDSketch
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if err := decoded.Validate(); err != nil {
+		t.Errorf("Decoded sketch is invalid: %v", err)
+	}
+
+	want, _ := s.Quantile(0.9)
+	got, _ := decoded.Quantile(0.9)
+	if got != want {
+		t.Errorf("Expected p90 %v after round trip, got %v", want, got)
+	}
+}
@@ -0,0 +1,178 @@
+package statsd
+
+import (
+	"sync"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/sketch"
+)
+
+const (
+	// DefaultGaugeExpiry — число сбросов без обновлений, после которого gauge забывается
+	DefaultGaugeExpiry = 60
+	// maxCounterCarry — предел числа дробных остатков удалённых счётчиков
+	maxCounterCarry = 10000
+)
+
+type counterAgg struct {
+	name   string
+	labels models.Labels
+	sum    float64
+}
+
+type gaugeAgg struct {
+	name    string
+	labels  models.Labels
+	value   float64
+	updated bool
+	// idle — число сбросов подряд без обновлений
+	idle int
+}
+
+type timerAgg struct {
+	name   string
+	labels models.Labels
+	sketch *sketch.DDSketch
+}
+
+type setAgg struct {
+	name    string
+	labels  models.Labels
+	members map[string]struct{}
+}
+
+// Aggregator накапливает наблюдения за интервал сброса:
+// counter — сумма с учётом частоты семплирования, gauge — последнее значение,
+// таймеры — скетч квантилей, set — число уникальных элементов.
+// Счётчики без наблюдений за интервал удаляются, их дробный остаток хранится
+// в carry (не более maxCounterCarry серий); gauge удаляются после gaugeExpiry
+// сбросов без обновлений.
+type Aggregator struct {
+	mu       sync.Mutex
+	counters map[string]*counterAgg
+	carry    map[string]float64
+	gauges   map[string]*gaugeAgg
+	timers   map[string]*timerAgg
+	sets     map[string]*setAgg
+
+	gaugeExpiry int
+}
+
+func NewAggregator() *Aggregator {
+	return &Aggregator{
+		counters:    make(map[string]*counterAgg),
+		carry:       make(map[string]float64),
+		gauges:      make(map[string]*gaugeAgg),
+		timers:      make(map[string]*timerAgg),
+		sets:        make(map[string]*setAgg),
+		gaugeExpiry: DefaultGaugeExpiry,
+	}
+}
+
+// SetGaugeExpiry задаёт число сбросов без обновлений, после которого gauge
+// удаляется: относительное изменение затем применяется к нулю. 0 — не удалять.
+func (a *Aggregator) SetGaugeExpiry(flushes int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.gaugeExpiry = flushes
+}
+
+// Add учитывает наблюдение
+func (a *Aggregator) Add(s Sample) {
+	key := models.SeriesKey(s.Name, s.Tags)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch s.Type {
+	case TypeCounter:
+		c, ok := a.counters[key]
+		if !ok {
+			c = &counterAgg{name: s.Name, labels: s.Tags, sum: a.carry[key]}
+			delete(a.carry, key)
+			a.counters[key] = c
+		}
+		c.sum += s.Value / s.Rate
+
+	case TypeGauge:
+		// Gauge сохраняется между сбросами, чтобы относительные изменения
+		// применялись к последнему известному значению
+		g, ok := a.gauges[key]
+		if !ok {
+			g = &gaugeAgg{name: s.Name, labels: s.Tags}
+			a.gauges[key] = g
+		}
+		if s.Relative {
+			g.value += s.Value
+		} else {
+			g.value = s.Value
+		}
+		g.updated = true
+		g.idle = 0
+
+	case TypeTimer, TypeHisto, TypeDistr:
+		t, ok := a.timers[key]
+		if !ok {
+			t = &timerAgg{name: s.Name, labels: s.Tags, sketch: sketch.New(sketch.DefaultAlpha)}
+			a.timers[key] = t
+		}
+		// При семплировании каждое наблюдение учитывается с весом 1/rate
+		t.sketch.AddWithCount(s.Value, 1/s.Rate)
+
+	case TypeSet:
+		st, ok := a.sets[key]
+		if !ok {
+			st = &setAgg{name: s.Name, labels: s.Tags, members: make(map[string]struct{})}
+			a.sets[key] = st
+		}
+		st.members[s.SetValue] = struct{}{}
+	}
+}
+
+// Flush возвращает агрегаты за прошедший интервал и начинает новый.
+// Дробная часть счётчиков переносится в следующий интервал.
+func (a *Aggregator) Flush() []models.Metrics {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var res []models.Metrics
+
+	for key, c := range a.counters {
+		delta := int64(c.sum)
+		if delta != 0 {
+			c.sum -= float64(delta)
+			res = append(res, models.Metrics{ID: c.name, MType: models.Counter, Delta: &delta, Labels: c.labels})
+		}
+		// Остаток ждёт следующего наблюдения серии; при заполненном carry отбрасывается
+		if c.sum != 0 && len(a.carry) < maxCounterCarry {
+			a.carry[key] = c.sum
+		}
+	}
+	a.counters = make(map[string]*counterAgg)
+
+	for key, g := range a.gauges {
+		if !g.updated {
+			g.idle++
+			if a.gaugeExpiry > 0 && g.idle >= a.gaugeExpiry {
+				delete(a.gauges, key)
+			}
+			continue
+		}
+		g.updated = false
+		v := g.value
+		res = append(res, models.Metrics{ID: g.name, MType: models.Gauge, Value: &v, Labels: g.labels})
+	}
+
+	for _, t := range a.timers {
+		res = append(res, models.Metrics{ID: t.name, MType: models.Summary, Sketch: t.sketch, Labels: t.labels})
+	}
+	a.timers = make(map[string]*timerAgg)
+
+	for _, st := range a.sets {
+		v := float64(len(st.members))
+		res = append(res, models.Metrics{ID: st.name, MType: models.Gauge, Value: &v, Labels: st.labels})
+	}
+	a.sets = make(map[string]*setAgg)
+
+	return res
+}
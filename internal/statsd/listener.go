@@ -0,0 +1,203 @@
+package statsd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/logger"
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/telemetry"
+)
+
+// maxPacketSize — максимальный размер UDP датаграммы
+const maxPacketSize = 65535
+
+// Writer — путь записи метрик сервера
+type Writer interface {
+	WriteMetric(m models.Metrics) error
+}
+
+// Listener принимает StatsD строки по UDP и сбрасывает агрегаты в Writer
+// каждые flushInterval
+type Listener struct {
+	addr          string
+	flushInterval time.Duration
+	writer        Writer
+	agg           *Aggregator
+
+	mu   sync.Mutex
+	conn net.PacketConn
+
+	registry    *telemetry.Registry
+	packets     *telemetry.Counter
+	lines       *telemetry.Counter
+	writeErrors *telemetry.Counter
+	log         zerolog.Logger
+}
+
+func NewListener(addr string, flushInterval time.Duration, writer Writer, registry *telemetry.Registry) *Listener {
+	return &Listener{
+		addr:          addr,
+		flushInterval: flushInterval,
+		writer:        writer,
+		agg:           NewAggregator(),
+		registry:      registry,
+		packets:       registry.Counter("statsd_packets_total", nil),
+		lines:         registry.Counter("statsd_lines_total", nil),
+		writeErrors:   registry.Counter("statsd_write_errors_total", nil),
+		log:           logger.GetLogger(),
+	}
+}
+
+// Listen открывает UDP сокет
+func (l *Listener) Listen() error {
+	conn, err := net.ListenPacket("udp", l.addr)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	l.conn = conn
+	l.mu.Unlock()
+	return nil
+}
+
+// SetGaugeExpiry задаёт число сбросов без обновлений, после которого gauge удаляется
+func (l *Listener) SetGaugeExpiry(flushes int) {
+	l.agg.SetGaugeExpiry(flushes)
+}
+
+// Addr возвращает фактический адрес сокета (после Listen)
+func (l *Listener) Addr() net.Addr {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn == nil {
+		return nil
+	}
+	return l.conn.LocalAddr()
+}
+
+// Serve читает датаграммы до отмены контекста или закрытия сокета.
+// При завершении выполняется финальный сброс агрегатов.
+func (l *Listener) Serve(ctx context.Context) error {
+	l.mu.Lock()
+	conn := l.conn
+	l.mu.Unlock()
+	if conn == nil {
+		return errors.New("statsd: listener is not bound")
+	}
+
+	flushCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(l.flushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-flushCtx.Done():
+				return
+			case <-ticker.C:
+				l.Flush()
+			}
+		}
+	}()
+
+	// Закрываем сокет по отмене контекста, чтобы прервать ReadFrom
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	buf := make([]byte, maxPacketSize)
+	var err error
+	for {
+		var n int
+		n, _, err = conn.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		l.packets.Inc()
+		l.handlePacket(string(buf[:n]))
+	}
+
+	cancel()
+	wg.Wait()
+	l.Flush()
+
+	if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// ListenAndServe открывает сокет и обслуживает его до отмены контекста
+func (l *Listener) ListenAndServe(ctx context.Context) error {
+	if err := l.Listen(); err != nil {
+		return err
+	}
+	return l.Serve(ctx)
+}
+
+// Close закрывает сокет; Serve завершится после финального сброса
+func (l *Listener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn == nil {
+		return nil
+	}
+	return l.conn.Close()
+}
+
+func (l *Listener) handlePacket(packet string) {
+	for _, line := range strings.Split(packet, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		l.lines.Inc()
+
+		samples, err := ParseLine(line)
+		if err != nil {
+			reason := ReasonFormat
+			var pe *ParseError
+			if errors.As(err, &pe) {
+				reason = pe.Reason
+			}
+			l.registry.Counter("statsd_parse_errors_total", models.Labels{"reason": reason}).Inc()
+			continue
+		}
+		for _, s := range samples {
+			l.agg.Add(s)
+		}
+	}
+}
+
+// Flush передаёт накопленные агрегаты в Writer. Ошибки записи учитываются
+// в statsd_write_errors_total, в журнал пишется одна строка за сброс с первой ошибкой.
+func (l *Listener) Flush() {
+	metrics := l.agg.Flush()
+	var (
+		failed int
+		first  error
+	)
+	for _, m := range metrics {
+		if err := l.writer.WriteMetric(m); err != nil {
+			l.writeErrors.Inc()
+			if failed == 0 {
+				first = fmt.Errorf("%s %s: %w", m.MType, m.Key(), err)
+			}
+			failed++
+		}
+	}
+	if failed > 0 {
+		l.log.Warn().Err(first).Int("failed", failed).Int("total", len(metrics)).Msg("statsd: failed to write metrics")
+	}
+}
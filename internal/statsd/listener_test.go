@@ -0,0 +1,192 @@
+package statsd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/telemetry"
+)
+
+type memWriter struct {
+	mu      sync.Mutex
+	metrics map[string]models.Metrics
+}
+
+func (w *memWriter) WriteMetric(m models.Metrics) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.metrics[m.MType+":"+m.Key()] = m
+	return nil
+}
+
+func TestAggregatorFlush(t *testing.T) {
+	agg := NewAggregator()
+	for _, line := range []string{
+		"hits:1|c", "hits:1|c|@0.5", "temp:10|g", "temp:+5|g",
+		"latency:10|ms", "latency:20|ms", "sampled:5|ms|@0.3", "sampled:5|ms|@0.3", "sampled:5|ms|@0.3",
+		"users:a|s", "users:b|s", "users:a|s",
+	} {
+		samples, err := ParseLine(line)
+		if err != nil {
+			t.Fatalf("ParseLine(%q) failed: %v", line, err)
+		}
+		for _, s := range samples {
+			agg.Add(s)
+		}
+	}
+
+	byKey := make(map[string]models.Metrics)
+	for _, m := range agg.Flush() {
+		byKey[m.MType+":"+m.Key()] = m
+	}
+
+	if m := byKey["counter:hits"]; m.Delta == nil || *m.Delta != 3 {
+		t.Errorf("Expected hits = 3 (1 + 1/0.5), got %+v", m)
+	}
+	if m := byKey["gauge:temp"]; m.Value == nil || *m.Value != 15 {
+		t.Errorf("Expected temp = 15, got %+v", m)
+	}
+	if m := byKey["summary:latency"]; m.Sketch == nil || m.Sketch.Count != 2 {
+		t.Errorf("Expected latency summary with 2 observations, got %+v", m)
+	}
+	// Вес 1/0.3 не округляется до 3 на каждом наблюдении: три значения дают 10
+	if m := byKey["summary:sampled"]; m.Sketch == nil || m.Sketch.Count != 10 {
+		t.Errorf("Expected sampled summary with weight 10, got %+v", m)
+	}
+	if m := byKey["gauge:users"]; m.Value == nil || *m.Value != 2 {
+		t.Errorf("Expected 2 unique users, got %+v", m)
+	}
+
+	// Без новых наблюдений следующий сброс пуст
+	if res := agg.Flush(); len(res) != 0 {
+		t.Errorf("Expected empty flush, got %d metrics", len(res))
+	}
+}
+
+func addLines(t *testing.T, agg *Aggregator, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		samples, err := ParseLine(line)
+		if err != nil {
+			t.Fatalf("ParseLine(%q) failed: %v", line, err)
+		}
+		for _, s := range samples {
+			agg.Add(s)
+		}
+	}
+}
+
+func TestAggregatorPrunesIdleCounters(t *testing.T) {
+	agg := NewAggregator()
+	addLines(t, agg, "hits:1|c|@0.3", "rare:1|c|@0.5")
+	agg.Flush()
+
+	// Счётчики без наблюдений удаляются, дробный остаток переносится в carry
+	if len(agg.counters) != 0 || len(agg.carry) != 1 {
+		t.Fatalf("Expected idle counters pruned and one remainder carried, got %d counters, carry %v", len(agg.counters), agg.carry)
+	}
+	if res := agg.Flush(); len(res) != 0 {
+		t.Errorf("Expected empty flush, got %+v", res)
+	}
+
+	// Остаток 1/0.3 - 3 учитывается при следующем наблюдении серии
+	addLines(t, agg, "hits:1|c|@0.3", "hits:1|c|@0.3")
+	res := agg.Flush()
+	if len(res) != 1 || *res[0].Delta != 7 {
+		t.Errorf("Expected hits = 7 with carried remainder, got %+v", res)
+	}
+}
+
+func TestAggregatorExpiresIdleGauges(t *testing.T) {
+	agg := NewAggregator()
+	agg.SetGaugeExpiry(2)
+	addLines(t, agg, "temp:10|g", "load:1|g")
+	agg.Flush()
+
+	addLines(t, agg, "load:2|g")
+	agg.Flush()
+	agg.Flush()
+	if _, ok := agg.gauges["temp"]; ok {
+		t.Error("Expected gauge idle for 2 flushes to expire")
+	}
+	if _, ok := agg.gauges["load"]; !ok {
+		t.Error("Expected recently updated gauge to be kept")
+	}
+
+	// Относительное изменение забытого gauge применяется к нулю
+	addLines(t, agg, "temp:+5|g")
+	res := agg.Flush()
+	if len(res) != 1 || *res[0].Value != 5 {
+		t.Errorf("Expected temp = 5 after expiry, got %+v", res)
+	}
+}
+
+func TestListener(t *testing.T) {
+	writer := &memWriter{metrics: make(map[string]models.Metrics)}
+	registry := telemetry.NewRegistry()
+	listener := NewListener("127.0.0.1:0", time.Hour, writer, registry)
+	if err := listener.Listen(); err != nil {
+		t.Fatalf("Listen() failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- listener.Serve(ctx) }()
+
+	conn, err := net.Dial("udp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("jobs:2|c|#queue:mail\njobs:3|c|#queue:mail\nbroken line\n"))
+
+	// Ждём, пока пакет будет обработан
+	deadline := time.Now().Add(2 * time.Second)
+	for registry.Counter("statsd_lines_total", nil).Value() < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Остановка выполняет финальный сброс
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Serve() returned error: %v", err)
+	}
+
+	m, ok := writer.metrics["counter:"+models.SeriesKey("jobs", models.Labels{"queue": "mail"})]
+	if !ok || *m.Delta != 5 {
+		t.Errorf("Expected jobs{queue=mail} = 5, got %+v", writer.metrics)
+	}
+	if v := registry.Counter("statsd_parse_errors_total", models.Labels{"reason": ReasonFormat}).Value(); v != 1 {
+		t.Errorf("Expected 1 parse error, got %d", v)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) WriteMetric(models.Metrics) error { return errors.New("series limit exceeded") }
+
+func TestListenerFlushErrorsSummarized(t *testing.T) {
+	registry := telemetry.NewRegistry()
+	listener := NewListener("127.0.0.1:0", time.Hour, failingWriter{}, registry)
+	var buf bytes.Buffer
+	listener.log = zerolog.New(&buf)
+
+	listener.handlePacket("a:1|c\nb:2|c\nc:3|g\n")
+	listener.Flush()
+
+	if v := registry.Counter("statsd_write_errors_total", nil).Value(); v != 3 {
+		t.Errorf("Expected 3 write errors, got %d", v)
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 1 || !strings.Contains(buf.String(), `"failed":3`) {
+		t.Errorf("Expected one summary line for the flush, got:\n%s", buf.String())
+	}
+}
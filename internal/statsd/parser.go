@@ -0,0 +1,139 @@
+// Package statsd принимает метрики в формате StatsD/DogStatsD по UDP,
+// агрегирует их за интервал сброса и передаёт в общий путь записи сервера.
+package statsd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+)
+
+// Типы StatsD метрик
+const (
+	TypeCounter = "c"
+	TypeGauge   = "g"
+	TypeTimer   = "ms"
+	TypeHisto   = "h" // DogStatsD, обрабатывается как таймер
+	TypeDistr   = "d" // DogStatsD distribution, обрабатывается как таймер
+	TypeSet     = "s"
+)
+
+// Причины ошибок разбора, используются как метка счётчика ошибок
+const (
+	ReasonFormat     = "invalid_format"
+	ReasonValue      = "invalid_value"
+	ReasonType       = "invalid_type"
+	ReasonSampleRate = "invalid_sample_rate"
+	ReasonTags       = "invalid_tags"
+)
+
+// ParseError — ошибка разбора строки с причиной
+type ParseError struct {
+	Reason string
+	Line   string
+	Msg    string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("statsd: %s: %q", e.Msg, e.Line)
+}
+
+// Sample — одно наблюдение из строки StatsD
+type Sample struct {
+	Name string
+	Type string
+	// Value — числовое значение (для set не используется)
+	Value float64
+	// SetValue — элемент множества для типа s
+	SetValue string
+	// Relative — gauge задан относительным изменением (+N или -N)
+	Relative bool
+	// Rate — частота семплирования из @rate, по умолчанию 1
+	Rate float64
+	Tags models.Labels
+}
+
+// ParseLine разбирает строку вида `name:value|type[|@rate][|#tag:val,tag2]`.
+// DogStatsD допускает несколько значений через ':' — возвращается по одному Sample на значение.
+func ParseLine(line string) ([]Sample, error) {
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" || rest == "" {
+		return nil, &ParseError{Reason: ReasonFormat, Line: line, Msg: "expected name:value|type"}
+	}
+
+	fields := strings.Split(rest, "|")
+	if len(fields) < 2 {
+		return nil, &ParseError{Reason: ReasonFormat, Line: line, Msg: "missing metric type"}
+	}
+
+	mtype := fields[1]
+	switch mtype {
+	case TypeCounter, TypeGauge, TypeTimer, TypeHisto, TypeDistr, TypeSet:
+	default:
+		return nil, &ParseError{Reason: ReasonType, Line: line, Msg: "unknown metric type " + mtype}
+	}
+
+	rate := 1.0
+	var tags models.Labels
+	for _, f := range fields[2:] {
+		switch {
+		case strings.HasPrefix(f, "@"):
+			r, err := strconv.ParseFloat(f[1:], 64)
+			if err != nil || r <= 0 || r > 1 {
+				return nil, &ParseError{Reason: ReasonSampleRate, Line: line, Msg: "invalid sample rate " + f}
+			}
+			rate = r
+		case strings.HasPrefix(f, "#"):
+			t, err := parseTags(f[1:])
+			if err != nil {
+				return nil, &ParseError{Reason: ReasonTags, Line: line, Msg: err.Error()}
+			}
+			tags = t
+		case f == "":
+		default:
+			// Прочие расширения DogStatsD (|c:container, |T timestamp) игнорируются
+		}
+	}
+
+	var samples []Sample
+	for _, raw := range strings.Split(fields[0], ":") {
+		s := Sample{Name: name, Type: mtype, Rate: rate, Tags: tags}
+		if mtype == TypeSet {
+			s.SetValue = raw
+			samples = append(samples, s)
+			continue
+		}
+		if mtype == TypeGauge && (strings.HasPrefix(raw, "+") || strings.HasPrefix(raw, "-")) {
+			s.Relative = true
+		}
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, &ParseError{Reason: ReasonValue, Line: line, Msg: "invalid value " + raw}
+		}
+		s.Value = v
+		samples = append(samples, s)
+	}
+	return samples, nil
+}
+
+// parseTags разбирает теги DogStatsD `key:value,key2`. Тег без значения получает значение "true".
+func parseTags(s string) (models.Labels, error) {
+	tags := make(models.Labels)
+	for _, t := range strings.Split(s, ",") {
+		if t == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(t, ":")
+		if !ok {
+			v = "true"
+		}
+		k = models.SanitizeLabelName(k)
+		if k == "" {
+			return nil, fmt.Errorf("empty tag name in %q", t)
+		}
+		tags[k] = v
+	}
+	return tags, nil
+}
@@ -0,0 +1,83 @@
+package statsd
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line     string
+		name     string
+		mtype    string
+		value    float64
+		rate     float64
+		relative bool
+		tags     map[string]string
+	}{
+		{line: "requests:1|c", name: "requests", mtype: TypeCounter, value: 1, rate: 1},
+		{line: "requests:3|c|@0.1", name: "requests", mtype: TypeCounter, value: 3, rate: 0.1},
+		{line: "temp:21.5|g", name: "temp", mtype: TypeGauge, value: 21.5, rate: 1},
+		{line: "temp:-2|g", name: "temp", mtype: TypeGauge, value: -2, rate: 1, relative: true},
+		{line: "latency:320|ms|@0.5", name: "latency", mtype: TypeTimer, value: 320, rate: 0.5},
+		{
+			line: "page.views:1|c|#env:prod,host:web-1,canary", name: "page.views", mtype: TypeCounter, value: 1, rate: 1,
+			tags: map[string]string{"env": "prod", "host": "web-1", "canary": "true"},
+		},
+	}
+
+	for _, tt := range tests {
+		samples, err := ParseLine(tt.line)
+		if err != nil {
+			t.Errorf("ParseLine(%q) failed: %v", tt.line, err)
+			continue
+		}
+		if len(samples) != 1 {
+			t.Errorf("ParseLine(%q): expected 1 sample, got %d", tt.line, len(samples))
+			continue
+		}
+		s := samples[0]
+		if s.Name != tt.name || s.Type != tt.mtype || s.Value != tt.value || s.Rate != tt.rate || s.Relative != tt.relative {
+			t.Errorf("ParseLine(%q) = %+v", tt.line, s)
+		}
+		for k, v := range tt.tags {
+			if s.Tags[k] != v {
+				t.Errorf("ParseLine(%q): expected tag %s=%s, got %v", tt.line, k, v, s.Tags)
+			}
+		}
+	}
+}
+
+func TestParseLineSetAndMultiValue(t *testing.T) {
+	samples, err := ParseLine("users:alice|s")
+	if err != nil || len(samples) != 1 || samples[0].SetValue != "alice" {
+		t.Errorf("Unexpected set sample: %+v, %v", samples, err)
+	}
+
+	samples, err = ParseLine("latency:1:2:3|ms")
+	if err != nil || len(samples) != 3 {
+		t.Errorf("Expected 3 samples for multi-value line, got %+v, %v", samples, err)
+	}
+}
+
+func TestParseLineErrors(t *testing.T) {
+	tests := map[string]string{
+		"no-colon":       ReasonFormat,
+		"name:1":         ReasonFormat,
+		"name:abc|c":     ReasonValue,
+		"name:1|x":       ReasonType,
+		"name:1|c|@2":    ReasonSampleRate,
+		"name:1|c|@zero": ReasonSampleRate,
+	}
+	for line, reason := range tests {
+		_, err := ParseLine(line)
+		var pe *ParseError
+		if !errors.As(err, &pe) {
+			t.Errorf("ParseLine(%q): expected ParseError, got %v", line, err)
+			continue
+		}
+		if pe.Reason != reason {
+			t.Errorf("ParseLine(%q): expected reason %s, got %s", line, reason, pe.Reason)
+		}
+	}
+}
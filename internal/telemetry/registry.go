@@ -0,0 +1,162 @@
+// Package telemetry содержит реестр собственных метрик процесса (self-metrics):
+// счётчики ошибок, задержки запросов и т.п. Реестр отдаётся в формате Prometheus.
+package telemetry
+
+import (
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/promfmt"
+)
+
+// Counter — монотонный счётчик
+type Counter struct {
+	v atomic.Int64
+}
+
+func (c *Counter) Inc() {
+	c.v.Add(1)
+}
+
+func (c *Counter) Add(n int64) {
+	c.v.Add(n)
+}
+
+func (c *Counter) Value() int64 {
+	return c.v.Load()
+}
+
+// Gauge — текущее значение
+type Gauge struct {
+	bits atomic.Uint64
+}
+
+func (g *Gauge) Set(v float64) {
+	g.bits.Store(math.Float64bits(v))
+}
+
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(g.bits.Load())
+}
+
+// Histogram — потокобезопасная гистограмма наблюдений
+type Histogram struct {
+	mu sync.Mutex
+	h  *models.HistogramValue
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.h.Observe(v)
+}
+
+func (h *Histogram) snapshot() *models.HistogramValue {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.h.Clone()
+}
+
+type entry struct {
+	name   string
+	labels models.Labels
+	metric any
+}
+
+// Registry хранит собственные метрики процесса. Метрики создаются при первом обращении.
+type Registry struct {
+	mu         sync.Mutex
+	entries    map[string]*entry // тип + ключ серии -> метрика
+	order      []string
+	collectors []func()
+}
+
+func NewRegistry() *Registry {
+	return &Registry{entries: make(map[string]*entry)}
+}
+
+func (r *Registry) getOrCreate(mtype, name string, labels models.Labels, create func() any) any {
+	id := mtype + ":" + models.SeriesKey(name, labels)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e, ok := r.entries[id]; ok {
+		return e.metric
+	}
+	e := &entry{name: name, labels: labels.Clone(), metric: create()}
+	r.entries[id] = e
+	r.order = append(r.order, id)
+	return e.metric
+}
+
+// Counter возвращает счётчик с данным именем и метками
+func (r *Registry) Counter(name string, labels models.Labels) *Counter {
+	return r.getOrCreate(models.Counter, name, labels, func() any { return &Counter{} }).(*Counter)
+}
+
+// Gauge возвращает gauge с данным именем и метками
+func (r *Registry) Gauge(name string, labels models.Labels) *Gauge {
+	return r.getOrCreate(models.Gauge, name, labels, func() any { return &Gauge{} }).(*Gauge)
+}
+
+// Histogram возвращает гистограмму с данным именем и метками.
+// Границы корзин учитываются только при создании.
+func (r *Registry) Histogram(name string, labels models.Labels, bounds []float64) *Histogram {
+	return r.getOrCreate(models.Histogram, name, labels, func() any {
+		return &Histogram{h: models.NewHistogram(bounds)}
+	}).(*Histogram)
+}
+
+// OnCollect регистрирует функцию, обновляющую метрики перед каждым снимком:
+// так выставляются gauge, которые дешевле вычислить при чтении, чем поддерживать
+func (r *Registry) OnCollect(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, fn)
+}
+
+// Metrics возвращает снимок всех метрик реестра
+func (r *Registry) Metrics() []models.Metrics {
+	r.mu.Lock()
+	collectors := r.collectors
+	r.mu.Unlock()
+	for _, fn := range collectors {
+		fn()
+	}
+
+	r.mu.Lock()
+	entries := make([]*entry, 0, len(r.order))
+	for _, id := range r.order {
+		entries = append(entries, r.entries[id])
+	}
+	r.mu.Unlock()
+
+	res := make([]models.Metrics, 0, len(entries))
+	for _, e := range entries {
+		m := models.Metrics{ID: e.name, Labels: e.labels.Clone()}
+		switch v := e.metric.(type) {
+		case *Counter:
+			d := v.Value()
+			m.MType, m.Delta = models.Counter, &d
+		case *Gauge:
+			g := v.Value()
+			m.MType, m.Value = models.Gauge, &g
+		case *Histogram:
+			m.MType, m.Histogram = models.Histogram, v.snapshot()
+		}
+		res = append(res, m)
+	}
+	return res
+}
+
+// Handler отдаёт метрики реестра в текстовом формате Prometheus
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", promfmt.ContentType)
+		w.WriteHeader(http.StatusOK)
+		promfmt.Write(w, r.Metrics())
+	})
+}
@@ -0,0 +1,168 @@
+package telemetry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	models "github.com/kvsukharev/go-musthave-metrics-tpl/internal/model"
+	"github.com/kvsukharev/go-musthave-metrics-tpl/internal/promfmt"
+)
+
+func TestRegistryReturnsSameSeries(t *testing.T) {
+	r := NewRegistry()
+
+	labels := models.Labels{"route": "/update"}
+	c := r.Counter("requests_total", labels)
+	// Метки копируются при создании: изменение исходной карты не создаёт новую серию
+	labels["route"] = "/value"
+	if r.Counter("requests_total", models.Labels{"route": "/update"}) != c {
+		t.Error("Expected the same counter for the same name and labels")
+	}
+	if r.Counter("requests_total", models.Labels{"route": "/value"}) == c {
+		t.Error("Expected a separate counter for other labels")
+	}
+	if r.Gauge("up", nil) != r.Gauge("up", models.Labels{}) {
+		t.Error("Expected nil and empty labels to select the same gauge")
+	}
+	h := r.Histogram("duration_seconds", nil, []float64{1})
+	if r.Histogram("duration_seconds", nil, []float64{5, 10}) != h {
+		t.Error("Expected the same histogram regardless of bounds after creation")
+	}
+
+	// Одно имя у разных типов — разные метрики
+	r.Gauge("requests_total", labels).Set(1)
+	if n := len(r.Metrics()); n != 5 {
+		t.Errorf("Expected 5 series, got %d", n)
+	}
+}
+
+func TestRegistryValues(t *testing.T) {
+	r := NewRegistry()
+
+	c := r.Counter("errors_total", nil)
+	c.Inc()
+	c.Add(4)
+	g := r.Gauge("queue", nil)
+	g.Set(2.5)
+	g.Set(-1.25)
+	h := r.Histogram("latency_seconds", nil, []float64{0.1, 1})
+	for _, v := range []float64{0.05, 0.5, 0.7, 3} {
+		h.Observe(v)
+	}
+
+	metrics := r.Metrics()
+	if len(metrics) != 3 {
+		t.Fatalf("Expected 3 metrics, got %+v", metrics)
+	}
+	// Снимок в порядке регистрации
+	if m := metrics[0]; m.ID != "errors_total" || m.MType != models.Counter || *m.Delta != 5 {
+		t.Errorf("Unexpected counter %+v", m)
+	}
+	if m := metrics[1]; m.ID != "queue" || m.MType != models.Gauge || *m.Value != -1.25 {
+		t.Errorf("Unexpected gauge %+v", m)
+	}
+	m := metrics[2]
+	if m.ID != "latency_seconds" || m.MType != models.Histogram || m.Histogram.Count != 4 || m.Histogram.Sum != 4.25 {
+		t.Fatalf("Unexpected histogram %+v", m)
+	}
+
+	// Снимок гистограммы не меняется от новых наблюдений
+	h.Observe(0.01)
+	if m.Histogram.Count != 4 {
+		t.Errorf("Expected snapshot to be a copy, got count %d", m.Histogram.Count)
+	}
+}
+
+func TestRegistryConcurrentUpdates(t *testing.T) {
+	r := NewRegistry()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				r.Counter("ops_total", nil).Inc()
+				r.Histogram("op_seconds", nil, models.DefaultBuckets).Observe(0.001)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if v := r.Counter("ops_total", nil).Value(); v != 8000 {
+		t.Errorf("Expected 8000, got %d", v)
+	}
+	if n := r.Histogram("op_seconds", nil, nil).snapshot().Count; n != 8000 {
+		t.Errorf("Expected 8000 observations, got %d", n)
+	}
+}
+
+func TestRegistryOnCollect(t *testing.T) {
+	r := NewRegistry()
+	calls := 0
+	r.OnCollect(func() {
+		calls++
+		r.Gauge("collected", nil).Set(float64(calls))
+	})
+
+	for want := 1; want <= 2; want++ {
+		metrics := r.Metrics()
+		if len(metrics) != 1 || *metrics[0].Value != float64(want) {
+			t.Errorf("Expected gauge updated by collector to %d, got %+v", want, metrics)
+		}
+	}
+}
+
+func TestRegistryHandler(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("http_requests_total", models.Labels{"method": "GET", "status": "200"}).Add(3)
+	r.Gauge("tenants", nil).Set(2)
+	h := r.Histogram("request_duration_seconds", nil, []float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+
+	w := httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/metrics", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != promfmt.ContentType {
+		t.Fatalf("Unexpected response %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	body := w.Body.String()
+	for _, want := range []string{
+		"# TYPE http_requests_total counter",
+		`http_requests_total{method="GET",status="200"} 3`,
+		"# TYPE tenants gauge",
+		"tenants 2",
+		"# TYPE request_duration_seconds histogram",
+		`request_duration_seconds_bucket{le="0.1"} 1`,
+		`request_duration_seconds_bucket{le="1"} 2`,
+		`request_duration_seconds_bucket{le="+Inf"} 2`,
+		"request_duration_seconds_count 2",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %q in exposition:\n%s", want, body)
+		}
+	}
+
+	// Вывод разбирается парсером формата экспозиции
+	families, err := promfmt.Parse(strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Exposition is not valid: %v\n%s", err, body)
+	}
+	types := make(map[string]string)
+	for _, f := range families {
+		types[f.Name] = f.Type
+	}
+	want := map[string]string{
+		"http_requests_total":      promfmt.TypeCounter,
+		"tenants":                  promfmt.TypeGauge,
+		"request_duration_seconds": promfmt.TypeHistogram,
+	}
+	for name, typ := range want {
+		if types[name] != typ {
+			t.Errorf("Expected family %s of type %s, got %q", name, typ, types[name])
+		}
+	}
+}
@@ -0,0 +1,42 @@
+// Package tenant определяет арендатора (tenant) запроса. Метрики разных арендаторов
+// хранятся в отдельных пространствах имён сервера.
+package tenant
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+const (
+	// Header — заголовок с идентификатором арендатора
+	Header = "X-Tenant-ID"
+	// Default — арендатор запросов без заголовка и протоколов без арендаторов (StatsD, Graphite)
+	Default = "default"
+)
+
+var validID = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// Validate проверяет идентификатор арендатора: латинские буквы, цифры, '_', '.', '-',
+// не длиннее 64 символов
+func Validate(id string) error {
+	if !validID.MatchString(id) {
+		return fmt.Errorf("invalid tenant id %q", id)
+	}
+	return nil
+}
+
+type contextKey struct{}
+
+// WithTenant возвращает контекст с арендатором запроса
+func WithTenant(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext возвращает арендатора запроса или Default
+func FromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(contextKey{}).(string); ok {
+		return id
+	}
+	return Default
+}
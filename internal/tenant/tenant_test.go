@@ -0,0 +1,29 @@
+package tenant
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	for _, id := range []string{"default", "team-a", "team_b.prod", "A1"} {
+		if err := Validate(id); err != nil {
+			t.Errorf("Expected %q to be valid: %v", id, err)
+		}
+	}
+	for _, id := range []string{"", "-team", "team a", "team/a", strings.Repeat("a", 65)} {
+		if err := Validate(id); err == nil {
+			t.Errorf("Expected %q to be invalid", id)
+		}
+	}
+}
+
+func TestContext(t *testing.T) {
+	if got := FromContext(context.Background()); got != Default {
+		t.Errorf("Expected default tenant, got %q", got)
+	}
+	if got := FromContext(WithTenant(context.Background(), "team-a")); got != "team-a" {
+		t.Errorf("Expected team-a, got %q", got)
+	}
+}
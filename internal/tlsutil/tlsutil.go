@@ -0,0 +1,204 @@
+// Package tlsutil собирает tls.Config сервера и агента из PEM файлов.
+// Сертификаты и CA перечитываются при изменении файлов без перезапуска.
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// CheckInterval — как часто проверяется время изменения файлов
+const CheckInterval = time.Second
+
+// watchedFiles отслеживает время изменения набора файлов
+type watchedFiles struct {
+	files   []string
+	modTime time.Time
+	checked time.Time
+}
+
+// changed сообщает, изменился ли какой-либо файл с прошлой загрузки.
+// Проверяет не чаще CheckInterval.
+func (w *watchedFiles) changed(now time.Time) bool {
+	if now.Sub(w.checked) < CheckInterval {
+		return false
+	}
+	w.checked = now
+	mod, err := latestModTime(w.files)
+	return err == nil && !mod.Equal(w.modTime)
+}
+
+func latestModTime(files []string) (time.Time, error) {
+	var latest time.Time
+	for _, f := range files {
+		st, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if st.ModTime().After(latest) {
+			latest = st.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// KeyPair — сертификат с ключом. Если файлы изменились, пара перечитывается
+// при следующем рукопожатии; при ошибке чтения остаётся прежняя.
+type KeyPair struct {
+	mu    sync.Mutex
+	watch watchedFiles
+	cert  *tls.Certificate
+	now   func() time.Time
+}
+
+// LoadKeyPair загружает сертификат и ключ
+func LoadKeyPair(certFile, keyFile string) (*KeyPair, error) {
+	p := &KeyPair{watch: watchedFiles{files: []string{certFile, keyFile}}, now: time.Now}
+	if err := p.load(); err != nil {
+		return nil, err
+	}
+	p.watch.checked = p.now()
+	return p, nil
+}
+
+func (p *KeyPair) load() error {
+	mod, err := latestModTime(p.watch.files)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(p.watch.files[0], p.watch.files[1])
+	if err != nil {
+		return err
+	}
+	p.cert, p.watch.modTime = &cert, mod
+	return nil
+}
+
+// Certificate возвращает текущий сертификат, перечитывая изменившиеся файлы
+func (p *KeyPair) Certificate() *tls.Certificate {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.watch.changed(p.now()) {
+		if err := p.load(); err != nil {
+			log.Printf("tls: keeping previous certificate, reload of %s failed: %v", p.watch.files[0], err)
+		} else {
+			log.Printf("tls: reloaded certificate %s", p.watch.files[0])
+		}
+	}
+	return p.cert
+}
+
+// CAPool — набор доверенных CA из PEM файла, перечитывается при изменении
+type CAPool struct {
+	mu    sync.Mutex
+	watch watchedFiles
+	pool  *x509.CertPool
+	now   func() time.Time
+}
+
+// LoadCAPool загружает CA сертификаты
+func LoadCAPool(file string) (*CAPool, error) {
+	p := &CAPool{watch: watchedFiles{files: []string{file}}, now: time.Now}
+	if err := p.load(); err != nil {
+		return nil, err
+	}
+	p.watch.checked = p.now()
+	return p, nil
+}
+
+func (p *CAPool) load() error {
+	mod, err := latestModTime(p.watch.files)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(p.watch.files[0])
+	if err != nil {
+		return err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return fmt.Errorf("no certificates found in %s", p.watch.files[0])
+	}
+	p.pool, p.watch.modTime = pool, mod
+	return nil
+}
+
+// Pool возвращает текущий набор CA, перечитывая изменившийся файл
+func (p *CAPool) Pool() *x509.CertPool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.watch.changed(p.now()) {
+		if err := p.load(); err != nil {
+			log.Printf("tls: keeping previous CA bundle, reload of %s failed: %v", p.watch.files[0], err)
+		} else {
+			log.Printf("tls: reloaded CA bundle %s", p.watch.files[0])
+		}
+	}
+	return p.pool
+}
+
+// ServerConfig — TLS сервера с сертификатом certFile/keyFile. Непустой clientCAFile
+// включает mTLS: клиент обязан предъявить сертификат, подписанный одним из этих CA.
+func ServerConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	pair, err := LoadKeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("server certificate: %w", err)
+	}
+	getCert := func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return pair.Certificate(), nil
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: getCert}
+	if clientCAFile == "" {
+		return cfg, nil
+	}
+
+	cas, err := LoadCAPool(clientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("client CA: %w", err)
+	}
+	cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	cfg.ClientCAs = cas.Pool()
+	// Набор CA берётся на каждое соединение, чтобы подхватывать обновления файла
+	cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		return &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: getCert,
+			ClientAuth:     tls.RequireAndVerifyClientCert,
+			ClientCAs:      cas.Pool(),
+		}, nil
+	}
+	return cfg, nil
+}
+
+// ClientConfig — TLS клиента: caFile задаёт доверенные CA (пусто — системные),
+// certFile и keyFile — клиентский сертификат для mTLS (задаются вместе или не задаются).
+// Клиентский сертификат перечитывается при изменении; CA — при пересоздании конфигурации.
+func ClientConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		cas, err := LoadCAPool(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("CA: %w", err)
+		}
+		cfg.RootCAs = cas.Pool()
+	}
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("client certificate and key must be set together")
+	}
+	if certFile != "" {
+		pair, err := LoadKeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("client certificate: %w", err)
+		}
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return pair.Certificate(), nil
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,98 @@
+package tlsutil
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	if err := GenerateDevCA(dir, []string{"localhost", "127.0.0.1"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	serverCfg, err := ServerConfig(path(ServerFile), path(ServerKeyFile), path(CAFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	srv.TLS = serverCfg
+	srv.StartTLS()
+	defer srv.Close()
+
+	get := func(caFile, certFile, keyFile string) (string, error) {
+		cfg, err := ClientConfig(caFile, certFile, keyFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		var buf bytes.Buffer
+		buf.ReadFrom(resp.Body)
+		return buf.String(), nil
+	}
+
+	cn, err := get(path(CAFile), path(ClientFile), path(ClientKeyFile))
+	if err != nil || cn != "metrics agent" {
+		t.Errorf("Expected mTLS request to succeed, got %q, %v", cn, err)
+	}
+	if _, err := get(path(CAFile), "", ""); err == nil {
+		t.Error("Expected request without client certificate to fail")
+	}
+	if _, err := get("", path(ClientFile), path(ClientKeyFile)); err == nil {
+		t.Error("Expected request without trusted CA to fail")
+	}
+	if _, err := ClientConfig("", path(ClientFile), ""); err == nil {
+		t.Error("Expected error for certificate without key")
+	}
+}
+
+func TestKeyPairReload(t *testing.T) {
+	dir := t.TempDir()
+	if err := GenerateDevCA(dir, []string{"localhost"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, ServerFile), filepath.Join(dir, ServerKeyFile)
+	pair, err := LoadKeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	pair.now = func() time.Time { return now }
+	first := pair.Certificate()
+
+	// Новые файлы подхватываются после CheckInterval
+	if err := GenerateDevCA(dir, []string{"localhost"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+	if pair.Certificate() != first {
+		t.Error("Certificate must not be re-checked before CheckInterval")
+	}
+	now = now.Add(CheckInterval)
+	second := pair.Certificate()
+	if second == first || bytes.Equal(second.Certificate[0], first.Certificate[0]) {
+		t.Error("Expected certificate to be reloaded after files changed")
+	}
+
+	// Испорченный файл не заменяет рабочий сертификат
+	os.WriteFile(certFile, []byte("garbage"), 0o644)
+	os.Chtimes(certFile, future.Add(time.Minute), future.Add(time.Minute))
+	now = now.Add(CheckInterval)
+	if pair.Certificate() != second {
+		t.Error("Expected previous certificate to be kept when reload fails")
+	}
+}